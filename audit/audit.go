@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"train-booking-service/auth"
+	"train-booking-service/logging"
+	"train-booking-service/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Rule describes what the audit log records about the calls of a method.
+type Rule struct {
+	// Target returns the email of the passenger a request acts on. It is nil for methods acting on the whole train
+	Target func(req any) string
+	// Watch prepares the context a call runs with to find out what the call changes, and returns it with the
+	// function reading the change once the call is done. It is nil to record none
+	Watch func(ctx context.Context, req any) (context.Context, Changed)
+}
+
+// Changed returns the value a call changed, as it was before and after the call.
+type Changed func(ctx context.Context) (before, after protobuf.Message)
+
+// Filter selects audit entries. Empty fields match every entry.
+type Filter struct {
+	BookingReference string
+	UserEmail        string
+	Actor            string // Subject or email of the caller
+	Since            time.Time
+	Until            time.Time // Excluded
+}
+
+// matches reports whether an entry passes the filter.
+func (f Filter) matches(entry *proto.AuditEntry) bool {
+	switch {
+	case f.BookingReference != "" && !strings.EqualFold(entry.BookingReference, f.BookingReference):
+		return false
+	case f.UserEmail != "" && !strings.EqualFold(entry.UserEmail, f.UserEmail):
+		return false
+	case f.Actor != "" && entry.Actor != f.Actor && !strings.EqualFold(entry.ActorEmail, f.Actor):
+		return false
+	}
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		at, err := time.Parse(time.RFC3339Nano, entry.Time)
+		if err != nil || at.Before(f.Since) || !f.Until.IsZero() && !at.Before(f.Until) {
+			return false
+		}
+	}
+	return true
+}
+
+// Log is an append-only audit trail of the calls that change the booking state: who made each call, when, on which
+// booking, and the value it changed before and after the call.
+type Log struct {
+	path    string // JSON Lines file the entries are appended to, empty to keep them in memory only
+	rules   map[string]Rule
+	mu      sync.Mutex
+	entries []*proto.AuditEntry
+	now     func() time.Time
+}
+
+// NewLog initializes a new Log instance auditing the methods of rules, keyed by full method name. When path is set,
+// the entries already in the file are loaded and new ones are appended to it.
+func NewLog(path string, rules map[string]Rule) (*Log, error) {
+	l := &Log{path: path, rules: rules, now: time.Now}
+	if path == "" {
+		return l, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		entry := &proto.AuditEntry{}
+		if err := protojson.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("could not parse audit entry on line %d of %s: %w", line, path, err)
+		}
+		l.entries = append(l.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Record adds an entry for a call of method by the caller identified in ctx. Before and after are the value the call
+// changed, nil when there was none, and err is the error the call returned.
+func (l *Log) Record(ctx context.Context, method, userEmail string, before, after protobuf.Message, err error) error {
+	entry := &proto.AuditEntry{
+		Method:    path.Base(method),
+		UserEmail: userEmail,
+		Code:      status.Code(err).String(),
+	}
+	if identity, ok := auth.FromContext(ctx); ok {
+		entry.Actor, entry.ActorEmail, entry.ActorRoles = identity.Subject, identity.Email, identity.Roles
+	}
+	if err != nil {
+		entry.Error = status.Convert(err).Message()
+	}
+	for _, value := range []protobuf.Message{after, before} {
+		if ticket, ok := value.(interface{ GetBookingReference() string }); ok && entry.BookingReference == "" {
+			entry.BookingReference = ticket.GetBookingReference()
+		}
+	}
+	var encodeErr error
+	if entry.Before, encodeErr = encode(before); encodeErr != nil {
+		return encodeErr
+	}
+	if entry.After, encodeErr = encode(after); encodeErr != nil {
+		return encodeErr
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Sequence = int64(len(l.entries) + 1)
+	entry.Time = l.now().UTC().Format(time.RFC3339Nano)
+	if l.path != "" {
+		if err := l.append(entry); err != nil {
+			return fmt.Errorf("could not write audit entry: %w", err)
+		}
+	}
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+// encode returns the compact JSON of a value, or an empty string for none.
+func encode(value protobuf.Message) (string, error) {
+	if value == nil || !value.ProtoReflect().IsValid() {
+		return "", nil
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("could not encode audited value: %w", err)
+	}
+	// Compact with encoding/json, as protojson varies its whitespace on purpose
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		return "", fmt.Errorf("could not encode audited value: %w", err)
+	}
+	return compacted.String(), nil
+}
+
+// append writes an entry at the end of the file and syncs it, so recorded entries survive a crash.
+func (l *Log) append(entry *proto.AuditEntry) error {
+	data, err := protojson.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	var line bytes.Buffer
+	if err := json.Compact(&line, data); err != nil {
+		return err
+	}
+	line.WriteByte('\n')
+
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := line.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Query returns the entries passing the filter, oldest first.
+func (l *Log) Query(filter Filter) []*proto.AuditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []*proto.AuditEntry
+	for _, entry := range l.entries {
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// UnaryServerInterceptor records every unary call of an audited method, whether it succeeds or not. It must run
+// after the authentication interceptor, and after the handler errors are given their status code.
+func (l *Log) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		rule, ok := l.rules[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		handlerCtx, changed := ctx, Changed(nil)
+		if rule.Watch != nil {
+			handlerCtx, changed = rule.Watch(ctx, req)
+		}
+		resp, err := handler(handlerCtx, req)
+
+		userEmail := ""
+		if rule.Target != nil {
+			userEmail = rule.Target(req)
+		}
+		var before, after protobuf.Message
+		if changed != nil {
+			// The call may have used up its deadline, but its change must still be recorded
+			before, after = changed(context.WithoutCancel(ctx))
+		}
+		if recordErr := l.Record(ctx, info.FullMethod, userEmail, before, after, err); recordErr != nil {
+			logging.FromContext(ctx).Error("could not audit call", logging.KeyError, recordErr)
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"train-booking-service/auth"
+	"train-booking-service/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// testRules audits ModifySeat on a single ticket, as a handler would change it.
+func testRules(ticket **proto.TicketReceipt) map[string]Rule {
+	return map[string]Rule{
+		proto.TrainService_ModifySeat_FullMethodName: {
+			Target: func(req any) string { return req.(*proto.ModifySeatRequest).UserEmail },
+			Watch: func(ctx context.Context, req any) (context.Context, Changed) {
+				read := func() protobuf.Message {
+					if *ticket == nil {
+						return nil
+					}
+					return protobuf.Clone(*ticket)
+				}
+				before := read()
+				return ctx, func(ctx context.Context) (protobuf.Message, protobuf.Message) {
+					return before, read()
+				}
+			},
+		},
+	}
+}
+
+// call runs a ModifySeat call through the interceptor as the given caller, the handler applying change.
+func call(t *testing.T, l *Log, subject string, change func() error) {
+	ctx := auth.NewContext(context.Background(), &auth.Identity{Subject: subject, Email: subject + "@example.com", Roles: []string{auth.RoleAgent}})
+	info := &grpc.UnaryServerInfo{FullMethod: proto.TrainService_ModifySeat_FullMethodName}
+	_, err := l.UnaryServerInterceptor()(ctx, &proto.ModifySeatRequest{UserEmail: "jane@example.com", NewSeat: "A2"}, info,
+		func(ctx context.Context, req any) (any, error) {
+			return nil, change()
+		})
+	if err != nil {
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+}
+
+func TestLog_RecordsChanges(t *testing.T) {
+	ticket := &proto.TicketReceipt{Seat: "A1", BookingReference: "ABC234", User: &proto.User{Email: "jane@example.com"}}
+	l, err := NewLog("", testRules(&ticket))
+	assert.NoError(t, err)
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return start }
+
+	call(t, l, "agent-1", func() error {
+		ticket.Seat = "A2"
+		return nil
+	})
+	l.now = func() time.Time { return start.Add(time.Hour) }
+	call(t, l, "agent-2", func() error {
+		return status.Error(codes.Unavailable, "seat A3 is already booked")
+	})
+
+	entries := l.Query(Filter{})
+	assert.Len(t, entries, 2)
+	assert.Equal(t, int64(1), entries[0].Sequence)
+	assert.Equal(t, "2030-01-01T09:00:00Z", entries[0].Time)
+	assert.Equal(t, "agent-1", entries[0].Actor)
+	assert.Equal(t, "agent-1@example.com", entries[0].ActorEmail)
+	assert.Equal(t, []string{auth.RoleAgent}, entries[0].ActorRoles)
+	assert.Equal(t, "ModifySeat", entries[0].Method)
+	assert.Equal(t, "jane@example.com", entries[0].UserEmail)
+	assert.Equal(t, "ABC234", entries[0].BookingReference)
+	assert.Contains(t, entries[0].Before, `"seat":"A1"`)
+	assert.Contains(t, entries[0].After, `"seat":"A2"`)
+	assert.Equal(t, "OK", entries[0].Code)
+	assert.Empty(t, entries[0].Error)
+
+	// Failed calls are recorded with their error
+	assert.Equal(t, "Unavailable", entries[1].Code)
+	assert.Equal(t, "seat A3 is already booked", entries[1].Error)
+	assert.Equal(t, entries[1].Before, entries[1].After)
+
+	// Calls of methods without a rule are not recorded
+	info := &grpc.UnaryServerInfo{FullMethod: proto.TrainService_GetReceipt_FullMethodName}
+	_, err = l.UnaryServerInterceptor()(context.Background(), &proto.GetReceiptRequest{}, info, func(ctx context.Context, req any) (any, error) {
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, l.Query(Filter{}), 2)
+}
+
+func TestLog_Query(t *testing.T) {
+	ticket := &proto.TicketReceipt{Seat: "A1", BookingReference: "ABC234", User: &proto.User{Email: "jane@example.com"}}
+	l, err := NewLog("", testRules(&ticket))
+	assert.NoError(t, err)
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	for i, subject := range []string{"agent-1", "agent-2", "agent-1"} {
+		l.now = func() time.Time { return start.Add(time.Duration(i) * time.Hour) }
+		call(t, l, subject, func() error { return nil })
+	}
+	ticket = nil
+	call(t, l, "agent-2", func() error { return nil })
+
+	sequences := func(filter Filter) []int64 {
+		var sequences []int64
+		for _, entry := range l.Query(filter) {
+			sequences = append(sequences, entry.Sequence)
+		}
+		return sequences
+	}
+	assert.Equal(t, []int64{1, 2, 3}, sequences(Filter{BookingReference: "abc234"}))
+	assert.Equal(t, []int64{1, 2, 3, 4}, sequences(Filter{UserEmail: "Jane@example.com"}))
+	assert.Equal(t, []int64{1, 3}, sequences(Filter{Actor: "agent-1"}))
+	assert.Equal(t, []int64{2, 4}, sequences(Filter{Actor: "AGENT-2@example.com"}))
+	assert.Equal(t, []int64{2}, sequences(Filter{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)}))
+	assert.Empty(t, sequences(Filter{UserEmail: "john@example.com"}))
+}
+
+func TestLog_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	ticket := &proto.TicketReceipt{Seat: "A1", BookingReference: "ABC234", User: &proto.User{Email: "jane@example.com"}}
+	l, err := NewLog(path, testRules(&ticket))
+	assert.NoError(t, err)
+	call(t, l, "agent-1", func() error { return nil })
+
+	// Entries survive a restart and new ones are appended after them
+	reopened, err := NewLog(path, testRules(&ticket))
+	assert.NoError(t, err)
+	call(t, reopened, "agent-2", func() error { return nil })
+	entries := reopened.Query(Filter{})
+	assert.Len(t, entries, 2)
+	assert.True(t, protobuf.Equal(l.Query(Filter{})[0], entries[0]))
+	assert.Equal(t, int64(2), entries[1].Sequence)
+
+	assert.NoError(t, os.WriteFile(path, []byte("not json\n"), 0o600))
+	_, err = NewLog(path, nil)
+	assert.ErrorContains(t, err, "could not parse audit entry on line 1")
+}
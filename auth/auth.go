@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Define authentication method constants for type safety
+const (
+	MethodJWT    = "jwt"
+	MethodAPIKey = "api_key"
+)
+
+// Define the metadata keys credentials are read from
+const (
+	AuthorizationHeader = "authorization" // "Bearer <jwt>"
+	APIKeyHeader        = "x-api-key"
+)
+
+// Identity describes an authenticated caller.
+type Identity struct {
+	Subject string
+	Email   string
+	Roles   []string
+	Method  string
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying the caller identity.
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the caller identity attached to ctx, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// Config configures how callers are authenticated. At least one of KeySet and APIKeys must be set.
+type Config struct {
+	KeySet   *KeySet  // Keys bearer JWTs are verified against
+	Issuer   string   // Required "iss" claim, if set
+	Audience string   // Required "aud" claim, if set
+	APIKeys  []APIKey // Accepted API keys
+	Public   []string // Full method names that may be called without credentials
+}
+
+// Authenticator authenticates gRPC callers using bearer JWTs or API keys.
+type Authenticator struct {
+	keySet  *KeySet
+	parser  *jwt.Parser
+	apiKeys map[[sha256.Size]byte]*Identity
+	public  map[string]bool
+}
+
+// claims are the JWT claims an identity is built from.
+type claims struct {
+	jwt.RegisteredClaims
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
+}
+
+// NewAuthenticator initializes a new Authenticator instance.
+func NewAuthenticator(config Config) (*Authenticator, error) {
+	if config.KeySet == nil && len(config.APIKeys) == 0 {
+		return nil, fmt.Errorf("no JWT key set or API keys configured")
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA", "HS256", "HS384", "HS512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+
+	authenticator := &Authenticator{
+		keySet:  config.KeySet,
+		parser:  jwt.NewParser(options...),
+		apiKeys: make(map[[sha256.Size]byte]*Identity, len(config.APIKeys)),
+		public:  make(map[string]bool, len(config.Public)),
+	}
+	for _, key := range config.APIKeys {
+		// Keys are looked up by their hash so lookups do not leak key prefixes through timing
+		authenticator.apiKeys[sha256.Sum256([]byte(key.Key))] = &Identity{
+			Subject: key.Subject,
+			Email:   key.Email,
+			Roles:   key.Roles,
+			Method:  MethodAPIKey,
+		}
+	}
+	for _, method := range config.Public {
+		authenticator.public[method] = true
+	}
+	return authenticator, nil
+}
+
+// Authenticate identifies the caller from the credentials in the incoming metadata of ctx.
+// It returns an Unauthenticated status error when credentials are missing or invalid.
+func (a *Authenticator) Authenticate(ctx context.Context) (*Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if values := md.Get(AuthorizationHeader); len(values) > 0 {
+		scheme, token, found := strings.Cut(values[0], " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return nil, status.Error(codes.Unauthenticated, "authorization header must be a bearer token")
+		}
+		return a.verifyToken(token)
+	}
+
+	if values := md.Get(APIKeyHeader); len(values) > 0 {
+		identity, ok := a.apiKeys[sha256.Sum256([]byte(values[0]))]
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		return identity, nil
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "missing credentials")
+}
+
+// verifyToken verifies a bearer JWT against the key set and builds the caller identity from its claims.
+func (a *Authenticator) verifyToken(token string) (*Identity, error) {
+	if a.keySet == nil {
+		return nil, status.Error(codes.Unauthenticated, "bearer tokens are not accepted")
+	}
+
+	var tokenClaims claims
+	_, err := a.parser.ParseWithClaims(token, &tokenClaims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := a.keySet.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid bearer token: %v", err)
+	}
+	if tokenClaims.Subject == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token: missing subject")
+	}
+
+	return &Identity{
+		Subject: tokenClaims.Subject,
+		Email:   tokenClaims.Email,
+		Roles:   tokenClaims.Roles,
+		Method:  MethodJWT,
+	}, nil
+}
+
+// UnaryServerInterceptor authenticates unary calls and attaches the caller identity to their context.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if a.public[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		identity, err := a.Authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(NewContext(ctx, identity), req)
+	}
+}
+
+// StreamServerInterceptor authenticates streaming calls and attaches the caller identity to their context.
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if a.public[info.FullMethod] {
+			return handler(srv, stream)
+		}
+		identity, err := a.Authenticate(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &identityStream{ServerStream: stream, ctx: NewContext(stream.Context(), identity)})
+	}
+}
+
+// identityStream is a server stream whose context carries the caller identity.
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream context carrying the caller identity.
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testKeys generates an Ed25519 and an RSA key pair and the key set holding their public keys.
+func testKeys(t *testing.T) (ed25519.PrivateKey, *rsa.PrivateKey, *KeySet) {
+	t.Helper()
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	encode := base64.RawURLEncoding.EncodeToString
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": %q},
+		{"kty": "RSA", "kid": "rsa", "n": %q, "e": %q}
+	]}`, encode(edPublic), encode(rsaPrivate.N.Bytes()), encode(big.NewInt(int64(rsaPrivate.E)).Bytes()))
+
+	keySet, err := ParseKeySet([]byte(jwks))
+	assert.NoError(t, err)
+	return edPrivate, rsaPrivate, keySet
+}
+
+// signToken signs a JWT with the given method, key ID and claims.
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key any, tokenClaims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, tokenClaims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+// incoming returns a context carrying the given incoming metadata.
+func incoming(pairs ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func TestAuthenticate_BearerToken(t *testing.T) {
+	edPrivate, rsaPrivate, keySet := testKeys(t)
+	authenticator, err := NewAuthenticator(Config{KeySet: keySet, Issuer: "train-booking", Audience: "train-service"})
+	assert.NoError(t, err)
+
+	valid := jwt.MapClaims{
+		"sub":   "user-1",
+		"email": "johndoe@example.com",
+		"roles": []string{"passenger"},
+		"iss":   "train-booking",
+		"aud":   "train-service",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+
+	identity, err := authenticator.Authenticate(incoming(AuthorizationHeader, "Bearer "+signToken(t, jwt.SigningMethodEdDSA, "ed", edPrivate, valid)))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", identity.Subject)
+	assert.Equal(t, "johndoe@example.com", identity.Email)
+	assert.Equal(t, []string{"passenger"}, identity.Roles)
+	assert.Equal(t, MethodJWT, identity.Method)
+
+	identity, err = authenticator.Authenticate(incoming(AuthorizationHeader, "Bearer "+signToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, valid)))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", identity.Subject)
+
+	invalid := map[string]string{}
+
+	expired := jwt.MapClaims{}
+	for k, v := range valid {
+		expired[k] = v
+	}
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	invalid["expired"] = signToken(t, jwt.SigningMethodEdDSA, "ed", edPrivate, expired)
+
+	wrongAudience := jwt.MapClaims{}
+	for k, v := range valid {
+		wrongAudience[k] = v
+	}
+	wrongAudience["aud"] = "another-service"
+	invalid["wrong audience"] = signToken(t, jwt.SigningMethodEdDSA, "ed", edPrivate, wrongAudience)
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	invalid["wrong key"] = signToken(t, jwt.SigningMethodEdDSA, "ed", otherKey, valid)
+	invalid["unknown kid"] = signToken(t, jwt.SigningMethodEdDSA, "other", edPrivate, valid)
+	invalid["alg mismatch"] = signToken(t, jwt.SigningMethodHS256, "rsa", rsaPrivate.N.Bytes(), valid)
+
+	for name, token := range invalid {
+		_, err := authenticator.Authenticate(incoming(AuthorizationHeader, "Bearer "+token))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), name)
+	}
+
+	_, err = authenticator.Authenticate(incoming(AuthorizationHeader, "Basic dXNlcjpwYXNz"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthenticate_APIKey(t *testing.T) {
+	authenticator, err := NewAuthenticator(Config{APIKeys: []APIKey{
+		{Key: "secret-agent-key", Subject: "agent-1", Roles: []string{"agent"}},
+	}})
+	assert.NoError(t, err)
+
+	identity, err := authenticator.Authenticate(incoming(APIKeyHeader, "secret-agent-key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-1", identity.Subject)
+	assert.Equal(t, MethodAPIKey, identity.Method)
+
+	_, err = authenticator.Authenticate(incoming(APIKeyHeader, "guessed-key"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = authenticator.Authenticate(context.Background())
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Bearer tokens are rejected when no key set is configured
+	_, err = authenticator.Authenticate(incoming(AuthorizationHeader, "Bearer abc.def.ghi"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	authenticator, err := NewAuthenticator(Config{
+		APIKeys: []APIKey{{Key: "secret-agent-key", Subject: "agent-1"}},
+		Public:  []string{"/proto.TrainService/Public"},
+	})
+	assert.NoError(t, err)
+	interceptor := authenticator.UnaryServerInterceptor()
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		identity, ok := FromContext(ctx)
+		if !ok {
+			return "anonymous", nil
+		}
+		return identity.Subject, nil
+	}
+
+	resp, err := interceptor(incoming(APIKeyHeader, "secret-agent-key"), nil, &grpc.UnaryServerInfo{FullMethod: "/proto.TrainService/GetReceipt"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-1", resp)
+
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/proto.TrainService/GetReceipt"}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	resp, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/proto.TrainService/Public"}, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "anonymous", resp)
+}
+
+func TestNewAuthenticator_NoCredentials(t *testing.T) {
+	_, err := NewAuthenticator(Config{})
+	assert.Error(t, err)
+}
+
+func TestParseKeySet_Invalid(t *testing.T) {
+	for name, jwks := range map[string]string{
+		"empty":       `{"keys": []}`,
+		"missing kid": `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`,
+		"unknown kty": `{"keys": [{"kty": "XYZ", "kid": "a"}]}`,
+		"bad curve":   `{"keys": [{"kty": "EC", "kid": "a", "crv": "P-192", "x": "AQ", "y": "AQ"}]}`,
+		"duplicate":   `{"keys": [{"kty": "oct", "kid": "a", "k": "c2VjcmV0"}, {"kty": "oct", "kid": "a", "k": "c2VjcmV0"}]}`,
+	} {
+		_, err := ParseKeySet([]byte(jwks))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	type receiptRequest struct{ email string }
+
+	var denials []Denial
+	policy := NewPolicy(map[string]Rule{
+		"/proto.TrainService/GetReceipt": {
+			Roles:      []string{RoleAgent, RoleAdmin},
+			OwnerRoles: []string{RolePassenger},
+			Owner:      func(req any) string { return req.(*receiptRequest).email },
+		},
+		"/proto.TrainService/GetUsersBySection": {Roles: []string{RoleAgent, RoleAdmin}},
+	}, []string{"/grpc.health.v1.Health/Check"}, func(denial Denial) {
+		denials = append(denials, denial)
+	})
+
+	passenger := NewContext(context.Background(), &Identity{Subject: "user-1", Email: "JohnDoe@example.com", Roles: []string{RolePassenger}})
+	agent := NewContext(context.Background(), &Identity{Subject: "agent-1", Roles: []string{RoleAgent}})
+
+	// Passengers only see their own bookings
+	assert.NoError(t, policy.Authorize(passenger, "/proto.TrainService/GetReceipt", &receiptRequest{email: "johndoe@example.com"}))
+	err := policy.Authorize(passenger, "/proto.TrainService/GetReceipt", &receiptRequest{email: "alicedoe@example.com"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Staff see every booking
+	assert.NoError(t, policy.Authorize(agent, "/proto.TrainService/GetReceipt", &receiptRequest{email: "alicedoe@example.com"}))
+	assert.NoError(t, policy.Authorize(agent, "/proto.TrainService/GetUsersBySection", nil))
+
+	err = policy.Authorize(passenger, "/proto.TrainService/GetUsersBySection", nil)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Methods without a rule are denied
+	err = policy.Authorize(agent, "/proto.TrainService/Unknown", nil)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Public methods need no identity at all
+	assert.NoError(t, policy.Authorize(context.Background(), "/grpc.health.v1.Health/Check", nil))
+	err = policy.Authorize(context.Background(), "/proto.TrainService/GetUsersBySection", nil)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	assert.Len(t, denials, 3)
+	assert.Equal(t, "user-1", denials[0].Subject)
+	assert.Equal(t, "alicedoe@example.com", denials[0].Target)
+	assert.Equal(t, "/proto.TrainService/GetUsersBySection", denials[1].Method)
+	assert.Equal(t, "/proto.TrainService/Unknown", denials[2].Method)
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// jsonWebKey is a single key of a JSON Web Key Set (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// KeySet holds the public keys, or shared secrets, JWTs are verified against, keyed by key ID.
+type KeySet struct {
+	keys map[string]any
+}
+
+// LoadKeySet reads a JSON Web Key Set file.
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key set: %w", err)
+	}
+	return ParseKeySet(data)
+}
+
+// ParseKeySet parses a JSON Web Key Set. RSA, EC (P-256, P-384, P-521), Ed25519 and HMAC (oct) keys are supported.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("could not parse key set: %w", err)
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("key set has no keys")
+	}
+
+	keySet := &KeySet{keys: make(map[string]any, len(set.Keys))}
+	for _, jwk := range set.Keys {
+		if jwk.Kid == "" {
+			return nil, fmt.Errorf("key set entry of type %s has no kid", jwk.Kty)
+		}
+		if _, exists := keySet.keys[jwk.Kid]; exists {
+			return nil, fmt.Errorf("key %s is defined more than once", jwk.Kid)
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", jwk.Kid, err)
+		}
+		keySet.keys[jwk.Kid] = key
+	}
+	return keySet, nil
+}
+
+// Key returns the key with the given key ID.
+func (s *KeySet) Key(kid string) (any, bool) {
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// publicKey decodes the key material of a JSON Web Key.
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	case "oct":
+		k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(k) == 0 {
+			return nil, fmt.Errorf("invalid shared secret")
+		}
+		return k, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer.
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// APIKey describes the caller an API key belongs to.
+type APIKey struct {
+	Key     string   `json:"key"`
+	Subject string   `json:"subject"`
+	Email   string   `json:"email"`
+	Roles   []string `json:"roles"`
+}
+
+// LoadAPIKeys reads a JSON file holding a list of API keys.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read API keys: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("could not parse API keys: %w", err)
+	}
+	for _, key := range keys {
+		if key.Key == "" || key.Subject == "" {
+			return nil, fmt.Errorf("every API key needs a key and a subject")
+		}
+	}
+	return keys, nil
+}
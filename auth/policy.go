@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Define role constants for type safety
+const (
+	RolePassenger = "passenger"
+	RoleAgent     = "agent"
+	RoleAdmin     = "admin"
+)
+
+// Rule describes who may call a method.
+type Rule struct {
+	// Roles may call the method on any resource
+	Roles []string
+	// OwnerRoles may only call the method on their own resources, as identified by Owner
+	OwnerRoles []string
+	// Owner returns the email of the passenger a request acts on
+	Owner func(req any) string
+}
+
+// Denial records a call rejected by the policy.
+type Denial struct {
+	Time    time.Time `json:"time"`
+	Method  string    `json:"method"`
+	Subject string    `json:"subject"`
+	Email   string    `json:"email,omitempty"`
+	Roles   []string  `json:"roles"`
+	Target  string    `json:"target,omitempty"` // Email of the passenger the call acted on, if any
+	Reason  string    `json:"reason"`
+}
+
+// Policy maps each method to the roles allowed to call it. Methods without a rule are denied.
+type Policy struct {
+	rules    map[string]Rule
+	public   map[string]bool
+	onDenied func(Denial)
+}
+
+// NewPolicy initializes a new Policy instance. Public methods skip authorization, and onDenied,
+// if set, is called with an audit record for every denied call.
+func NewPolicy(rules map[string]Rule, public []string, onDenied func(Denial)) *Policy {
+	policy := &Policy{
+		rules:    rules,
+		public:   make(map[string]bool, len(public)),
+		onDenied: onDenied,
+	}
+	for _, method := range public {
+		policy.public[method] = true
+	}
+	return policy
+}
+
+// hasAnyRole checks if an identity holds any of the given roles.
+func hasAnyRole(identity *Identity, roles []string) bool {
+	for _, role := range identity.Roles {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks that the caller identified in ctx may call method with req. A nil req
+// authorizes a streaming call, which only callers holding one of the rule's Roles may make.
+// It returns a PermissionDenied status error when the call is not allowed.
+func (p *Policy) Authorize(ctx context.Context, method string, req any) error {
+	if p.public[method] {
+		return nil
+	}
+
+	identity, ok := FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing credentials")
+	}
+
+	rule, ok := p.rules[method]
+	if !ok {
+		return p.deny(identity, method, "", "no policy for method")
+	}
+	if hasAnyRole(identity, rule.Roles) {
+		return nil
+	}
+	if !hasAnyRole(identity, rule.OwnerRoles) || rule.Owner == nil {
+		return p.deny(identity, method, "", "missing required role")
+	}
+
+	target := ""
+	if req != nil {
+		target = rule.Owner(req)
+	}
+	if identity.Email == "" || !strings.EqualFold(identity.Email, target) {
+		return p.deny(identity, method, target, "not the owner of the booking")
+	}
+	return nil
+}
+
+// deny records a denied call and returns the PermissionDenied error for it.
+func (p *Policy) deny(identity *Identity, method, target, reason string) error {
+	if p.onDenied != nil {
+		p.onDenied(Denial{
+			Time:    time.Now().UTC(),
+			Method:  method,
+			Subject: identity.Subject,
+			Email:   identity.Email,
+			Roles:   identity.Roles,
+			Target:  target,
+			Reason:  reason,
+		})
+	}
+	return status.Errorf(codes.PermissionDenied, "permission denied: %s", reason)
+}
+
+// UnaryServerInterceptor authorizes unary calls. It must run after the authentication interceptor.
+func (p *Policy) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := p.Authorize(ctx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authorizes streaming calls. It must run after the authentication interceptor.
+func (p *Policy) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := p.Authorize(stream.Context(), info.FullMethod, nil); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"train-booking-service/dao"
+	"train-booking-service/manifest"
+	"train-booking-service/proto"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// sectionCompletion completes section names with the sections of the default layout.
+func sectionCompletion(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	var sections []cobra.Completion
+	for _, section := range dao.DefaultLayout().Sections {
+		sections = append(sections, cobra.CompletionWithDesc(section.Name, section.Class))
+	}
+	return sections, cobra.ShellCompDirectiveNoFileComp
+}
+
+// parseInfant parses an infant given as FIRST:LAST:YYYY-MM-DD.
+func parseInfant(value string) (*proto.User, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid infant %q: use FIRST:LAST:YYYY-MM-DD", value)
+	}
+	return &proto.User{FirstName: parts[0], LastName: parts[1], DateOfBirth: parts[2]}, nil
+}
+
+// newBookCommand creates the command purchasing a ticket.
+func newBookCommand(o *options) *cobra.Command {
+	req := &proto.PurchaseTicketRequest{User: &proto.User{}}
+	var infants []string
+	assistance := &proto.AssistanceRequest{}
+
+	cmd := &cobra.Command{
+		Use:     "book",
+		Short:   "Purchase a ticket",
+		Example: "  client book --from London --to France --first-name John --last-name Doe --email johndoe@example.com --class first",
+		Args:    cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			for _, value := range infants {
+				infant, err := parseInfant(value)
+				if err != nil {
+					return err
+				}
+				req.Infants = append(req.Infants, infant)
+			}
+			if assistance.Type != "" || assistance.Notes != "" {
+				req.Assistance = assistance
+			}
+			return nil
+		},
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.PurchaseTicket(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				ticketRows(t, resp.Ticket)
+			})
+		}),
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.From, "from", "", "station the journey starts from")
+	flags.StringVar(&req.To, "to", "", "station the journey ends at")
+	flags.StringVar(&req.User.FirstName, "first-name", "", "first name of the passenger")
+	flags.StringVar(&req.User.LastName, "last-name", "", "last name of the passenger")
+	flags.StringVar(&req.User.Email, "email", "", "email of the passenger, identifying the booking")
+	flags.StringVar(&req.User.DateOfBirth, "date-of-birth", "", "date of birth of the passenger as YYYY-MM-DD, required for child and senior passengers")
+	flags.StringVar(&req.User.PassengerType, "passenger-type", "", "adult, child or senior, derived from the date of birth when not given")
+	flags.StringVar(&req.User.Railcard, "railcard", "", "railcard of the passenger: student or disability")
+	flags.StringVar(&req.FareClass, "class", "", "fare class, defaults to standard")
+	flags.StringVar(&req.RequestedSeat, "seat", "", "seat to book, such as A12, any free seat of the fare class when not given")
+	flags.StringArrayVar(&infants, "infant", nil, "infant travelling on the passenger's lap as FIRST:LAST:YYYY-MM-DD")
+	flags.StringVar(&assistance.Type, "assistance", "", "special assistance required: wheelchair, mobility, visual, hearing or other")
+	flags.StringVar(&assistance.Notes, "assistance-notes", "", "details of the special assistance required")
+	for _, name := range []string{"from", "to", "first-name", "last-name", "email"} {
+		cmd.MarkFlagRequired(name)
+	}
+
+	var classes []string
+	for _, class := range dao.DefaultLayout().FareClasses {
+		classes = append(classes, class.Name)
+	}
+	cmd.RegisterFlagCompletionFunc("class", fixedCompletion(classes...))
+	cmd.RegisterFlagCompletionFunc("passenger-type", fixedCompletion(dao.PassengerAdult, dao.PassengerChild, dao.PassengerSenior))
+	cmd.RegisterFlagCompletionFunc("railcard", fixedCompletion(dao.ConcessionStudent, dao.ConcessionDisability))
+	cmd.RegisterFlagCompletionFunc("assistance", fixedCompletion(dao.AssistanceWheelchair, dao.AssistanceMobility, dao.AssistanceVisual, dao.AssistanceHearing, dao.AssistanceOther))
+	return cmd
+}
+
+// newReceiptCommand creates the command showing the receipt of a ticket.
+func newReceiptCommand(o *options) *cobra.Command {
+	req := &proto.GetReceiptRequest{}
+	cmd := &cobra.Command{
+		Use:               "receipt EMAIL",
+		Short:             "Show the receipt of a passenger's ticket",
+		Example:           "  client receipt johndoe@example.com\n  client receipt johndoe@example.com --revision 1",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			req.UserEmail = args[0]
+			resp, err := c.client.GetReceipt(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				ticketRows(t, resp.Ticket)
+				t.row("Revision", resp.Revision)
+			})
+		}),
+	}
+	cmd.Flags().Int32Var(&req.Revision, "revision", 0, "show the ticket as it was in this revision of the booking, see history")
+	return cmd
+}
+
+// newHistoryCommand creates the command listing every revision of a booking.
+func newHistoryCommand(o *options) *cobra.Command {
+	req := &proto.GetBookingHistoryRequest{}
+	cmd := &cobra.Command{
+		Use:   "history [EMAIL]",
+		Short: "List every revision of a passenger's booking",
+		Long: "List every revision of a booking, oldest first: the purchase and each change of seat, price or status,\n" +
+			"and its cancellation. The booking is the passenger's current one, or their last cancelled one, or the\n" +
+			"booking given by --booking.",
+		Example:           "  client history johndoe@example.com\n  client history --booking ABC234",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && req.BookingReference == "" {
+				return fmt.Errorf("an email or --booking is required")
+			}
+			return nil
+		},
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			if len(args) == 1 {
+				req.UserEmail = args[0]
+			}
+			resp, err := c.client.GetBookingHistory(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				fmt.Fprintf(t.w, "Booking %s\n\n", resp.BookingReference)
+				t.row("REVISION", "CHANGE", "CHANGED AT", "SEAT", "CLASS", "PRICE PAID", "STATUS")
+				for _, revision := range resp.Revisions {
+					ticket := revision.Ticket
+					t.row(revision.Revision, revision.Change, revision.ChangedAt, ticket.Seat, ticket.FareClass, fmt.Sprintf("%.2f", ticket.PricePaid), ticket.Status)
+				}
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&req.BookingReference, "booking", "", "booking reference, to find a booking without its passenger's email")
+	return cmd
+}
+
+// newSeatsCommand creates the command listing the passengers seated in a section.
+func newSeatsCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "seats SECTION",
+		Short:             "List the passengers seated in a section",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: sectionCompletion,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.GetUsersBySection(c.ctx, &proto.GetUsersBySectionRequest{Section: args[0]})
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row("SEAT", "PASSENGER", "EMAIL")
+				for _, userSeat := range resp.UserSeats {
+					t.row(userSeat.Seat, name(userSeat.User), userSeat.User.GetEmail())
+				}
+			})
+		}),
+	}
+}
+
+// newMoveCommand creates the command moving a passenger to another seat.
+func newMoveCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "move EMAIL SEAT",
+		Short:             "Move a passenger to another seat",
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.ModifySeat(c.ctx, &proto.ModifySeatRequest{UserEmail: args[0], NewSeat: args[1]})
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				ticketRows(t, resp.NewTicket)
+				t.row("Fare difference", fmt.Sprintf("%.2f", resp.FareDifference))
+			})
+		}),
+	}
+}
+
+// newCancelCommand creates the command removing a passenger from the train.
+func newCancelCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "cancel EMAIL",
+		Short:             "Cancel a passenger's booking",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.RemoveUser(c.ctx, &proto.RemoveUserRequest{UserEmail: args[0]})
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row("Removed", fmt.Sprintf("%s (%s)", name(resp.User), resp.User.GetEmail()))
+			})
+		}),
+	}
+}
+
+// newCheckInCommand creates the command checking a passenger in.
+func newCheckInCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "check-in EMAIL",
+		Short:             "Check a passenger in, assigning a seat to overbooked tickets",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.CheckIn(c.ctx, &proto.CheckInRequest{UserEmail: args[0]})
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				ticketRows(t, resp.Ticket)
+			})
+		}),
+	}
+}
+
+// newAssistanceCommand creates the command listing the passengers requiring assistance.
+func newAssistanceCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "assistance",
+		Short:             "List the passengers requiring special assistance",
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.GetAssistanceManifest(c.ctx, &proto.GetAssistanceManifestRequest{})
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row("SEAT", "PASSENGER", "EMAIL", "ASSISTANCE", "NOTES", "SEAT ATTRIBUTES")
+				for _, entry := range resp.Entries {
+					t.row(entry.Seat, name(entry.User), entry.User.GetEmail(), entry.Assistance.GetType(), entry.Assistance.GetNotes(), strings.Join(entry.SeatAttributes, ","))
+				}
+			})
+		}),
+	}
+}
+
+// newManifestCommand creates the command exporting the passenger manifest of the departure.
+func newManifestCommand(o *options) *cobra.Command {
+	req := &proto.ExportManifestRequest{}
+	var file string
+	cmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "Export the passenger manifest by coach as CSV, JSON Lines or printable HTML",
+		Long: "Export the passenger manifest of the departure, every booking grouped by coach with its journey,\n" +
+			"passenger type, infants, assistance and check-in status. The manifest is written to standard output\n" +
+			"or --file; --output json or yaml print the response message instead.",
+		Example:           "  client manifest --format html --file manifest.html\n  client manifest --format jsonl | jq .email",
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if manifest.ContentType(req.Format) == "" {
+				return fmt.Errorf("invalid manifest format %q: use csv, jsonl or html", req.Format)
+			}
+			return nil
+		},
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.ExportManifest(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			if o.output != "table" {
+				return o.print(cmd.OutOrStdout(), resp, nil)
+			}
+			if file == "" {
+				_, err := cmd.OutOrStdout().Write(resp.Data)
+				return err
+			}
+			if err := os.WriteFile(file, resp.Data, 0o644); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Wrote the manifest of %d bookings to %s\n", resp.Passengers, file)
+			return nil
+		}),
+	}
+	cmd.Flags().StringVar(&req.Format, "format", manifest.FormatCSV, "manifest format: csv, jsonl or html")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "file to write the manifest to instead of standard output")
+	cmd.RegisterFlagCompletionFunc("format", fixedCompletion(manifest.FormatCSV, manifest.FormatJSONL, manifest.FormatHTML))
+	cmd.MarkFlagFilename("file", "csv", "jsonl", "html")
+	return cmd
+}
+
+// newBlockCommand creates the command taking seats or a section out of service.
+func newBlockCommand(o *options) *cobra.Command {
+	req := &proto.BlockSeatsRequest{}
+	cmd := &cobra.Command{
+		Use:     "block [SEAT...]",
+		Short:   "Take seats or a whole section out of service",
+		Example: "  client block A4 A5 --reason 'Broken recliner' --expires-at 2024-06-02T09:00:00Z\n  client block --section F --reason 'Coach out of service'",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && req.Section == "" {
+				return fmt.Errorf("give the seats or a --section to block")
+			}
+			return nil
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			req.Seats = args
+			resp, err := c.client.BlockSeats(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				blocksRows(t, resp.Blocks)
+				for _, ticket := range resp.ReseatedTickets {
+					fmt.Fprintf(t.w, "\nReseated %s to %s\n", ticket.User.GetEmail(), ticket.Seat)
+				}
+				for _, ticket := range resp.FlaggedTickets {
+					fmt.Fprintf(t.w, "\nReseat required for %s on %s\n", ticket.User.GetEmail(), ticket.Seat)
+				}
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&req.Section, "section", "", "block every seat of the section")
+	cmd.Flags().StringVar(&req.Reason, "reason", "", "why the seats are out of service")
+	cmd.Flags().StringVar(&req.ExpiresAt, "expires-at", "", "RFC 3339 time the block ends, none when not given")
+	cmd.RegisterFlagCompletionFunc("section", sectionCompletion)
+	return cmd
+}
+
+// newUnblockCommand creates the command returning seats or a section to service.
+func newUnblockCommand(o *options) *cobra.Command {
+	req := &proto.UnblockSeatsRequest{}
+	cmd := &cobra.Command{
+		Use:   "unblock [SEAT...]",
+		Short: "Return seats or a whole section to service",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && req.Section == "" {
+				return fmt.Errorf("give the seats or a --section to unblock")
+			}
+			return nil
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			req.Seats = args
+			resp, err := c.client.UnblockSeats(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row("Unblocked", strings.Join(resp.Seats, " "))
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&req.Section, "section", "", "unblock every seat of the section")
+	cmd.RegisterFlagCompletionFunc("section", sectionCompletion)
+	return cmd
+}
+
+// newBlocksCommand creates the command listing the blocked seats.
+func newBlocksCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "blocks",
+		Short:             "List the seats out of service",
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.ListSeatBlocks(c.ctx, &proto.ListSeatBlocksRequest{})
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				blocksRows(t, resp.Blocks)
+			})
+		}),
+	}
+}
+
+// newDepartureCommand creates the command scheduling the departure.
+func newDepartureCommand(o *options) *cobra.Command {
+	req := &proto.SetDepartureRequest{}
+	cmd := &cobra.Command{
+		Use:     "departure",
+		Short:   "Schedule the departure and set its booking policy",
+		Example: "  client departure --time 2024-06-02T09:00:00Z --assistance-cutoff 24h --overbooking 5",
+		Args:    cobra.NoArgs,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.SetDeparture(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row(resp.Message)
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&req.DepartureTime, "time", "", "RFC 3339 departure time")
+	cmd.Flags().StringVar(&req.AssistanceCutoff, "assistance-cutoff", "", "how long before departure accessible seats stop being held, defaults to 24h")
+	cmd.Flags().Int32Var(&req.OverbookingAllowance, "overbooking", 0, "bookings confirmed without a seat once a fare class is full")
+	cmd.MarkFlagRequired("time")
+	return cmd
+}
+
+// newDeniedBoardingCommand creates the command listing the bookings still without a seat.
+func newDeniedBoardingCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "denied-boarding",
+		Short:             "List the overbooked tickets still without a seat",
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.GetDeniedBoardingReport(c.ctx, &proto.GetDeniedBoardingReportRequest{})
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				if resp.Departure != "" {
+					fmt.Fprintf(t.w, "Departure: %s\n\n", resp.Departure)
+				}
+				ticketsRows(t, resp.Tickets)
+			})
+		}),
+	}
+}
+
+// newAuditCommand creates the command querying the audit log of changes.
+func newAuditCommand(o *options) *cobra.Command {
+	req := &proto.QueryAuditLogRequest{}
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show who changed which booking and when",
+		Long: "Show the audit log of the calls that changed, or tried to change, the booking state, oldest first.\n" +
+			"Every filter is optional. Use --output json or yaml to see the values before and after each change.",
+		Example:           "  client audit --booking ABC234\n  client audit --actor agent-1 --since 2024-06-01T00:00:00Z -o json",
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.QueryAuditLog(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row("SEQ", "TIME", "ACTOR", "METHOD", "EMAIL", "REFERENCE", "RESULT")
+				for _, entry := range resp.Entries {
+					t.row(entry.Sequence, entry.Time, entry.Actor, entry.Method, entry.UserEmail, entry.BookingReference, entry.Code)
+				}
+			})
+		}),
+	}
+	cmd.Flags().StringVar(&req.BookingReference, "booking", "", "booking reference the changes were made to")
+	cmd.Flags().StringVar(&req.UserEmail, "email", "", "email of the passenger the changes were made to")
+	cmd.Flags().StringVar(&req.Actor, "actor", "", "subject or email of the caller who made the changes")
+	cmd.Flags().StringVar(&req.Since, "since", "", "RFC 3339 time of the oldest changes to show")
+	cmd.Flags().StringVar(&req.Until, "until", "", "RFC 3339 time the changes shown were made before")
+	return cmd
+}
+
+// newHealthCommand creates the command checking the health of the server.
+func newHealthCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "health [SERVICE]",
+		Short:             "Check the health of the server, or of one of its services such as liveness",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: fixedCompletion("proto.TrainService", "liveness"),
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			req := &grpc_health_v1.HealthCheckRequest{}
+			if len(args) == 1 {
+				req.Service = args[0]
+			}
+			resp, err := grpc_health_v1.NewHealthClient(c.conn).Check(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			if err := o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row("Status", resp.Status)
+			}); err != nil {
+				return err
+			}
+
+			// Fail when not serving, so scripts can wait for the server with the exit code
+			if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+				return status.Errorf(codes.Unavailable, "server is %s", resp.Status)
+			}
+			return nil
+		}),
+	}
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"train-booking-service/dao"
+	"train-booking-service/proto"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/status"
+)
+
+// Define the layout of the seat map
+const (
+	seatsPerRow = 10
+	bookedCell  = "--"
+	blockedCell = "##"
+)
+
+// consoleHelp lists the commands of the console.
+const consoleHelp = `Commands:
+  map [SECTION]        show the seat map of the train or of one section
+  book                 book a ticket, picking the seat and filling in the passenger step by step
+  receipt EMAIL        show the receipt of a passenger's ticket
+  move EMAIL SEAT      move a passenger to another seat
+  cancel EMAIL         cancel a passenger's booking
+  check-in EMAIL       check a passenger in
+  help                 show this help
+  quit                 leave the console
+`
+
+// errAborted is returned by prompts when the agent leaves a form without finishing it.
+var errAborted = errors.New("aborted")
+
+// emailPattern matches plausible email addresses, the server has the final say.
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// console is an interactive session of a station agent over one connection.
+type console struct {
+	c      *connection
+	layout dao.Layout
+	in     *bufio.Scanner
+	out    io.Writer
+}
+
+// seatMap holds the seats that cannot be booked, as last read from the server.
+type seatMap struct {
+	booked  map[string]bool
+	blocked map[string]bool
+}
+
+// newConsoleCommand creates the command starting the interactive console.
+func newConsoleCommand(o *options) *cobra.Command {
+	var layoutPath string
+	cmd := &cobra.Command{
+		Use:   "console",
+		Short: "Book and manage tickets interactively, picking seats on the seat map",
+		Long: "Book and manage tickets interactively. The console shows the seat map of the train, walks through the\n" +
+			"passenger details with validation as they are typed and asks for confirmation before booking.\n" +
+			"Each call made by the console has its own --timeout.",
+		Args: cobra.NoArgs,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			layout := dao.DefaultLayout()
+			if layoutPath != "" {
+				var err error
+				if layout, err = dao.LoadLayout(layoutPath); err != nil {
+					return err
+				}
+			}
+			s := &console{c: c, layout: layout, in: bufio.NewScanner(cmd.InOrStdin()), out: cmd.OutOrStdout()}
+			return s.run()
+		}),
+	}
+	cmd.Flags().StringVar(&layoutPath, "layout", "", "train layout file used by the server, the built-in layout when not given")
+	cmd.MarkFlagFilename("layout", "json")
+	return cmd
+}
+
+// run reads and runs commands until the input ends or the agent quits.
+func (s *console) run() error {
+	fmt.Fprintln(s.out, "Train booking console. Type help for the commands.")
+	for {
+		line, err := s.read("train> ")
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(s.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		command, args := fields[0], fields[1:]
+		if command == "quit" || command == "exit" {
+			return nil
+		}
+		err = s.dispatch(command, args)
+		switch {
+		case errors.Is(err, io.EOF):
+			fmt.Fprintln(s.out)
+			return nil
+		case errors.Is(err, errAborted):
+			fmt.Fprintln(s.out, "Cancelled.")
+		case err != nil:
+			s.printError(err)
+		}
+	}
+}
+
+// dispatch runs one console command.
+func (s *console) dispatch(command string, args []string) error {
+	usage := func(use string) error {
+		return fmt.Errorf("usage: %s", use)
+	}
+	switch command {
+	case "help", "?":
+		fmt.Fprint(s.out, consoleHelp)
+		return nil
+	case "map":
+		if len(args) > 1 {
+			return usage("map [SECTION]")
+		}
+		return s.showMap(args)
+	case "book":
+		return s.book()
+	case "receipt":
+		if len(args) != 1 {
+			return usage("receipt EMAIL")
+		}
+		return s.receipt(args[0])
+	case "move":
+		if len(args) != 2 {
+			return usage("move EMAIL SEAT")
+		}
+		return s.move(args[0], strings.ToUpper(args[1]))
+	case "cancel":
+		if len(args) != 1 {
+			return usage("cancel EMAIL")
+		}
+		return s.cancel(args[0])
+	case "check-in":
+		if len(args) != 1 {
+			return usage("check-in EMAIL")
+		}
+		return s.checkIn(args[0])
+	default:
+		return fmt.Errorf("unknown command %q, type help for the commands", command)
+	}
+}
+
+// printError reports a failed command without leaving the console.
+func (s *console) printError(err error) {
+	if st, ok := status.FromError(err); ok {
+		fmt.Fprintf(s.out, "Error: %s: %s\n", st.Code(), st.Message())
+		return
+	}
+	fmt.Fprintf(s.out, "Error: %v\n", err)
+}
+
+// read prints a prompt and reads a line of input.
+func (s *console) read(prompt string) (string, error) {
+	fmt.Fprint(s.out, prompt)
+	if !s.in.Scan() {
+		if err := s.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return strings.TrimSpace(s.in.Text()), nil
+}
+
+// ask prompts for a value until it passes validation. A single "." aborts the form.
+func (s *console) ask(label string, validate func(string) error) (string, error) {
+	for {
+		value, err := s.read(label + ": ")
+		if err != nil {
+			return "", err
+		}
+		if value == "." {
+			return "", errAborted
+		}
+		if err := validate(value); err != nil {
+			fmt.Fprintf(s.out, "  %v\n", err)
+			continue
+		}
+		return value, nil
+	}
+}
+
+// confirm asks a yes or no question, anything but yes is taken as no.
+func (s *console) confirm(question string) (bool, error) {
+	answer, err := s.read(question + " [y/N]: ")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// seats returns the seats of a section, in seat number order.
+func seats(section dao.Section) []string {
+	seats := make([]string, section.Capacity)
+	for i := range seats {
+		seats[i] = section.Name + strconv.Itoa(i+1)
+	}
+	return seats
+}
+
+// sectionByName returns the section of the layout with the given name.
+func (s *console) sectionByName(name string) (dao.Section, bool) {
+	for _, section := range s.layout.Sections {
+		if section.Name == name {
+			return section, true
+		}
+	}
+	return dao.Section{}, false
+}
+
+// loadSeatMap reads the booked and blocked seats of the sections from the server.
+func (s *console) loadSeatMap(sections []dao.Section) (*seatMap, error) {
+	ctx, cancel := s.c.call()
+	defer cancel()
+
+	m := &seatMap{booked: map[string]bool{}, blocked: map[string]bool{}}
+	for _, section := range sections {
+		resp, err := s.c.client.GetUsersBySection(ctx, &proto.GetUsersBySectionRequest{Section: section.Name})
+		if err != nil {
+			return nil, err
+		}
+		for _, userSeat := range resp.UserSeats {
+			m.booked[userSeat.Seat] = true
+		}
+	}
+	blocks, err := s.c.client.ListSeatBlocks(ctx, &proto.ListSeatBlocksRequest{})
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks.Blocks {
+		m.blocked[block.Seat] = true
+	}
+	return m, nil
+}
+
+// showMap prints the seat map of every section, or of the section given.
+func (s *console) showMap(args []string) error {
+	sections := s.layout.Sections
+	if len(args) == 1 {
+		section, ok := s.sectionByName(strings.ToUpper(args[0]))
+		if !ok {
+			return fmt.Errorf("no section %s on this train", args[0])
+		}
+		sections = []dao.Section{section}
+	}
+	m, err := s.loadSeatMap(sections)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	for _, section := range sections {
+		free := 0
+		var cells []string
+		for _, seat := range seats(section) {
+			switch {
+			case m.blocked[seat]:
+				cells = append(cells, blockedCell)
+			case m.booked[seat]:
+				cells = append(cells, bookedCell)
+			case len(s.layout.SeatAttributes[seat]) > 0:
+				free++
+				cells = append(cells, seat+"*")
+			default:
+				free++
+				cells = append(cells, seat)
+			}
+		}
+		fmt.Fprintf(w, "Section %s (%s), %d of %d seats free\n", section.Name, section.Class, free, section.Capacity)
+		for row := range slices.Chunk(cells, seatsPerRow) {
+			fmt.Fprintf(w, "  %s\n", strings.Join(row, "\t"))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s booked, %s blocked, * accessible seat held for passengers requesting assistance\n", bookedCell, blockedCell)
+	return w.Flush()
+}
+
+// validateSeat checks that a seat exists in the layout and is free on the seat map.
+func (s *console) validateSeat(m *seatMap, seat string) error {
+	section, ok := s.sectionByName(seat[:1])
+	if !ok || !slices.Contains(seats(section), seat) {
+		return fmt.Errorf("no seat %s on this train", seat)
+	}
+	if m.blocked[seat] {
+		return fmt.Errorf("seat %s is blocked", seat)
+	}
+	if m.booked[seat] {
+		return fmt.Errorf("seat %s is already booked", seat)
+	}
+	return nil
+}
+
+// required rejects empty values.
+func required(value string) error {
+	if value == "" {
+		return fmt.Errorf("required")
+	}
+	return nil
+}
+
+// oneOf accepts an empty value or one of the values given.
+func oneOf(values ...string) func(string) error {
+	return func(value string) error {
+		if value != "" && !slices.Contains(values, value) {
+			return fmt.Errorf("use one of %s", strings.Join(values, ", "))
+		}
+		return nil
+	}
+}
+
+// validateDate accepts an empty value or a date in the past as YYYY-MM-DD.
+func validateDate(value string) error {
+	if value == "" {
+		return nil
+	}
+	date, err := time.Parse(dao.DateOfBirthLayout, value)
+	if err != nil {
+		return fmt.Errorf("use YYYY-MM-DD")
+	}
+	if date.After(time.Now()) {
+		return fmt.Errorf("date of birth is in the future")
+	}
+	return nil
+}
+
+// validateEmail checks the form of an email and that its passenger has no booking yet.
+func (s *console) validateEmail(value string) error {
+	if !emailPattern.MatchString(value) {
+		return fmt.Errorf("not a valid email")
+	}
+	ctx, cancel := s.c.call()
+	defer cancel()
+	if _, err := s.c.client.GetReceipt(ctx, &proto.GetReceiptRequest{UserEmail: value}); err == nil {
+		return fmt.Errorf("%s already has a booking", value)
+	}
+	return nil
+}
+
+// book walks the agent through a booking: the seat, the journey and the passenger, then books after confirmation.
+func (s *console) book() error {
+	m, err := s.loadSeatMap(s.layout.Sections)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, "Type . to cancel at any prompt.")
+
+	seat, err := s.ask("Seat (empty for any free seat)", func(value string) error {
+		if value == "" {
+			return nil
+		}
+		return s.validateSeat(m, strings.ToUpper(value))
+	})
+	if err != nil {
+		return err
+	}
+	seat = strings.ToUpper(seat)
+
+	// The seat decides the fare class, otherwise the agent picks it
+	req := &proto.PurchaseTicketRequest{User: &proto.User{}, RequestedSeat: seat}
+	if seat != "" {
+		section, _ := s.sectionByName(seat[:1])
+		req.FareClass = section.Class
+	} else {
+		var classes []string
+		for _, class := range s.layout.FareClasses {
+			classes = append(classes, class.Name)
+		}
+		if req.FareClass, err = s.ask("Fare class (empty for standard)", oneOf(classes...)); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range []struct {
+		label    string
+		value    *string
+		validate func(string) error
+	}{
+		{"From", &req.From, required},
+		{"To", &req.To, required},
+		{"First name", &req.User.FirstName, required},
+		{"Last name", &req.User.LastName, required},
+		{"Email", &req.User.Email, s.validateEmail},
+		{"Date of birth (YYYY-MM-DD, empty for an adult)", &req.User.DateOfBirth, validateDate},
+		{"Railcard (student, disability or empty)", &req.User.Railcard, oneOf(dao.ConcessionStudent, dao.ConcessionDisability)},
+	} {
+		if *field.value, err = s.ask(field.label, field.validate); err != nil {
+			return err
+		}
+	}
+
+	infant, err := s.ask("Infant on lap (FIRST:LAST:YYYY-MM-DD, empty for none)", func(value string) error {
+		if value == "" {
+			return nil
+		}
+		infant, err := parseInfant(value)
+		if err != nil {
+			return err
+		}
+		return validateDate(infant.DateOfBirth)
+	})
+	if err != nil {
+		return err
+	}
+	if infant != "" {
+		user, _ := parseInfant(infant)
+		req.Infants = []*proto.User{user}
+	}
+
+	assistanceTypes := []string{dao.AssistanceWheelchair, dao.AssistanceMobility, dao.AssistanceVisual, dao.AssistanceHearing, dao.AssistanceOther}
+	assistance, err := s.ask("Assistance ("+strings.Join(assistanceTypes, ", ")+" or empty)", oneOf(assistanceTypes...))
+	if err != nil {
+		return err
+	}
+	if assistance != "" {
+		req.Assistance = &proto.AssistanceRequest{Type: assistance}
+		if req.Assistance.Notes, err = s.ask("Assistance notes", func(string) error { return nil }); err != nil {
+			return err
+		}
+	}
+
+	// Show what is about to be booked
+	t := table{w: tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)}
+	fmt.Fprintln(t.w)
+	t.row("Passenger", name(req.User))
+	t.row("Email", req.User.Email)
+	t.row("Journey", fmt.Sprintf("%s to %s", req.From, req.To))
+	t.row("Seat", cmp.Or(seat, "any free seat"))
+	t.row("Class", cmp.Or(req.FareClass, dao.FareClassStandard))
+	t.row("Date of birth", req.User.DateOfBirth)
+	t.row("Railcard", req.User.Railcard)
+	if infant != "" {
+		t.row("Infant", fmt.Sprintf("%s (born %s)", name(req.Infants[0]), req.Infants[0].DateOfBirth))
+	}
+	if req.Assistance != nil {
+		t.row("Assistance", strings.TrimSpace(req.Assistance.Type+" "+req.Assistance.Notes))
+	}
+	t.w.Flush()
+	ok, err := s.confirm("Book this ticket?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errAborted
+	}
+
+	ctx, cancel := s.c.call()
+	defer cancel()
+	resp, err := s.c.client.PurchaseTicket(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Ticket.Seat == "" {
+		fmt.Fprintf(s.out, "The class is full: the booking is confirmed without a seat, one is assigned at check-in.\n")
+	}
+
+	fmt.Fprintln(s.out, "\nTicket booked.")
+	return s.printTicket(resp.Ticket)
+}
+
+// printTicket prints the details of a ticket.
+func (s *console) printTicket(ticket *proto.TicketReceipt) error {
+	t := table{w: tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)}
+	ticketRows(t, ticket)
+	return t.w.Flush()
+}
+
+// receipt prints the receipt of a passenger's ticket.
+func (s *console) receipt(email string) error {
+	ctx, cancel := s.c.call()
+	defer cancel()
+	resp, err := s.c.client.GetReceipt(ctx, &proto.GetReceiptRequest{UserEmail: email})
+	if err != nil {
+		return err
+	}
+	return s.printTicket(resp.Ticket)
+}
+
+// move moves a passenger to a seat that is free on the seat map.
+func (s *console) move(email, seat string) error {
+	section, ok := s.sectionByName(seat[:1])
+	if !ok {
+		return fmt.Errorf("no seat %s on this train", seat)
+	}
+	m, err := s.loadSeatMap([]dao.Section{section})
+	if err != nil {
+		return err
+	}
+	if err := s.validateSeat(m, seat); err != nil {
+		return err
+	}
+
+	ctx, cancel := s.c.call()
+	defer cancel()
+	resp, err := s.c.client.ModifySeat(ctx, &proto.ModifySeatRequest{UserEmail: email, NewSeat: seat})
+	if err != nil {
+		return err
+	}
+	if resp.FareDifference > 0 {
+		fmt.Fprintf(s.out, "Fare difference to charge: %.2f\n", resp.FareDifference)
+	}
+	return s.printTicket(resp.NewTicket)
+}
+
+// cancel removes a passenger's booking after confirmation.
+func (s *console) cancel(email string) error {
+	if err := s.receipt(email); err != nil {
+		return err
+	}
+	ok, err := s.confirm("Cancel this booking?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errAborted
+	}
+
+	ctx, cancel := s.c.call()
+	defer cancel()
+	resp, err := s.c.client.RemoveUser(ctx, &proto.RemoveUserRequest{UserEmail: email})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Booking of %s (%s) cancelled.\n", name(resp.User), resp.User.GetEmail())
+	return nil
+}
+
+// checkIn checks a passenger in and prints the seat they travel in.
+func (s *console) checkIn(email string) error {
+	ctx, cancel := s.c.call()
+	defer cancel()
+	resp, err := s.c.client.CheckIn(ctx, &proto.CheckInRequest{UserEmail: email})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, resp.Message)
+	return s.printTicket(resp.Ticket)
+}
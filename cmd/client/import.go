@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"train-booking-service/proto"
+
+	"github.com/spf13/cobra"
+)
+
+// importColumns are the columns a bulk import file may have, named after the fields of the purchase request.
+var importColumns = []string{
+	"from", "to", "first_name", "last_name", "email", "date_of_birth", "passenger_type", "railcard", "fare_class",
+	"assistance", "assistance_notes", "infant_first_name", "infant_last_name", "infant_date_of_birth",
+}
+
+// requiredImportColumns are the columns every bulk import file must have.
+var requiredImportColumns = []string{"from", "to", "first_name", "last_name", "email"}
+
+// readBookings reads the bookings of a CSV file with a header row, numbering each booking with its line in the file.
+func readBookings(r io.Reader) ([]*proto.BulkPurchaseRequest, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !slices.Contains(importColumns, column) {
+			return nil, fmt.Errorf("unknown column %q, use %s", column, strings.Join(importColumns, ", "))
+		}
+		columns[column] = i
+	}
+	for _, column := range requiredImportColumns {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("missing column %q", column)
+		}
+	}
+
+	var reqs []*proto.BulkPurchaseRequest
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		ticket := &proto.PurchaseTicketRequest{
+			From: field("from"),
+			To:   field("to"),
+			User: &proto.User{
+				FirstName:     field("first_name"),
+				LastName:      field("last_name"),
+				Email:         field("email"),
+				DateOfBirth:   field("date_of_birth"),
+				PassengerType: field("passenger_type"),
+				Railcard:      field("railcard"),
+			},
+			FareClass: field("fare_class"),
+		}
+		if field("assistance") != "" || field("assistance_notes") != "" {
+			ticket.Assistance = &proto.AssistanceRequest{Type: field("assistance"), Notes: field("assistance_notes")}
+		}
+		if field("infant_first_name") != "" || field("infant_last_name") != "" || field("infant_date_of_birth") != "" {
+			ticket.Infants = []*proto.User{{
+				FirstName:   field("infant_first_name"),
+				LastName:    field("infant_last_name"),
+				DateOfBirth: field("infant_date_of_birth"),
+			}}
+		}
+		line, _ := reader.FieldPos(0)
+		reqs = append(reqs, &proto.BulkPurchaseRequest{Row: int32(line), Ticket: ticket})
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("the file has no bookings")
+	}
+	return reqs, nil
+}
+
+// newImportCommand creates the command booking the passengers of a CSV file.
+func newImportCommand(o *options) *cobra.Command {
+	var dryRun, allOrNothing bool
+	var reqs []*proto.BulkPurchaseRequest
+
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Book the passengers listed in a CSV file, - for standard input",
+		Long: "Book the passengers listed in a CSV file, - for standard input, in a single call.\n\n" +
+			"The first row names the columns: " + strings.Join(importColumns, ", ") + ".\n" +
+			"Only " + strings.Join(requiredImportColumns, ", ") + " are required. Every booking is validated and\n" +
+			"reported with its line in the file: the seat it got, or why it could not be made. The command fails\n" +
+			"when any booking could not be made.",
+		Example: "  client import passengers.csv --dry-run\n  client import passengers.csv --all-or-nothing",
+		Args:    cobra.ExactArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+			return []cobra.Completion{"csv"}, cobra.ShellCompDirectiveFilterFileExt
+		},
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+			}
+
+			var err error
+			if reqs, err = readBookings(in); err != nil {
+				return fmt.Errorf("could not read %s: %w", args[0], err)
+			}
+			reqs[0].DryRun = dryRun
+			reqs[0].AllOrNothing = allOrNothing
+			return nil
+		},
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			stream, err := c.client.BulkPurchase(c.ctx)
+			if err != nil {
+				return err
+			}
+			for _, req := range reqs {
+				if err := stream.Send(req); err != nil {
+					break // The server ended the call, its status is returned by CloseAndRecv
+				}
+			}
+			resp, err := stream.CloseAndRecv()
+			if err != nil {
+				return err
+			}
+
+			emails := map[int32]string{}
+			for _, req := range reqs {
+				emails[req.Row] = req.Ticket.User.Email
+			}
+			if err := o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row("LINE", "EMAIL", "SEAT", "CLASS", "REFERENCE", "RESULT")
+				for _, result := range resp.Results {
+					if result.Error != "" {
+						t.row(result.Row, emails[result.Row], "", "", "", result.Code+": "+result.Error)
+						continue
+					}
+					t.row(result.Row, emails[result.Row], result.Ticket.Seat, result.Ticket.FareClass, result.Ticket.BookingReference, "ok")
+				}
+				fmt.Fprintf(t.w, "\n%s\n", resp.Message)
+			}); err != nil {
+				return err
+			}
+
+			if resp.Failed > 0 {
+				return fmt.Errorf("%d of %d bookings could not be made", resp.Failed, len(resp.Results))
+			}
+			return nil
+		}),
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "validate the bookings and show the seats they would get without booking anything")
+	cmd.Flags().BoolVar(&allOrNothing, "all-or-nothing", false, "book nothing unless every booking can be made")
+	return cmd
+}
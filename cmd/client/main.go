@@ -2,119 +2,249 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
-	"log"
+	"os"
+	"time"
+	"train-booking-service/auth"
+	"train-booking-service/logging"
 	"train-booking-service/proto"
+	"train-booking-service/tlsconfig"
+	"train-booking-service/tracing"
 
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-func main() {
-	// Define flags
-	Operation := flag.String("Operation", "", "Flag to indicate Operation: PurchaseTicket, GetReceipt, ModifySeat, GetUsersBySection, RemoveUser")
-	Data := flag.String("Data", "", "Flag to indicate data required for Operations: PurchaseTicket, GetReceipt, ModifySeat, GetUsersBySection, RemoveUser")
+// Define the exit codes of the client
+const (
+	exitOK          = 0
+	exitFailure     = 1 // The call failed on the server, or the client could not make it
+	exitUsage       = 2 // The command line or the request is invalid
+	exitNotFound    = 3 // The ticket does not exist
+	exitConflict    = 4 // The user or seat is already booked
+	exitRejected    = 5 // The request is valid but cannot be carried out, such as a blocked seat
+	exitDenied      = 6 // The credentials are missing, invalid or not allowed to make the call
+	exitRateLimited = 7 // The caller went over a rate limit or its booking limit
+	exitUnavailable = 8 // The server could not be reached, is not ready or did not answer in time
+)
 
-	flag.Parse()
+// statusExitCodes maps the gRPC status codes of failed calls to exit codes, other codes exit with exitFailure.
+var statusExitCodes = map[codes.Code]int{
+	codes.InvalidArgument:    exitUsage,
+	codes.NotFound:           exitNotFound,
+	codes.AlreadyExists:      exitConflict,
+	codes.Aborted:            exitConflict,
+	codes.FailedPrecondition: exitRejected,
+	codes.OutOfRange:         exitRejected,
+	codes.Unauthenticated:    exitDenied,
+	codes.PermissionDenied:   exitDenied,
+	codes.ResourceExhausted:  exitRateLimited,
+	codes.Unavailable:        exitUnavailable,
+	codes.DeadlineExceeded:   exitUnavailable,
+	codes.Canceled:           exitUnavailable,
+}
 
-	// Connect to the gRPC server
-	conn, err := grpc.Dial("localhost:7001", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("did not connect: %v", err)
+// defaultAddress returns the server address from the environment, or the local server.
+func defaultAddress() string {
+	if address := os.Getenv("TRAIN_SERVICE_ADDRESS"); address != "" {
+		return address
 	}
-	defer conn.Close()
-
-	// Create the client for TrainService
-	client := proto.NewTrainServiceClient(conn)
-
-	// Switch based on the operation type
-	switch *Operation {
-	case "PurchaseTicket":
-		// Parse the PurchaseTicketRequest
-		var req proto.PurchaseTicketRequest
-		if err := json.Unmarshal([]byte(*Data), &req); err != nil {
-			log.Fatalf("could not unmarshal PurchaseTicketRequest JSON: %v", err)
-		}
+	return "localhost:7001"
+}
 
-		// Call the PurchaseTicket method
-		resp, err := client.PurchaseTicket(context.Background(), &req)
-		if err != nil {
-			log.Fatalf("could not purchase ticket: %v", err)
-		}
+// options holds the flags shared by every command.
+type options struct {
+	server        string
+	timeout       time.Duration
+	output        string
+	token         string
+	apiKey        string
+	caCert        string
+	cert          string
+	key           string
+	serverName    string
+	requestID     string
+	traceExporter string
+	otlpEndpoint  string
+
+	// started is set once a command has parsed its arguments and begins to run, errors before that are usage errors
+	started bool
+}
 
-		// Output the response
-		fmt.Printf("Ticket purchased: %s, Seat: %s\n", resp.Message, resp.Ticket.Seat)
+// connection is an open connection to the server with the context of the call to make over it.
+type connection struct {
+	ctx    context.Context
+	conn   *grpc.ClientConn
+	client proto.TrainServiceClient
 
-	case "GetReceipt":
-		// Parse the GetReceiptRequest
-		var req proto.GetReceiptRequest
-		if err := json.Unmarshal([]byte(*Data), &req); err != nil {
-			log.Fatalf("could not unmarshal GetReceiptRequest JSON: %v", err)
-		}
+	// base carries the credentials without the timeout, for commands making many calls
+	base    context.Context
+	timeout time.Duration
+}
+
+// call returns the context of one of many calls made by a command, with its own timeout.
+func (c *connection) call() (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(c.base, c.timeout)
+	}
+	return context.WithCancel(c.base)
+}
 
-		// Call the GetReceipt method
-		resp, err := client.GetReceipt(context.Background(), &req)
+// run returns the function running a command: it connects to the server, calls fn with a context carrying the
+// credentials and the timeout, and closes the connection.
+func (o *options) run(fn func(cmd *cobra.Command, args []string, c *connection) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		o.started = true
+
+		// Trace the calls and propagate the trace context to the server
+		shutdownTracing, err := tracing.Setup(cmd.Context(), tracing.Config{
+			ServiceName:  "train-booking-client",
+			Exporter:     o.traceExporter,
+			OTLPEndpoint: o.otlpEndpoint,
+		})
 		if err != nil {
-			log.Fatalf("could not get receipt: %v", err)
+			return fmt.Errorf("could not configure tracing: %w", err)
 		}
-
-		// Output the receipt details
-		fmt.Printf("Receipt: %s to %s, Seat: %s, Price Paid: %.2f\n", resp.Ticket.From, resp.Ticket.To, resp.Ticket.Seat, resp.Ticket.PricePaid)
-
-	case "ModifySeat":
-		// Parse the ModifySeatRequest
-		var req proto.ModifySeatRequest
-		if err := json.Unmarshal([]byte(*Data), &req); err != nil {
-			log.Fatalf("could not unmarshal ModifySeatRequest JSON: %v", err)
+		defer shutdownTracing(context.Background())
+
+		// Use TLS when a CA or client certificate is given
+		transportCredentials := insecure.NewCredentials()
+		if o.caCert != "" || o.cert != "" || o.key != "" {
+			tlsConfig, err := tlsconfig.Client(o.caCert, o.cert, o.key, o.serverName)
+			if err != nil {
+				return fmt.Errorf("could not configure TLS: %w", err)
+			}
+			transportCredentials = credentials.NewTLS(tlsConfig)
 		}
 
-		// Call the ModifySeat method
-		resp, err := client.ModifySeat(context.Background(), &req)
+		conn, err := grpc.NewClient(o.server, grpc.WithTransportCredentials(transportCredentials), grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
 		if err != nil {
-			log.Fatalf("could not modify seat: %v", err)
+			return fmt.Errorf("could not connect to %s: %w", o.server, err)
 		}
+		defer conn.Close()
 
-		// Output the modified seat details
-		fmt.Printf("New Receipt: %s to %s, Seat: %s, Price Paid: %.2f\n", resp.NewTicket.From, resp.NewTicket.To, resp.NewTicket.Seat, resp.NewTicket.PricePaid)
-
-	case "RemoveUser":
-		// Parse the RemoveUserRequest
-		var req proto.RemoveUserRequest
-		if err := json.Unmarshal([]byte(*Data), &req); err != nil {
-			log.Fatalf("could not unmarshal RemoveUserRequest JSON: %v", err)
+		// Attach the credentials to every call
+		base := cmd.Context()
+		if o.token != "" {
+			base = metadata.AppendToOutgoingContext(base, "authorization", "Bearer "+o.token)
 		}
-
-		// Call the RemoveUser method
-		resp, err := client.RemoveUser(context.Background(), &req)
-		if err != nil {
-			log.Fatalf("could not remove user: %v", err)
+		if o.apiKey != "" {
+			base = metadata.AppendToOutgoingContext(base, auth.APIKeyHeader, o.apiKey)
+		}
+		if o.requestID != "" {
+			base = metadata.AppendToOutgoingContext(base, logging.RequestIDHeader, o.requestID)
 		}
+		c := &connection{conn: conn, client: proto.NewTrainServiceClient(conn), base: base, timeout: o.timeout}
+		ctx, cancel := c.call()
+		defer cancel()
+		c.ctx = ctx
 
-		// Output the removed user details
-		fmt.Printf("Removed User: Name: %s %s, Email: %s\n", resp.User.FirstName, resp.User.LastName, resp.User.Email)
+		return fn(cmd, args, c)
+	}
+}
 
-	case "GetUsersBySection":
-		// Parse the GetUsersBySectionRequest
-		var req proto.GetUsersBySectionRequest
-		if err := json.Unmarshal([]byte(*Data), &req); err != nil {
-			log.Fatalf("could not unmarshal GetUsersBySectionRequest JSON: %v", err)
+// exitCode returns the exit code of a command that failed with err.
+func (o *options) exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if !o.started {
+		return exitUsage
+	}
+	if s, ok := status.FromError(err); ok {
+		if code, ok := statusExitCodes[s.Code()]; ok {
+			return code
 		}
+		return exitFailure
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return exitUnavailable
+	}
+	return exitFailure
+}
 
-		// Call the GetUsersBySection method
-		resp, err := client.GetUsersBySection(context.Background(), &req)
-		if err != nil {
-			log.Fatalf("could not get users by section: %v", err)
-		}
+// newRootCommand creates the client command with all its subcommands.
+func newRootCommand(o *options) *cobra.Command {
+	root := &cobra.Command{
+		Use:   "client",
+		Short: "Book and manage train tickets",
+		Long: "Book and manage train tickets on the train booking service.\n\n" +
+			"Exit codes: 0 success, 1 failure, 2 invalid usage or request, 3 ticket not found, 4 already booked,\n" +
+			"5 request rejected, 6 not authenticated or not allowed, 7 rate or booking limit reached,\n" +
+			"8 server unavailable or timed out.",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !validOutput(o.output) {
+				return fmt.Errorf("invalid output format %q: use table, json or yaml", o.output)
+			}
+			return nil
+		},
+	}
 
-		// Output the list of users and their seats
-		fmt.Println("User List:")
-		for _, userSeat := range resp.UserSeats {
-			fmt.Printf("\nUser: %s %s (%s)\nSeat: %s\n", userSeat.User.FirstName, userSeat.User.LastName, userSeat.User.Email, userSeat.Seat)
-		}
+	flags := root.PersistentFlags()
+	flags.StringVar(&o.server, "server", defaultAddress(), "server address, defaults to $TRAIN_SERVICE_ADDRESS or localhost:7001")
+	flags.DurationVar(&o.timeout, "timeout", 10*time.Second, "deadline of the call, 0 for none")
+	flags.StringVarP(&o.output, "output", "o", "table", "output format: table, json or yaml")
+	flags.StringVar(&o.token, "token", os.Getenv("TRAIN_TOKEN"), "bearer token (JWT) to authenticate with, defaults to $TRAIN_TOKEN")
+	flags.StringVar(&o.apiKey, "api-key", os.Getenv("TRAIN_API_KEY"), "API key to authenticate with, defaults to $TRAIN_API_KEY")
+	flags.StringVar(&o.caCert, "ca-cert", "", "PEM CA certificates the server certificate is verified against; enables TLS")
+	flags.StringVar(&o.cert, "cert", "", "PEM client certificate for mutual TLS; enables TLS")
+	flags.StringVar(&o.key, "key", "", "PEM client private key for mutual TLS")
+	flags.StringVar(&o.serverName, "server-name", "", "server name to verify the server certificate against, if not the host of --server")
+	flags.StringVar(&o.requestID, "request-id", "", "request ID sent with the call, to find it in the server logs")
+	flags.StringVar(&o.traceExporter, "trace-exporter", "none", "where spans are exported: none, stdout or otlp")
+	flags.StringVar(&o.otlpEndpoint, "otlp-endpoint", tracing.DefaultOTLPEndpoint, "OpenTelemetry collector address of the otlp trace exporter")
+
+	root.RegisterFlagCompletionFunc("output", fixedCompletion("table", "json", "yaml"))
+	root.RegisterFlagCompletionFunc("trace-exporter", fixedCompletion("none", "stdout", "otlp"))
+	root.MarkPersistentFlagFilename("ca-cert", "crt", "pem")
+	root.MarkPersistentFlagFilename("cert", "crt", "pem")
+	root.MarkPersistentFlagFilename("key", "key", "pem")
+
+	root.AddCommand(
+		newBookCommand(o),
+		newReceiptCommand(o),
+		newHistoryCommand(o),
+		newSeatsCommand(o),
+		newMoveCommand(o),
+		newCancelCommand(o),
+		newCheckInCommand(o),
+		newAssistanceCommand(o),
+		newManifestCommand(o),
+		newBlockCommand(o),
+		newUnblockCommand(o),
+		newBlocksCommand(o),
+		newDepartureCommand(o),
+		newDeniedBoardingCommand(o),
+		newAuditCommand(o),
+		newHealthCommand(o),
+		newImportCommand(o),
+		newSnapshotCommand(o),
+		newConsoleCommand(o),
+	)
+	return root
+}
 
-	default:
-		log.Fatalf("No valid operation selected")
+func main() {
+	o := &options{}
+	root := newRootCommand(o)
+	if cmd, err := root.ExecuteC(); err != nil {
+		if s, ok := status.FromError(err); ok {
+			fmt.Fprintf(os.Stderr, "Error: %s: %s\n", s.Code(), s.Message())
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if !o.started {
+			fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+		}
+		os.Exit(o.exitCode(err))
 	}
 }
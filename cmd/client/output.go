@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"train-booking-service/proto"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// validOutput reports whether the output format is supported.
+func validOutput(format string) bool {
+	return format == "table" || format == "json" || format == "yaml"
+}
+
+// fixedCompletion completes a flag or argument with fixed values.
+func fixedCompletion(values ...string) cobra.CompletionFunc {
+	return cobra.FixedCompletions(values, cobra.ShellCompDirectiveNoFileComp)
+}
+
+// table writes aligned columns, one call to row per line.
+type table struct {
+	w *tabwriter.Writer
+}
+
+// row writes the cells of a line, empty cells are shown as "-".
+func (t table) row(cells ...any) {
+	text := make([]string, len(cells))
+	for i, cell := range cells {
+		text[i] = fmt.Sprint(cell)
+		if text[i] == "" {
+			text[i] = "-"
+		}
+	}
+	fmt.Fprintln(t.w, strings.Join(text, "\t"))
+}
+
+// print writes the response in the output format, calling render to write it as a table.
+func (o *options) print(w io.Writer, resp protobuf.Message, render func(t table)) error {
+	switch o.output {
+	case "json", "yaml":
+		data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(resp)
+		if err != nil {
+			return fmt.Errorf("could not encode response: %w", err)
+		}
+		if o.output == "json" {
+			// Indent with encoding/json, as protojson varies its whitespace on purpose
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, data, "", "  "); err != nil {
+				return fmt.Errorf("could not encode response: %w", err)
+			}
+			indented.WriteByte('\n')
+			_, err = indented.WriteTo(w)
+			return err
+		}
+
+		// Convert through JSON so YAML uses the same field names
+		var value any
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("could not encode response: %w", err)
+		}
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return fmt.Errorf("could not encode response: %w", err)
+		}
+		return encoder.Close()
+	default:
+		t := table{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+		render(t)
+		return t.w.Flush()
+	}
+}
+
+// name returns the full name of a user.
+func name(user *proto.User) string {
+	return strings.TrimSpace(user.GetFirstName() + " " + user.GetLastName())
+}
+
+// ticketRows writes the details of a ticket as field and value rows.
+func ticketRows(t table, ticket *proto.TicketReceipt) {
+	t.row("Booking reference", ticket.BookingReference)
+	t.row("Passenger", fmt.Sprintf("%s (%s)", name(ticket.User), ticket.User.GetPassengerType()))
+	t.row("Email", ticket.User.GetEmail())
+	t.row("Journey", fmt.Sprintf("%s to %s", ticket.From, ticket.To))
+	t.row("Seat", ticket.Seat)
+	t.row("Class", ticket.FareClass)
+	t.row("Price paid", fmt.Sprintf("%.2f", ticket.PricePaid))
+	t.row("Status", ticket.Status)
+	if ticket.Concession != "" {
+		t.row("Concession", ticket.Concession)
+	}
+	for _, infant := range ticket.Infants {
+		t.row("Infant", fmt.Sprintf("%s (born %s)", name(infant), infant.DateOfBirth))
+	}
+	if ticket.Assistance != nil {
+		t.row("Assistance", strings.TrimSpace(ticket.Assistance.Type+" "+ticket.Assistance.Notes))
+	}
+	if ticket.ReseatRequired {
+		t.row("Reseat required", "yes")
+	}
+}
+
+// ticketsRows writes tickets as a list, one per row.
+func ticketsRows(t table, tickets []*proto.TicketReceipt) {
+	t.row("REFERENCE", "PASSENGER", "EMAIL", "SEAT", "CLASS", "STATUS")
+	for _, ticket := range tickets {
+		t.row(ticket.BookingReference, name(ticket.User), ticket.User.GetEmail(), ticket.Seat, ticket.FareClass, ticket.Status)
+	}
+}
+
+// blocksRows writes seat blocks as a list, one per row.
+func blocksRows(t table, blocks []*proto.SeatBlock) {
+	t.row("SEAT", "REASON", "BLOCKED AT", "EXPIRES AT")
+	for _, block := range blocks {
+		t.row(block.Seat, block.Reason, block.BlockedAt, block.ExpiresAt)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"train-booking-service/dao"
+	"train-booking-service/proto"
+
+	"github.com/spf13/cobra"
+)
+
+// snapshotCompletion completes snapshot file names.
+func snapshotCompletion(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return []cobra.Completion{"snapshot", "pb"}, cobra.ShellCompDirectiveFilterFileExt
+}
+
+// newSnapshotCommand creates the commands exporting and importing snapshots of the whole booking state.
+func newSnapshotCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Export or import a snapshot of the whole booking state",
+		Long: "Export or import a snapshot of the whole booking state: the bookings and their passengers, the free seats\n" +
+			"of every section, the blocked seats and the departure. Snapshots are versioned protobuf files with a SHA-256\n" +
+			"checksum, to back up the state or move it to another server with the same train layout.",
+	}
+	cmd.AddCommand(newSnapshotExportCommand(o), newSnapshotImportCommand(o))
+	return cmd
+}
+
+// newSnapshotExportCommand creates the command writing a snapshot of the booking state to a file.
+func newSnapshotExportCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:               "export FILE",
+		Short:             "Write a snapshot of the booking state to a file, - for standard output",
+		Example:           "  client snapshot export backup.snapshot",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: snapshotCompletion,
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.ExportSnapshot(c.ctx, &proto.ExportSnapshotRequest{})
+			if err != nil {
+				return err
+			}
+			if args[0] == "-" {
+				_, err := cmd.OutOrStdout().Write(resp.Data)
+				return err
+			}
+			if err := os.WriteFile(args[0], resp.Data, 0o600); err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				t.row("File", args[0])
+				t.row("Tickets", resp.Tickets)
+				t.row("Blocked seats", resp.Blocks)
+				t.row("SHA-256", resp.Sha256)
+			})
+		}),
+	}
+}
+
+// newSnapshotImportCommand creates the command replacing the booking state with a snapshot file.
+func newSnapshotImportCommand(o *options) *cobra.Command {
+	req := &proto.ImportSnapshotRequest{}
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Replace the booking state with a snapshot file, - for standard input",
+		Long: "Replace the whole booking state with a snapshot file, - for standard input. The server checks the snapshot\n" +
+			"against its train layout before replacing anything: every seat must exist and be booked at most once, and\n" +
+			"the bookings without a seat must fit the overbooking allowance.",
+		Example:           "  client snapshot import backup.snapshot --dry-run\n  client snapshot import backup.snapshot",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: snapshotCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+			}
+
+			var err error
+			if req.Data, err = io.ReadAll(in); err != nil {
+				return fmt.Errorf("could not read %s: %w", args[0], err)
+			}
+			// Check the file before sending it, so a damaged file is reported as such
+			if _, err := dao.DecodeSnapshot(req.Data); err != nil {
+				return fmt.Errorf("invalid snapshot %s: %w", args[0], err)
+			}
+			return nil
+		},
+		RunE: o.run(func(cmd *cobra.Command, args []string, c *connection) error {
+			resp, err := c.client.ImportSnapshot(c.ctx, req)
+			if err != nil {
+				return err
+			}
+			return o.print(cmd.OutOrStdout(), resp, func(t table) {
+				fmt.Fprintln(t.w, resp.Message)
+			})
+		}),
+	}
+	cmd.Flags().BoolVar(&req.DryRun, "dry-run", false, "check the snapshot without replacing the booking state")
+	return cmd
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+	"train-booking-service/dao"
+	"train-booking-service/logging"
+	"train-booking-service/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// LivenessService is the health service name reporting whether the train state still responds.
+const LivenessService = "liveness"
+
+// Define liveness check timing
+const (
+	livenessInterval = 5 * time.Second // How often the train state lock is checked
+	livenessTimeout  = 2 * time.Second // How long the lock may be held before the server is reported as stuck
+)
+
+// healthMethods are the health check methods, which may be called without credentials.
+var healthMethods = []string{
+	healthpb.Health_Check_FullMethodName,
+	healthpb.Health_Watch_FullMethodName,
+}
+
+// healthService serves grpc.health.v1. The overall status ("") and proto.TrainService report readiness:
+// NOT_SERVING until the train state has been loaded and again once shutdown starts. LivenessService
+// reports NOT_SERVING while the train state lock is stuck.
+type healthService struct {
+	*health.Server
+	ready    atomic.Bool
+	stopping chan struct{} // Closed when shutdown starts, ending open Watch streams
+}
+
+// newHealthService initializes a new healthService instance reporting the server as not ready.
+func newHealthService() *healthService {
+	h := &healthService{Server: health.NewServer(), stopping: make(chan struct{})}
+	h.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetServingStatus(proto.TrainService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetServingStatus(LivenessService, healthpb.HealthCheckResponse_SERVING)
+	return h
+}
+
+// setReady reports the server as ready to serve TrainService calls.
+func (h *healthService) setReady() {
+	h.ready.Store(true)
+	h.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	h.SetServingStatus(proto.TrainService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+}
+
+// shutdown reports every service as NOT_SERVING and ends open Watch streams so they do not hold up draining.
+func (h *healthService) shutdown() {
+	h.ready.Store(false)
+	h.Server.Shutdown()
+	close(h.stopping)
+}
+
+// Watch streams status changes of a service until the client goes away or shutdown starts.
+func (h *healthService) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-h.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return h.Server.Watch(req, &watchStream{Health_WatchServer: stream, ctx: ctx})
+}
+
+// watchStream is a Watch stream whose context ends when shutdown starts.
+type watchStream struct {
+	healthpb.Health_WatchServer
+	ctx context.Context
+}
+
+// Context returns the stream context.
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+// watchLiveness periodically checks that the train state lock can be acquired until ctx is done.
+func (h *healthService) watchLiveness(ctx context.Context, trainDAO *dao.TrainDAO) {
+	ticker := time.NewTicker(livenessInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := trainDAO.Ping(livenessTimeout); err != nil {
+				slog.Error("liveness check failed", logging.KeyError, err)
+				h.SetServingStatus(LivenessService, healthpb.HealthCheckResponse_NOT_SERVING)
+				continue
+			}
+			h.SetServingStatus(LivenessService, healthpb.HealthCheckResponse_SERVING)
+		}
+	}
+}
+
+// alwaysAvailable checks if a method is served while the server is not ready.
+func alwaysAvailable(method string) bool {
+	return strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") ||
+		strings.HasPrefix(method, "/"+grpc_reflection_v1.ServerReflection_ServiceDesc.ServiceName+"/") ||
+		strings.HasPrefix(method, "/"+grpc_reflection_v1alpha.ServerReflection_ServiceDesc.ServiceName+"/")
+}
+
+// UnaryServerInterceptor rejects unary calls with Unavailable while the server is not ready.
+func (h *healthService) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !h.ready.Load() && !alwaysAvailable(info.FullMethod) {
+			return nil, status.Error(codes.Unavailable, "server is not ready")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streaming calls with Unavailable while the server is not ready.
+func (h *healthService) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !h.ready.Load() && !alwaysAvailable(info.FullMethod) {
+			return status.Error(codes.Unavailable, "server is not ready")
+		}
+		return handler(srv, stream)
+	}
+}
@@ -1,68 +1,239 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+	"train-booking-service/audit"
+	"train-booking-service/auth"
+	"train-booking-service/config"
 	"train-booking-service/dao"
+	"train-booking-service/gateway"
+	"train-booking-service/logging"
+	"train-booking-service/manifest"
+	"train-booking-service/metrics"
+	"train-booking-service/outbox"
 	"train-booking-service/proto"
-	"google.golang.org/grpc/reflection"
+	"train-booking-service/ratelimit"
+	"train-booking-service/tlsconfig"
+	"train-booking-service/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type TrainServiceServer struct {
 	proto.UnimplementedTrainServiceServer
-	dao *dao.TrainDAO
+	dao         *dao.TrainDAO
+	metrics     *metrics.Metrics
+	audit       *audit.Log
+	maxBookings int // Bookings a caller other than an admin may hold at once, zero for no limit
 }
 
-func NewTrainServiceServer() *TrainServiceServer {
+func NewTrainServiceServer(trainDAO *dao.TrainDAO, serverMetrics *metrics.Metrics, auditLog *audit.Log, maxBookings int) *TrainServiceServer {
 	return &TrainServiceServer{
-		dao: dao.NewTrainDAO(),
+		dao:         trainDAO,
+		metrics:     serverMetrics,
+		audit:       auditLog,
+		maxBookings: maxBookings,
 	}
 }
 
 func (s *TrainServiceServer) PurchaseTicket(ctx context.Context, req *proto.PurchaseTicketRequest) (*proto.TicketPurchaseResponse, error) {
-	log.Printf("PurchaseTicket for User=%s initiated", req.User.Email)
+	logger := logging.FromContext(ctx)
+	logger.Info("purchasing ticket", logging.KeyUser, req.User, "fare_class", req.FareClass, "requested_seat", req.RequestedSeat)
 
-	ticket, err := s.dao.SaveTicket(req.User, req.From, req.To)
+	bookedBy, maxBookings := s.bookingLimit(ctx)
+	ticket, err := s.dao.SaveBookingFor(ctx, req, bookedBy, maxBookings)
+	if errors.Is(err, dao.ErrBookingLimit) {
+		logger.Warn("booking limit reached", "booked_by", bookedBy, "max_bookings", maxBookings)
+		return nil, status.Errorf(codes.ResourceExhausted, "booking limit reached, a caller may hold at most %d bookings", maxBookings)
+	}
 	if err != nil {
-		log.Printf("Error saving ticket for user %s: %v", req.User, err)
+		logger.Warn("could not save ticket", logging.KeyUser, req.User, logging.KeyError, err)
 		return nil, err
 	}
+	logging.Annotate(ctx, logging.BookingReference(ticket.BookingReference))
 
-	log.Printf("Ticket purchased successfully for user %s", req.User)
+	message := "Ticket purchased successfully"
+	if ticket.Seat == "" {
+		message = "Ticket purchased without a seat, a seat will be assigned at check-in if one is available"
+	}
+
+	s.metrics.Purchased(ticket.FareClass)
+	logger.Info("ticket purchased", logging.BookingReference(ticket.BookingReference), "seat", ticket.Seat, "fare_class", ticket.FareClass)
 	return &proto.TicketPurchaseResponse{
 		Ticket:  ticket,
-		Message: "Ticket purchased successfully",
+		Message: message,
 	}, nil
 }
 
+// bookingLimit returns the subject the caller books for and how many bookings it may hold. Staff book for many
+// passengers, often sharing one key across a desk, and are trusted to make any number of bookings; passengers and
+// other callers are limited.
+func (s *TrainServiceServer) bookingLimit(ctx context.Context) (string, int) {
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return "", s.maxBookings
+	}
+	if slices.ContainsFunc(identity.Roles, func(role string) bool { return slices.Contains(staff, role) }) {
+		return identity.Subject, 0
+	}
+	return identity.Subject, s.maxBookings
+}
+
+// maxBulkBookings is the most bookings one BulkPurchase call may make.
+const maxBulkBookings = 1000
+
+func (s *TrainServiceServer) BulkPurchase(stream proto.TrainService_BulkPurchaseServer) error {
+	ctx := stream.Context()
+	logger := logging.FromContext(ctx)
+
+	// Read every booking first, so they are all validated and booked together
+	var options dao.BulkOptions
+	var rows []int32
+	var reqs []*proto.PurchaseTicketRequest
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(reqs) == 0 {
+			options = dao.BulkOptions{DryRun: req.DryRun, AllOrNothing: req.AllOrNothing}
+		}
+		if len(reqs) == maxBulkBookings {
+			return status.Errorf(codes.InvalidArgument, "a bulk purchase may make at most %d bookings", maxBulkBookings)
+		}
+
+		row := req.Row
+		if row == 0 {
+			row = int32(len(reqs) + 1)
+		}
+		rows = append(rows, row)
+		reqs = append(reqs, cmp.Or(req.Ticket, &proto.PurchaseTicketRequest{}))
+	}
+	if len(reqs) == 0 {
+		return status.Error(codes.InvalidArgument, "no bookings to purchase")
+	}
+	logger.Info("purchasing tickets in bulk", "bookings", len(reqs), "dry_run", options.DryRun, "all_or_nothing", options.AllOrNothing)
+
+	// Staff import whole passenger lists, which the booking limit does not cap
+	bookedBy, maxBookings := s.bookingLimit(ctx)
+	results, kept, err := s.dao.SaveBookings(ctx, reqs, bookedBy, maxBookings, options)
+	if err != nil {
+		logger.Error("could not purchase tickets in bulk", logging.KeyError, err)
+		return errorStatus(err)
+	}
+
+	resp := &proto.BulkPurchaseResponse{}
+	for i, result := range results {
+		bulkResult := &proto.BulkPurchaseResult{Row: rows[i]}
+		if result.Err != nil {
+			st := status.Convert(errorStatus(result.Err))
+			bulkResult.Error, bulkResult.Code = st.Message(), st.Code().String()
+			resp.Failed++
+			if !options.DryRun {
+				s.auditBooking(ctx, reqs[i].GetUser().GetEmail(), nil, st.Err())
+			}
+		} else {
+			bulkResult.Ticket = result.Ticket
+			if kept {
+				s.metrics.Purchased(result.Ticket.FareClass)
+				resp.Booked++
+				s.auditBooking(ctx, result.Ticket.User.Email, result.Ticket, nil)
+			}
+		}
+		resp.Results = append(resp.Results, bulkResult)
+	}
+
+	switch {
+	case options.DryRun:
+		resp.Message = fmt.Sprintf("Dry run: %d of %d bookings can be made, nothing was booked", len(reqs)-int(resp.Failed), len(reqs))
+	case !kept:
+		resp.Message = fmt.Sprintf("Nothing was booked: %d of %d bookings failed", resp.Failed, len(reqs))
+	default:
+		resp.Message = fmt.Sprintf("Booked %d of %d bookings", resp.Booked, len(reqs))
+	}
+	logger.Info("tickets purchased in bulk", "booked", resp.Booked, "failed", resp.Failed)
+	return stream.SendAndClose(resp)
+}
+
+// auditBooking records one booking of a bulk purchase in the audit log, as the audit interceptor only records
+// unary calls.
+func (s *TrainServiceServer) auditBooking(ctx context.Context, email string, ticket *proto.TicketReceipt, err error) {
+	if s.audit == nil {
+		return
+	}
+	if err := s.audit.Record(ctx, proto.TrainService_BulkPurchase_FullMethodName, email, nil, ticket, err); err != nil {
+		logging.FromContext(ctx).Error("could not audit call", logging.KeyError, err)
+	}
+}
+
 func (s *TrainServiceServer) GetReceipt(ctx context.Context, req *proto.GetReceiptRequest) (*proto.GetReceiptResponse, error) {
-	log.Printf("GetReceipt: UserEmail=%s", req.UserEmail)
+	logger := logging.FromContext(ctx)
+	logger.Debug("retrieving receipt", logging.KeyEmail, req.UserEmail, "revision", req.Revision)
 
-	ticket, err := s.dao.GetTicket(req.UserEmail)
+	ticket, revision, err := s.dao.TicketRevision(ctx, req.UserEmail, int(req.Revision))
 	if err != nil {
-		log.Printf("Error retrieving ticket for user %s: %v", req.UserEmail, err)
+		logger.Warn("could not retrieve ticket", logging.KeyEmail, req.UserEmail, "revision", req.Revision, logging.KeyError, err)
 		return nil, err
 	}
+	logging.Annotate(ctx, logging.BookingReference(ticket.BookingReference))
 
-	return &proto.GetReceiptResponse{Ticket: ticket}, nil
+	return &proto.GetReceiptResponse{Ticket: ticket, Revision: int32(revision)}, nil
+}
+
+func (s *TrainServiceServer) GetBookingHistory(ctx context.Context, req *proto.GetBookingHistoryRequest) (*proto.GetBookingHistoryResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debug("retrieving booking history", logging.KeyEmail, req.UserEmail, logging.BookingReference(req.BookingReference))
+
+	reference, revisions, err := s.dao.BookingHistory(ctx, req.UserEmail, req.BookingReference)
+	if err != nil {
+		logger.Warn("could not retrieve booking history", logging.KeyEmail, req.UserEmail, logging.BookingReference(req.BookingReference), logging.KeyError, err)
+		return nil, err
+	}
+	logging.Annotate(ctx, logging.BookingReference(reference))
+
+	return &proto.GetBookingHistoryResponse{BookingReference: reference, Revisions: revisions}, nil
 }
 
 func (s *TrainServiceServer) GetUsersBySection(ctx context.Context, req *proto.GetUsersBySectionRequest) (*proto.GetUsersBySectionResponse, error) {
 	// Validate section (e.g., ensure it is a valid string or within allowed sections)
+	logger := logging.FromContext(ctx)
 	if req.Section == "" {
-		log.Printf("Invalid section: %s", req.Section)
+		logger.Warn("invalid section", "section", req.Section)
 		return nil, fmt.Errorf("invalid section: %s", req.Section)
 	}
 
-	log.Printf("GetUsersBySection: Section=%s", req.Section)
+	logger.Debug("listing users by section", "section", req.Section)
 
-	sectionTickets, err := s.dao.GetUsersBySection(req.Section)
+	sectionTickets, err := s.dao.GetUsersBySection(ctx, req.Section)
 	if err != nil {
-		log.Printf("Error fetching users by section %s: %v", req.Section, err)
+		logger.Warn("could not list users by section", "section", req.Section, logging.KeyError, err)
 		return nil, err
 	}
 
@@ -78,55 +249,720 @@ func (s *TrainServiceServer) GetUsersBySection(ctx context.Context, req *proto.G
 }
 
 func (s *TrainServiceServer) ModifySeat(ctx context.Context, req *proto.ModifySeatRequest) (*proto.ModifySeatResponse, error) {
-	log.Printf("ModifySeat: UserEmail=%s, NewSeat=%s", req.UserEmail, req.NewSeat)
+	logger := logging.FromContext(ctx)
+	logger.Info("modifying seat", logging.KeyEmail, req.UserEmail, "new_seat", req.NewSeat)
+
+	// Deallocate the old seat and allocate the new seat, reading the fare difference under the same lock
+	newTicket, fareDifference, err := s.dao.ChangeSeat(ctx, req.UserEmail, req.NewSeat)
+	if err != nil {
+		logger.Warn("could not modify seat", logging.KeyEmail, req.UserEmail, logging.KeyError, err)
+		return nil, err
+	}
+	logging.Annotate(ctx, logging.BookingReference(newTicket.BookingReference))
+
+	s.metrics.Modified()
+	logger.Info("seat modified", logging.BookingReference(newTicket.BookingReference), "seat", newTicket.Seat)
+	return &proto.ModifySeatResponse{
+		NewTicket:      newTicket,
+		Message:        "Seat modified successfully",
+		FareDifference: fareDifference,
+	}, nil
+}
 
-	ticket, err := s.dao.GetTicket(req.UserEmail)
+func (s *TrainServiceServer) RemoveUser(ctx context.Context, req *proto.RemoveUserRequest) (*proto.RemoveUserResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Info("removing user", logging.KeyEmail, req.UserEmail)
+
+	ticket, err := s.dao.GetTicket(ctx, req.UserEmail)
 	if err != nil {
-		log.Printf("Error retrieving ticket for user %s: %v", req.UserEmail, err)
+		logger.Warn("could not retrieve ticket", logging.KeyEmail, req.UserEmail, logging.KeyError, err)
 		return nil, err
 	}
+	logging.Annotate(ctx, logging.BookingReference(ticket.BookingReference))
 
-	// Deallocate the old seat and allocate the new seat
-	if err := s.dao.ModifySeat(ticket.Seat, req.NewSeat, req.UserEmail); err != nil {
-		log.Printf("Error modifying seat for user %s: %v", req.UserEmail, err)
+	deletedTicket, err := s.dao.DeleteTicket(ctx, ticket)
+	if err != nil {
+		logger.Warn("could not delete ticket", logging.BookingReference(ticket.BookingReference), logging.KeyError, err)
 		return nil, err
 	}
 
-	ticket.Seat = req.NewSeat
-	log.Printf("Seat modified successfully for user %s", req.UserEmail)
-	return &proto.ModifySeatResponse{NewTicket: ticket, Message: "Seat modified successfully"}, nil
+	s.metrics.Removed()
+	logger.Info("user removed", logging.BookingReference(deletedTicket.BookingReference))
+	return &proto.RemoveUserResponse{User: deletedTicket.User, Message: "User removed successfully"}, nil
 }
 
-func (s *TrainServiceServer) RemoveUser(ctx context.Context, req *proto.RemoveUserRequest) (*proto.RemoveUserResponse, error) {
-	log.Printf("RemoveUser: UserEmail=%s", req.UserEmail)
+func (s *TrainServiceServer) GetAssistanceManifest(ctx context.Context, req *proto.GetAssistanceManifestRequest) (*proto.GetAssistanceManifestResponse, error) {
+	logging.FromContext(ctx).Debug("building assistance manifest")
+
+	var entries []*proto.AssistanceManifestEntry
+	for _, ticket := range s.dao.GetAssistanceRequests(ctx) {
+		entries = append(entries, &proto.AssistanceManifestEntry{
+			User:           ticket.User,
+			Seat:           ticket.Seat,
+			Assistance:     ticket.Assistance,
+			SeatAttributes: s.dao.SeatAttributes(ticket.Seat),
+		})
+	}
+
+	return &proto.GetAssistanceManifestResponse{Departure: s.departureTime(ctx), Entries: entries}, nil
+}
+
+func (s *TrainServiceServer) ExportManifest(ctx context.Context, req *proto.ExportManifestRequest) (*proto.ExportManifestResponse, error) {
+	logger := logging.FromContext(ctx)
+	format := cmp.Or(req.Format, manifest.FormatCSV)
+	logger.Debug("exporting manifest", "format", format)
+
+	departure := s.departureTime(ctx)
+	m := manifest.Manifest{Departure: departure, GeneratedAt: time.Now().UTC()}
+	bookings := s.dao.GetManifest(ctx)
+	for _, coach := range bookings.Coaches {
+		m.Coaches = append(m.Coaches, &proto.ManifestCoach{
+			Name:      coach.Section.Name,
+			FareClass: coach.Section.Class,
+			Capacity:  int32(coach.Section.Capacity),
+			Entries:   s.manifestEntries(coach.Section.Name, coach.Tickets),
+		})
+	}
+	if len(bookings.Unseated) > 0 {
+		m.Coaches = append(m.Coaches, &proto.ManifestCoach{Entries: s.manifestEntries("", bookings.Unseated)})
+	}
+
+	var data bytes.Buffer
+	if err := manifest.Write(&data, format, m); err != nil {
+		logger.Warn("could not export manifest", "format", format, logging.KeyError, err)
+		return nil, err
+	}
+
+	logger.Info("manifest exported", "format", format, "passengers", m.Passengers())
+	return &proto.ExportManifestResponse{
+		Format:      format,
+		ContentType: manifest.ContentType(format),
+		Data:        data.Bytes(),
+		Departure:   departure,
+		Passengers:  int32(m.Passengers()),
+	}, nil
+}
+
+func (s *TrainServiceServer) ExportSnapshot(ctx context.Context, req *proto.ExportSnapshotRequest) (*proto.ExportSnapshotResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debug("exporting snapshot")
+
+	snapshot := s.dao.Snapshot(ctx)
+	data, checksum, err := dao.EncodeSnapshot(snapshot)
+	if err != nil {
+		logger.Error("could not export snapshot", logging.KeyError, err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	logger.Info("snapshot exported", "tickets", len(snapshot.Tickets), "blocks", len(snapshot.Blocks), "sha256", checksum)
+	return &proto.ExportSnapshotResponse{
+		Data:    data,
+		Sha256:  checksum,
+		Tickets: int32(len(snapshot.Tickets)),
+		Blocks:  int32(len(snapshot.Blocks)),
+	}, nil
+}
+
+func (s *TrainServiceServer) ImportSnapshot(ctx context.Context, req *proto.ImportSnapshotRequest) (*proto.ImportSnapshotResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Info("importing snapshot", "bytes", len(req.Data), "dry_run", req.DryRun)
+
+	snapshot, err := dao.DecodeSnapshot(req.Data)
+	if err != nil {
+		logger.Warn("invalid snapshot", logging.KeyError, err)
+		return nil, err
+	}
+	if err := s.dao.RestoreSnapshot(ctx, snapshot, req.DryRun); err != nil {
+		logger.Warn("could not import snapshot", logging.KeyError, err)
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+
+	resp := &proto.ImportSnapshotResponse{Tickets: int32(len(snapshot.Tickets)), Blocks: int32(len(snapshot.Blocks))}
+	if req.DryRun {
+		resp.Message = fmt.Sprintf("Snapshot of %s is valid: %d tickets and %d blocked seats, nothing was imported", snapshot.CreatedAt, resp.Tickets, resp.Blocks)
+	} else {
+		resp.Message = fmt.Sprintf("Imported the snapshot of %s: %d tickets and %d blocked seats", snapshot.CreatedAt, resp.Tickets, resp.Blocks)
+	}
+	logger.Info("snapshot imported", "tickets", resp.Tickets, "blocks", resp.Blocks, "dry_run", req.DryRun, "created_at", snapshot.CreatedAt)
+	return resp, nil
+}
+
+func (s *TrainServiceServer) QueryAuditLog(ctx context.Context, req *proto.QueryAuditLogRequest) (*proto.QueryAuditLogResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debug("querying audit log", "booking_reference", req.BookingReference, logging.KeyEmail, req.UserEmail, "actor", req.Actor, "since", req.Since, "until", req.Until)
+
+	filter := audit.Filter{BookingReference: req.BookingReference, UserEmail: req.UserEmail, Actor: req.Actor}
+	for _, bound := range []struct {
+		name  string
+		value string
+		time  *time.Time
+	}{{"since", req.Since, &filter.Since}, {"until", req.Until, &filter.Until}} {
+		if bound.value == "" {
+			continue
+		}
+		var err error
+		if *bound.time, err = time.Parse(time.RFC3339, bound.value); err != nil {
+			logger.Warn("invalid audit query time", bound.name, bound.value, logging.KeyError, err)
+			return nil, fmt.Errorf("invalid %s %s, expected RFC 3339", bound.name, bound.value)
+		}
+	}
+
+	return &proto.QueryAuditLogResponse{Entries: s.audit.Query(filter)}, nil
+}
 
-	ticket, err := s.dao.GetTicket(req.UserEmail)
+// manifestEntries describes the tickets seated in a coach as entries of the passenger manifest.
+func (s *TrainServiceServer) manifestEntries(coach string, tickets []*proto.TicketReceipt) []*proto.ManifestEntry {
+	entries := []*proto.ManifestEntry{}
+	for _, ticket := range tickets {
+		entries = append(entries, &proto.ManifestEntry{
+			Coach:            coach,
+			Seat:             ticket.Seat,
+			FareClass:        ticket.FareClass,
+			BookingReference: ticket.BookingReference,
+			User:             ticket.User,
+			From:             ticket.From,
+			To:               ticket.To,
+			Infants:          ticket.Infants,
+			Assistance:       ticket.Assistance,
+			SeatAttributes:   s.dao.SeatAttributes(ticket.Seat),
+			Status:           ticket.Status,
+			ReseatRequired:   ticket.ReseatRequired,
+		})
+	}
+	return entries
+}
+
+// departureTime returns the scheduled departure time in RFC 3339, or an empty string when none is scheduled.
+func (s *TrainServiceServer) departureTime(ctx context.Context) string {
+	if departureTime := s.dao.Departure(ctx).Time; !departureTime.IsZero() {
+		return departureTime.Format(time.RFC3339)
+	}
+	return ""
+}
+
+func (s *TrainServiceServer) BlockSeats(ctx context.Context, req *proto.BlockSeatsRequest) (*proto.BlockSeatsResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Info("blocking seats", "seats", req.Seats, "section", req.Section, "reason", req.Reason, "expires_at", req.ExpiresAt)
+
+	var expiresAt time.Time
+	if req.ExpiresAt != "" {
+		var err error
+		if expiresAt, err = time.Parse(time.RFC3339, req.ExpiresAt); err != nil {
+			logger.Warn("invalid block expiry", "expires_at", req.ExpiresAt, logging.KeyError, err)
+			return nil, fmt.Errorf("invalid expires_at %s, expected RFC 3339", req.ExpiresAt)
+		}
+	}
+
+	result, err := s.dao.BlockSeats(ctx, req.Seats, req.Section, req.Reason, expiresAt)
+	if err != nil {
+		logger.Warn("could not block seats", logging.KeyError, err)
+		return nil, err
+	}
+
+	logger.Info("seats blocked", "blocked", len(result.Blocks), "reseated", len(result.Reseated), "flagged", len(result.Flagged))
+	return &proto.BlockSeatsResponse{
+		Message:         "Seats blocked successfully",
+		Blocks:          result.Blocks,
+		ReseatedTickets: result.Reseated,
+		FlaggedTickets:  result.Flagged,
+	}, nil
+}
+
+func (s *TrainServiceServer) UnblockSeats(ctx context.Context, req *proto.UnblockSeatsRequest) (*proto.UnblockSeatsResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Info("unblocking seats", "seats", req.Seats, "section", req.Section)
+
+	seats, err := s.dao.UnblockSeats(ctx, req.Seats, req.Section)
 	if err != nil {
-		log.Printf("Error retrieving ticket for user %s: %v", req.UserEmail, err)
+		logger.Warn("could not unblock seats", logging.KeyError, err)
 		return nil, err
 	}
 
-	deletedTicket, err := s.dao.DeleteTicket(ticket)
+	logger.Info("seats unblocked", "unblocked", len(seats))
+	return &proto.UnblockSeatsResponse{Message: "Seats unblocked successfully", Seats: seats}, nil
+}
+
+func (s *TrainServiceServer) ListSeatBlocks(ctx context.Context, req *proto.ListSeatBlocksRequest) (*proto.ListSeatBlocksResponse, error) {
+	logging.FromContext(ctx).Debug("listing seat blocks")
+
+	return &proto.ListSeatBlocksResponse{Blocks: s.dao.ListSeatBlocks(ctx)}, nil
+}
+
+func (s *TrainServiceServer) CheckIn(ctx context.Context, req *proto.CheckInRequest) (*proto.CheckInResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Info("checking in", logging.KeyEmail, req.UserEmail)
+
+	ticket, err := s.dao.CheckIn(ctx, req.UserEmail)
 	if err != nil {
-		log.Printf("Error deleting ticket for user %s: %v", req.UserEmail, err)
+		logger.Warn("could not check in", logging.KeyEmail, req.UserEmail, logging.KeyError, err)
 		return nil, err
 	}
+	logging.Annotate(ctx, logging.BookingReference(ticket.BookingReference))
 
-	log.Printf("User removed successfully: %s", req.UserEmail)
-	return &proto.RemoveUserResponse{User: deletedTicket.User, Message: "User removed successfully"}, nil
+	if ticket.Status == dao.BookingStatusDeniedBoarding {
+		logger.Warn("no seat available, boarding denied", logging.BookingReference(ticket.BookingReference))
+		return &proto.CheckInResponse{Ticket: ticket, Message: "No seat available, boarding denied"}, nil
+	}
+
+	logger.Info("checked in", logging.BookingReference(ticket.BookingReference), "seat", ticket.Seat)
+	return &proto.CheckInResponse{Ticket: ticket, Message: "Checked in successfully"}, nil
+}
+
+func (s *TrainServiceServer) SetDeparture(ctx context.Context, req *proto.SetDepartureRequest) (*proto.SetDepartureResponse, error) {
+	logger := logging.FromContext(ctx)
+	logger.Info("setting departure", "departure_time", req.DepartureTime, "assistance_cutoff", req.AssistanceCutoff, "overbooking_allowance", req.OverbookingAllowance)
+
+	departure := dao.Departure{
+		AssistanceCutoff:     dao.DefaultAssistanceCutoff,
+		OverbookingAllowance: int(req.OverbookingAllowance),
+	}
+	if req.DepartureTime != "" {
+		departureTime, err := time.Parse(time.RFC3339, req.DepartureTime)
+		if err != nil {
+			logger.Warn("invalid departure time", "departure_time", req.DepartureTime, logging.KeyError, err)
+			return nil, fmt.Errorf("invalid departure_time %s, expected RFC 3339", req.DepartureTime)
+		}
+		departure.Time = departureTime
+	}
+	if req.AssistanceCutoff != "" {
+		cutoff, err := time.ParseDuration(req.AssistanceCutoff)
+		if err != nil {
+			logger.Warn("invalid assistance cutoff", "assistance_cutoff", req.AssistanceCutoff, logging.KeyError, err)
+			return nil, fmt.Errorf("invalid assistance_cutoff %s, expected a duration such as 24h", req.AssistanceCutoff)
+		}
+		departure.AssistanceCutoff = cutoff
+	}
+
+	if err := s.dao.SetDeparture(ctx, departure); err != nil {
+		logger.Warn("could not set departure", logging.KeyError, err)
+		return nil, err
+	}
+
+	logger.Info("departure updated")
+	return &proto.SetDepartureResponse{Message: "Departure updated successfully"}, nil
+}
+
+func (s *TrainServiceServer) GetDeniedBoardingReport(ctx context.Context, req *proto.GetDeniedBoardingReportRequest) (*proto.GetDeniedBoardingReportResponse, error) {
+	logging.FromContext(ctx).Debug("building denied boarding report")
+
+	return &proto.GetDeniedBoardingReportResponse{Departure: s.departureTime(ctx), Tickets: s.dao.GetDeniedBoarding(ctx)}, nil
+}
+
+// newAuthenticator builds the authenticator from the JWT key set and API keys files.
+func newAuthenticator(jwksPath, apiKeysPath, issuer, audience string) (*auth.Authenticator, error) {
+	config := auth.Config{Issuer: issuer, Audience: audience, Public: healthMethods}
+	if jwksPath != "" {
+		keySet, err := auth.LoadKeySet(jwksPath)
+		if err != nil {
+			return nil, err
+		}
+		config.KeySet = keySet
+	}
+	if apiKeysPath != "" {
+		apiKeys, err := auth.LoadAPIKeys(apiKeysPath)
+		if err != nil {
+			return nil, err
+		}
+		config.APIKeys = apiKeys
+	}
+	return auth.NewAuthenticator(config)
+}
+
+// newLimiter builds the rate limiter from the rate limit configuration. Health checks are never limited.
+func newLimiter(rateLimit config.RateLimit) (*ratelimit.Limiter, error) {
+	limiterConfig := ratelimit.Config{
+		Caller:  ratelimit.Limit(rateLimit.Caller),
+		IP:      ratelimit.Limit(rateLimit.IP),
+		Methods: make(map[string]ratelimit.Limit),
+		Exempt:  healthMethods,
+	}
+	for name, limit := range rateLimit.Methods {
+		method := "/" + proto.TrainService_ServiceDesc.ServiceName + "/" + name
+		unary := slices.ContainsFunc(proto.TrainService_ServiceDesc.Methods, func(desc grpc.MethodDesc) bool { return desc.MethodName == name })
+		streaming := slices.ContainsFunc(proto.TrainService_ServiceDesc.Streams, func(desc grpc.StreamDesc) bool { return desc.StreamName == name })
+		if !unary && !streaming {
+			return nil, fmt.Errorf("rate limit for unknown method %s", name)
+		}
+		limiterConfig.Methods[method] = ratelimit.Limit(limit)
+	}
+	return ratelimit.New(limiterConfig)
+}
+
+// newDAO builds the train DAO from the layout and storage configuration.
+func newDAO(cfg *config.Config) (*dao.TrainDAO, error) {
+	layout := dao.DefaultLayout()
+	if cfg.LayoutPath != "" {
+		var err error
+		if layout, err = dao.LoadLayout(cfg.LayoutPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var store dao.Store
+	if cfg.Storage.Backend == config.StorageFile {
+		store = dao.NewFileStore(cfg.Storage.Path)
+	}
+	if cfg.Storage.EventsPath != "" {
+		return dao.NewTrainDAOWithEventStore(layout, store, dao.NewFileEventStore(cfg.Storage.EventsPath))
+	}
+	if store != nil {
+		return dao.NewTrainDAOWithStore(layout, store)
+	}
+	return dao.NewTrainDAOWithLayout(layout)
+}
+
+// outboxPollInterval is how often the event log is checked for events to publish.
+const outboxPollInterval = time.Second
+
+// newPublisher builds the publisher of the booking events to the configured sinks, nil when no sink is configured.
+func newPublisher(cfg config.Outbox, trainDAO *dao.TrainDAO) (*outbox.Publisher, error) {
+	var sinks []outbox.Sink
+	if cfg.WebhookURL != "" {
+		sinks = append(sinks, outbox.NewWebhookSink(cfg.WebhookURL, 10*time.Second))
+	}
+	if cfg.File != "" {
+		sinks = append(sinks, outbox.NewFileSink(cfg.File))
+	}
+	if cfg.BrokerDir != "" {
+		sinks = append(sinks, outbox.NewBrokerSink(cfg.BrokerDir))
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return outbox.NewPublisher(trainDAO, sinks, outbox.Config{
+		MaxAttempts:  cfg.MaxAttempts,
+		RetryBackoff: cfg.RetryBackoff.Duration,
+		PollInterval: outboxPollInterval,
+		Dir:          cfg.Dir,
+	})
+}
+
+// Define process exit status constants
+const (
+	exitOK           = 0 // Every in-flight call finished and the state was saved
+	exitError        = 1 // The server failed or the state could not be saved
+	exitDrainTimeout = 2 // The state was saved but calls still running at the shutdown deadline were cancelled
+)
+
+// flushPeriodically writes changes to the store at the given interval until ctx is done.
+func flushPeriodically(ctx context.Context, trainDAO *dao.TrainDAO, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := trainDAO.Flush(); err != nil {
+				slog.Error("could not flush state", logging.KeyError, err)
+			}
+		}
+	}
+}
+
+// shutdown stops accepting new calls on the gRPC server and the gateway, which may be nil, waits up to timeout
+// for in-flight calls to finish, cancelling any still running after that, and saves the state. It returns the
+// exit status of the process.
+func shutdown(server *grpc.Server, gatewayServer *http.Server, trainDAO *dao.TrainDAO, timeout time.Duration) int {
+	slog.Info("shutting down, waiting for in-flight calls to finish", "timeout", timeout)
+	status := exitOK
+
+	var draining sync.WaitGroup
+	draining.Add(1)
+	go func() {
+		defer draining.Done()
+		server.GracefulStop()
+	}()
+	if gatewayServer != nil {
+		draining.Add(1)
+		go func() {
+			defer draining.Done()
+			gatewayServer.Shutdown(context.Background())
+		}()
+	}
+	drained := make(chan struct{})
+	go func() {
+		draining.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		slog.Info("all in-flight calls finished")
+	case <-time.After(timeout):
+		slog.Warn("shutdown deadline exceeded, cancelling the remaining calls")
+		server.Stop()
+		if gatewayServer != nil {
+			gatewayServer.Close()
+		}
+		<-drained
+		status = exitDrainTimeout
+	}
+
+	if err := trainDAO.Flush(); err != nil {
+		slog.Error("could not save state on shutdown", logging.KeyError, err)
+		return exitError
+	}
+	slog.Info("server stopped")
+	return status
+}
+
+// serveMetrics serves the Prometheus metrics at /metrics in the background.
+func serveMetrics(address string, serverMetrics *metrics.Metrics) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", serverMetrics.Handler())
+	metricsServer := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		slog.Info("serving metrics", "address", address, "path", "/metrics")
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("could not serve metrics", logging.KeyError, err)
+		}
+	}()
+	return metricsServer
+}
+
+// fatal logs an error that prevents the server from starting and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.KeyError, err)
+	os.Exit(exitError)
+}
+
+// serveGateway serves the REST gateway in the background, over TLS when tlsConfig is set.
+func serveGateway(address string, restGateway *gateway.Gateway, tlsConfig *tls.Config) *http.Server {
+	gatewayServer := &http.Server{Addr: address, Handler: restGateway, ReadHeaderTimeout: 10 * time.Second}
+	if tlsConfig != nil {
+		gatewayServer.TLSConfig = tlsConfig.Clone()
+	}
+
+	go func() {
+		slog.Info("serving the REST gateway", "address", address, "openapi", gateway.OpenAPIPath)
+		var err error
+		if tlsConfig != nil {
+			err = gatewayServer.ListenAndServeTLS("", "")
+		} else {
+			err = gatewayServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("could not serve the REST gateway", logging.KeyError, err)
+		}
+	}()
+	return gatewayServer
+}
+
+// errorStatus maps the kinds of DAO errors to gRPC status codes. Other errors are invalid requests.
+func errorStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, dao.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, dao.ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, dao.ErrUnavailable):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, dao.ErrBookingLimit):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, dao.ErrNotSaved):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+}
+
+// errorStatusInterceptor gives handler errors a gRPC status code, so callers and the gateway can tell a missing
+// ticket from a full train.
+func errorStatusInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+	return resp, nil
+}
+
+// timeoutInterceptor applies a deadline to unary calls that do not carry a shorter one.
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
 }
 
 func main() {
-	server := grpc.NewServer()
-	proto.RegisterTrainServiceServer(server, NewTrainServiceServer())
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("failed to print configuration: %v", err)
+		}
+		return
+	}
+
+	slog.SetDefault(logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName:  "train-booking-service",
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+	})
+	if err != nil {
+		fatal("could not configure tracing", err)
+	}
+
+	authenticator, err := newAuthenticator(cfg.Auth.JWKS, cfg.Auth.APIKeys, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience)
+	if err != nil {
+		fatal("could not configure authentication", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	healthService := newHealthService()
+	serverMetrics := metrics.New()
+	policy := auth.NewPolicy(accessPolicy, healthMethods, auditDenial)
+
+	rpcLogger := logging.NewRPCLogger(slog.Default(), healthMethods)
+
+	limiter, err := newLimiter(cfg.RateLimit)
+	if err != nil {
+		fatal("could not configure rate limits", err)
+	}
+
+	// The train state is attached once it has been loaded, until then the health service reports
+	// NOT_SERVING and TrainService calls are rejected
+	trainService := NewTrainServiceServer(nil, serverMetrics, nil, cfg.RateLimit.MaxBookings)
+	auditLog, err := audit.NewLog(cfg.Audit.Path, auditRules(trainService))
+	if err != nil {
+		fatal("could not open the audit log", err)
+	}
+	trainService.audit = auditLog
+
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		rpcLogger.UnaryServerInterceptor(),
+		serverMetrics.UnaryServerInterceptor(),
+		healthService.UnaryServerInterceptor(),
+		authenticator.UnaryServerInterceptor(),
+		limiter.UnaryServerInterceptor(),
+		policy.UnaryServerInterceptor(),
+	}
+	if cfg.Timeouts.Request.Duration > 0 {
+		unaryInterceptors = append(unaryInterceptors, timeoutInterceptor(cfg.Timeouts.Request.Duration))
+	}
+	unaryInterceptors = append(unaryInterceptors, auditLog.UnaryServerInterceptor(), errorStatusInterceptor)
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(
+			rpcLogger.StreamServerInterceptor(),
+			serverMetrics.StreamServerInterceptor(),
+			healthService.StreamServerInterceptor(),
+			authenticator.StreamServerInterceptor(),
+			limiter.StreamServerInterceptor(),
+			policy.StreamServerInterceptor(),
+		),
+		grpc.ConnectionTimeout(cfg.Timeouts.Connection.Duration),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLS.Cert != "" {
+		tlsConfig, err = tlsconfig.Server(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.ClientCA)
+		if err != nil {
+			fatal("could not configure TLS", err)
+		}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else {
+		slog.Warn("TLS is not configured, serving cleartext")
+	}
+
+	serverMetrics.RegisterDAO(func() (dao.Stats, bool) {
+		if !healthService.ready.Load() {
+			return dao.Stats{}, false
+		}
+		return trainService.dao.GetStats(), true
+	})
+
+	server := grpc.NewServer(options...)
+	proto.RegisterTrainServiceServer(server, trainService)
+	healthpb.RegisterHealthServer(server, healthService)
 	reflection.Register(server)
-	listener, err := net.Listen("tcp", ":7001")
+	listener, err := net.Listen("tcp", cfg.ListenAddress)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		fatal("could not listen", err)
+	}
+
+	var metricsServer *http.Server
+	if cfg.Metrics.ListenAddress != "" {
+		metricsServer = serveMetrics(cfg.Metrics.ListenAddress, serverMetrics)
+	}
+
+	// The gateway calls the service through the same interceptors as gRPC calls
+	var gatewayServer *http.Server
+	if cfg.Gateway.ListenAddress != "" {
+		restGateway, err := gateway.New(trainService, unaryInterceptors...)
+		if err != nil {
+			fatal("could not configure the REST gateway", err)
+		}
+		gatewayServer = serveGateway(cfg.Gateway.ListenAddress, restGateway, tlsConfig)
 	}
 
-	log.Println("Server is listening on port 7001...")
-	if err := server.Serve(listener); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	slog.Info("server is listening", "address", listener.Addr().String())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	trainDAO, err := newDAO(cfg)
+	if err != nil {
+		slog.Error("could not initialize train state", logging.KeyError, err)
+		server.Stop()
+		os.Exit(exitError)
+	}
+	trainService.dao = trainDAO
+	healthService.setReady()
+	slog.Info("train state loaded, server is ready")
+
+	if cfg.Storage.Backend == config.StorageFile {
+		go flushPeriodically(ctx, trainDAO, cfg.Storage.FlushInterval.Duration)
+	}
+	go healthService.watchLiveness(ctx, trainDAO)
+
+	publisher, err := newPublisher(cfg.Outbox, trainDAO)
+	if err != nil {
+		slog.Error("could not configure event publishing", logging.KeyError, err)
+		server.Stop()
+		os.Exit(exitError)
+	}
+	if publisher != nil {
+		go publisher.Run(ctx)
+	}
+
+	select {
+	case err := <-served:
+		slog.Error("could not serve", logging.KeyError, err)
+		if err := trainDAO.Flush(); err != nil {
+			slog.Error("could not save state", logging.KeyError, err)
+		}
+		os.Exit(exitError)
+	case <-ctx.Done():
+	}
+
+	// Restore the default signal handling so a second signal stops the server immediately
+	stop()
+	healthService.shutdown()
+	status := shutdown(server, gatewayServer, trainDAO, cfg.Timeouts.Shutdown.Duration)
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("could not flush traces", logging.KeyError, err)
 	}
+	os.Exit(status)
 }
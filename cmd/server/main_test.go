@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"train-booking-service/auth"
+	"train-booking-service/dao"
+	"train-booking-service/metrics"
+	"train-booking-service/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestServer returns a server over an empty train whose callers may hold maxBookings bookings.
+func newTestServer(maxBookings int) *TrainServiceServer {
+	return NewTrainServiceServer(dao.NewTrainDAO(), metrics.New(), nil, maxBookings)
+}
+
+// callerContext returns a context authenticated as the given subject with one role.
+func callerContext(subject, role string) context.Context {
+	return auth.NewContext(context.Background(), &auth.Identity{Subject: subject, Email: subject + "@example.com", Roles: []string{role}})
+}
+
+// purchase returns a purchase request for a passenger.
+func purchase(email string) *proto.PurchaseTicketRequest {
+	return &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: email}}
+}
+
+func TestPurchaseTicket_BookingLimit(t *testing.T) {
+	const maxBookings = 2
+	s := newTestServer(maxBookings)
+
+	// Staff sell to many passengers and go past the limit
+	for _, role := range []string{auth.RoleAgent, auth.RoleAdmin} {
+		ctx := callerContext(role+"-desk", role)
+		for i := 0; i <= maxBookings; i++ {
+			_, err := s.PurchaseTicket(ctx, purchase(fmt.Sprintf("%s%d@example.com", role, i)))
+			assert.NoError(t, err)
+		}
+	}
+
+	// Passengers are limited
+	ctx := callerContext("passenger", auth.RolePassenger)
+	for i := 0; i < maxBookings; i++ {
+		_, err := s.PurchaseTicket(ctx, purchase(fmt.Sprintf("passenger%d@example.com", i)))
+		assert.NoError(t, err)
+	}
+	_, err := s.PurchaseTicket(ctx, purchase("passenger@example.com"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+// bulkStream is a BulkPurchase stream sending fixed requests and keeping the response.
+type bulkStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	reqs []*proto.BulkPurchaseRequest
+	resp *proto.BulkPurchaseResponse
+}
+
+func (s *bulkStream) Context() context.Context { return s.ctx }
+
+func (s *bulkStream) Recv() (*proto.BulkPurchaseRequest, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *bulkStream) SendAndClose(resp *proto.BulkPurchaseResponse) error {
+	s.resp = resp
+	return nil
+}
+
+func TestBulkPurchase_BookingLimit(t *testing.T) {
+	const maxBookings = 2
+	s := newTestServer(maxBookings)
+	bulk := func(ctx context.Context, prefix string, allOrNothing bool) *proto.BulkPurchaseResponse {
+		stream := &bulkStream{ctx: ctx}
+		for i := 0; i <= maxBookings; i++ {
+			stream.reqs = append(stream.reqs, &proto.BulkPurchaseRequest{Ticket: purchase(fmt.Sprintf("%s%d@example.com", prefix, i)), AllOrNothing: allOrNothing})
+		}
+		assert.NoError(t, s.BulkPurchase(stream))
+		return stream.resp
+	}
+
+	// An agent imports a passenger list longer than the limit, all or nothing included
+	agent := callerContext("agent-desk", auth.RoleAgent)
+	assert.Equal(t, int32(maxBookings+1), bulk(agent, "group", false).Booked)
+	assert.Equal(t, int32(maxBookings+1), bulk(agent, "tour", true).Booked)
+
+	// Other callers are still limited
+	resp := bulk(callerContext("script", auth.RolePassenger), "script", false)
+	assert.Equal(t, int32(maxBookings), resp.Booked)
+	assert.Equal(t, codes.ResourceExhausted.String(), resp.Results[maxBookings].Code)
+}
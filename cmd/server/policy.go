@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"train-booking-service/audit"
+	"train-booking-service/auth"
+	"train-booking-service/dao"
+	"train-booking-service/logging"
+	"train-booking-service/proto"
+
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// staff are the roles allowed to act on any passenger's booking.
+var staff = []string{auth.RoleAgent, auth.RoleAdmin}
+
+// passengers are the roles allowed to act on their own booking only.
+var passengers = []string{auth.RolePassenger}
+
+// allRoles are the roles of every known caller.
+var allRoles = []string{auth.RolePassenger, auth.RoleAgent, auth.RoleAdmin}
+
+// accessPolicy maps each TrainService method to the roles allowed to call it.
+var accessPolicy = map[string]auth.Rule{
+	proto.TrainService_PurchaseTicket_FullMethodName: {
+		Roles:      staff,
+		OwnerRoles: passengers,
+		Owner:      func(req any) string { return req.(*proto.PurchaseTicketRequest).GetUser().GetEmail() },
+	},
+	proto.TrainService_GetReceipt_FullMethodName: {
+		Roles:      staff,
+		OwnerRoles: passengers,
+		Owner:      func(req any) string { return req.(*proto.GetReceiptRequest).UserEmail },
+	},
+	proto.TrainService_ModifySeat_FullMethodName: {
+		Roles:      staff,
+		OwnerRoles: passengers,
+		Owner:      func(req any) string { return req.(*proto.ModifySeatRequest).UserEmail },
+	},
+	proto.TrainService_RemoveUser_FullMethodName: {
+		Roles:      staff,
+		OwnerRoles: passengers,
+		Owner:      func(req any) string { return req.(*proto.RemoveUserRequest).UserEmail },
+	},
+	proto.TrainService_CheckIn_FullMethodName: {
+		Roles:      staff,
+		OwnerRoles: passengers,
+		Owner:      func(req any) string { return req.(*proto.CheckInRequest).UserEmail },
+	},
+	proto.TrainService_GetBookingHistory_FullMethodName: {
+		Roles:      staff,
+		OwnerRoles: passengers,
+		Owner:      func(req any) string { return req.(*proto.GetBookingHistoryRequest).UserEmail },
+	},
+	proto.TrainService_GetUsersBySection_FullMethodName:              {Roles: staff},
+	proto.TrainService_GetAssistanceManifest_FullMethodName:          {Roles: staff},
+	proto.TrainService_GetDeniedBoardingReport_FullMethodName:        {Roles: staff},
+	proto.TrainService_ListSeatBlocks_FullMethodName:                 {Roles: staff},
+	proto.TrainService_BulkPurchase_FullMethodName:                   {Roles: staff},
+	proto.TrainService_ExportManifest_FullMethodName:                 {Roles: staff},
+	proto.TrainService_BlockSeats_FullMethodName:                     {Roles: []string{auth.RoleAdmin}},
+	proto.TrainService_UnblockSeats_FullMethodName:                   {Roles: []string{auth.RoleAdmin}},
+	proto.TrainService_SetDeparture_FullMethodName:                   {Roles: []string{auth.RoleAdmin}},
+	proto.TrainService_ExportSnapshot_FullMethodName:                 {Roles: []string{auth.RoleAdmin}},
+	proto.TrainService_ImportSnapshot_FullMethodName:                 {Roles: []string{auth.RoleAdmin}},
+	proto.TrainService_QueryAuditLog_FullMethodName:                  {Roles: []string{auth.RoleAdmin}},
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo":      {Roles: allRoles},
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo": {Roles: allRoles},
+}
+
+// auditRules maps each TrainService method changing the booking state to what the audit log records about it.
+// BulkPurchase is recorded by its handler, one entry per booking.
+func auditRules(s *TrainServiceServer) map[string]audit.Rule {
+	// watch records the value a call changes from the changes its DAO operations make under their lock, so a
+	// concurrent call is never taken for part of it. When the call changed nothing, current reads the value as it is
+	type readChange = func(changes *dao.Changes, req any) (before, after protobuf.Message, changed bool)
+	type readCurrent = func(ctx context.Context, req any) protobuf.Message
+	watch := func(read readChange, current readCurrent) func(ctx context.Context, req any) (context.Context, audit.Changed) {
+		return func(ctx context.Context, req any) (context.Context, audit.Changed) {
+			ctx, changes := dao.WithChanges(ctx)
+			return ctx, func(ctx context.Context) (protobuf.Message, protobuf.Message) {
+				if before, after, changed := read(changes, req); changed {
+					return before, after
+				}
+				value := current(ctx, req)
+				return value, value
+			}
+		}
+	}
+	booking := func(target func(req any) string) audit.Rule {
+		return audit.Rule{
+			Target: target,
+			Watch: watch(func(changes *dao.Changes, req any) (protobuf.Message, protobuf.Message, bool) {
+				before, after, changed := changes.Booking(target(req))
+				return before, after, changed
+			}, func(ctx context.Context, req any) protobuf.Message {
+				ticket, err := s.dao.GetTicket(ctx, target(req))
+				if err != nil {
+					return nil
+				}
+				return ticket
+			}),
+		}
+	}
+	blocks := audit.Rule{Watch: watch(func(changes *dao.Changes, req any) (protobuf.Message, protobuf.Message, bool) {
+		before, after, changed := changes.SeatBlocks()
+		return &proto.ListSeatBlocksResponse{Blocks: before}, &proto.ListSeatBlocksResponse{Blocks: after}, changed
+	}, func(ctx context.Context, req any) protobuf.Message {
+		return &proto.ListSeatBlocksResponse{Blocks: s.dao.ListSeatBlocks(ctx)}
+	})}
+	departure := audit.Rule{Watch: watch(func(changes *dao.Changes, req any) (protobuf.Message, protobuf.Message, bool) {
+		before, after, changed := changes.Departure()
+		return departureMessage(before), departureMessage(after), changed
+	}, func(ctx context.Context, req any) protobuf.Message {
+		return departureMessage(s.dao.Departure(ctx))
+	})}
+
+	return map[string]audit.Rule{
+		proto.TrainService_PurchaseTicket_FullMethodName: booking(accessPolicy[proto.TrainService_PurchaseTicket_FullMethodName].Owner),
+		proto.TrainService_ModifySeat_FullMethodName:     booking(accessPolicy[proto.TrainService_ModifySeat_FullMethodName].Owner),
+		proto.TrainService_RemoveUser_FullMethodName:     booking(accessPolicy[proto.TrainService_RemoveUser_FullMethodName].Owner),
+		proto.TrainService_CheckIn_FullMethodName:        booking(accessPolicy[proto.TrainService_CheckIn_FullMethodName].Owner),
+		proto.TrainService_BlockSeats_FullMethodName:     blocks,
+		proto.TrainService_UnblockSeats_FullMethodName:   blocks,
+		proto.TrainService_SetDeparture_FullMethodName:   departure,
+		proto.TrainService_ImportSnapshot_FullMethodName: {},
+	}
+}
+
+// departureMessage describes a departure the way SetDeparture sets it.
+func departureMessage(departure dao.Departure) *proto.SetDepartureRequest {
+	value := &proto.SetDepartureRequest{
+		AssistanceCutoff:     departure.AssistanceCutoff.String(),
+		OverbookingAllowance: int32(departure.OverbookingAllowance),
+	}
+	if !departure.Time.IsZero() {
+		value.DepartureTime = departure.Time.Format(time.RFC3339)
+	}
+	return value
+}
+
+// auditDenial writes an audit record for a call rejected by the access policy. The emails of the caller and
+// the passenger are redacted by the logger like any other.
+func auditDenial(denial auth.Denial) {
+	slog.Warn("authorization denied",
+		slog.Bool("audit", true),
+		slog.String(logging.KeyMethod, denial.Method),
+		slog.String("subject", denial.Subject),
+		slog.String(logging.KeyEmail, denial.Email),
+		slog.Any("roles", denial.Roles),
+		slog.String("target", denial.Target),
+		slog.String("reason", denial.Reason),
+	)
+}
@@ -0,0 +1,493 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Define storage backend constants for type safety
+const (
+	StorageMemory = "memory" // State is lost when the server stops
+	StorageFile   = "file"   // State is kept in a JSON file
+)
+
+// Define log format constants for type safety
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// EnvConfigFile names the environment variable holding the path of the configuration file.
+const EnvConfigFile = "TRAIN_CONFIG"
+
+// Duration is a time.Duration written as a string such as "1m30s" in configuration files.
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// Storage configures where the train state is kept.
+type Storage struct {
+	Backend       string   `json:"backend"`
+	Path          string   `json:"path"`           // State file of the file backend
+	FlushInterval Duration `json:"flush_interval"` // How often changes are written to the state file
+	EventsPath    string   `json:"events_path"`    // Event log the state is rebuilt from, kept in memory when empty
+}
+
+// Audit configures where the audit log is kept.
+type Audit struct {
+	Path string `json:"path"` // JSON Lines file the audit log is appended to, kept in memory when empty
+}
+
+// Outbox configures where booking events are published. Events are published only when a sink is set.
+type Outbox struct {
+	WebhookURL   string   `json:"webhook_url"`   // HTTP endpoint every event is posted to
+	File         string   `json:"file"`          // JSON Lines file every event is appended to
+	BrokerDir    string   `json:"broker_dir"`    // Directory of the local broker topics, one JSON Lines file per event type
+	Dir          string   `json:"dir"`           // Delivery positions and dead letters, kept in memory when empty
+	MaxAttempts  int      `json:"max_attempts"`  // Delivery attempts of an event before it is dead-lettered
+	RetryBackoff Duration `json:"retry_backoff"` // Wait before retrying a delivery, doubling with each attempt
+}
+
+// Auth configures how callers are authenticated.
+type Auth struct {
+	JWKS        string `json:"jwks"`     // Path to the JSON Web Key Set bearer tokens are verified against
+	APIKeys     string `json:"api_keys"` // Path to the JSON file of accepted API keys
+	JWTIssuer   string `json:"jwt_issuer"`
+	JWTAudience string `json:"jwt_audience"`
+}
+
+// TLS configures the server certificate and mutual TLS.
+type TLS struct {
+	Cert     string `json:"cert"`
+	Key      string `json:"key"`
+	ClientCA string `json:"client_ca"` // Enables mutual TLS when set
+}
+
+// Log configures the server log.
+type Log struct {
+	Level  string `json:"level"`  // debug, info, warn or error
+	Format string `json:"format"` // text or json
+}
+
+// Metrics configures the Prometheus metrics endpoint.
+type Metrics struct {
+	ListenAddress string `json:"listen_address"` // HTTP address serving /metrics, empty to disable
+}
+
+// Gateway configures the HTTP/JSON gateway.
+type Gateway struct {
+	ListenAddress string `json:"listen_address"` // HTTP address serving the REST API, empty to disable
+}
+
+// Tracing configures where OpenTelemetry spans are exported.
+type Tracing struct {
+	Exporter     string `json:"exporter"`      // none, stdout or otlp
+	OTLPEndpoint string `json:"otlp_endpoint"` // Collector address of the otlp exporter
+}
+
+// Limit is a token bucket refilled with Rate calls per second and holding up to Burst calls.
+type Limit struct {
+	Rate  float64 `json:"rate"` // Zero disables the limit
+	Burst int     `json:"burst"`
+}
+
+// RateLimit configures how callers are protected against each other.
+type RateLimit struct {
+	Caller      Limit            `json:"caller"`       // Per authenticated caller, across all methods
+	IP          Limit            `json:"ip"`           // Per client IP address, across all methods
+	Methods     map[string]Limit `json:"methods"`      // Per authenticated caller, keyed by TrainService method name
+	MaxBookings int              `json:"max_bookings"` // Bookings a caller may hold at once, zero for no limit
+}
+
+// Timeouts bound how long the server waits on callers.
+type Timeouts struct {
+	Request    Duration `json:"request"`    // Deadline applied to every unary call, zero for none
+	Connection Duration `json:"connection"` // Time allowed for a new connection to complete its handshake
+	Shutdown   Duration `json:"shutdown"`   // Time allowed for in-flight calls to finish when the server stops
+}
+
+// Config is the server configuration.
+type Config struct {
+	ListenAddress string    `json:"listen_address"`
+	Storage       Storage   `json:"storage"`
+	Audit         Audit     `json:"audit"`
+	Outbox        Outbox    `json:"outbox"`
+	LayoutPath    string    `json:"layout_path"` // Train layout file, the default layout is used when empty
+	Auth          Auth      `json:"auth"`
+	TLS           TLS       `json:"tls"`
+	Log           Log       `json:"log"`
+	Metrics       Metrics   `json:"metrics"`
+	Gateway       Gateway   `json:"gateway"`
+	Tracing       Tracing   `json:"tracing"`
+	RateLimit     RateLimit `json:"rate_limit"`
+	Timeouts      Timeouts  `json:"timeouts"`
+
+	// PrintConfig asks for the effective configuration to be printed instead of starting the server
+	PrintConfig bool `json:"-"`
+}
+
+// Default returns the configuration used for settings that are not configured.
+func Default() *Config {
+	return &Config{
+		ListenAddress: ":7001",
+		Storage:       Storage{Backend: StorageMemory, FlushInterval: Duration{5 * time.Second}},
+		Outbox:        Outbox{MaxAttempts: 5, RetryBackoff: Duration{time.Second}},
+		Log:           Log{Level: "info", Format: LogFormatText},
+		Metrics:       Metrics{ListenAddress: ":9090"},
+		Gateway:       Gateway{ListenAddress: ":8080"},
+		Tracing:       Tracing{Exporter: "none", OTLPEndpoint: "localhost:4317"},
+		RateLimit: RateLimit{
+			Caller:      Limit{Rate: 20, Burst: 40},
+			IP:          Limit{Rate: 50, Burst: 100},
+			Methods:     map[string]Limit{"PurchaseTicket": {Rate: 1, Burst: 5}},
+			MaxBookings: 10,
+		},
+		Timeouts: Timeouts{Request: Duration{30 * time.Second}, Connection: Duration{10 * time.Second}, Shutdown: Duration{15 * time.Second}},
+	}
+}
+
+// setting is a configuration value that can be overridden by an environment variable and a flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(config *Config, value string) error
+}
+
+// stringSetting sets a string field.
+func stringSetting(flag, env, usage string, field func(config *Config) *string) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(config *Config, value string) error {
+		*field(config) = value
+		return nil
+	}}
+}
+
+// durationSetting sets a duration field.
+func durationSetting(flag, env, usage string, field func(config *Config) *Duration) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(config *Config, value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field(config).Duration = duration
+		return nil
+	}}
+}
+
+// intSetting sets an integer field.
+func intSetting(flag, env, usage string, field func(config *Config) *int) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(config *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(config) = n
+		return nil
+	}}
+}
+
+// limitSetting sets a rate limit written as "rate:burst", such as "20:40".
+func limitSetting(flag, env, usage string, field func(config *Config) *Limit) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(config *Config, value string) error {
+		rate, burst, found := strings.Cut(value, ":")
+		if !found {
+			return fmt.Errorf("rate limit must be written as rate:burst")
+		}
+		var limit Limit
+		var err error
+		if limit.Rate, err = strconv.ParseFloat(rate, 64); err != nil {
+			return err
+		}
+		if limit.Burst, err = strconv.Atoi(burst); err != nil {
+			return err
+		}
+		*field(config) = limit
+		return nil
+	}}
+}
+
+// settings lists every setting in the order they are documented.
+var settings = []setting{
+	stringSetting("listen", "TRAIN_LISTEN_ADDRESS", "Address the gRPC server listens on",
+		func(c *Config) *string { return &c.ListenAddress }),
+	stringSetting("storage", "TRAIN_STORAGE_BACKEND", "Storage backend: memory or file",
+		func(c *Config) *string { return &c.Storage.Backend }),
+	stringSetting("storage-path", "TRAIN_STORAGE_PATH", "State file of the file storage backend",
+		func(c *Config) *string { return &c.Storage.Path }),
+	durationSetting("storage-flush-interval", "TRAIN_STORAGE_FLUSH_INTERVAL", "How often changes are written to the state file",
+		func(c *Config) *Duration { return &c.Storage.FlushInterval }),
+	stringSetting("storage-events-path", "TRAIN_STORAGE_EVENTS_PATH", "Event log file the state is rebuilt from on startup",
+		func(c *Config) *string { return &c.Storage.EventsPath }),
+	stringSetting("audit-log", "TRAIN_AUDIT_LOG", "File the audit log of changes is appended to",
+		func(c *Config) *string { return &c.Audit.Path }),
+	stringSetting("outbox-webhook", "TRAIN_OUTBOX_WEBHOOK_URL", "HTTP endpoint booking events are posted to",
+		func(c *Config) *string { return &c.Outbox.WebhookURL }),
+	stringSetting("outbox-file", "TRAIN_OUTBOX_FILE", "JSON Lines file booking events are appended to",
+		func(c *Config) *string { return &c.Outbox.File }),
+	stringSetting("outbox-broker-dir", "TRAIN_OUTBOX_BROKER_DIR", "Directory of the local broker topics booking events are published on, one file per event type",
+		func(c *Config) *string { return &c.Outbox.BrokerDir }),
+	stringSetting("outbox-dir", "TRAIN_OUTBOX_DIR", "Directory of the event delivery positions and dead letters, kept in memory when empty",
+		func(c *Config) *string { return &c.Outbox.Dir }),
+	intSetting("outbox-max-attempts", "TRAIN_OUTBOX_MAX_ATTEMPTS", "Delivery attempts of a booking event before it is dead-lettered",
+		func(c *Config) *int { return &c.Outbox.MaxAttempts }),
+	durationSetting("outbox-retry-backoff", "TRAIN_OUTBOX_RETRY_BACKOFF", "Wait before retrying the delivery of a booking event, doubling with each attempt",
+		func(c *Config) *Duration { return &c.Outbox.RetryBackoff }),
+	stringSetting("layout", "TRAIN_LAYOUT_PATH", "Path to the JSON train layout, the default layout is used when empty",
+		func(c *Config) *string { return &c.LayoutPath }),
+	stringSetting("jwks", "TRAIN_JWKS", "Path to the JSON Web Key Set bearer tokens are verified against",
+		func(c *Config) *string { return &c.Auth.JWKS }),
+	stringSetting("api-keys", "TRAIN_API_KEYS", "Path to the JSON file of accepted API keys",
+		func(c *Config) *string { return &c.Auth.APIKeys }),
+	stringSetting("jwt-issuer", "TRAIN_JWT_ISSUER", "Issuer bearer tokens must carry, if set",
+		func(c *Config) *string { return &c.Auth.JWTIssuer }),
+	stringSetting("jwt-audience", "TRAIN_JWT_AUDIENCE", "Audience bearer tokens must carry, if set",
+		func(c *Config) *string { return &c.Auth.JWTAudience }),
+	stringSetting("tls-cert", "TRAIN_TLS_CERT", "Path to the PEM server certificate; enables TLS together with -tls-key",
+		func(c *Config) *string { return &c.TLS.Cert }),
+	stringSetting("tls-key", "TRAIN_TLS_KEY", "Path to the PEM server private key",
+		func(c *Config) *string { return &c.TLS.Key }),
+	stringSetting("tls-client-ca", "TRAIN_TLS_CLIENT_CA", "Path to the PEM CA certificates client certificates must be signed by; enables mutual TLS",
+		func(c *Config) *string { return &c.TLS.ClientCA }),
+	stringSetting("log-level", "TRAIN_LOG_LEVEL", "Log level: debug, info, warn or error",
+		func(c *Config) *string { return &c.Log.Level }),
+	stringSetting("log-format", "TRAIN_LOG_FORMAT", "Log format: text or json",
+		func(c *Config) *string { return &c.Log.Format }),
+	stringSetting("metrics-listen", "TRAIN_METRICS_ADDRESS", "HTTP address serving Prometheus metrics at /metrics, empty to disable",
+		func(c *Config) *string { return &c.Metrics.ListenAddress }),
+	stringSetting("gateway-listen", "TRAIN_GATEWAY_ADDRESS", "HTTP address serving the REST API, empty to disable",
+		func(c *Config) *string { return &c.Gateway.ListenAddress }),
+	stringSetting("trace-exporter", "TRAIN_TRACE_EXPORTER", "Where spans are exported: none, stdout or otlp",
+		func(c *Config) *string { return &c.Tracing.Exporter }),
+	stringSetting("otlp-endpoint", "TRAIN_OTLP_ENDPOINT", "OpenTelemetry collector address of the otlp trace exporter",
+		func(c *Config) *string { return &c.Tracing.OTLPEndpoint }),
+	limitSetting("rate-limit-caller", "TRAIN_RATE_LIMIT_CALLER", "Calls per second and burst allowed per authenticated caller, as rate:burst, 0:0 to disable",
+		func(c *Config) *Limit { return &c.RateLimit.Caller }),
+	limitSetting("rate-limit-ip", "TRAIN_RATE_LIMIT_IP", "Calls per second and burst allowed per client IP address, as rate:burst, 0:0 to disable",
+		func(c *Config) *Limit { return &c.RateLimit.IP }),
+	intSetting("max-bookings", "TRAIN_MAX_BOOKINGS", "Bookings a caller may hold at once, 0 for no limit; agents and admins are not limited",
+		func(c *Config) *int { return &c.RateLimit.MaxBookings }),
+	durationSetting("request-timeout", "TRAIN_REQUEST_TIMEOUT", "Deadline applied to every unary call, 0 for none",
+		func(c *Config) *Duration { return &c.Timeouts.Request }),
+	durationSetting("connection-timeout", "TRAIN_CONNECTION_TIMEOUT", "Time allowed for a new connection to complete its handshake",
+		func(c *Config) *Duration { return &c.Timeouts.Connection }),
+	durationSetting("shutdown-timeout", "TRAIN_SHUTDOWN_TIMEOUT", "Time allowed for in-flight calls to finish when the server stops",
+		func(c *Config) *Duration { return &c.Timeouts.Shutdown }),
+}
+
+// Load builds the configuration from, in increasing order of precedence, the defaults, the configuration file
+// named by -config or TRAIN_CONFIG, environment variables and command line flags, and validates it.
+func Load(name string, args []string, getenv func(string) string) (*Config, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := flags.String("config", "", "Path to the JSON configuration file (env "+EnvConfigFile+")")
+	printConfig := flags.Bool("print-config", false, "Print the effective configuration as JSON and exit")
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		values[s.flag] = flags.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	config := Default()
+	if *path == "" {
+		*path = getenv(EnvConfigFile)
+	}
+	if *path != "" {
+		if err := config.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err := s.set(config, value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && err == nil {
+				if setErr := s.set(config, *values[s.flag]); setErr != nil {
+					err = fmt.Errorf("invalid -%s: %w", s.flag, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config.PrintConfig = *printConfig
+	return config, nil
+}
+
+// loadFile overlays the settings of a JSON configuration file. Unknown settings are rejected.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read configuration file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("could not parse configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks that the configuration is complete and consistent.
+func (c *Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", c.ListenAddress, err)
+	}
+
+	switch c.Storage.Backend {
+	case StorageMemory:
+	case StorageFile:
+		if c.Storage.Path == "" {
+			return fmt.Errorf("the file storage backend needs a state file path")
+		}
+		if c.Storage.FlushInterval.Duration <= 0 {
+			return fmt.Errorf("storage flush interval must be positive")
+		}
+	default:
+		return fmt.Errorf("invalid storage backend %q, must be %s or %s", c.Storage.Backend, StorageMemory, StorageFile)
+	}
+
+	if c.Outbox.WebhookURL != "" {
+		if u, err := url.Parse(c.Outbox.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid outbox webhook URL %q, must be an http or https URL", c.Outbox.WebhookURL)
+		}
+	}
+	// Events not delivered yet must survive a restart, and the delivery positions are event sequences, which start
+	// over when the event log is not kept
+	if c.Outbox.WebhookURL != "" || c.Outbox.File != "" || c.Outbox.BrokerDir != "" || c.Outbox.Dir != "" {
+		if c.Storage.EventsPath == "" {
+			return fmt.Errorf("publishing events needs a storage events path")
+		}
+	}
+	if c.Outbox.MaxAttempts < 1 {
+		return fmt.Errorf("outbox max attempts must be at least 1")
+	}
+	if c.Outbox.RetryBackoff.Duration <= 0 {
+		return fmt.Errorf("outbox retry backoff must be positive")
+	}
+
+	if c.Auth.JWKS == "" && c.Auth.APIKeys == "" {
+		return fmt.Errorf("no JWT key set or API keys configured")
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		return fmt.Errorf("TLS needs both a certificate and a key")
+	}
+	if c.TLS.ClientCA != "" && c.TLS.Cert == "" {
+		return fmt.Errorf("mutual TLS needs a server certificate and key")
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid log level %q, must be debug, info, warn or error", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("invalid log format %q, must be %s or %s", c.Log.Format, LogFormatText, LogFormatJSON)
+	}
+
+	if c.Metrics.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.ListenAddress); err != nil {
+			return fmt.Errorf("invalid metrics listen address %q: %w", c.Metrics.ListenAddress, err)
+		}
+	}
+
+	if c.Gateway.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Gateway.ListenAddress); err != nil {
+			return fmt.Errorf("invalid gateway listen address %q: %w", c.Gateway.ListenAddress, err)
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.OTLPEndpoint == "" {
+			return fmt.Errorf("the otlp trace exporter needs a collector endpoint")
+		}
+	default:
+		return fmt.Errorf("invalid trace exporter %q, must be none, stdout or otlp", c.Tracing.Exporter)
+	}
+
+	limits := map[string]Limit{"caller": c.RateLimit.Caller, "IP": c.RateLimit.IP}
+	for method, limit := range c.RateLimit.Methods {
+		limits[method] = limit
+	}
+	for name, limit := range limits {
+		if limit.Rate < 0 {
+			return fmt.Errorf("invalid %s rate limit: rate must not be negative", name)
+		}
+		if limit.Rate > 0 && limit.Burst < 1 {
+			return fmt.Errorf("invalid %s rate limit: burst must be at least 1", name)
+		}
+	}
+	if c.RateLimit.MaxBookings < 0 {
+		return fmt.Errorf("max bookings must not be negative")
+	}
+
+	if c.Timeouts.Request.Duration < 0 {
+		return fmt.Errorf("request timeout must not be negative")
+	}
+	if c.Timeouts.Connection.Duration <= 0 {
+		return fmt.Errorf("connection timeout must be positive")
+	}
+	if c.Timeouts.Shutdown.Duration <= 0 {
+		return fmt.Errorf("shutdown timeout must be positive")
+	}
+	return nil
+}
+
+// Print writes the configuration as indented JSON.
+func (c *Config) Print(w io.Writer) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
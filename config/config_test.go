@@ -0,0 +1,148 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// env returns a getenv function reading from a map.
+func env(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+// writeFile writes a configuration file to a temporary directory and returns its path.
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	config, err := Load("server", []string{"-api-keys", "keys.json"}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, ":7001", config.ListenAddress)
+	assert.Equal(t, StorageMemory, config.Storage.Backend)
+	assert.Equal(t, "info", config.Log.Level)
+	assert.Equal(t, 30*time.Second, config.Timeouts.Request.Duration)
+	assert.Equal(t, 15*time.Second, config.Timeouts.Shutdown.Duration)
+	assert.Equal(t, "keys.json", config.Auth.APIKeys)
+	assert.Equal(t, ":9090", config.Metrics.ListenAddress)
+	assert.Equal(t, ":8080", config.Gateway.ListenAddress)
+	assert.Equal(t, Limit{Rate: 20, Burst: 40}, config.RateLimit.Caller)
+	assert.Equal(t, Limit{Rate: 1, Burst: 5}, config.RateLimit.Methods["PurchaseTicket"])
+	assert.Equal(t, 10, config.RateLimit.MaxBookings)
+
+	// The metrics endpoint can be disabled
+	config, err = Load("server", []string{"-api-keys", "keys.json", "-metrics-listen", ""}, env(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, config.Metrics.ListenAddress)
+	assert.False(t, config.PrintConfig)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `{
+		"listen_address": ":8001",
+		"storage": {"backend": "file", "path": "/var/lib/train/state.json", "flush_interval": "1s", "events_path": "/var/lib/train/events.jsonl"},
+		"audit": {"path": "/var/lib/train/audit.jsonl"},
+		"auth": {"api_keys": "file-keys.json"},
+		"log": {"level": "debug", "format": "json"},
+		"rate_limit": {"ip": {"rate": 5, "burst": 10}, "methods": {"ModifySeat": {"rate": 2, "burst": 2}}},
+		"timeouts": {"request": "5s"}
+	}`)
+
+	// The file overrides the defaults, environment variables override the file and flags override both
+	config, err := Load("server", []string{"-listen", ":9001", "-rate-limit-caller", "0.5:2", "-print-config"}, env(map[string]string{
+		EnvConfigFile:           path,
+		"TRAIN_LISTEN_ADDRESS":  ":8501",
+		"TRAIN_LOG_LEVEL":       "warn",
+		"TRAIN_REQUEST_TIMEOUT": "2s",
+		"TRAIN_MAX_BOOKINGS":    "3",
+		"TRAIN_OUTBOX_FILE":     "/var/lib/train/outbox.jsonl",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, ":9001", config.ListenAddress)
+	assert.Equal(t, "warn", config.Log.Level)
+	assert.Equal(t, LogFormatJSON, config.Log.Format)
+	assert.Equal(t, 2*time.Second, config.Timeouts.Request.Duration)
+	assert.Equal(t, 10*time.Second, config.Timeouts.Connection.Duration)
+	assert.Equal(t, StorageFile, config.Storage.Backend)
+	assert.Equal(t, time.Second, config.Storage.FlushInterval.Duration)
+	assert.Equal(t, "/var/lib/train/events.jsonl", config.Storage.EventsPath)
+	assert.Equal(t, "/var/lib/train/audit.jsonl", config.Audit.Path)
+	assert.Equal(t, "/var/lib/train/outbox.jsonl", config.Outbox.File)
+	assert.Equal(t, 5, config.Outbox.MaxAttempts)
+	assert.Equal(t, time.Second, config.Outbox.RetryBackoff.Duration)
+	assert.Equal(t, "file-keys.json", config.Auth.APIKeys)
+	assert.Equal(t, Limit{Rate: 0.5, Burst: 2}, config.RateLimit.Caller)
+	assert.Equal(t, Limit{Rate: 5, Burst: 10}, config.RateLimit.IP)
+	assert.Equal(t, Limit{Rate: 2, Burst: 2}, config.RateLimit.Methods["ModifySeat"])
+	assert.Equal(t, Limit{Rate: 1, Burst: 5}, config.RateLimit.Methods["PurchaseTicket"])
+	assert.Equal(t, 3, config.RateLimit.MaxBookings)
+	assert.True(t, config.PrintConfig)
+
+	// The printed configuration can be used as a configuration file
+	var printed bytes.Buffer
+	assert.NoError(t, config.Print(&printed))
+	reloaded, err := Load("server", []string{"-config", writeFile(t, printed.String())}, env(nil))
+	assert.NoError(t, err)
+	reloaded.PrintConfig = true
+	assert.Equal(t, config, reloaded)
+
+	var fields map[string]any
+	assert.NoError(t, json.Unmarshal(printed.Bytes(), &fields))
+	assert.Equal(t, "2s", fields["timeouts"].(map[string]any)["request"])
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	for name, test := range map[string]struct {
+		args []string
+		env  map[string]string
+		file string
+	}{
+		"no credentials":          {args: []string{}},
+		"bad listen address":      {args: []string{"-api-keys", "k", "-listen", "7001"}},
+		"unknown backend":         {args: []string{"-api-keys", "k", "-storage", "postgres"}},
+		"file without path":       {args: []string{"-api-keys", "k", "-storage", "file"}},
+		"zero flush interval":     {args: []string{"-api-keys", "k", "-storage", "file", "-storage-path", "s", "-storage-flush-interval", "0s"}},
+		"cert without key":        {args: []string{"-api-keys", "k", "-tls-cert", "server.crt"}},
+		"client CA without cert":  {args: []string{"-api-keys", "k", "-tls-client-ca", "ca.crt"}},
+		"bad log level":           {args: []string{"-api-keys", "k", "-log-level", "verbose"}},
+		"bad log format":          {args: []string{"-api-keys", "k", "-log-format", "xml"}},
+		"bad trace exporter":      {args: []string{"-api-keys", "k", "-trace-exporter", "jaeger"}},
+		"otlp without endpoint":   {args: []string{"-api-keys", "k", "-trace-exporter", "otlp", "-otlp-endpoint", ""}},
+		"bad metrics address":     {args: []string{"-api-keys", "k", "-metrics-listen", "9090"}},
+		"bad gateway address":     {args: []string{"-api-keys", "k", "-gateway-listen", "8080"}},
+		"bad duration flag":       {args: []string{"-api-keys", "k", "-request-timeout", "soon"}},
+		"negative timeout":        {args: []string{"-api-keys", "k", "-request-timeout", "-1s"}},
+		"zero shutdown timeout":   {args: []string{"-api-keys", "k", "-shutdown-timeout", "0s"}},
+		"bad duration env":        {args: []string{"-api-keys", "k"}, env: map[string]string{"TRAIN_CONNECTION_TIMEOUT": "10"}},
+		"bad rate limit":          {args: []string{"-api-keys", "k", "-rate-limit-ip", "10"}},
+		"zero burst":              {args: []string{"-api-keys", "k", "-rate-limit-caller", "10:0"}},
+		"negative max bookings":   {args: []string{"-api-keys", "k", "-max-bookings", "-1"}},
+		"bad outbox webhook":      {args: []string{"-api-keys", "k", "-outbox-webhook", "crm.example.com/events"}},
+		"outbox dir without log":  {args: []string{"-api-keys", "k", "-outbox-dir", "outbox"}},
+		"outbox sink without log": {args: []string{"-api-keys", "k", "-outbox-file", "events.jsonl"}},
+		"zero outbox attempts":    {args: []string{"-api-keys", "k", "-outbox-max-attempts", "0"}},
+		"zero outbox backoff":     {args: []string{"-api-keys", "k", "-outbox-retry-backoff", "0s"}},
+		"bad method rate limit":   {file: `{"auth": {"api_keys": "k"}, "rate_limit": {"methods": {"GetReceipt": {"rate": -1}}}}`},
+		"unknown flag":            {args: []string{"-api-keys", "k", "-port", "7001"}},
+		"unknown file setting":    {file: `{"auth": {"api_keys": "k"}, "port": 7001}`},
+		"bad file duration":       {file: `{"auth": {"api_keys": "k"}, "timeouts": {"request": 30}}`},
+		"missing file":            {args: []string{"-api-keys", "k", "-config", "missing.json"}},
+	} {
+		args := test.args
+		if test.file != "" {
+			args = append(args, "-config", writeFile(t, test.file))
+		}
+		_, err := Load("server", args, env(test.env))
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,100 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+	"train-booking-service/proto"
+)
+
+// Define seat accessibility attribute constants for type safety
+const (
+	SeatWheelchair = "wheelchair" // Space for a wheelchair user
+	SeatPriority   = "priority"   // Priority seat near the doors for passengers with reduced mobility
+)
+
+// Define assistance type constants for type safety
+const (
+	AssistanceWheelchair = "wheelchair"
+	AssistanceMobility   = "mobility"
+	AssistanceVisual     = "visual"
+	AssistanceHearing    = "hearing"
+	AssistanceOther      = "other"
+)
+
+// DefaultAssistanceCutoff is how long before departure protected seats are released to all passengers.
+const DefaultAssistanceCutoff = 24 * time.Hour
+
+// validateAssistance checks the type of an assistance request.
+func validateAssistance(assistance *proto.AssistanceRequest) error {
+	if assistance == nil {
+		return nil
+	}
+	switch assistance.Type {
+	case AssistanceWheelchair, AssistanceMobility, AssistanceVisual, AssistanceHearing, AssistanceOther:
+		return nil
+	default:
+		return fmt.Errorf("invalid assistance type: %q", assistance.Type)
+	}
+}
+
+// seatNeed returns the seat attribute a passenger with an assistance request should be seated on,
+// or an empty string if they have no special seating needs.
+func seatNeed(assistance *proto.AssistanceRequest) string {
+	switch {
+	case assistance == nil:
+		return ""
+	case assistance.Type == AssistanceWheelchair:
+		return SeatWheelchair
+	default:
+		return SeatPriority
+	}
+}
+
+// hasAttribute checks if a seat is flagged with an accessibility attribute.
+func (dao *TrainDAO) hasAttribute(seat, attribute string) bool {
+	return slices.Contains(dao.layout.SeatAttributes[seat], attribute)
+}
+
+// protectionActive checks if seats with accessibility attributes are still held back
+// for passengers who request assistance. Seats stay protected until the cutoff before departure,
+// or indefinitely while no departure is scheduled.
+func (dao *TrainDAO) protectionActive() bool {
+	if dao.departure.Time.IsZero() {
+		return true
+	}
+	return dao.now().Before(dao.departure.Time.Add(-dao.departure.AssistanceCutoff))
+}
+
+// isProtected checks if a seat is held back for passengers who request assistance.
+func (dao *TrainDAO) isProtected(seat string) bool {
+	return len(dao.layout.SeatAttributes[seat]) > 0 && dao.protectionActive()
+}
+
+// canOccupy checks if a passenger with the given assistance request may be seated on a seat.
+func (dao *TrainDAO) canOccupy(seat string, assistance *proto.AssistanceRequest) bool {
+	return assistance != nil || !dao.isProtected(seat)
+}
+
+// GetAssistanceRequests retrieves all tickets with an assistance request, ordered by seat with unseated bookings first.
+func (dao *TrainDAO) GetAssistanceRequests(ctx context.Context) []*proto.TicketReceipt {
+	defer dao.lock(ctx, "GetAssistanceRequests")(nil)
+
+	tickets := []*proto.TicketReceipt{}
+	for _, ticket := range dao.tickets {
+		if ticket.Assistance != nil {
+			tickets = append(tickets, cloneTicket(ticket))
+		}
+	}
+	sort.SliceStable(tickets, func(i, j int) bool {
+		return seatLess(tickets[i].Seat, tickets[j].Seat)
+	})
+	return tickets
+}
+
+// SeatAttributes returns the accessibility attributes of a seat.
+func (dao *TrainDAO) SeatAttributes(seat string) []string {
+	return dao.layout.SeatAttributes[seat]
+}
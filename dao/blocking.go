@@ -0,0 +1,197 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"train-booking-service/proto"
+
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// seatBlock records why and until when an operator took a seat out of service.
+type seatBlock struct {
+	reason    string
+	blockedAt time.Time
+	expiresAt time.Time // Zero when the block does not expire
+}
+
+// BlockResult describes the seats blocked by BlockSeats and the bookings that were on them.
+type BlockResult struct {
+	Blocks   []*proto.SeatBlock
+	Reseated []*proto.TicketReceipt // Bookings moved to another seat in the same fare class
+	Flagged  []*proto.TicketReceipt // Bookings left on a blocked seat because no replacement seat was free
+}
+
+// toProto converts a seat block to its protobuf representation.
+func (block *seatBlock) toProto(seat string) *proto.SeatBlock {
+	expiresAt := ""
+	if !block.expiresAt.IsZero() {
+		expiresAt = block.expiresAt.Format(time.RFC3339)
+	}
+	return &proto.SeatBlock{
+		Seat:      seat,
+		Reason:    block.reason,
+		BlockedAt: block.blockedAt.Format(time.RFC3339),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// seatExists checks if a seat is part of the train layout.
+func (dao *TrainDAO) seatExists(seat string) bool {
+	section := dao.layout.section(sectionOf(seat))
+	if section == nil {
+		return false
+	}
+	n := seatNumber(seat)
+	return n >= 1 && n <= section.Capacity && seat == fmt.Sprintf("%s%v", section.Name, n)
+}
+
+// isBlocked checks if a seat is out of service.
+func (dao *TrainDAO) isBlocked(seat string) bool {
+	block, exists := dao.blocks[seat]
+	return exists && (block.expiresAt.IsZero() || dao.now().Before(block.expiresAt))
+}
+
+// expireBlocks returns seats whose block has expired to service.
+func (dao *TrainDAO) expireBlocks() {
+	for seat := range dao.blocks {
+		if !dao.isBlocked(seat) {
+			dao.unblockSeat(seat)
+		}
+	}
+}
+
+// unblockSeat returns a seat to service and clears the flag on any booking left on it.
+func (dao *TrainDAO) unblockSeat(seat string) {
+	// Applying an unblock cannot fail, it only removes the block and the flag
+	dao.record(&proto.BookingEvent{Type: EventSeatUnblocked, Block: dao.blocks[seat].toProto(seat)})
+}
+
+// resolveSeats validates a list of seats, or expands a section to all of its seats.
+func (dao *TrainDAO) resolveSeats(seats []string, section string) ([]string, error) {
+	if section != "" {
+		if len(seats) > 0 {
+			return nil, fmt.Errorf("either seats or a section must be given, not both")
+		}
+		layoutSection := dao.layout.section(section)
+		if layoutSection == nil {
+			return nil, fmt.Errorf("invalid section: %s", section)
+		}
+		for i := 0; i < layoutSection.Capacity; i++ {
+			seats = append(seats, fmt.Sprintf("%s%v", section, i+1))
+		}
+		return seats, nil
+	}
+
+	if len(seats) == 0 {
+		return nil, fmt.Errorf("no seats or section given")
+	}
+	for _, seat := range seats {
+		if !dao.seatExists(seat) {
+			return nil, fmt.Errorf("invalid seat: %s", seat)
+		}
+	}
+	return seats, nil
+}
+
+// BlockSeats takes seats, or every seat of a section, out of service until they are unblocked or the block expires.
+// A zero expiresAt blocks the seats indefinitely. Bookings on a newly blocked seat are moved to a free seat in
+// the same fare class, or flagged as requiring a new seat when none is free.
+func (dao *TrainDAO) BlockSeats(ctx context.Context, seats []string, section, reason string, expiresAt time.Time) (result *BlockResult, err error) {
+	defer dao.lock(ctx, "BlockSeats")(&err)
+
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to block seats")
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(dao.now()) {
+		return nil, fmt.Errorf("block expiry %s is in the past", expiresAt.Format(time.RFC3339))
+	}
+
+	seats, err = dao.resolveSeats(seats, section)
+	if err != nil {
+		return nil, err
+	}
+
+	dao.expireBlocks()
+
+	// Block every seat first so bookings are not moved onto a seat that is about to be blocked
+	result = &BlockResult{}
+	for _, seat := range seats {
+		block := (&seatBlock{reason: reason, blockedAt: dao.now(), expiresAt: expiresAt}).toProto(seat)
+		if _, err := dao.record(&proto.BookingEvent{Type: EventSeatBlocked, Block: block}); err != nil {
+			return nil, err
+		}
+		result.Blocks = append(result.Blocks, block)
+	}
+
+	for _, seat := range seats {
+		ticket := dao.sections[sectionOf(seat)][seat]
+		if ticket == nil {
+			continue
+		}
+
+		changed := protobuf.Clone(ticket).(*proto.TicketReceipt)
+		event := &proto.BookingEvent{Type: EventReseatRequired, Ticket: changed}
+		if newSeat, err := dao.assignSeat(ticket.FareClass, ticket.Assistance); err != nil {
+			changed.ReseatRequired = true
+		} else {
+			changed.Seat = newSeat
+			changed.ReseatRequired = false
+			event = &proto.BookingEvent{Type: EventSeatChanged, Ticket: changed, PreviousSeat: seat}
+		}
+
+		recorded, err := dao.record(event)
+		if err != nil {
+			return nil, err
+		}
+		if recorded.ReseatRequired {
+			result.Flagged = append(result.Flagged, recorded)
+		} else {
+			result.Reseated = append(result.Reseated, recorded)
+		}
+	}
+	return result, nil
+}
+
+// UnblockSeats returns seats, or every seat of a section, to service and returns the seats that were blocked.
+func (dao *TrainDAO) UnblockSeats(ctx context.Context, seats []string, section string) (unblocked []string, err error) {
+	defer dao.lock(ctx, "UnblockSeats")(&err)
+
+	seats, err = dao.resolveSeats(seats, section)
+	if err != nil {
+		return nil, err
+	}
+
+	dao.expireBlocks()
+
+	unblocked = []string{}
+	for _, seat := range seats {
+		if _, exists := dao.blocks[seat]; exists {
+			dao.unblockSeat(seat)
+			unblocked = append(unblocked, seat)
+		}
+	}
+	return unblocked, nil
+}
+
+// ListSeatBlocks retrieves all seats currently out of service, ordered by seat.
+func (dao *TrainDAO) ListSeatBlocks(ctx context.Context) []*proto.SeatBlock {
+	defer dao.lock(ctx, "ListSeatBlocks")(nil)
+
+	dao.expireBlocks()
+	return dao.seatBlocks()
+}
+
+// seatBlocks lists the seat blocks in seat order.
+func (dao *TrainDAO) seatBlocks() []*proto.SeatBlock {
+	blocks := []*proto.SeatBlock{}
+	for seat, block := range dao.blocks {
+		blocks = append(blocks, block.toProto(seat))
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return seatLess(blocks[i].Seat, blocks[j].Seat)
+	})
+	return blocks
+}
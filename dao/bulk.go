@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"train-booking-service/proto"
+)
+
+// BulkOptions controls how SaveBookings keeps the bookings it makes.
+type BulkOptions struct {
+	DryRun       bool // Keep none of the bookings, only report the seats they would get
+	AllOrNothing bool // Keep none of the bookings unless every one of them succeeds
+}
+
+// BulkResult is the outcome of one booking of SaveBookings: the ticket, or the error that rejected it.
+type BulkResult struct {
+	Ticket *proto.TicketReceipt
+	Err    error
+}
+
+// SaveBookings stores many bookings like SaveBookingFor under a single lock, so no other booking can take a seat
+// between them. Every request is tried in order, each seeing the seats taken by the ones before it, and gets a
+// result. It reports whether the successful bookings were kept: on a dry run, and for an all-or-nothing purchase
+// with a failed booking, they are undone and their tickets only show the seats they would have had. An error means
+// the bookings could not be saved, and none of them were kept.
+func (dao *TrainDAO) SaveBookings(ctx context.Context, reqs []*proto.PurchaseTicketRequest, bookedBy string, maxBookings int, options BulkOptions) (results []BulkResult, kept bool, err error) {
+	defer dao.lock(ctx, "SaveBookings")(&err)
+
+	dirty, sequence, pending, staged := dao.dirty, dao.sequence, len(dao.pending), len(dao.staged)
+	before, history := dao.snapshot(), maps.Clone(dao.history)
+	results = make([]BulkResult, len(reqs))
+	failed := false
+	for i, req := range reqs {
+		results[i].Ticket, results[i].Err = dao.saveBooking(req, bookedBy, maxBookings)
+		failed = failed || results[i].Err != nil
+	}
+	if !options.DryRun && !(options.AllOrNothing && failed) {
+		return results, true, nil
+	}
+
+	// Put back the state, booking histories and sequence from before the bookings and forget their events, including
+	// those of blocks that expired meanwhile, as if they never happened. The tickets keep their seats so they can
+	// still be reported, but lose their booking references as no such bookings exist.
+	for _, result := range results {
+		if result.Err == nil {
+			result.Ticket.BookingReference = ""
+		}
+	}
+	dao.pending, dao.staged = dao.pending[:pending], dao.staged[:staged]
+	if err := dao.restoreSnapshot(before); err != nil {
+		// The events of the bookings are forgotten already, rebuild the state from the events kept instead
+		if rollbackErr := dao.rollback(); rollbackErr != nil {
+			return nil, false, fmt.Errorf("could not undo the bookings: %v, nor rebuild the state: %w", err, rollbackErr)
+		}
+		return results, false, nil
+	}
+	dao.history, dao.sequence, dao.dirty = history, sequence, dirty
+	return results, false, nil
+}
+
+// restoreSnapshot replaces the bookings, seat map, blocks and departure with those of a snapshot taken by the
+// operation holding the lock. The state is left untouched when the snapshot cannot be restored.
+func (dao *TrainDAO) restoreSnapshot(snapshot *proto.Snapshot) error {
+	state, err := snapshotState(snapshot)
+	if err != nil {
+		return err
+	}
+	restored, err := NewTrainDAOWithLayout(dao.layout)
+	if err != nil {
+		return err
+	}
+	if err := restored.restore(state); err != nil {
+		return err
+	}
+	dao.users, dao.tickets, dao.sections, dao.availableSeats = restored.users, restored.tickets, restored.sections, restored.availableSeats
+	dao.blocks, dao.departure = restored.blocks, restored.departure
+	return nil
+}
@@ -0,0 +1,128 @@
+package dao
+
+import (
+	"context"
+	"sync"
+	"train-booking-service/proto"
+)
+
+// Keys of the values a call may change
+const (
+	changeBlocks    = "blocks"
+	changeDeparture = "departure"
+)
+
+type changesKey struct{}
+
+// Changes collects what the DAO operations run with a context change. Each change is read under the lock of the
+// operation making it and kept only once its events are saved, so a caller sees exactly what its own call changed,
+// never a change made by a concurrent call.
+type Changes struct {
+	mu     sync.Mutex
+	values map[string]*change
+}
+
+// change is a value as it was before the first change of a call, and after its last.
+type change struct {
+	before, after any
+}
+
+// stagedChange is a change made by the operation holding the lock, kept once the events of the operation are saved.
+type stagedChange struct {
+	key           string
+	before, after any
+}
+
+// WithChanges returns a copy of ctx whose DAO operations record what they change in the returned Changes.
+func WithChanges(ctx context.Context) (context.Context, *Changes) {
+	changes := &Changes{values: make(map[string]*change)}
+	return context.WithValue(ctx, changesKey{}, changes), changes
+}
+
+// changesFromContext returns the Changes attached to ctx, nil when there are none.
+func changesFromContext(ctx context.Context) *Changes {
+	changes, _ := ctx.Value(changesKey{}).(*Changes)
+	return changes
+}
+
+// keep adds the changes of an operation whose events were saved.
+func (c *Changes) keep(staged []stagedChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range staged {
+		if value, exists := c.values[s.key]; exists {
+			value.after = s.after
+		} else {
+			c.values[s.key] = &change{before: s.before, after: s.after}
+		}
+	}
+}
+
+// get returns a change, and whether the value changed at all.
+func (c *Changes) get(key string) (change, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, changed := c.values[key]
+	if !changed {
+		return change{}, false
+	}
+	return *value, true
+}
+
+// Booking returns a passenger's booking before and after the changes, nil when it did not exist, and whether it
+// changed at all.
+func (c *Changes) Booking(email string) (before, after *proto.TicketReceipt, changed bool) {
+	value, changed := c.get(bookingChange(email))
+	before, _ = value.before.(*proto.TicketReceipt)
+	after, _ = value.after.(*proto.TicketReceipt)
+	return before, after, changed
+}
+
+// SeatBlocks returns the seat blocks before and after the changes, and whether they changed at all.
+func (c *Changes) SeatBlocks() (before, after []*proto.SeatBlock, changed bool) {
+	value, changed := c.get(changeBlocks)
+	before, _ = value.before.([]*proto.SeatBlock)
+	after, _ = value.after.([]*proto.SeatBlock)
+	return before, after, changed
+}
+
+// Departure returns the departure before and after the changes, and whether it changed at all.
+func (c *Changes) Departure() (before, after Departure, changed bool) {
+	value, changed := c.get(changeDeparture)
+	before, _ = value.before.(Departure)
+	after, _ = value.after.(Departure)
+	return before, after, changed
+}
+
+// bookingChange is the key of the changes of a passenger's booking.
+func bookingChange(email string) string {
+	return "booking " + email
+}
+
+// stage reads the value an event is about to change, when the operation holding the lock records its changes. The
+// returned function reads it again once the event is applied and stages the change.
+func (dao *TrainDAO) stage(event *proto.BookingEvent) func() {
+	if dao.changes == nil {
+		return func() {}
+	}
+
+	var key string
+	var read func() any
+	switch event.Type {
+	case EventSeatBlocked, EventSeatUnblocked:
+		key, read = changeBlocks, func() any { return dao.seatBlocks() }
+	case EventDepartureSet:
+		key, read = changeDeparture, func() any { return dao.departure }
+	case EventSnapshotRestored:
+		return func() {}
+	default:
+		email := event.UserEmail
+		key, read = bookingChange(email), func() any { return cloneTicket(dao.tickets[email]) }
+	}
+	before := read()
+	return func() {
+		dao.staged = append(dao.staged, stagedChange{key: key, before: before, after: read()})
+	}
+}
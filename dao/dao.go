@@ -1,195 +1,614 @@
 package dao
 
 import (
+	"context"
 	"fmt"
+	"math/rand/v2"
 	"slices"
 	"sort"
+	"strconv"
 	"sync"
+	"time"
 	"train-booking-service/proto"
+
+	protobuf "google.golang.org/protobuf/proto"
 )
 
 // Define section constants for type safety
 const (
-	SectionA   = "A"
-	SectionB   = "B"
-	SectionCap = 25 // Maximum capacity for Section A and B
+	SectionA      = "A"
+	SectionB      = "B"
+	SectionW      = "W" // Accessible standard class section
+	SectionF      = "F" // First class section
+	SectionS      = "S" // Sleeper section
+	SectionCap    = 25  // Maximum capacity for Section A and B
+	AccessibleCap = 6   // Maximum capacity for Section W
+	FirstClassCap = 12  // Maximum capacity for Section F
+	SleeperCap    = 10  // Maximum capacity for Section S
 )
 
 // TrainDAO is the data access object for managing train seat reservations and user tickets.
 type TrainDAO struct {
 	users          map[string]*proto.User
+	tickets        map[string]*proto.TicketReceipt // Tickets keyed by user email, including unseated bookings
 	sections       map[string]map[string]*proto.TicketReceipt
 	availableSeats map[string][]string
+	layout         Layout
+	sectionClass   map[string]string
+	fares          map[string]float32
+	departure      Departure
+	blocks         map[string]*seatBlock
+	history        map[string][]*proto.BookingRevision // Revisions of every booking, keyed by booking reference
+	store          Store                               // Nil when the state is only kept in memory
+	dirty          bool                                // The state changed since it was last saved to the store
+	events         EventStore
+	sequence       int64                 // Sequence of the last recorded event
+	pending        []*proto.BookingEvent // Recorded events not appended to the event store yet
+	changes        *Changes              // Changes of the operation holding the lock, nil when not recorded
+	staged         []stagedChange        // Changes of the operation holding the lock, kept once its events are saved
+	now            func() time.Time
+	random         func(n int) int // Random number in [0, n), for booking references
 	mu             sync.Mutex
 }
 
-// NewTrainDAO initializes a new TrainDAO instance.
+// NewTrainDAO initializes a new TrainDAO instance with the default layout.
 func NewTrainDAO() *TrainDAO {
-	availableSeats := map[string][]string{
-		SectionA: make([]string, SectionCap),
-		SectionB: make([]string, SectionCap),
+	dao, _ := NewTrainDAOWithLayout(DefaultLayout())
+	return dao
+}
+
+// NewTrainDAOWithLayout initializes a new TrainDAO instance with the given layout.
+func NewTrainDAOWithLayout(layout Layout) (*TrainDAO, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid train layout: %w", err)
+	}
+
+	dao := &TrainDAO{
+		layout:       layout,
+		sectionClass: make(map[string]string),
+		fares:        make(map[string]float32),
+		history:      make(map[string][]*proto.BookingRevision),
+		events:       NewMemoryEventStore(),
+		now:          time.Now,
+		random:       rand.IntN,
 	}
-	for i := 0; i < SectionCap; i++ {
-		availableSeats[SectionA][i] = fmt.Sprintf("%s%v", SectionA, i+1)
-		availableSeats[SectionB][i] = fmt.Sprintf("%s%v", SectionB, i+1)
+	for _, class := range layout.FareClasses {
+		dao.fares[class.Name] = class.Price
 	}
-	return &TrainDAO{
-		users: make(map[string]*proto.User),
-		sections: map[string]map[string]*proto.TicketReceipt{
-			SectionA: make(map[string]*proto.TicketReceipt),
-			SectionB: make(map[string]*proto.TicketReceipt),
-		},
-		availableSeats: availableSeats,
+	for _, section := range layout.Sections {
+		dao.sectionClass[section.Name] = section.Class
 	}
+	dao.reset()
+	return dao, nil
 }
 
-// newUser creates a new user
-func (dao *TrainDAO) newUser(firstName, lastName, email string) *proto.User {
-	dao.users[email] = &proto.User{
-		FirstName: firstName,
-		LastName:  lastName,
-		Email:     email,
+// reset empties the train: no bookings, every seat free, no blocks and no departure scheduled.
+func (dao *TrainDAO) reset() {
+	dao.users = make(map[string]*proto.User)
+	dao.tickets = make(map[string]*proto.TicketReceipt)
+	dao.sections = make(map[string]map[string]*proto.TicketReceipt)
+	dao.availableSeats = make(map[string][]string)
+	dao.departure = Departure{AssistanceCutoff: DefaultAssistanceCutoff}
+	dao.blocks = make(map[string]*seatBlock)
+	for _, section := range dao.layout.Sections {
+		dao.sections[section.Name] = make(map[string]*proto.TicketReceipt)
+		dao.availableSeats[section.Name] = make([]string, section.Capacity)
+		for i := 0; i < section.Capacity; i++ {
+			dao.availableSeats[section.Name][i] = fmt.Sprintf("%s%v", section.Name, i+1)
+		}
+	}
+}
+
+// sectionOf returns the section a seat belongs to.
+func sectionOf(seat string) string {
+	if seat == "" {
+		return ""
 	}
+	return string(seat[0])
+}
+
+// seatNumber returns the numeric part of a seat ID, or 0 if it has none.
+func seatNumber(seat string) int {
+	n, err := strconv.Atoi(seat[len(sectionOf(seat)):])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// seatLess orders seats by section and then by seat number.
+func seatLess(a, b string) bool {
+	if sectionOf(a) != sectionOf(b) {
+		return sectionOf(a) < sectionOf(b)
+	}
+	return seatNumber(a) < seatNumber(b)
+}
+
+// sortSeats keeps the available seats of a section in seat number order, so A2 comes before A10.
+func (dao *TrainDAO) sortSeats(section string) {
+	slices.SortFunc(dao.availableSeats[section], func(a, b string) int {
+		return seatNumber(a) - seatNumber(b)
+	})
+}
 
-	return dao.users[email]
+// normalizeFareClass maps an empty fare class to the standard class.
+func normalizeFareClass(fareClass string) string {
+	if fareClass == "" {
+		return FareClassStandard
+	}
+	return fareClass
 }
 
-// newTicket creates a new ticket
-func (dao *TrainDAO) newTicket(from, to string, user *proto.User, seat string) *proto.TicketReceipt {
-	section := string(seat[0])
+// newUser creates a new user
+func newUser(userDetails *proto.User, passengerType string) *proto.User {
+	return &proto.User{
+		FirstName:     userDetails.FirstName,
+		LastName:      userDetails.LastName,
+		Email:         userDetails.Email,
+		DateOfBirth:   userDetails.DateOfBirth,
+		PassengerType: passengerType,
+		Railcard:      userDetails.Railcard,
+	}
+}
 
+// newTicket creates a new ticket, leaving it unseated when seat is empty. The ticket is booked once it is recorded.
+func (dao *TrainDAO) newTicket(req *proto.PurchaseTicketRequest, user *proto.User, fareClass, seat, concession string, infants []*proto.User) *proto.TicketReceipt {
 	ticket := &proto.TicketReceipt{
-		From:      from,
-		To:        to,
-		User:      user,
-		PricePaid: 20.0,
-		Seat:      seat,
+		From:       req.From,
+		To:         req.To,
+		User:       user,
+		PricePaid:  discountedFare(dao.fares[fareClass], concession),
+		FareClass:  fareClass,
+		Concession: concession,
+		Infants:    infants,
+		Assistance: req.Assistance,
+		Status:     BookingStatusBooked,
+		Seat:       seat,
+	}
+	ticket.BookingReference = dao.newBookingReference()
+	return ticket
+}
+
+// cloneTicket copies a booking, so it can be read once the lock is released while the booking keeps changing. A nil
+// ticket stays nil.
+func cloneTicket(ticket *proto.TicketReceipt) *proto.TicketReceipt {
+	if ticket == nil {
+		return nil
+	}
+	return protobuf.Clone(ticket).(*proto.TicketReceipt)
+}
+
+// bookingReferenceAlphabet leaves out characters that are easily confused, such as 0 and O.
+const bookingReferenceAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// bookingReferenceLength is the number of characters of a booking reference.
+const bookingReferenceLength = 6
+
+// newBookingReference generates a random booking reference that no booking, current or cancelled, has used.
+func (dao *TrainDAO) newBookingReference() string {
+	for {
+		reference := make([]byte, bookingReferenceLength)
+		for i := range reference {
+			reference[i] = bookingReferenceAlphabet[dao.random(len(bookingReferenceAlphabet))]
+		}
+		if !dao.bookingReferenceUsed(string(reference)) {
+			return string(reference)
+		}
+	}
+}
+
+// bookingReferenceUsed reports whether a ticket already has the booking reference, or a cancelled booking had it.
+// A reused reference would add the revisions of the new booking to the history of the old one.
+func (dao *TrainDAO) bookingReferenceUsed(reference string) bool {
+	if _, exists := dao.history[reference]; exists {
+		return true
+	}
+	for _, ticket := range dao.tickets {
+		if ticket.BookingReference == reference {
+			return true
+		}
 	}
+	return false
+}
+
+// allocateSeat places a ticket on its seat and takes the seat out of the available seats of its section. The ticket
+// itself is not changed, it must already hold the seat and the fare class of its section.
+func (dao *TrainDAO) allocateSeat(ticket *proto.TicketReceipt) {
+	seat := ticket.Seat
+	section := sectionOf(seat)
+
 	dao.sections[section][seat] = ticket
 	dao.availableSeats[section] = slices.DeleteFunc(dao.availableSeats[section], func(element string) bool {
 		return element == seat
 	})
-	return ticket
 }
 
-// AssignSeat assigns the next available seat in the least occupied section.
-func (dao *TrainDAO) assignSeat() (string, error) {
-	// Find the section with the least allocated seats
-	section := SectionA
-	if len(dao.sections[SectionA]) > len(dao.sections[SectionB]) {
-		section = SectionB
+// AssignSeat assigns the next available seat in the least occupied section of a fare class.
+// Passengers who request assistance are seated on a seat matching their needs where one is free,
+// other passengers only get seats with accessibility attributes once protection has ended and no other seat is left.
+func (dao *TrainDAO) assignSeat(fareClass string, assistance *proto.AssistanceRequest) (string, error) {
+	switch seatNeed(assistance) {
+	case SeatWheelchair:
+		if seat := dao.findSeat(fareClass, func(seat string) bool { return dao.hasAttribute(seat, SeatWheelchair) }); seat != "" {
+			return seat, nil
+		}
+		return "", errorf(ErrUnavailable, "no wheelchair spaces available in fare class %s", fareClass)
+	case SeatPriority:
+		if seat := dao.findSeat(fareClass, func(seat string) bool { return dao.hasAttribute(seat, SeatPriority) }); seat != "" {
+			return seat, nil
+		}
 	}
 
-	// Check if the section is full
-	if len(dao.sections[section]) == 25 {
-		return "", fmt.Errorf("no available seats in section %s", section)
+	if seat := dao.findSeat(fareClass, func(seat string) bool { return len(dao.layout.SeatAttributes[seat]) == 0 }); seat != "" {
+		return seat, nil
+	}
+	if seat := dao.findSeat(fareClass, func(seat string) bool { return dao.canOccupy(seat, assistance) }); seat != "" {
+		return seat, nil
 	}
 
-	seat := dao.availableSeats[section][0]
-	dao.availableSeats[section] = slices.Delete(dao.availableSeats[section], 0, 1)
-
-	// Mark the seat as allocated
-	dao.sections[section][seat] = nil
+	// The fare class is full
+	return "", errorf(ErrUnavailable, "no available seats in fare class %s", fareClass)
+}
 
-	return seat, nil
+// findSeat returns the first available seat matching a predicate in the least occupied section of a fare class
+// that has one, or an empty string if there is none. Blocked seats never match.
+func (dao *TrainDAO) findSeat(fareClass string, match func(seat string) bool) string {
+	section, seat := "", ""
+	for _, candidate := range dao.layout.Sections {
+		if candidate.Class != fareClass {
+			continue
+		}
+		if section != "" && len(dao.sections[candidate.Name]) >= len(dao.sections[section]) {
+			continue
+		}
+		if i := slices.IndexFunc(dao.availableSeats[candidate.Name], func(seat string) bool {
+			return !dao.isBlocked(seat) && match(seat)
+		}); i >= 0 {
+			section, seat = candidate.Name, dao.availableSeats[candidate.Name][i]
+		}
+	}
+	return seat
 }
 
 // IsSeatAvailable checks if a seat is available in a section.
 func (dao *TrainDAO) isSeatAvailable(seat string) bool {
-	section := string(seat[0]) // Extract section from the seat ID (first character)
+	section := sectionOf(seat) // Extract section from the seat ID (first character)
 	exists := slices.Contains(dao.availableSeats[section], seat)
 	return exists // If seat does not exist, it is available
 }
 
 // ModifySeat allocates a specific seat to a user if it's available.
-func (dao *TrainDAO) ModifySeat(oldSeat, newSeat string, email string) error {
-	dao.mu.Lock()
-	defer dao.mu.Unlock()
+// Moving to a seat in a more expensive fare class charges the fare difference,
+// moving to a cheaper one keeps the original fare. Unseated bookings may use it to pick a seat.
+func (dao *TrainDAO) ModifySeat(ctx context.Context, oldSeat, newSeat string, email string) (err error) {
+	defer dao.lock(ctx, "ModifySeat")(&err)
+
+	ticket, exists := dao.tickets[email]
+	if !exists {
+		return errorf(ErrNotFound, "ticket for user with email %s not found", email)
+	}
+	if ticket.Seat != oldSeat {
+		return fmt.Errorf("user %s does not hold seat %s", email, oldSeat)
+	}
+
+	_, err = dao.modifySeat(ticket, newSeat)
+	return err
+}
 
-	if available := dao.isSeatAvailable(newSeat); !available {
-		return fmt.Errorf("seat %s already booked", newSeat)
+// ChangeSeat moves a user like ModifySeat from whichever seat they hold. It returns the ticket after the move and
+// the fare difference charged for it, both read under the same lock as the move.
+func (dao *TrainDAO) ChangeSeat(ctx context.Context, email, newSeat string) (moved *proto.TicketReceipt, fareDifference float32, err error) {
+	defer dao.lock(ctx, "ChangeSeat")(&err)
+
+	ticket, exists := dao.tickets[email]
+	if !exists {
+		return nil, 0, errorf(ErrNotFound, "ticket for user with email %s not found", email)
+	}
+
+	pricePaid := ticket.PricePaid
+	if moved, err = dao.modifySeat(ticket, newSeat); err != nil {
+		return nil, 0, err
+	}
+	return moved, moved.PricePaid - pricePaid, nil
+}
+
+// modifySeat moves a ticket to a new seat like ModifySeat. The caller must hold the lock.
+func (dao *TrainDAO) modifySeat(ticket *proto.TicketReceipt, newSeat string) (*proto.TicketReceipt, error) {
+	if !dao.seatExists(newSeat) {
+		return nil, fmt.Errorf("invalid seat: %s", newSeat)
+	}
+
+	dao.expireBlocks()
+
+	if err := dao.checkSeat(newSeat, ticket.Assistance); err != nil {
+		return nil, err
 	}
 
-	deletedTicket := dao.deallocateSeat(oldSeat)
+	moved := protobuf.Clone(ticket).(*proto.TicketReceipt)
+	moved.Seat = newSeat
+	moved.FareClass = dao.sectionClass[sectionOf(newSeat)]
+	moved.ReseatRequired = false
+	if moved.Status == BookingStatusDeniedBoarding {
+		moved.Status = BookingStatusCheckedIn
+	}
+
+	if fare := discountedFare(dao.fares[moved.FareClass], moved.Concession); fare > moved.PricePaid {
+		moved.PricePaid = fare
+	}
+
+	return dao.record(&proto.BookingEvent{Type: EventSeatChanged, Ticket: moved, PreviousSeat: ticket.Seat})
+}
 
-	dao.newTicket(deletedTicket.From, deletedTicket.To, deletedTicket.User, newSeat)
+// checkSeat checks that a passenger with the given assistance needs can take an existing seat.
+func (dao *TrainDAO) checkSeat(seat string, assistance *proto.AssistanceRequest) error {
+	if available := dao.isSeatAvailable(seat); !available {
+		return errorf(ErrConflict, "seat %s already booked", seat)
+	}
+
+	if dao.isBlocked(seat) {
+		return errorf(ErrUnavailable, "seat %s is blocked: %s", seat, dao.blocks[seat].reason)
+	}
 
+	if !dao.canOccupy(seat, assistance) {
+		return errorf(ErrUnavailable, "seat %s is reserved for passengers requiring assistance", seat)
+	}
 	return nil
 }
 
-// deallocateSeat deallocates a seat when a user is removed.
+// deallocateSeat releases a seat back to the available seats of its section.
 func (dao *TrainDAO) deallocateSeat(seat string) *proto.TicketReceipt {
-	section := string(seat[0])
+	section := sectionOf(seat)
 	deletedTicket := dao.sections[section][seat]
 	delete(dao.sections[section], seat)
-	delete(dao.users, deletedTicket.User.Email)
 	dao.availableSeats[section] = append(dao.availableSeats[section], seat)
-	slices.Sort(dao.availableSeats[section])
+	dao.sortSeats(section)
 	return deletedTicket
 }
 
-// SaveTicket stores ticket purchase information for a user.
-func (dao *TrainDAO) SaveTicket(userDetails *proto.User, from, to string) (*proto.TicketReceipt, error) {
-	dao.mu.Lock()
-	defer dao.mu.Unlock()
+// SaveTicket stores ticket purchase information for a user in the standard fare class.
+func (dao *TrainDAO) SaveTicket(ctx context.Context, userDetails *proto.User, from, to string) (*proto.TicketReceipt, error) {
+	return dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: from,
+		To:   to,
+		User: userDetails,
+	})
+}
+
+// SaveBooking stores ticket purchase information for the user of a purchase request,
+// assigning a seat in the requested fare class and applying any concession the user is eligible for.
+// Infants on the request travel on the user's lap and do not take a seat. When the fare class is full
+// the booking is confirmed without a seat as long as the departure's overbooking allowance is not used up.
+// A requested seat is booked as is, or the booking is rejected when that seat cannot be taken.
+func (dao *TrainDAO) SaveBooking(ctx context.Context, req *proto.PurchaseTicketRequest) (*proto.TicketReceipt, error) {
+	return dao.SaveBookingFor(ctx, req, "", 0)
+}
+
+// SaveBookingFor stores a booking like SaveBooking on behalf of the caller bookedBy, which is recorded on the
+// ticket. The booking is rejected with ErrBookingLimit when the caller already holds maxBookings bookings,
+// zero means no limit.
+func (dao *TrainDAO) SaveBookingFor(ctx context.Context, req *proto.PurchaseTicketRequest, bookedBy string, maxBookings int) (ticket *proto.TicketReceipt, err error) {
+	defer dao.lock(ctx, "SaveBooking")(&err)
+
+	return dao.saveBooking(req, bookedBy, maxBookings)
+}
+
+// saveBooking stores a booking like SaveBookingFor. The caller must hold the lock.
+func (dao *TrainDAO) saveBooking(req *proto.PurchaseTicketRequest, bookedBy string, maxBookings int) (*proto.TicketReceipt, error) {
+	if maxBookings > 0 && dao.bookingsBy(bookedBy) >= maxBookings {
+		return nil, errorf(ErrBookingLimit, "%s already holds %d bookings", bookedBy, maxBookings)
+	}
 
+	userDetails := req.User
+	if userDetails == nil {
+		return nil, fmt.Errorf("user details are required")
+	}
 	if user, exists := dao.users[userDetails.Email]; exists {
-		return nil, fmt.Errorf("user %s has already booked a ticket", user.Email)
+		return nil, errorf(ErrConflict, "user %s has already booked a ticket", user.Email)
+	}
+
+	fareClass := normalizeFareClass(req.FareClass)
+	if _, ok := dao.fares[fareClass]; !ok {
+		return nil, fmt.Errorf("invalid fare class: %s", req.FareClass)
+	}
+	if req.RequestedSeat != "" {
+		if !dao.seatExists(req.RequestedSeat) {
+			return nil, fmt.Errorf("invalid seat: %s", req.RequestedSeat)
+		}
+		// The requested seat decides the fare class, which must match the one asked for
+		seatClass := dao.sectionClass[sectionOf(req.RequestedSeat)]
+		if req.FareClass != "" && seatClass != fareClass {
+			return nil, fmt.Errorf("seat %s is not in fare class %s", req.RequestedSeat, fareClass)
+		}
+		fareClass = seatClass
+	}
+
+	passengerType, err := resolvePassengerType(userDetails, dao.now())
+	if err != nil {
+		return nil, err
+	}
+	if passengerType == PassengerInfant {
+		return nil, fmt.Errorf("infants cannot book a seat and must travel on an adult's booking")
 	}
 
-	dao.newUser(userDetails.FirstName, userDetails.LastName, userDetails.Email)
+	concession, err := concessionFor(passengerType, userDetails.Railcard)
+	if err != nil {
+		return nil, err
+	}
 
-	seat, err := dao.assignSeat()
+	infants, err := dao.validateInfants(passengerType, req.Infants)
 	if err != nil {
 		return nil, err
 	}
 
-	ticket := dao.newTicket(from, to, userDetails, seat)
-	return ticket, nil
+	if err := validateAssistance(req.Assistance); err != nil {
+		return nil, err
+	}
+
+	dao.expireBlocks()
+
+	seat := req.RequestedSeat
+	if seat != "" {
+		if err := dao.checkSeat(seat, req.Assistance); err != nil {
+			return nil, err
+		}
+	} else if seat, err = dao.assignSeat(fareClass, req.Assistance); err != nil {
+		if dao.unseatedBookings() >= dao.departure.OverbookingAllowance {
+			return nil, err
+		}
+		// Confirm the booking without a seat, one is assigned at check-in if available
+		seat = ""
+	}
+
+	ticket := dao.newTicket(req, newUser(userDetails, passengerType), fareClass, seat, concession, infants)
+	ticket.BookedBy = bookedBy
+	return dao.record(&proto.BookingEvent{Type: EventTicketPurchased, Ticket: ticket})
 }
 
-// DeleteTicket deletes a user's ticket and deallocates their seat.
-func (dao *TrainDAO) DeleteTicket(ticket *proto.TicketReceipt) (*proto.TicketReceipt, error) {
-	dao.mu.Lock()
-	defer dao.mu.Unlock()
+// bookingsBy counts the tickets held by bookings a caller made.
+func (dao *TrainDAO) bookingsBy(bookedBy string) int {
+	count := 0
+	for _, ticket := range dao.tickets {
+		if ticket.BookedBy == bookedBy {
+			count++
+		}
+	}
+	return count
+}
 
-	deletedTicket := dao.deallocateSeat(ticket.Seat)
+// validateInfants checks the infants travelling on a booking and returns them with their passenger type set.
+func (dao *TrainDAO) validateInfants(passengerType string, infants []*proto.User) ([]*proto.User, error) {
+	if len(infants) == 0 {
+		return nil, nil
+	}
+	if passengerType != PassengerAdult && passengerType != PassengerSenior {
+		return nil, fmt.Errorf("infants must travel on an adult's booking")
+	}
+	if len(infants) > MaxInfants {
+		return nil, fmt.Errorf("at most %d infant may travel on one booking", MaxInfants)
+	}
+
+	validated := make([]*proto.User, 0, len(infants))
+	for i, infant := range infants {
+		// Errors name the infant by position, they end up in logs where passenger names must not appear
+		if infant.DateOfBirth == "" {
+			return nil, fmt.Errorf("date of birth is required for infant %d", i+1)
+		}
+		infantType, err := resolvePassengerType(infant, dao.now())
+		if err != nil {
+			return nil, err
+		}
+		if infantType != PassengerInfant {
+			return nil, fmt.Errorf("infant %d is not an infant and needs their own ticket", i+1)
+		}
+		validated = append(validated, &proto.User{
+			FirstName:     infant.FirstName,
+			LastName:      infant.LastName,
+			Email:         infant.Email,
+			DateOfBirth:   infant.DateOfBirth,
+			PassengerType: PassengerInfant,
+		})
+	}
+	return validated, nil
+}
 
-	return deletedTicket, nil
+// DeleteTicket deletes a user's ticket and deallocates their seat.
+func (dao *TrainDAO) DeleteTicket(ctx context.Context, ticket *proto.TicketReceipt) (deleted *proto.TicketReceipt, err error) {
+	defer dao.lock(ctx, "DeleteTicket")(&err)
+
+	deletedTicket, exists := dao.tickets[ticket.User.Email]
+	if !exists {
+		return nil, errorf(ErrNotFound, "ticket for user with email %s not found", ticket.User.Email)
+	}
+	if _, err := dao.record(&proto.BookingEvent{Type: EventTicketCancelled, Ticket: deletedTicket, PreviousSeat: deletedTicket.Seat}); err != nil {
+		return nil, err
+	}
+	return cloneTicket(deletedTicket), nil
 }
 
 // GetTicket retrieves a user's ticket by their email.
-func (dao *TrainDAO) GetTicket(email string) (*proto.TicketReceipt, error) {
-	dao.mu.Lock()
-	defer dao.mu.Unlock()
+func (dao *TrainDAO) GetTicket(ctx context.Context, email string) (*proto.TicketReceipt, error) {
+	defer dao.lock(ctx, "GetTicket")(nil)
 
-	for _, section := range dao.sections {
-		for _, ticket := range section {
-			if ticket.User.Email == email {
-				return ticket, nil
-			}
-		}
+	dao.expireBlocks()
+
+	if ticket, exists := dao.tickets[email]; exists {
+		return cloneTicket(ticket), nil
 	}
-	return nil, fmt.Errorf("ticket for user with email %s not found", email)
+	return nil, errorf(ErrNotFound, "ticket for user with email %s not found", email)
 }
 
 // GetUsersBySection retrieves all users assigned to seats in a given section.
-func (dao *TrainDAO) GetUsersBySection(section string) ([]*proto.TicketReceipt, error) {
-	dao.mu.Lock()
-	defer dao.mu.Unlock()
+func (dao *TrainDAO) GetUsersBySection(ctx context.Context, section string) ([]*proto.TicketReceipt, error) {
+	defer dao.lock(ctx, "GetUsersBySection")(nil)
 
 	// Validate section
-	if section != SectionA && section != SectionB {
+	if _, exists := dao.sections[section]; !exists {
 		return nil, fmt.Errorf("invalid section: %s", section)
 	}
 
 	tickets := []*proto.TicketReceipt{}
 	for _, ticket := range dao.sections[section] {
 		// Only include users who have a ticket
-		tickets = append(tickets, ticket)
+		tickets = append(tickets, cloneTicket(ticket))
 	}
 	sort.SliceStable(tickets, func(i, j int) bool {
-		return tickets[i].Seat < tickets[j].Seat
+		return seatNumber(tickets[i].Seat) < seatNumber(tickets[j].Seat)
 	})
 	return tickets, nil
 }
+
+// Ping checks that the DAO can still serve requests by acquiring its lock within timeout.
+// It returns an error when the lock is held for longer, for example by a stuck operation.
+func (dao *TrainDAO) Ping(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !dao.mu.TryLock() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("train state lock not acquired within %s", timeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	dao.mu.Unlock()
+	return nil
+}
+
+// Stats summarizes the bookings and seat inventory of the train.
+type Stats struct {
+	AvailableSeats map[string]int // Free seats that are not blocked, keyed by section
+	BlockedSeats   map[string]int // Seats out of service, keyed by section
+	TicketsSold    map[string]int // Bookings, keyed by fare class
+	Unseated       int            // Bookings confirmed beyond capacity that are still waiting for a seat
+}
+
+// GetStats retrieves a summary of the bookings and seat inventory. It only reads the state, expired blocks counting
+// as unblocked without being removed, so it records no events and needs no span for every metrics scrape.
+func (dao *TrainDAO) GetStats() Stats {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	stats := Stats{
+		AvailableSeats: make(map[string]int, len(dao.layout.Sections)),
+		BlockedSeats:   make(map[string]int, len(dao.layout.Sections)),
+		TicketsSold:    make(map[string]int, len(dao.layout.FareClasses)),
+		Unseated:       dao.unseatedBookings(),
+	}
+	for _, section := range dao.layout.Sections {
+		for _, seat := range dao.availableSeats[section.Name] {
+			if !dao.isBlocked(seat) {
+				stats.AvailableSeats[section.Name]++
+			}
+		}
+		stats.BlockedSeats[section.Name] = 0
+	}
+	for seat := range dao.blocks {
+		if dao.isBlocked(seat) {
+			stats.BlockedSeats[sectionOf(seat)]++
+		}
+	}
+	for _, class := range dao.layout.FareClasses {
+		stats.TicketsSold[class.Name] = 0
+	}
+	for _, ticket := range dao.tickets {
+		stats.TicketsSold[ticket.FareClass]++
+	}
+	return stats
+}
@@ -1,11 +1,22 @@
 package dao
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 	"train-booking-service/proto"
 
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	protobuf "google.golang.org/protobuf/proto"
 )
 
 func TestNewTrainDAO(t *testing.T) {
@@ -17,8 +28,9 @@ func TestNewTrainDAO(t *testing.T) {
 }
 
 func TestPurchaseTicketSuccessful(t *testing.T) {
+	ctx := context.Background()
 	dao := NewTrainDAO()
-	ticket, err := dao.SaveTicket(&proto.User{
+	ticket, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "John",
 		LastName:  "Doe",
 		Email:     "johndoe@example.com",
@@ -35,8 +47,9 @@ func TestPurchaseTicketSuccessful(t *testing.T) {
 }
 
 func TestPurchaseTicketFailure_SameUserBookingTwoTickets(t *testing.T) {
+	ctx := context.Background()
 	dao := NewTrainDAO()
-	ticket1, err := dao.SaveTicket(&proto.User{
+	ticket1, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "John",
 		LastName:  "Doe",
 		Email:     "johndoe@example.com",
@@ -50,7 +63,7 @@ func TestPurchaseTicketFailure_SameUserBookingTwoTickets(t *testing.T) {
 	assert.Equal(t, "France", ticket1.To)
 	assert.Equal(t, float32(20), ticket1.PricePaid)
 	assert.Equal(t, "A1", ticket1.Seat)
-	_, err = dao.SaveTicket(&proto.User{
+	_, err = dao.SaveTicket(ctx, &proto.User{
 		FirstName: "John",
 		LastName:  "Doe",
 		Email:     "johndoe@example.com",
@@ -59,16 +72,17 @@ func TestPurchaseTicketFailure_SameUserBookingTwoTickets(t *testing.T) {
 }
 
 func TestPurchaseTicketFailure_SeatsFull(t *testing.T) {
+	ctx := context.Background()
 	dao := NewTrainDAO()
 	for i := 0; i < 50; i++ {
-		_, err := dao.SaveTicket(&proto.User{
+		_, err := dao.SaveTicket(ctx, &proto.User{
 			FirstName: "John",
 			LastName:  "Doe",
 			Email:     fmt.Sprintf("johndoe%v@example.com", i),
 		}, "London", "France")
 		assert.NoError(t, err)
 	}
-	_, err := dao.SaveTicket(&proto.User{
+	_, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "John",
 		LastName:  "Doe",
 		Email:     "johndoe@example.com",
@@ -77,8 +91,9 @@ func TestPurchaseTicketFailure_SeatsFull(t *testing.T) {
 }
 
 func TestModifySeat_SuccessfulAllocation(t *testing.T) {
+	ctx := context.Background()
 	dao := NewTrainDAO()
-	oldTicket, err := dao.SaveTicket(&proto.User{
+	oldTicket, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "Alice",
 		LastName:  "Doe",
 		Email:     "alicedoe@example.com",
@@ -93,17 +108,18 @@ func TestModifySeat_SuccessfulAllocation(t *testing.T) {
 	assert.Equal(t, float32(20), oldTicket.PricePaid)
 	assert.Equal(t, "A1", oldTicket.Seat)
 
-	err = dao.ModifySeat(oldTicket.Seat, "B1", oldTicket.User.Email)
+	err = dao.ModifySeat(ctx, oldTicket.Seat, "B1", oldTicket.User.Email)
 	assert.NoError(t, err)
 
-	newTicket, err := dao.GetTicket(oldTicket.User.Email)
+	newTicket, err := dao.GetTicket(ctx, oldTicket.User.Email)
 	assert.NoError(t, err)
 	assert.Equal(t, "B1", newTicket.Seat)
 }
 
 func TestModifySeat_AlreadyAllocated(t *testing.T) {
+	ctx := context.Background()
 	dao := NewTrainDAO()
-	ticket1, err := dao.SaveTicket(&proto.User{
+	ticket1, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "Alice",
 		LastName:  "Doe",
 		Email:     "alicedoe@example.com",
@@ -118,7 +134,7 @@ func TestModifySeat_AlreadyAllocated(t *testing.T) {
 	assert.Equal(t, float32(20), ticket1.PricePaid)
 	assert.Equal(t, "A1", ticket1.Seat)
 
-	ticket2, err := dao.SaveTicket(&proto.User{
+	ticket2, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "John",
 		LastName:  "Doe",
 		Email:     "johndoe@example.com",
@@ -133,13 +149,14 @@ func TestModifySeat_AlreadyAllocated(t *testing.T) {
 	assert.Equal(t, float32(20), ticket2.PricePaid)
 	assert.Equal(t, "B1", ticket2.Seat)
 
-	err = dao.ModifySeat(ticket1.Seat, "B1", ticket1.User.Email)
+	err = dao.ModifySeat(ctx, ticket1.Seat, "B1", ticket1.User.Email)
 	assert.Error(t, err)
 }
 
 func TestDeleteTicket(t *testing.T) {
+	ctx := context.Background()
 	dao := NewTrainDAO()
-	ticket, err := dao.SaveTicket(&proto.User{
+	ticket, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "John",
 		LastName:  "Doe",
 		Email:     "johndoe@example.com",
@@ -154,17 +171,18 @@ func TestDeleteTicket(t *testing.T) {
 	assert.Equal(t, float32(20), ticket.PricePaid)
 	assert.Equal(t, "A1", ticket.Seat)
 
-	deletedTicket, err := dao.DeleteTicket(ticket)
+	deletedTicket, err := dao.DeleteTicket(ctx, ticket)
 	assert.NoError(t, err)
 	assert.Equal(t, ticket.Seat, deletedTicket.Seat)
 
-	_, err = dao.GetTicket(deletedTicket.User.Email)
+	_, err = dao.GetTicket(ctx, deletedTicket.User.Email)
 	assert.Error(t, err)
 }
 
 func TestGetUsersBySection(t *testing.T) {
+	ctx := context.Background()
 	dao := NewTrainDAO()
-	ticket1, err := dao.SaveTicket(&proto.User{
+	ticket1, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "Alice",
 		LastName:  "Doe",
 		Email:     "alicedoe@example.com",
@@ -179,7 +197,7 @@ func TestGetUsersBySection(t *testing.T) {
 	assert.Equal(t, float32(20), ticket1.PricePaid)
 	assert.Equal(t, "A1", ticket1.Seat)
 
-	ticket2, err := dao.SaveTicket(&proto.User{
+	ticket2, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "John",
 		LastName:  "Doe",
 		Email:     "johndoe@example.com",
@@ -194,7 +212,7 @@ func TestGetUsersBySection(t *testing.T) {
 	assert.Equal(t, float32(20), ticket2.PricePaid)
 	assert.Equal(t, "B1", ticket2.Seat)
 
-	ticket3, err := dao.SaveTicket(&proto.User{
+	ticket3, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "Bob",
 		LastName:  "Doe",
 		Email:     "bobdoe@example.com",
@@ -209,7 +227,7 @@ func TestGetUsersBySection(t *testing.T) {
 	assert.Equal(t, float32(20), ticket3.PricePaid)
 	assert.Equal(t, "A2", ticket3.Seat)
 
-	tickets, err := dao.GetUsersBySection(SectionA)
+	tickets, err := dao.GetUsersBySection(ctx, SectionA)
 	assert.NoError(t, err)
 	assert.Len(t, tickets, 2)
 
@@ -218,8 +236,9 @@ func TestGetUsersBySection(t *testing.T) {
 }
 
 func TestGetUsersBySection_InvalidSection(t *testing.T) {
+	ctx := context.Background()
 	dao := NewTrainDAO()
-	ticket1, err := dao.SaveTicket(&proto.User{
+	ticket1, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "Alice",
 		LastName:  "Doe",
 		Email:     "alicedoe@example.com",
@@ -234,7 +253,7 @@ func TestGetUsersBySection_InvalidSection(t *testing.T) {
 	assert.Equal(t, float32(20), ticket1.PricePaid)
 	assert.Equal(t, "A1", ticket1.Seat)
 
-	ticket2, err := dao.SaveTicket(&proto.User{
+	ticket2, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "John",
 		LastName:  "Doe",
 		Email:     "johndoe@example.com",
@@ -249,7 +268,7 @@ func TestGetUsersBySection_InvalidSection(t *testing.T) {
 	assert.Equal(t, float32(20), ticket2.PricePaid)
 	assert.Equal(t, "B1", ticket2.Seat)
 
-	ticket3, err := dao.SaveTicket(&proto.User{
+	ticket3, err := dao.SaveTicket(ctx, &proto.User{
 		FirstName: "Bob",
 		LastName:  "Doe",
 		Email:     "bobdoe@example.com",
@@ -264,6 +283,1467 @@ func TestGetUsersBySection_InvalidSection(t *testing.T) {
 	assert.Equal(t, float32(20), ticket3.PricePaid)
 	assert.Equal(t, "A2", ticket3.Seat)
 
-	_, err = dao.GetUsersBySection("C")
+	_, err = dao.GetUsersBySection(ctx, "C")
 	assert.Error(t, err)
 }
+
+func TestPurchaseTicket_FareClass(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	ticket1, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "Alice",
+			LastName:  "Doe",
+			Email:     "alicedoe@example.com",
+		},
+		FareClass: FareClassFirst,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "F1", ticket1.Seat)
+	assert.Equal(t, FareClassFirst, ticket1.FareClass)
+	assert.Equal(t, float32(45), ticket1.PricePaid)
+
+	ticket2, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+		},
+		FareClass: FareClassSleeper,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "S1", ticket2.Seat)
+	assert.Equal(t, FareClassSleeper, ticket2.FareClass)
+	assert.Equal(t, float32(70), ticket2.PricePaid)
+
+	_, err = dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "Bob",
+			LastName:  "Doe",
+			Email:     "bobdoe@example.com",
+		},
+		FareClass: "economy",
+	})
+	assert.Error(t, err)
+
+	// A failed booking must not leave the user registered
+	ticket3, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "Bob",
+		LastName:  "Doe",
+		Email:     "bobdoe@example.com",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, FareClassStandard, ticket3.FareClass)
+}
+
+func TestPurchaseTicketFailure_FareClassFull(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	for i := 0; i < SleeperCap; i++ {
+		_, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+			From: "London",
+			To:   "France",
+			User: &proto.User{
+				FirstName: "John",
+				LastName:  "Doe",
+				Email:     fmt.Sprintf("johndoe%v@example.com", i),
+			},
+			FareClass: FareClassSleeper,
+		})
+		assert.NoError(t, err)
+	}
+	_, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+		},
+		FareClass: FareClassSleeper,
+	})
+	assert.Error(t, err)
+
+	// Other fare classes keep their own inventory
+	ticket, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "johndoe@example.com",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, "A1", ticket.Seat)
+}
+
+func TestPurchaseTicket_RequestedSeat(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	booking := func(email, fareClass, seat string) *proto.PurchaseTicketRequest {
+		return &proto.PurchaseTicketRequest{
+			From:          "London",
+			To:            "France",
+			User:          &proto.User{FirstName: "John", LastName: "Doe", Email: email},
+			FareClass:     fareClass,
+			RequestedSeat: seat,
+		}
+	}
+
+	// The requested seat is booked, in its fare class
+	ticket, err := dao.SaveBooking(ctx, booking("a@example.com", "", "F3"))
+	assert.NoError(t, err)
+	assert.Equal(t, "F3", ticket.Seat)
+	assert.Equal(t, FareClassFirst, ticket.FareClass)
+	assert.Equal(t, float32(45), ticket.PricePaid)
+	ticket, err = dao.SaveBooking(ctx, booking("b@example.com", FareClassStandard, "A7"))
+	assert.NoError(t, err)
+	assert.Equal(t, "A7", ticket.Seat)
+
+	// A seat that cannot be taken rejects the booking rather than booking another one
+	_, err = dao.SaveBooking(ctx, booking("c@example.com", "", "F3"))
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = dao.SaveBooking(ctx, booking("c@example.com", FareClassFirst, "A8"))
+	assert.EqualError(t, err, "seat A8 is not in fare class first")
+	_, err = dao.SaveBooking(ctx, booking("c@example.com", "", "Z1"))
+	assert.EqualError(t, err, "invalid seat: Z1")
+	_, err = dao.BlockSeats(ctx, []string{"A8"}, "", "Broken recliner", time.Time{})
+	assert.NoError(t, err)
+	_, err = dao.SaveBooking(ctx, booking("c@example.com", "", "A8"))
+	assert.ErrorIs(t, err, ErrUnavailable)
+	_, err = dao.GetTicket(ctx, "c@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestModifySeat_ClassUpgradeAndDowngrade(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	ticket, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "Alice",
+		LastName:  "Doe",
+		Email:     "alicedoe@example.com",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, float32(20), ticket.PricePaid)
+
+	err = dao.ModifySeat(ctx, ticket.Seat, "F3", ticket.User.Email)
+	assert.NoError(t, err)
+
+	upgraded, err := dao.GetTicket(ctx, ticket.User.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, "F3", upgraded.Seat)
+	assert.Equal(t, FareClassFirst, upgraded.FareClass)
+	assert.Equal(t, float32(45), upgraded.PricePaid)
+
+	err = dao.ModifySeat(ctx, upgraded.Seat, "B2", ticket.User.Email)
+	assert.NoError(t, err)
+
+	downgraded, err := dao.GetTicket(ctx, ticket.User.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, "B2", downgraded.Seat)
+	assert.Equal(t, FareClassStandard, downgraded.FareClass)
+	assert.Equal(t, float32(45), downgraded.PricePaid)
+
+	// The user still holds a booking after moving seats
+	_, err = dao.SaveTicket(ctx, &proto.User{
+		FirstName: "Alice",
+		LastName:  "Doe",
+		Email:     "alicedoe@example.com",
+	}, "London", "France")
+	assert.Error(t, err)
+
+	err = dao.ModifySeat(ctx, downgraded.Seat, "Z1", ticket.User.Email)
+	assert.Error(t, err)
+
+	// ChangeSeat moves the ticket from whichever seat it holds and reports the fare difference charged
+	_, err = dao.SaveTicket(ctx, &proto.User{FirstName: "Bob", LastName: "Doe", Email: "bobdoe@example.com"}, "London", "France")
+	assert.NoError(t, err)
+	moved, fareDifference, err := dao.ChangeSeat(ctx, "bobdoe@example.com", "S2")
+	assert.NoError(t, err)
+	assert.Equal(t, "S2", moved.Seat)
+	assert.Equal(t, float32(50), fareDifference)
+	moved, fareDifference, err = dao.ChangeSeat(ctx, "bobdoe@example.com", "A9")
+	assert.NoError(t, err)
+	assert.Equal(t, "A9", moved.Seat)
+	assert.Equal(t, float32(0), fareDifference)
+	_, _, err = dao.ChangeSeat(ctx, "nobody@example.com", "A10")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNewTrainDAOWithLayout_Invalid(t *testing.T) {
+	layout := DefaultLayout()
+	layout.Sections = append(layout.Sections, Section{Name: "C", Class: "economy", Capacity: 10})
+
+	_, err := NewTrainDAOWithLayout(layout)
+	assert.Error(t, err)
+}
+
+func TestPurchaseTicket_Concessions(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	dao.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	child, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName:   "Tim",
+		LastName:    "Doe",
+		Email:       "timdoe@example.com",
+		DateOfBirth: "2014-06-02",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, PassengerChild, child.User.PassengerType)
+	assert.Equal(t, ConcessionChild, child.Concession)
+	assert.Equal(t, float32(10), child.PricePaid)
+
+	senior, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName:   "Ada",
+		LastName:    "Doe",
+		Email:       "adadoe@example.com",
+		DateOfBirth: "1964-06-01",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, PassengerSenior, senior.User.PassengerType)
+	assert.Equal(t, ConcessionSenior, senior.Concession)
+	assert.Equal(t, float32(14), senior.PricePaid)
+
+	// The largest discount wins when a passenger is eligible for more than one concession
+	disabled, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName:   "Bob",
+		LastName:    "Doe",
+		Email:       "bobdoe@example.com",
+		DateOfBirth: "1950-01-01",
+		Railcard:    ConcessionDisability,
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, ConcessionDisability, disabled.Concession)
+	assert.Equal(t, float32(13), disabled.PricePaid)
+
+	student, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "Sam",
+		LastName:  "Doe",
+		Email:     "samdoe@example.com",
+		Railcard:  ConcessionStudent,
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, PassengerAdult, student.User.PassengerType)
+	assert.Equal(t, ConcessionStudent, student.Concession)
+	assert.Equal(t, float32(15), student.PricePaid)
+
+	_, err = dao.SaveTicket(ctx, &proto.User{
+		FirstName:   "Kim",
+		LastName:    "Doe",
+		Email:       "kimdoe@example.com",
+		DateOfBirth: "2014-06-02",
+		Railcard:    ConcessionStudent,
+	}, "London", "France")
+	assert.Error(t, err)
+
+	_, err = dao.SaveTicket(ctx, &proto.User{
+		FirstName:     "Lee",
+		LastName:      "Doe",
+		Email:         "leedoe@example.com",
+		PassengerType: PassengerChild,
+	}, "London", "France")
+	assert.Error(t, err)
+
+	_, err = dao.SaveTicket(ctx, &proto.User{
+		FirstName:     "Lee",
+		LastName:      "Doe",
+		Email:         "leedoe@example.com",
+		DateOfBirth:   "1990-01-01",
+		PassengerType: PassengerSenior,
+	}, "London", "France")
+	assert.Error(t, err)
+
+	// Upgrades charge the discounted fare difference
+	err = dao.ModifySeat(ctx, child.Seat, "F1", child.User.Email)
+	assert.NoError(t, err)
+	upgraded, err := dao.GetTicket(ctx, child.User.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(22.5), upgraded.PricePaid)
+}
+
+func TestPurchaseTicket_Infants(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	dao.now = func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	ticket, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "Alice",
+			LastName:  "Doe",
+			Email:     "alicedoe@example.com",
+		},
+		Infants: []*proto.User{
+			{FirstName: "Baby", LastName: "Doe", DateOfBirth: "2023-01-01"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ticket.Infants, 1)
+	assert.Equal(t, PassengerInfant, ticket.Infants[0].PassengerType)
+	assert.Equal(t, float32(20), ticket.PricePaid)
+
+	// Infants do not consume seats
+	assert.Len(t, dao.availableSeats[SectionA], SectionCap-1)
+	assert.Len(t, dao.availableSeats[SectionB], SectionCap)
+
+	_, err = dao.SaveTicket(ctx, &proto.User{
+		FirstName:   "Baby",
+		LastName:    "Roe",
+		Email:       "babyroe@example.com",
+		DateOfBirth: "2023-01-01",
+	}, "London", "France")
+	assert.Error(t, err)
+
+	_, err = dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+		},
+		Infants: []*proto.User{
+			{FirstName: "Toddler", LastName: "Doe", DateOfBirth: "2020-01-01"},
+		},
+	})
+	assert.EqualError(t, err, "infant 1 is not an infant and needs their own ticket")
+
+	// Errors do not name the infant
+	_, err = dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From:    "London",
+		To:      "France",
+		User:    &proto.User{FirstName: "Jim", LastName: "Doe", Email: "jimdoe@example.com"},
+		Infants: []*proto.User{{FirstName: "Toddler", LastName: "Doe"}},
+	})
+	assert.EqualError(t, err, "date of birth is required for infant 1")
+
+	_, err = dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName:   "Tim",
+			LastName:    "Doe",
+			Email:       "timdoe@example.com",
+			DateOfBirth: "2014-01-01",
+		},
+		Infants: []*proto.User{
+			{FirstName: "Baby", LastName: "Doe", DateOfBirth: "2023-01-01"},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestPurchaseTicket_AssistanceSeating(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+
+	wheelchair, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "Alice",
+			LastName:  "Doe",
+			Email:     "alicedoe@example.com",
+		},
+		Assistance: &proto.AssistanceRequest{Type: AssistanceWheelchair, Notes: "Ramp needed at London"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "W1", wheelchair.Seat)
+
+	visual, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+		},
+		Assistance: &proto.AssistanceRequest{Type: AssistanceVisual},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "W3", visual.Seat)
+
+	_, err = dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "Bob",
+			LastName:  "Doe",
+			Email:     "bobdoe@example.com",
+		},
+		Assistance: &proto.AssistanceRequest{Type: "jetpack"},
+	})
+	assert.Error(t, err)
+
+	// Passengers without assistance are kept off protected seats
+	regular, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "Bob",
+		LastName:  "Doe",
+		Email:     "bobdoe@example.com",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, "A1", regular.Seat)
+
+	err = dao.ModifySeat(ctx, regular.Seat, "W2", regular.User.Email)
+	assert.Error(t, err)
+
+	err = dao.ModifySeat(ctx, visual.Seat, "W2", visual.User.Email)
+	assert.NoError(t, err)
+
+	manifest := dao.GetAssistanceRequests(ctx)
+	assert.Len(t, manifest, 2)
+	assert.Equal(t, "W1", manifest[0].Seat)
+	assert.Equal(t, "W2", manifest[1].Seat)
+	assert.Equal(t, "Ramp needed at London", manifest[0].Assistance.Notes)
+}
+
+func TestPurchaseTicket_AssistanceProtectionCutoff(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	dao.now = func() time.Time { return now }
+	assert.NoError(t, dao.SetDeparture(ctx, Departure{Time: now.Add(48 * time.Hour), AssistanceCutoff: 24 * time.Hour}))
+
+	for i := 0; i < 2*SectionCap; i++ {
+		_, err := dao.SaveTicket(ctx, &proto.User{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     fmt.Sprintf("johndoe%v@example.com", i),
+		}, "London", "France")
+		assert.NoError(t, err)
+	}
+
+	// Protected seats are held back before the cutoff
+	_, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "johndoe@example.com",
+	}, "London", "France")
+	assert.Error(t, err)
+
+	// And released to everyone after it
+	now = now.Add(25 * time.Hour)
+	ticket, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "johndoe@example.com",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, "W1", ticket.Seat)
+}
+
+func TestBlockSeats(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	ticket, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "Alice",
+		LastName:  "Doe",
+		Email:     "alicedoe@example.com",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, "A1", ticket.Seat)
+
+	result, err := dao.BlockSeats(ctx, []string{"A1", "A2"}, "", "Broken recliner", time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, result.Blocks, 2)
+	assert.Len(t, result.Reseated, 1)
+	assert.Empty(t, result.Flagged)
+	assert.Equal(t, "B1", result.Reseated[0].Seat)
+
+	// Blocked seats are neither assigned nor available to move to
+	next, err := dao.SaveTicket(ctx, &proto.User{
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "johndoe@example.com",
+	}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, "A3", next.Seat)
+
+	err = dao.ModifySeat(ctx, next.Seat, "A2", next.User.Email)
+	assert.Error(t, err)
+
+	_, err = dao.BlockSeats(ctx, []string{"A3"}, "", "", time.Time{})
+	assert.Error(t, err)
+	_, err = dao.BlockSeats(ctx, []string{"A99"}, "", "Missing seat", time.Time{})
+	assert.Error(t, err)
+
+	unblocked, err := dao.UnblockSeats(ctx, []string{"A1", "A2", "A4"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A1", "A2"}, unblocked)
+	assert.Empty(t, dao.ListSeatBlocks(ctx))
+
+	err = dao.ModifySeat(ctx, next.Seat, "A2", next.User.Email)
+	assert.NoError(t, err)
+}
+
+func TestBlockSeats_SectionFlagsBookingsWithoutReplacement(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	dao.now = func() time.Time { return now }
+
+	ticket, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "Alice",
+			LastName:  "Doe",
+			Email:     "alicedoe@example.com",
+		},
+		FareClass: FareClassFirst,
+	})
+	assert.NoError(t, err)
+
+	result, err := dao.BlockSeats(ctx, nil, SectionF, "Coach out of service", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, result.Blocks, FirstClassCap)
+	assert.Len(t, result.Flagged, 1)
+	assert.True(t, result.Flagged[0].ReseatRequired)
+	flagged, err := dao.GetTicket(ctx, ticket.User.Email)
+	assert.NoError(t, err)
+	assert.True(t, flagged.ReseatRequired)
+
+	_, err = dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "johndoe@example.com",
+		},
+		FareClass: FareClassFirst,
+	})
+	assert.Error(t, err)
+
+	// Blocks lift on their own once they expire
+	now = now.Add(2 * time.Hour)
+	assert.Empty(t, dao.ListSeatBlocks(ctx))
+	flagged, err = dao.GetTicket(ctx, ticket.User.Email)
+	assert.NoError(t, err)
+	assert.False(t, flagged.ReseatRequired)
+}
+
+func TestOverbooking_DeferredSeatingAndDeniedBoarding(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	assert.NoError(t, dao.SetDeparture(ctx, Departure{AssistanceCutoff: DefaultAssistanceCutoff, OverbookingAllowance: 2}))
+
+	var seated []*proto.TicketReceipt
+	for i := 0; i < SleeperCap; i++ {
+		ticket, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+			From: "London",
+			To:   "France",
+			User: &proto.User{
+				FirstName: "John",
+				LastName:  "Doe",
+				Email:     fmt.Sprintf("johndoe%v@example.com", i),
+			},
+			FareClass: FareClassSleeper,
+		})
+		assert.NoError(t, err)
+		seated = append(seated, ticket)
+	}
+
+	var unseated []*proto.TicketReceipt
+	for _, email := range []string{"alicedoe@example.com", "bobdoe@example.com"} {
+		ticket, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+			From: "London",
+			To:   "France",
+			User: &proto.User{
+				FirstName: "Jane",
+				LastName:  "Doe",
+				Email:     email,
+			},
+			FareClass: FareClassSleeper,
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, ticket.Seat)
+		assert.Equal(t, FareClassSleeper, ticket.FareClass)
+		assert.Equal(t, float32(70), ticket.PricePaid)
+		unseated = append(unseated, ticket)
+	}
+
+	// The allowance is used up
+	_, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From: "London",
+		To:   "France",
+		User: &proto.User{
+			FirstName: "Eve",
+			LastName:  "Doe",
+			Email:     "evedoe@example.com",
+		},
+		FareClass: FareClassSleeper,
+	})
+	assert.Error(t, err)
+	assert.Error(t, dao.SetDeparture(ctx, Departure{OverbookingAllowance: 1}))
+
+	// Nothing is free at check-in
+	ticket, err := dao.CheckIn(ctx, unseated[0].User.Email)
+	assert.NoError(t, err)
+	assert.Empty(t, ticket.Seat)
+	assert.Equal(t, BookingStatusDeniedBoarding, ticket.Status)
+
+	// A cancellation frees a seat for the next passenger to check in
+	_, err = dao.DeleteTicket(ctx, seated[0])
+	assert.NoError(t, err)
+
+	ticket, err = dao.CheckIn(ctx, unseated[0].User.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, "S1", ticket.Seat)
+	assert.Equal(t, BookingStatusCheckedIn, ticket.Status)
+
+	ticket, err = dao.CheckIn(ctx, unseated[1].User.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, BookingStatusDeniedBoarding, ticket.Status)
+
+	report := dao.GetDeniedBoarding(ctx)
+	assert.Len(t, report, 1)
+	assert.Equal(t, "bobdoe@example.com", report[0].User.Email)
+
+	// Unseated passengers can still be moved to a free seat in another class
+	err = dao.ModifySeat(ctx, "", "A1", unseated[1].User.Email)
+	assert.NoError(t, err)
+	moved, err := dao.GetTicket(ctx, unseated[1].User.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, BookingStatusCheckedIn, moved.Status)
+	assert.Empty(t, dao.GetDeniedBoarding(ctx))
+
+	removed, err := dao.DeleteTicket(ctx, unseated[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "A1", removed.Seat)
+}
+
+func TestBookingReference(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+
+	references := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		ticket, err := dao.SaveTicket(ctx, &proto.User{FirstName: "John", LastName: "Doe", Email: fmt.Sprintf("user%d@example.com", i)}, "London", "France")
+		assert.NoError(t, err)
+		assert.Regexp(t, "^[A-HJ-NP-Z2-9]{6}$", ticket.BookingReference)
+		references[ticket.BookingReference] = true
+	}
+	assert.Len(t, references, 20)
+
+	// The reference stays with the booking when the seat changes
+	ticket, err := dao.GetTicket(ctx, "user0@example.com")
+	assert.NoError(t, err)
+	reference := ticket.BookingReference
+	assert.NoError(t, dao.ModifySeat(ctx, ticket.Seat, "B25", "user0@example.com"))
+	ticket, err = dao.GetTicket(ctx, "user0@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, reference, ticket.BookingReference)
+}
+
+func TestBookingReference_NotReusedAfterCancellation(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	// The generator comes up with AAAAAA twice, then BBBBBB
+	picks := slices.Repeat([]int{0}, 2*bookingReferenceLength)
+	picks = append(picks, slices.Repeat([]int{1}, bookingReferenceLength)...)
+	dao.random = func(int) int {
+		pick := picks[0]
+		picks = picks[1:]
+		return pick
+	}
+
+	cancelled, err := dao.SaveTicket(ctx, &proto.User{FirstName: "John", LastName: "Doe", Email: "a@example.com"}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, "AAAAAA", cancelled.BookingReference)
+	_, err = dao.DeleteTicket(ctx, cancelled)
+	assert.NoError(t, err)
+
+	// The cancelled booking keeps its reference and its history to itself
+	booked, err := dao.SaveTicket(ctx, &proto.User{FirstName: "Jane", LastName: "Doe", Email: "b@example.com"}, "London", "France")
+	assert.NoError(t, err)
+	assert.Equal(t, "BBBBBB", booked.BookingReference)
+	_, revisions, err := dao.BookingHistory(ctx, "", "AAAAAA")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, "a@example.com", revisions[1].Ticket.User.Email)
+	_, revisions, err = dao.BookingHistory(ctx, "b@example.com", "")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+}
+
+func TestSaveBookingFor_Limit(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+
+	book := func(email, bookedBy string) (*proto.TicketReceipt, error) {
+		return dao.SaveBookingFor(ctx, &proto.PurchaseTicketRequest{
+			From: "London",
+			To:   "France",
+			User: &proto.User{FirstName: "John", LastName: "Doe", Email: email},
+		}, bookedBy, 2)
+	}
+
+	ticket, err := book("first@example.com", "agent-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-1", ticket.BookedBy)
+	_, err = book("second@example.com", "agent-1")
+	assert.NoError(t, err)
+
+	// The third booking of the caller is rejected, other callers are counted separately
+	_, err = book("third@example.com", "agent-1")
+	assert.ErrorIs(t, err, ErrBookingLimit)
+	_, err = book("third@example.com", "agent-2")
+	assert.NoError(t, err)
+
+	// Removing a booking frees a place
+	_, err = dao.DeleteTicket(ctx, ticket)
+	assert.NoError(t, err)
+	_, err = book("fourth@example.com", "agent-1")
+	assert.NoError(t, err)
+}
+
+func TestSaveBookings(t *testing.T) {
+	ctx := context.Background()
+	booking := func(email, fareClass string) *proto.PurchaseTicketRequest {
+		return &proto.PurchaseTicketRequest{
+			From:      "London",
+			To:        "France",
+			User:      &proto.User{FirstName: "John", LastName: "Doe", Email: email},
+			FareClass: fareClass,
+		}
+	}
+	reqs := []*proto.PurchaseTicketRequest{
+		booking("first@example.com", ""),
+		booking("second@example.com", "first"),
+		booking("first@example.com", ""),
+		booking("third@example.com", "economy"),
+	}
+
+	// Valid bookings are kept, the others are reported
+	dao := NewTrainDAO()
+	results, kept, err := dao.SaveBookings(ctx, reqs, "agent-1", 0, BulkOptions{})
+	assert.NoError(t, err)
+	assert.True(t, kept)
+	assert.Len(t, results, 4)
+	assert.Equal(t, "A1", results[0].Ticket.Seat)
+	assert.Equal(t, "F1", results[1].Ticket.Seat)
+	assert.Equal(t, "agent-1", results[1].Ticket.BookedBy)
+	assert.ErrorIs(t, results[2].Err, ErrConflict)
+	assert.EqualError(t, results[3].Err, "invalid fare class: economy")
+	_, err = dao.GetTicket(ctx, "second@example.com")
+	assert.NoError(t, err)
+
+	// An all-or-nothing purchase with a failed booking keeps none
+	dao = NewTrainDAO()
+	results, kept, err = dao.SaveBookings(ctx, reqs, "agent-1", 0, BulkOptions{AllOrNothing: true})
+	assert.NoError(t, err)
+	assert.False(t, kept)
+	assert.Equal(t, "A1", results[0].Ticket.Seat)
+	assert.Empty(t, results[0].Ticket.BookingReference)
+	assert.Error(t, results[2].Err)
+	assert.Equal(t, NewTrainDAO().GetStats(), dao.GetStats())
+	assert.Equal(t, NewTrainDAO().availableSeats, dao.availableSeats)
+
+	// A dry run keeps none, and later bookings see the seats taken by earlier ones
+	results, kept, err = dao.SaveBookings(ctx, reqs[:2], "agent-1", 0, BulkOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.False(t, kept)
+	assert.NoError(t, results[1].Err)
+	_, err = dao.GetTicket(ctx, "first@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+	results, kept, err = dao.SaveBookings(ctx, []*proto.PurchaseTicketRequest{booking("a@example.com", ""), booking("b@example.com", "")}, "", 0, BulkOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.False(t, kept)
+	assert.NotEqual(t, results[0].Ticket.Seat, results[1].Ticket.Seat)
+
+	// Booking limits count the bookings made earlier in the purchase
+	results, kept, err = dao.SaveBookings(ctx, reqs[:2], "agent-2", 1, BulkOptions{})
+	assert.NoError(t, err)
+	assert.True(t, kept)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, ErrBookingLimit)
+
+	// An undone purchase also forgets what expiring blocks changed meanwhile, histories and sequences included
+	dao = NewTrainDAO()
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	dao.now = func() time.Time { return now }
+	flagged, err := dao.SaveBooking(ctx, booking("flagged@example.com", FareClassFirst))
+	assert.NoError(t, err)
+	_, err = dao.BlockSeats(ctx, nil, SectionF, "Coach out of service", now.Add(time.Hour))
+	assert.NoError(t, err)
+	revisions, sequence := len(dao.history[flagged.BookingReference]), dao.sequence
+	now = now.Add(2 * time.Hour)
+	_, kept, err = dao.SaveBookings(ctx, reqs[:1], "", 0, BulkOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.False(t, kept)
+	assert.Len(t, dao.history[flagged.BookingReference], revisions)
+	assert.Equal(t, sequence, dao.sequence)
+	assert.Len(t, dao.ListSeatBlocks(ctx), 0)
+	assert.Len(t, dao.history[flagged.BookingReference], revisions+1)
+	events, err := dao.Events(ctx)
+	assert.NoError(t, err)
+	for i, event := range events {
+		assert.Equal(t, int64(i+1), event.Sequence)
+	}
+	assert.Greater(t, dao.history[flagged.BookingReference][revisions].Sequence, sequence)
+}
+
+func TestGetManifest(t *testing.T) {
+	ctx := context.Background()
+	dao, err := NewTrainDAOWithLayout(Layout{
+		FareClasses: []FareClass{{Name: FareClassStandard, Price: 20}, {Name: FareClassFirst, Price: 45}},
+		Sections: []Section{
+			{Name: SectionB, Class: FareClassStandard, Capacity: 2},
+			{Name: SectionA, Class: FareClassStandard, Capacity: 1},
+			{Name: SectionF, Class: FareClassFirst, Capacity: 2},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, dao.SetDeparture(ctx, Departure{OverbookingAllowance: 1}))
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"} {
+		_, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+			From: "London",
+			To:   "France",
+			User: &proto.User{FirstName: "John", LastName: "Doe", Email: email},
+		})
+		assert.NoError(t, err)
+	}
+
+	// Coaches follow the layout, tickets are ordered by seat and bookings without a seat are listed apart
+	manifest := dao.GetManifest(ctx)
+	assert.Len(t, manifest.Coaches, 3)
+	assert.Equal(t, SectionB, manifest.Coaches[0].Section.Name)
+	var seats []string
+	for _, ticket := range manifest.Coaches[0].Tickets {
+		seats = append(seats, ticket.Seat)
+	}
+	assert.Equal(t, []string{"B1", "B2"}, seats)
+	assert.Len(t, manifest.Coaches[1].Tickets, 1)
+	assert.Empty(t, manifest.Coaches[2].Tickets)
+	assert.Len(t, manifest.Unseated, 1)
+	assert.Equal(t, "d@example.com", manifest.Unseated[0].User.Email)
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	assert.NoError(t, dao.SetDeparture(ctx, Departure{AssistanceCutoff: time.Hour, OverbookingAllowance: 3}))
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		_, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: email}})
+		assert.NoError(t, err)
+	}
+	_, err := dao.BlockSeats(ctx, []string{"A5"}, "", "Broken recliner", time.Time{})
+	assert.NoError(t, err)
+
+	data, checksum, err := EncodeSnapshot(dao.Snapshot(ctx))
+	assert.NoError(t, err)
+	assert.Len(t, checksum, 64)
+	snapshot, err := DecodeSnapshot(data)
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.Tickets, 2)
+	assert.Len(t, snapshot.Sections, 5)
+	assert.NotContains(t, snapshot.Sections[0].AvailableSeats, "A1")
+
+	// Importing replaces the bookings made since the snapshot
+	restored := NewTrainDAO()
+	_, err = restored.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "Jane", LastName: "Doe", Email: "c@example.com"}})
+	assert.NoError(t, err)
+	assert.NoError(t, restored.RestoreSnapshot(ctx, snapshot, false))
+	want, got := dao.Snapshot(ctx), restored.Snapshot(ctx)
+	want.CreatedAt, got.CreatedAt = "", ""
+	assert.True(t, protobuf.Equal(want, got))
+	_, err = restored.GetTicket(ctx, "c@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// A damaged file or a newer version is rejected
+	damaged := slices.Clone(data)
+	damaged[len(damaged)-70] ^= 1
+	_, err = DecodeSnapshot(damaged)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	file, _ := protobuf.Marshal(&proto.SnapshotFile{Version: SnapshotVersion + 1})
+	_, err = DecodeSnapshot(file)
+	assert.EqualError(t, err, "snapshot version 2 is newer than the supported version 1")
+}
+
+func TestRestoreSnapshot_Invalid(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	_, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: "a@example.com"}})
+	assert.NoError(t, err)
+
+	for name, test := range map[string]struct {
+		change func(snapshot *proto.Snapshot)
+		err    string
+	}{
+		"seat booked twice": {func(snapshot *proto.Snapshot) {
+			snapshot.Tickets = append(snapshot.Tickets, &proto.TicketReceipt{Seat: "A1", User: &proto.User{Email: "b@example.com"}})
+		}, "seat A1 is booked more than once"},
+		"seat booked and free": {func(snapshot *proto.Snapshot) {
+			snapshot.Sections[0].AvailableSeats = append(snapshot.Sections[0].AvailableSeats, "A1")
+		}, "seat A1 is both booked and free"},
+		"seat missing": {func(snapshot *proto.Snapshot) {
+			snapshot.Sections[0].AvailableSeats = snapshot.Sections[0].AvailableSeats[1:]
+		}, "section A has 1 booked and 23 free seats, but 25 seats"},
+		"capacity": {func(snapshot *proto.Snapshot) {
+			snapshot.Sections[0].Capacity = 30
+		}, "section A is standard with 30 seats, the train layout has it standard with 25 seats"},
+		"seat outside the layout": {func(snapshot *proto.Snapshot) {
+			snapshot.Tickets[0].Seat = "A26"
+		}, "seat A26 of user a@example.com is not part of the train layout"},
+		"overbooked": {func(snapshot *proto.Snapshot) {
+			snapshot.Tickets = append(snapshot.Tickets, &proto.TicketReceipt{FareClass: FareClassStandard, User: &proto.User{Email: "b@example.com"}})
+		}, "1 bookings without a seat exceed the overbooking allowance of 0"},
+	} {
+		snapshot := dao.Snapshot(ctx)
+		test.change(snapshot)
+		restored := NewTrainDAO()
+		assert.EqualError(t, restored.RestoreSnapshot(ctx, snapshot, false), test.err, name)
+		assert.Empty(t, restored.tickets, name)
+	}
+
+	// A dry run checks the snapshot without replacing the state
+	restored := NewTrainDAO()
+	assert.NoError(t, restored.RestoreSnapshot(ctx, dao.Snapshot(ctx), true))
+	assert.Empty(t, restored.tickets)
+}
+
+func TestEvents_RebuildProjection(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	assert.NoError(t, dao.SetDeparture(ctx, Departure{AssistanceCutoff: time.Hour, OverbookingAllowance: 1}))
+	seats := map[string]string{}
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		ticket, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: email}})
+		assert.NoError(t, err)
+		seats[email] = ticket.Seat
+	}
+	assert.NoError(t, dao.ModifySeat(ctx, seats["b@example.com"], "F1", "b@example.com"))
+	_, err := dao.BlockSeats(ctx, []string{seats["a@example.com"]}, "", "Broken recliner", time.Time{})
+	assert.NoError(t, err)
+	_, err = dao.CheckIn(ctx, "a@example.com")
+	assert.NoError(t, err)
+	_, err = dao.DeleteTicket(ctx, &proto.TicketReceipt{User: &proto.User{Email: "c@example.com"}})
+	assert.NoError(t, err)
+
+	// A rolled back bulk import records nothing
+	_, kept, err := dao.SaveBookings(ctx, []*proto.PurchaseTicketRequest{
+		{From: "London", To: "France", User: &proto.User{FirstName: "Jane", LastName: "Doe", Email: "d@example.com"}},
+	}, "", 0, BulkOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.False(t, kept)
+
+	events, err := dao.Events(ctx)
+	assert.NoError(t, err)
+	var types []string
+	for i, event := range events {
+		assert.Equal(t, int64(i+1), event.Sequence)
+		assert.NotEmpty(t, event.OccurredAt)
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		EventDepartureSet, EventTicketPurchased, EventTicketPurchased, EventTicketPurchased, EventSeatChanged,
+		EventSeatBlocked, EventSeatChanged, EventTicketCheckedIn, EventTicketCancelled,
+	}, types)
+	assert.Equal(t, seats["b@example.com"], events[4].PreviousSeat)
+	assert.Equal(t, "F1", events[4].Ticket.Seat)
+	assert.Equal(t, "b@example.com", events[4].UserEmail)
+	assert.Equal(t, seats["a@example.com"], events[6].PreviousSeat)
+
+	after, err := dao.EventsAfter(ctx, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, events[7:], after)
+	after, err = dao.EventsAfter(ctx, 9)
+	assert.NoError(t, err)
+	assert.Empty(t, after)
+
+	// Replaying the events gives the same state, whether in place or in a new DAO
+	want := dao.Snapshot(ctx)
+	assert.NoError(t, dao.RebuildProjection(ctx))
+	got := dao.Snapshot(ctx)
+	want.CreatedAt, got.CreatedAt = "", ""
+	assert.True(t, protobuf.Equal(want, got))
+
+	store := NewMemoryEventStore()
+	assert.NoError(t, store.Append(events))
+	replayed, err := NewTrainDAOWithEventStore(DefaultLayout(), nil, store)
+	assert.NoError(t, err)
+	got = replayed.Snapshot(ctx)
+	got.CreatedAt = ""
+	assert.True(t, protobuf.Equal(want, got))
+
+	// Events out of sequence are rejected
+	store = NewMemoryEventStore()
+	assert.NoError(t, store.Append([]*proto.BookingEvent{events[0], events[2]}))
+	_, err = NewTrainDAOWithEventStore(DefaultLayout(), nil, store)
+	assert.EqualError(t, err, "could not rebuild state from events: event 3 follows event 1")
+}
+
+func TestTickets_AreCopies(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	ticket, err := dao.SaveTicket(ctx, &proto.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com"}, "London", "France")
+	assert.NoError(t, err)
+	seat := ticket.Seat
+	received, err := dao.GetTicket(ctx, "johndoe@example.com")
+	assert.NoError(t, err)
+
+	// Tickets handed out can be read while the booking changes, and keep showing it as it was
+	done := make(chan error)
+	go func() {
+		done <- dao.ModifySeat(ctx, seat, "A10", "johndoe@example.com")
+	}()
+	_, err = protobuf.Marshal(received)
+	assert.NoError(t, err)
+	assert.NoError(t, <-done)
+	assert.Equal(t, seat, ticket.Seat)
+	assert.Equal(t, seat, received.Seat)
+
+	moved, err := dao.GetTicket(ctx, "johndoe@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "A10", moved.Seat)
+	moved.Seat = "B10"
+	assert.Equal(t, "A10", dao.GetManifest(ctx).Coaches[0].Tickets[0].Seat)
+}
+
+func TestFileEventStore_Startup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	statePath, eventsPath := filepath.Join(dir, "state.json"), filepath.Join(dir, "events.jsonl")
+
+	// A saved state loaded into an empty event log becomes its first event
+	saved, err := NewTrainDAOWithStore(DefaultLayout(), NewFileStore(statePath))
+	assert.NoError(t, err)
+	_, err = saved.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: "a@example.com"}})
+	assert.NoError(t, err)
+	assert.NoError(t, saved.Flush())
+
+	dao, err := NewTrainDAOWithEventStore(DefaultLayout(), NewFileStore(statePath), NewFileEventStore(eventsPath))
+	assert.NoError(t, err)
+	booked, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "Jane", LastName: "Doe", Email: "b@example.com"}})
+	assert.NoError(t, err)
+
+	// The events survive a restart, and the state is rebuilt from them rather than from the older state file
+	restarted, err := NewTrainDAOWithEventStore(DefaultLayout(), NewFileStore(statePath), NewFileEventStore(eventsPath))
+	assert.NoError(t, err)
+	events, err := restarted.Events(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, EventSnapshotRestored, events[0].Type)
+	assert.Equal(t, EventTicketPurchased, events[1].Type)
+	ticket, err := restarted.GetTicket(ctx, "b@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, booked.Seat, ticket.Seat)
+	_, err = restarted.GetTicket(ctx, "a@example.com")
+	assert.NoError(t, err)
+
+	// New events are read from where the index left off, by this store and by one that has not read the file yet
+	_, err = restarted.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "Jim", LastName: "Doe", Email: "c@example.com"}})
+	assert.NoError(t, err)
+	for _, store := range []EventStore{restarted.events, NewFileEventStore(eventsPath)} {
+		after, err := store.LoadAfter(1)
+		assert.NoError(t, err)
+		assert.Len(t, after, 2)
+		assert.Equal(t, int64(2), after[0].Sequence)
+		assert.Equal(t, "c@example.com", after[1].GetTicket().GetUser().GetEmail())
+		after, err = store.LoadAfter(3)
+		assert.NoError(t, err)
+		assert.Empty(t, after)
+	}
+
+	// A damaged log is reported with its line
+	assert.NoError(t, os.WriteFile(eventsPath, []byte("{\"sequence\": \"1\", \"type\": \"SeatBlocked\"}\nnot json\n"), 0o600))
+	_, err = NewTrainDAOWithEventStore(DefaultLayout(), nil, NewFileEventStore(eventsPath))
+	assert.ErrorContains(t, err, "could not parse event on line 2")
+}
+
+// failingEventStore is an event store whose appends fail while fail is set.
+type failingEventStore struct {
+	*MemoryEventStore
+	fail bool
+}
+
+func (s *failingEventStore) Append(events []*proto.BookingEvent) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryEventStore.Append(events)
+}
+
+func TestEvents_NotSavedIsUndone(t *testing.T) {
+	ctx := context.Background()
+	store := &failingEventStore{MemoryEventStore: NewMemoryEventStore()}
+	dao, err := NewTrainDAOWithEventStore(DefaultLayout(), nil, store)
+	assert.NoError(t, err)
+	booking := func(email string) *proto.PurchaseTicketRequest {
+		return &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: email}}
+	}
+	booked, err := dao.SaveBooking(ctx, booking("a@example.com"))
+	assert.NoError(t, err)
+
+	// A change whose events cannot be saved is undone and reported
+	store.fail = true
+	_, err = dao.SaveBooking(ctx, booking("b@example.com"))
+	assert.ErrorIs(t, err, ErrNotSaved)
+	assert.ErrorContains(t, err, "disk full")
+	assert.ErrorIs(t, dao.ModifySeat(ctx, booked.Seat, "A10", "a@example.com"), ErrNotSaved)
+	_, kept, err := dao.SaveBookings(ctx, []*proto.PurchaseTicketRequest{booking("c@example.com")}, "", 0, BulkOptions{})
+	assert.True(t, kept)
+	assert.ErrorIs(t, err, ErrNotSaved)
+
+	store.fail = false
+	_, err = dao.GetTicket(ctx, "b@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = dao.GetTicket(ctx, "c@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+	ticket, err := dao.GetTicket(ctx, "a@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, booked.Seat, ticket.Seat)
+	_, revisions, err := dao.BookingHistory(ctx, "a@example.com", "")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+
+	// Later changes carry on from the events that were saved
+	_, err = dao.SaveBooking(ctx, booking("b@example.com"))
+	assert.NoError(t, err)
+	events, err := dao.Events(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, int64(2), events[1].Sequence)
+	assert.Equal(t, "b@example.com", events[1].UserEmail)
+}
+
+func TestChanges(t *testing.T) {
+	ctx := context.Background()
+	store := &failingEventStore{MemoryEventStore: NewMemoryEventStore()}
+	dao, err := NewTrainDAOWithEventStore(DefaultLayout(), nil, store)
+	assert.NoError(t, err)
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		_, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: email}})
+		assert.NoError(t, err)
+	}
+	a, err := dao.GetTicket(ctx, "a@example.com")
+	assert.NoError(t, err)
+
+	// Only the changes made with the context are recorded, from the first one to the last
+	watched, changes := WithChanges(ctx)
+	assert.NoError(t, dao.ModifySeat(watched, a.Seat, "A10", "a@example.com"))
+	assert.NoError(t, dao.ModifySeat(ctx, "A10", "A11", "a@example.com"))
+	assert.NoError(t, dao.ModifySeat(watched, "A11", "A12", "a@example.com"))
+	_, err = dao.BlockSeats(watched, []string{"F1"}, "", "Broken recliner", time.Time{})
+	assert.NoError(t, err)
+	before, after, changed := changes.Booking("a@example.com")
+	assert.True(t, changed)
+	assert.Equal(t, a.Seat, before.Seat)
+	assert.Equal(t, "A12", after.Seat)
+	_, _, changed = changes.Booking("b@example.com")
+	assert.False(t, changed)
+	blocksBefore, blocksAfter, changed := changes.SeatBlocks()
+	assert.True(t, changed)
+	assert.Empty(t, blocksBefore)
+	assert.Len(t, blocksAfter, 1)
+	_, _, changed = changes.Departure()
+	assert.False(t, changed)
+
+	// A cancelled booking is nil after the change
+	b, err := dao.GetTicket(ctx, "b@example.com")
+	assert.NoError(t, err)
+	watched, changes = WithChanges(ctx)
+	_, err = dao.DeleteTicket(watched, b)
+	assert.NoError(t, err)
+	before, after, changed = changes.Booking("b@example.com")
+	assert.True(t, changed)
+	assert.NotNil(t, before)
+	assert.Nil(t, after)
+
+	// Changes that were undone are not recorded
+	store.fail = true
+	watched, changes = WithChanges(ctx)
+	assert.ErrorIs(t, dao.ModifySeat(watched, "A12", "A13", "a@example.com"), ErrNotSaved)
+	_, _, changed = changes.Booking("a@example.com")
+	assert.False(t, changed)
+}
+
+func TestBookingHistory(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	purchased, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: "a@example.com"}})
+	assert.NoError(t, err)
+	seat, reference := purchased.Seat, purchased.BookingReference
+	assert.NoError(t, dao.ModifySeat(ctx, seat, "F1", "a@example.com"))
+	_, err = dao.BlockSeats(ctx, []string{"F1"}, "", "Broken recliner", time.Time{})
+	assert.NoError(t, err)
+	_, err = dao.CheckIn(ctx, "a@example.com")
+	assert.NoError(t, err)
+
+	// The current ticket is the latest revision, and earlier ones keep their seat and price
+	ticket, revision, err := dao.TicketRevision(ctx, "a@example.com", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, revision)
+	assert.Equal(t, BookingStatusCheckedIn, ticket.Status)
+	ticket, revision, err = dao.TicketRevision(ctx, "a@example.com", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revision)
+	assert.Equal(t, seat, ticket.Seat)
+	assert.Equal(t, float32(20), ticket.PricePaid)
+	assert.Equal(t, BookingStatusBooked, ticket.Status)
+	ticket, _, err = dao.TicketRevision(ctx, "a@example.com", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "F1", ticket.Seat)
+	assert.Equal(t, float32(45), ticket.PricePaid)
+	_, _, err = dao.TicketRevision(ctx, "a@example.com", 5)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = dao.TicketRevision(ctx, "a@example.com", -1)
+	assert.EqualError(t, err, "invalid revision -1, revisions start at 1")
+
+	// The history outlives a cancellation, and a new booking starts its own history
+	_, err = dao.DeleteTicket(ctx, &proto.TicketReceipt{User: &proto.User{Email: "a@example.com"}})
+	assert.NoError(t, err)
+	found, revisions, err := dao.BookingHistory(ctx, "a@example.com", "")
+	assert.NoError(t, err)
+	assert.Equal(t, reference, found)
+	var changes []string
+	for i, revision := range revisions {
+		assert.Equal(t, int32(i+1), revision.Revision)
+		changes = append(changes, revision.Change)
+	}
+	assert.Equal(t, []string{EventTicketPurchased, EventSeatChanged, EventSeatChanged, EventTicketCheckedIn, EventTicketCancelled}, changes)
+	assert.Equal(t, revisions[2].Ticket.Seat, revisions[4].Ticket.Seat)
+
+	rebooked, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{From: "London", To: "France", User: &proto.User{FirstName: "John", LastName: "Doe", Email: "a@example.com"}})
+	assert.NoError(t, err)
+	found, revisions, err = dao.BookingHistory(ctx, "a@example.com", "")
+	assert.NoError(t, err)
+	assert.Equal(t, rebooked.BookingReference, found)
+	assert.Len(t, revisions, 1)
+	_, revisions, err = dao.BookingHistory(ctx, "", reference)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 5)
+
+	// A reference must belong to the email it is given with
+	_, _, err = dao.BookingHistory(ctx, "b@example.com", reference)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = dao.BookingHistory(ctx, "", "")
+	assert.EqualError(t, err, "a user email or a booking reference is required")
+
+	// Changing what is returned does not change the history
+	revisions[0].Change = "Tampered"
+	revisions[0].Ticket.Seat = "Z99"
+	ticket, _, err = dao.TicketRevision(ctx, "a@example.com", 1)
+	assert.NoError(t, err)
+	ticket.Seat = "Z99"
+	_, revisions, err = dao.BookingHistory(ctx, "", reference)
+	assert.NoError(t, err)
+	assert.Equal(t, EventTicketPurchased, revisions[0].Change)
+	assert.Equal(t, seat, revisions[0].Ticket.Seat)
+	ticket, _, err = dao.TicketRevision(ctx, "a@example.com", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, rebooked.Seat, ticket.Seat)
+
+	// Histories are rebuilt with the rest of the state
+	assert.NoError(t, dao.RebuildProjection(ctx))
+	_, rebuilt, err := dao.BookingHistory(ctx, "", reference)
+	assert.NoError(t, err)
+	assert.Len(t, rebuilt, 5)
+	assert.True(t, protobuf.Equal(revisions[4], rebuilt[4]))
+}
+
+func TestErrorKinds(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+
+	_, err := dao.GetTicket(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, "ticket for user with email nobody@example.com not found", err.Error())
+
+	for i := 0; i < 50; i++ {
+		_, err = dao.SaveTicket(ctx, &proto.User{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     fmt.Sprintf("johndoe%v@example.com", i),
+		}, "London", "France")
+		assert.NoError(t, err)
+	}
+	_, err = dao.SaveTicket(ctx, &proto.User{FirstName: "John", LastName: "Doe", Email: "johndoe0@example.com"}, "London", "France")
+	assert.ErrorIs(t, err, ErrConflict)
+	err = dao.ModifySeat(ctx, "A1", "B1", "johndoe0@example.com")
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = dao.SaveTicket(ctx, &proto.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com"}, "London", "France")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestFileStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	dao, err := NewTrainDAOWithStore(DefaultLayout(), NewFileStore(path))
+	assert.NoError(t, err)
+	assert.NoError(t, dao.SetDeparture(ctx, Departure{
+		Time:                 time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC),
+		AssistanceCutoff:     2 * time.Hour,
+		OverbookingAllowance: 1,
+	}))
+
+	ticket, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From:       "London",
+		To:         "France",
+		User:       &proto.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com"},
+		FareClass:  FareClassFirst,
+		Assistance: &proto.AssistanceRequest{Type: AssistanceVisual},
+	})
+	assert.NoError(t, err)
+	_, err = dao.BlockSeats(ctx, []string{"A5"}, "", "Broken seat", time.Time{})
+	assert.NoError(t, err)
+
+	// Nothing is written until the state is flushed
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, dao.Flush())
+
+	restored, err := NewTrainDAOWithStore(DefaultLayout(), NewFileStore(path))
+	assert.NoError(t, err)
+
+	restoredTicket, err := restored.GetTicket(ctx, "johndoe@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, ticket.Seat, restoredTicket.Seat)
+	assert.Equal(t, ticket.PricePaid, restoredTicket.PricePaid)
+	assert.Equal(t, ticket.BookingReference, restoredTicket.BookingReference)
+	assert.Equal(t, AssistanceVisual, restoredTicket.Assistance.Type)
+	assert.Equal(t, dao.Departure(ctx), restored.Departure(ctx))
+	assert.Len(t, restored.ListSeatBlocks(ctx), 1)
+
+	// Restored bookings still hold their seat and user, and restored blocks still apply
+	_, err = restored.SaveTicket(ctx, &proto.User{Email: "johndoe@example.com"}, "London", "France")
+	assert.Error(t, err)
+	next, err := restored.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+		From:      "London",
+		To:        "France",
+		User:      &proto.User{FirstName: "Jane", LastName: "Doe", Email: "janedoe@example.com"},
+		FareClass: FareClassFirst,
+	})
+	assert.NoError(t, err)
+	assert.NotEqual(t, ticket.Seat, next.Seat)
+	err = restored.ModifySeat(ctx, ticket.Seat, "A5", "johndoe@example.com")
+	assert.Error(t, err)
+
+	// A state that does not fit the layout is rejected
+	_, err = NewTrainDAOWithStore(Layout{
+		FareClasses: []FareClass{{Name: FareClassStandard, Price: 20}},
+		Sections:    []Section{{Name: SectionA, Class: FareClassStandard, Capacity: 2}},
+	}, NewFileStore(path))
+	assert.Error(t, err)
+}
+
+func TestLoadLayout(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "layout.json")
+	assert.NoError(t, os.WriteFile(valid, []byte(`{
+		"fare_classes": [{"name": "standard", "price": 15}],
+		"sections": [{"name": "A", "class": "standard", "capacity": 4}],
+		"seat_attributes": {"A1": ["wheelchair"]}
+	}`), 0o600))
+	layout, err := LoadLayout(valid)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(15), layout.FareClasses[0].Price)
+	assert.Equal(t, 4, layout.Sections[0].Capacity)
+	assert.Equal(t, []string{SeatWheelchair}, layout.SeatAttributes["A1"])
+
+	invalid := filepath.Join(dir, "invalid.json")
+	assert.NoError(t, os.WriteFile(invalid, []byte(`{"fare_classes": [], "sections": [{"name": "A", "class": "first", "capacity": 4}]}`), 0o600))
+	_, err = LoadLayout(invalid)
+	assert.Error(t, err)
+
+	_, err = LoadLayout(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestPing(t *testing.T) {
+	dao := NewTrainDAO()
+	assert.NoError(t, dao.Ping(10*time.Millisecond))
+
+	// A stuck operation holding the lock fails the check
+	dao.mu.Lock()
+	assert.Error(t, dao.Ping(10*time.Millisecond))
+	dao.mu.Unlock()
+
+	assert.NoError(t, dao.Ping(10*time.Millisecond))
+}
+
+func TestGetStats(t *testing.T) {
+	ctx := context.Background()
+	dao := NewTrainDAO()
+	assert.NoError(t, dao.SetDeparture(ctx, Departure{AssistanceCutoff: DefaultAssistanceCutoff, OverbookingAllowance: 1}))
+
+	_, err := dao.SaveTicket(ctx, &proto.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com"}, "London", "France")
+	assert.NoError(t, err)
+	_, err = dao.BlockSeats(ctx, []string{"B5", "B6"}, "", "Broken seats", time.Time{})
+	assert.NoError(t, err)
+	for i := 0; i < SleeperCap+1; i++ {
+		_, err := dao.SaveBooking(ctx, &proto.PurchaseTicketRequest{
+			From:      "London",
+			To:        "France",
+			User:      &proto.User{FirstName: "Jane", LastName: "Doe", Email: fmt.Sprintf("janedoe%d@example.com", i)},
+			FareClass: FareClassSleeper,
+		})
+		assert.NoError(t, err)
+	}
+
+	stats := dao.GetStats()
+	assert.Equal(t, SectionCap-1, stats.AvailableSeats[SectionA])
+	assert.Equal(t, SectionCap-2, stats.AvailableSeats[SectionB])
+	assert.Equal(t, 0, stats.AvailableSeats[SectionS])
+	assert.Equal(t, 2, stats.BlockedSeats[SectionB])
+	assert.Equal(t, 0, stats.BlockedSeats[SectionA])
+	assert.Equal(t, 1, stats.TicketsSold[FareClassStandard])
+	assert.Equal(t, SleeperCap+1, stats.TicketsSold[FareClassSleeper])
+	assert.Equal(t, 0, stats.TicketsSold[FareClassFirst])
+	assert.Equal(t, 1, stats.Unseated)
+
+	// An expired block no longer counts, and reading the stats records nothing
+	now := time.Now()
+	dao.now = func() time.Time { return now }
+	_, err = dao.BlockSeats(ctx, []string{"A5"}, "", "Cleaning", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dao.GetStats().BlockedSeats[SectionA])
+	sequence := dao.sequence
+	now = now.Add(time.Hour)
+	stats = dao.GetStats()
+	assert.Equal(t, 0, stats.BlockedSeats[SectionA])
+	assert.Equal(t, SectionCap-1, stats.AvailableSeats[SectionA])
+	assert.Equal(t, sequence, dao.sequence)
+}
+
+func TestTracing_LockWait(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	dao := NewTrainDAO()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "PurchaseTicket")
+
+	// Hold the lock so the booking has to wait for it
+	dao.mu.Lock()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		dao.mu.Unlock()
+	}()
+	_, err := dao.SaveTicket(ctx, &proto.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com"}, "London", "France")
+	assert.NoError(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "TrainDAO.SaveBooking", span.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+
+	var wait float64
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) == LockWaitAttribute {
+			wait = attr.Value.AsFloat64()
+		}
+	}
+	assert.GreaterOrEqual(t, wait, float64(20))
+}
@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"train-booking-service/proto"
+
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Define booking status constants for type safety
+const (
+	BookingStatusBooked         = "booked"
+	BookingStatusCheckedIn      = "checked_in"
+	BookingStatusDeniedBoarding = "denied_boarding" // Checked in but no seat was free
+)
+
+// Departure describes the scheduled departure of the train.
+type Departure struct {
+	Time time.Time
+	// AssistanceCutoff is how long before departure seats with accessibility
+	// attributes stop being held back for passengers who request assistance
+	AssistanceCutoff time.Duration
+	// OverbookingAllowance is how many bookings may be confirmed without a seat once a fare class is full
+	OverbookingAllowance int
+}
+
+// SetDeparture sets the scheduled departure of the train.
+func (dao *TrainDAO) SetDeparture(ctx context.Context, departure Departure) (err error) {
+	defer dao.lock(ctx, "SetDeparture")(&err)
+
+	if departure.AssistanceCutoff < 0 {
+		return fmt.Errorf("assistance cutoff must not be negative")
+	}
+	if departure.OverbookingAllowance < 0 {
+		return fmt.Errorf("overbooking allowance must not be negative")
+	}
+	if unseated := dao.unseatedBookings(); departure.OverbookingAllowance < unseated {
+		return fmt.Errorf("overbooking allowance %d is below the %d bookings already confirmed without a seat", departure.OverbookingAllowance, unseated)
+	}
+
+	_, err = dao.record(&proto.BookingEvent{Type: EventDepartureSet, Departure: departureProto(departure)})
+	return err
+}
+
+// Departure returns the scheduled departure of the train.
+func (dao *TrainDAO) Departure(ctx context.Context) Departure {
+	defer dao.lock(ctx, "Departure")(nil)
+
+	return dao.departure
+}
+
+// unseatedBookings counts the bookings confirmed beyond capacity that have no seat yet.
+func (dao *TrainDAO) unseatedBookings() int {
+	count := 0
+	for _, ticket := range dao.tickets {
+		if ticket.Seat == "" {
+			count++
+		}
+	}
+	return count
+}
+
+// CheckIn checks a user in for the departure. Unseated bookings are assigned a seat in their fare class
+// if one has become free, otherwise the booking is marked as denied boarding and can check in again later.
+func (dao *TrainDAO) CheckIn(ctx context.Context, email string) (checkedIn *proto.TicketReceipt, err error) {
+	defer dao.lock(ctx, "CheckIn")(&err)
+
+	ticket, exists := dao.tickets[email]
+	if !exists {
+		return nil, errorf(ErrNotFound, "ticket for user with email %s not found", email)
+	}
+
+	dao.expireBlocks()
+
+	checkedIn = protobuf.Clone(ticket).(*proto.TicketReceipt)
+	if ticket.Seat == "" {
+		seat, err := dao.assignSeat(ticket.FareClass, ticket.Assistance)
+		if err != nil {
+			checkedIn.Status = BookingStatusDeniedBoarding
+			return dao.record(&proto.BookingEvent{Type: EventBoardingDenied, Ticket: checkedIn})
+		}
+		checkedIn.Seat = seat
+	}
+
+	checkedIn.Status = BookingStatusCheckedIn
+	return dao.record(&proto.BookingEvent{Type: EventTicketCheckedIn, Ticket: checkedIn, PreviousSeat: ticket.Seat})
+}
+
+// GetDeniedBoarding retrieves all bookings that could not be seated, ordered by status so passengers
+// denied at check-in come before those who have not checked in yet, and then by email.
+func (dao *TrainDAO) GetDeniedBoarding(ctx context.Context) []*proto.TicketReceipt {
+	defer dao.lock(ctx, "GetDeniedBoarding")(nil)
+
+	tickets := []*proto.TicketReceipt{}
+	for _, ticket := range dao.tickets {
+		if ticket.Seat == "" {
+			tickets = append(tickets, cloneTicket(ticket))
+		}
+	}
+	sort.SliceStable(tickets, func(i, j int) bool {
+		if tickets[i].Status != tickets[j].Status {
+			return tickets[i].Status == BookingStatusDeniedBoarding
+		}
+		return tickets[i].User.Email < tickets[j].User.Email
+	})
+	return tickets
+}
@@ -0,0 +1,36 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Define error kinds callers can check for with errors.Is
+var (
+	ErrNotFound     = errors.New("not found")             // No ticket is held by the user
+	ErrConflict     = errors.New("conflict")              // The user or seat is already booked
+	ErrUnavailable  = errors.New("unavailable")           // No suitable seat is free, or the seat is blocked or reserved
+	ErrBookingLimit = errors.New("booking limit reached") // The caller already holds as many bookings as it may
+	ErrNotSaved     = errors.New("not saved")             // The events of a change could not be saved, it was undone
+)
+
+// kindError is an error of one of the error kinds, with its own message.
+type kindError struct {
+	kind    error
+	message string
+}
+
+// Error returns the message of the error.
+func (e *kindError) Error() string {
+	return e.message
+}
+
+// Unwrap returns the kind of the error.
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+// errorf formats an error of the given kind.
+func errorf(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
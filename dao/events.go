@@ -0,0 +1,522 @@
+package dao
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"train-booking-service/proto"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Define event type constants for type safety
+const (
+	EventTicketPurchased  = "TicketPurchased"
+	EventSeatChanged      = "SeatChanged"     // Moved by the passenger, or off a blocked seat
+	EventTicketCheckedIn  = "TicketCheckedIn" // Seated at check-in if the booking had no seat
+	EventBoardingDenied   = "BoardingDenied"  // Checked in without a free seat
+	EventReseatRequired   = "ReseatRequired"  // Left on a blocked seat as no other seat was free
+	EventTicketCancelled  = "TicketCancelled"
+	EventSeatBlocked      = "SeatBlocked"
+	EventSeatUnblocked    = "SeatUnblocked" // Unblocked by an operator, or the block expired
+	EventDepartureSet     = "DepartureSet"
+	EventSnapshotRestored = "SnapshotRestored"
+)
+
+// EventStore keeps the events of a TrainDAO in the order they happened. Events are never changed once appended.
+type EventStore interface {
+	// Append adds events after the ones already stored.
+	Append(events []*proto.BookingEvent) error
+	// Load returns every stored event, in order.
+	Load() ([]*proto.BookingEvent, error)
+	// LoadAfter returns the stored events after the event with the given sequence, in order.
+	LoadAfter(sequence int64) ([]*proto.BookingEvent, error)
+}
+
+// MemoryEventStore keeps events in memory, they are lost when the server stops.
+type MemoryEventStore struct {
+	mu     sync.Mutex
+	events []*proto.BookingEvent
+}
+
+// NewMemoryEventStore initializes a new, empty MemoryEventStore instance.
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{}
+}
+
+// Append adds events to the store.
+func (s *MemoryEventStore) Append(events []*proto.BookingEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// Load returns every event in the store.
+func (s *MemoryEventStore) Load() ([]*proto.BookingEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*proto.BookingEvent(nil), s.events...), nil
+}
+
+// LoadAfter returns the events in the store after the event with the given sequence.
+func (s *MemoryEventStore) LoadAfter(sequence int64) ([]*proto.BookingEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := sort.Search(len(s.events), func(i int) bool { return s.events[i].Sequence > sequence })
+	return append([]*proto.BookingEvent(nil), s.events[i:]...), nil
+}
+
+// FileEventStore keeps events in a JSON Lines file, one event per line, only ever appending to it. It indexes where
+// each line starts, so the events after a sequence are read without reading the whole file again.
+type FileEventStore struct {
+	path    string
+	mu      sync.Mutex
+	indexed bool    // The file has been read, and offsets and size describe it
+	offsets []int64 // Offset of the line of each event, the event with sequence n being on line n
+	size    int64   // Length of the file
+}
+
+// NewFileEventStore initializes a new FileEventStore instance appending to path.
+func NewFileEventStore(path string) *FileEventStore {
+	return &FileEventStore{path: path}
+}
+
+// Append writes events at the end of the file and syncs it, so appended events survive a crash. When the events
+// cannot all be written the file is cut back to its previous length, so none of them are kept.
+func (s *FileEventStore) Append(events []*proto.BookingEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lines bytes.Buffer
+	var offsets []int64
+	for _, event := range events {
+		offsets = append(offsets, int64(lines.Len()))
+		data, err := protojson.Marshal(event)
+		if err != nil {
+			return err
+		}
+		// Compact with encoding/json, as protojson varies its whitespace on purpose
+		if err := json.Compact(&lines, data); err != nil {
+			return err
+		}
+		lines.WriteByte('\n')
+	}
+	length := int64(lines.Len())
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := lines.WriteTo(file); err != nil {
+		file.Truncate(size)
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Truncate(size)
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if s.indexed && size == s.size {
+		for _, offset := range offsets {
+			s.offsets = append(s.offsets, size+offset)
+		}
+		s.size = size + length
+	} else {
+		// The file changed behind the store's back, read it again when it is next needed
+		s.indexed = false
+	}
+	return nil
+}
+
+// Load reads every event of the file. A missing file means no event has happened yet.
+func (s *FileEventStore) Load() ([]*proto.BookingEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.load()
+}
+
+// load reads every event of the file like Load, indexing the lines. The caller must hold the lock.
+func (s *FileEventStore) load() ([]*proto.BookingEvent, error) {
+	s.indexed, s.offsets, s.size = false, nil, 0
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		s.indexed = true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events, offsets, size, err := s.read(file, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.indexed, s.offsets, s.size = true, offsets, size
+	return events, nil
+}
+
+// read parses the lines of the file from offset to its end, returning the events, the offsets of their lines and
+// the offset of the end.
+func (s *FileEventStore) read(file io.Reader, offset int64) ([]*proto.BookingEvent, []int64, int64, error) {
+	var events []*proto.BookingEvent
+	var offsets []int64
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		event := &proto.BookingEvent{}
+		if err := protojson.Unmarshal(scanner.Bytes(), event); err != nil {
+			return nil, nil, 0, fmt.Errorf("could not parse event on line %d of %s: %w", line, s.path, err)
+		}
+		events = append(events, event)
+		offsets = append(offsets, offset)
+		offset += int64(len(scanner.Bytes())) + 1
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, 0, fmt.Errorf("could not read %s: %w", s.path, err)
+	}
+	return events, offsets, offset, nil
+}
+
+// LoadAfter reads the events of the file after the event with the given sequence. Only the lines of those events are
+// read, and the lock is released while they are, as appends never change them.
+func (s *FileEventStore) LoadAfter(sequence int64) ([]*proto.BookingEvent, error) {
+	s.mu.Lock()
+	if !s.indexed {
+		if _, err := s.load(); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	if sequence < 0 {
+		sequence = 0
+	}
+	if sequence >= int64(len(s.offsets)) {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	start, end := s.offsets[sequence], s.size
+	s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	events, _, _, err := s.read(io.NewSectionReader(file, start, end-start), start)
+	if err != nil {
+		return nil, err
+	}
+	// Lines are indexed by position, skip any event the position does not match
+	return slices.DeleteFunc(events, func(event *proto.BookingEvent) bool { return event.Sequence <= sequence }), nil
+}
+
+// NewTrainDAOWithEventStore initializes a new TrainDAO instance with the given layout, recording its events in
+// events. When events holds events the state is rebuilt from them; otherwise the state saved in store, if any, is
+// restored and recorded as the first event. Store may be nil to keep the state in memory only.
+func NewTrainDAOWithEventStore(layout Layout, store Store, events EventStore) (*TrainDAO, error) {
+	dao, err := NewTrainDAOWithLayout(layout)
+	if err != nil {
+		return nil, err
+	}
+	dao.events = events
+
+	past, err := events.Load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load events: %w", err)
+	}
+	if len(past) > 0 {
+		if err := dao.replay(past); err != nil {
+			return nil, fmt.Errorf("could not rebuild state from events: %w", err)
+		}
+		dao.dirty = true // The saved state may be older than the events
+	} else if store != nil {
+		state, err := store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("could not load saved state: %w", err)
+		}
+		if state != nil {
+			restored, err := NewTrainDAOWithLayout(layout)
+			if err != nil {
+				return nil, err
+			}
+			if err := restored.restore(state); err != nil {
+				return nil, fmt.Errorf("could not restore saved state: %w", err)
+			}
+			if _, err := dao.record(&proto.BookingEvent{Type: EventSnapshotRestored, Snapshot: restored.snapshot()}); err != nil {
+				return nil, fmt.Errorf("could not restore saved state: %w", err)
+			}
+			dao.dirty = false
+			if err := dao.publish(); err != nil {
+				return nil, fmt.Errorf("could not save events: %w", err)
+			}
+		}
+	}
+	dao.store = store
+	return dao, nil
+}
+
+// record applies an event to the state and queues it to be appended to the event store when the lock is released.
+// It returns a copy of the booking the event is about as it is after the event, or nil when the booking no longer
+// exists. The event is copied, so later changes to the messages it was built from do not change it.
+func (dao *TrainDAO) record(event *proto.BookingEvent) (*proto.TicketReceipt, error) {
+	event = protobuf.Clone(event).(*proto.BookingEvent)
+	event.Sequence = dao.sequence + 1
+	event.OccurredAt = dao.now().UTC().Format(time.RFC3339Nano)
+	if event.Ticket != nil {
+		event.UserEmail = event.Ticket.User.GetEmail()
+		event.BookingReference = event.Ticket.BookingReference
+	}
+
+	staged := dao.stage(event)
+	if err := dao.apply(event); err != nil {
+		return nil, err
+	}
+	staged()
+	dao.sequence = event.Sequence
+	dao.pending = append(dao.pending, event)
+	dao.markDirty()
+	return cloneTicket(dao.tickets[event.UserEmail]), nil
+}
+
+// apply changes the state as an event says. It is the only place the bookings, seat map, blocks and departure
+// change, so the state can be rebuilt by applying the events again.
+func (dao *TrainDAO) apply(event *proto.BookingEvent) error {
+	switch event.Type {
+	case EventTicketPurchased, EventSeatChanged, EventTicketCheckedIn, EventBoardingDenied, EventReseatRequired:
+		if event.Ticket == nil || event.Ticket.User == nil {
+			return fmt.Errorf("%s event %d has no ticket", event.Type, event.Sequence)
+		}
+		// Replace the booking rather than change it, as copies handed out earlier may still be read
+		ticket := protobuf.Clone(event.Ticket).(*proto.TicketReceipt)
+		if current, exists := dao.tickets[event.UserEmail]; exists && current.Seat != "" {
+			dao.deallocateSeat(current.Seat)
+		}
+		dao.putTicket(ticket)
+		dao.revise(event, ticket)
+	case EventTicketCancelled:
+		if current, exists := dao.tickets[event.UserEmail]; exists {
+			if current.Seat != "" {
+				dao.deallocateSeat(current.Seat)
+			}
+			dao.revise(event, current)
+		}
+		delete(dao.tickets, event.UserEmail)
+		delete(dao.users, event.UserEmail)
+	case EventSeatBlocked:
+		block, err := parseBlock(event.Block)
+		if err != nil {
+			return fmt.Errorf("%s event %d: %w", event.Type, event.Sequence, err)
+		}
+		dao.blocks[event.Block.Seat] = block
+	case EventSeatUnblocked:
+		delete(dao.blocks, event.Block.GetSeat())
+		if current := dao.sections[sectionOf(event.Block.GetSeat())][event.Block.GetSeat()]; current != nil && current.ReseatRequired {
+			ticket := protobuf.Clone(current).(*proto.TicketReceipt)
+			ticket.ReseatRequired = false
+			dao.putTicket(ticket)
+			dao.revise(event, ticket)
+		}
+	case EventDepartureSet:
+		departure, err := parseDeparture(event.Departure)
+		if err != nil {
+			return fmt.Errorf("%s event %d: %w", event.Type, event.Sequence, err)
+		}
+		dao.departure = departure
+	case EventSnapshotRestored:
+		state, err := snapshotState(protobuf.Clone(event.Snapshot).(*proto.Snapshot))
+		if err != nil {
+			return fmt.Errorf("%s event %d: %w", event.Type, event.Sequence, err)
+		}
+		dao.reset()
+		if err := dao.restore(state); err != nil {
+			return fmt.Errorf("%s event %d: %w", event.Type, event.Sequence, err)
+		}
+		dao.reviseChanged(event)
+	default:
+		return fmt.Errorf("event %d has unknown type %q", event.Sequence, event.Type)
+	}
+	return nil
+}
+
+// putTicket stores a booking, and places it on its seat when it has one.
+func (dao *TrainDAO) putTicket(ticket *proto.TicketReceipt) {
+	if ticket.Seat != "" {
+		dao.allocateSeat(ticket)
+	}
+	dao.users[ticket.User.Email] = ticket.User
+	dao.tickets[ticket.User.Email] = ticket
+}
+
+// replay rebuilds the state from the start by applying events in order.
+func (dao *TrainDAO) replay(events []*proto.BookingEvent) error {
+	dao.reset()
+	dao.history = make(map[string][]*proto.BookingRevision)
+	dao.sequence = 0
+	for _, event := range events {
+		if event.Sequence != dao.sequence+1 {
+			return fmt.Errorf("event %d follows event %d", event.Sequence, dao.sequence)
+		}
+		if err := dao.apply(event); err != nil {
+			return err
+		}
+		dao.sequence = event.Sequence
+	}
+	return nil
+}
+
+// publish appends the queued events to the event store. Events that could not be appended stay queued and are
+// appended with the next ones, so the store never misses an event or gets them out of order.
+func (dao *TrainDAO) publish() error {
+	if len(dao.pending) == 0 || dao.events == nil {
+		return nil
+	}
+	if err := dao.events.Append(dao.pending); err != nil {
+		return err
+	}
+	dao.pending = nil
+	return nil
+}
+
+// rollback undoes the events not appended to the event store yet, rebuilding the state from the events that were.
+// When the event store cannot be read the events stay queued, to be appended with the next ones.
+func (dao *TrainDAO) rollback() error {
+	events, err := dao.events.Load()
+	if err != nil {
+		return fmt.Errorf("could not load events: %w", err)
+	}
+	if err := dao.rebuild(events); err != nil {
+		return err
+	}
+	dao.pending = nil
+	return nil
+}
+
+// rebuild replaces the state with the state built by replaying events. The state is left untouched when the events
+// cannot be replayed.
+func (dao *TrainDAO) rebuild(events []*proto.BookingEvent) error {
+	rebuilt, err := NewTrainDAOWithLayout(dao.layout)
+	if err != nil {
+		return err
+	}
+	rebuilt.now = dao.now
+	rebuilt.random = dao.random
+	if err := rebuilt.replay(events); err != nil {
+		return fmt.Errorf("could not rebuild state from events: %w", err)
+	}
+	dao.users, dao.tickets, dao.sections, dao.availableSeats = rebuilt.users, rebuilt.tickets, rebuilt.sections, rebuilt.availableSeats
+	dao.blocks, dao.departure, dao.history, dao.sequence = rebuilt.blocks, rebuilt.departure, rebuilt.history, rebuilt.sequence
+	dao.markDirty()
+	return nil
+}
+
+// Events returns every event recorded so far, in order.
+func (dao *TrainDAO) Events(ctx context.Context) ([]*proto.BookingEvent, error) {
+	defer dao.lock(ctx, "Events")(nil)
+
+	if err := dao.publish(); err != nil {
+		return nil, fmt.Errorf("could not save events: %w", err)
+	}
+	return dao.events.Load()
+}
+
+// EventsAfter returns the events appended to the event store after the event with the given sequence, in order. It
+// is how the outbox publisher reads the events it has not delivered yet, and does not take the lock, so reading them
+// never holds up the bookings.
+func (dao *TrainDAO) EventsAfter(ctx context.Context, sequence int64) ([]*proto.BookingEvent, error) {
+	return dao.events.LoadAfter(sequence)
+}
+
+// RebuildProjection throws away the bookings, seat map, blocks, departure and booking histories and rebuilds them from the events in
+// the event store. The state is left untouched when the events cannot be replayed.
+func (dao *TrainDAO) RebuildProjection(ctx context.Context) error {
+	defer dao.lock(ctx, "RebuildProjection")(nil)
+
+	if err := dao.publish(); err != nil {
+		return fmt.Errorf("could not save events: %w", err)
+	}
+	events, err := dao.events.Load()
+	if err != nil {
+		return fmt.Errorf("could not load events: %w", err)
+	}
+	return dao.rebuild(events)
+}
+
+// parseBlock converts a seat block from its protobuf representation.
+func parseBlock(block *proto.SeatBlock) (*seatBlock, error) {
+	if block == nil {
+		return nil, fmt.Errorf("no seat block")
+	}
+	blockedAt, err := time.Parse(time.RFC3339, block.BlockedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block time of seat %s: %w", block.Seat, err)
+	}
+	var expiresAt time.Time
+	if block.ExpiresAt != "" {
+		if expiresAt, err = time.Parse(time.RFC3339, block.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("invalid block expiry of seat %s: %w", block.Seat, err)
+		}
+	}
+	return &seatBlock{reason: block.Reason, blockedAt: blockedAt, expiresAt: expiresAt}, nil
+}
+
+// departureProto converts a departure to its protobuf representation.
+func departureProto(departure Departure) *proto.SnapshotDeparture {
+	message := &proto.SnapshotDeparture{
+		AssistanceCutoff:     departure.AssistanceCutoff.String(),
+		OverbookingAllowance: int32(departure.OverbookingAllowance),
+	}
+	if !departure.Time.IsZero() {
+		message.Time = departure.Time.Format(time.RFC3339)
+	}
+	return message
+}
+
+// parseDeparture converts a departure from its protobuf representation, nil being the default departure.
+func parseDeparture(message *proto.SnapshotDeparture) (Departure, error) {
+	departure := Departure{AssistanceCutoff: DefaultAssistanceCutoff}
+	if message == nil {
+		return departure, nil
+	}
+	if message.OverbookingAllowance < 0 {
+		return Departure{}, fmt.Errorf("overbooking allowance must not be negative")
+	}
+	departure.OverbookingAllowance = int(message.OverbookingAllowance)
+	if message.Time != "" {
+		var err error
+		if departure.Time, err = time.Parse(time.RFC3339, message.Time); err != nil {
+			return Departure{}, fmt.Errorf("invalid departure time: %w", err)
+		}
+	}
+	if message.AssistanceCutoff != "" {
+		var err error
+		if departure.AssistanceCutoff, err = time.ParseDuration(message.AssistanceCutoff); err != nil {
+			return Departure{}, fmt.Errorf("invalid assistance cutoff: %w", err)
+		}
+	}
+	return departure, nil
+}
@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"train-booking-service/proto"
+
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// revise adds the booking as it is after an event to its history. Revisions are copies, so they never change.
+func (dao *TrainDAO) revise(event *proto.BookingEvent, ticket *proto.TicketReceipt) {
+	if ticket.BookingReference == "" {
+		return
+	}
+	revisions := dao.history[ticket.BookingReference]
+	dao.history[ticket.BookingReference] = append(revisions, &proto.BookingRevision{
+		Revision:  int32(len(revisions) + 1),
+		Change:    event.Type,
+		ChangedAt: event.OccurredAt,
+		Sequence:  event.Sequence,
+		Ticket:    protobuf.Clone(ticket).(*proto.TicketReceipt),
+	})
+}
+
+// reviseChanged adds a revision for every booking that differs from its latest revision, such as the bookings
+// replaced by a snapshot.
+func (dao *TrainDAO) reviseChanged(event *proto.BookingEvent) {
+	for _, ticket := range dao.state().Tickets {
+		revisions := dao.history[ticket.BookingReference]
+		if len(revisions) == 0 || !protobuf.Equal(revisions[len(revisions)-1].Ticket, ticket) {
+			dao.revise(event, ticket)
+		}
+	}
+}
+
+// TicketRevision retrieves a revision of a user's current booking, the current one when revision is zero. It returns
+// the ticket as it was in that revision and the number of the revision.
+func (dao *TrainDAO) TicketRevision(ctx context.Context, email string, revision int) (*proto.TicketReceipt, int, error) {
+	defer dao.lock(ctx, "TicketRevision")(nil)
+
+	dao.expireBlocks()
+
+	if revision < 0 {
+		return nil, 0, fmt.Errorf("invalid revision %d, revisions start at 1", revision)
+	}
+	ticket, exists := dao.tickets[email]
+	if !exists {
+		return nil, 0, errorf(ErrNotFound, "ticket for user with email %s not found", email)
+	}
+	revisions := dao.history[ticket.BookingReference]
+	switch {
+	case revision == 0:
+		return cloneTicket(ticket), len(revisions), nil
+	case revision > len(revisions):
+		return nil, 0, errorf(ErrNotFound, "booking %s has no revision %d, its latest revision is %d", ticket.BookingReference, revision, len(revisions))
+	}
+	return cloneTicket(revisions[revision-1].Ticket), revision, nil
+}
+
+// BookingHistory retrieves every revision of a booking, oldest first, with the booking reference. The booking is
+// found by reference, which must belong to email when both are given, or else is the current booking of email, or
+// the last one it cancelled.
+func (dao *TrainDAO) BookingHistory(ctx context.Context, email, reference string) (string, []*proto.BookingRevision, error) {
+	defer dao.lock(ctx, "BookingHistory")(nil)
+
+	dao.expireBlocks()
+
+	switch {
+	case reference != "":
+		revisions := dao.history[reference]
+		if len(revisions) == 0 || email != "" && revisions[0].Ticket.User.GetEmail() != email {
+			return "", nil, errorf(ErrNotFound, "booking %s not found", reference)
+		}
+	case email == "":
+		return "", nil, fmt.Errorf("a user email or a booking reference is required")
+	default:
+		if ticket, exists := dao.tickets[email]; exists {
+			reference = ticket.BookingReference
+			break
+		}
+		var last int64
+		for candidate, revisions := range dao.history {
+			latest := revisions[len(revisions)-1]
+			if latest.Ticket.User.GetEmail() == email && latest.Sequence > last {
+				reference, last = candidate, latest.Sequence
+			}
+		}
+		if reference == "" {
+			return "", nil, errorf(ErrNotFound, "no booking found for user with email %s", email)
+		}
+	}
+	revisions := make([]*proto.BookingRevision, len(dao.history[reference]))
+	for i, revision := range dao.history[reference] {
+		revisions[i] = protobuf.Clone(revision).(*proto.BookingRevision)
+	}
+	return reference, revisions, nil
+}
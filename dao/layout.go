@@ -0,0 +1,143 @@
+package dao
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Define fare class constants for type safety
+const (
+	FareClassStandard = "standard"
+	FareClassFirst    = "first"
+	FareClassSleeper  = "sleeper"
+)
+
+// FareClass describes a class of travel and the fare charged for a seat in it.
+type FareClass struct {
+	Name  string  `json:"name"`
+	Price float32 `json:"price"`
+}
+
+// Section describes a section of the train, the fare class it belongs to and how many seats it holds.
+type Section struct {
+	Name     string `json:"name"`
+	Class    string `json:"class"`
+	Capacity int    `json:"capacity"`
+}
+
+// Layout describes the fare classes and sections that make up the train.
+type Layout struct {
+	FareClasses []FareClass `json:"fare_classes"`
+	Sections    []Section   `json:"sections"`
+	// SeatAttributes flags seats with accessibility attributes, keyed by seat ID
+	SeatAttributes map[string][]string `json:"seat_attributes"`
+}
+
+// LoadLayout reads a train layout from a JSON file and validates it.
+func LoadLayout(path string) (Layout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Layout{}, fmt.Errorf("could not read train layout: %w", err)
+	}
+
+	var layout Layout
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&layout); err != nil {
+		return Layout{}, fmt.Errorf("could not parse train layout: %w", err)
+	}
+	if err := layout.Validate(); err != nil {
+		return Layout{}, fmt.Errorf("invalid train layout: %w", err)
+	}
+	return layout, nil
+}
+
+// DefaultLayout returns the layout used by NewTrainDAO: two standard sections,
+// a standard accessible section with wheelchair spaces and priority seats,
+// a first class section and a sleeper section.
+func DefaultLayout() Layout {
+	return Layout{
+		FareClasses: []FareClass{
+			{Name: FareClassStandard, Price: 20.0},
+			{Name: FareClassFirst, Price: 45.0},
+			{Name: FareClassSleeper, Price: 70.0},
+		},
+		Sections: []Section{
+			{Name: SectionA, Class: FareClassStandard, Capacity: SectionCap},
+			{Name: SectionB, Class: FareClassStandard, Capacity: SectionCap},
+			{Name: SectionW, Class: FareClassStandard, Capacity: AccessibleCap},
+			{Name: SectionF, Class: FareClassFirst, Capacity: FirstClassCap},
+			{Name: SectionS, Class: FareClassSleeper, Capacity: SleeperCap},
+		},
+		SeatAttributes: map[string][]string{
+			"W1": {SeatWheelchair},
+			"W2": {SeatWheelchair},
+			"W3": {SeatPriority},
+			"W4": {SeatPriority},
+			"W5": {SeatPriority},
+			"W6": {SeatPriority},
+		},
+	}
+}
+
+// Validate checks that the layout is usable: every section belongs to a known
+// fare class, has a single character name and a positive capacity, and every
+// seat with accessibility attributes exists.
+func (l Layout) Validate() error {
+	classes := make(map[string]bool, len(l.FareClasses))
+	for _, class := range l.FareClasses {
+		if class.Name == "" {
+			return fmt.Errorf("fare class name must not be empty")
+		}
+		if class.Price < 0 {
+			return fmt.Errorf("fare class %s has a negative price", class.Name)
+		}
+		classes[class.Name] = true
+	}
+
+	sections := make(map[string]bool, len(l.Sections))
+	for _, section := range l.Sections {
+		// Seat IDs are derived from the first character of the seat, see sectionOf
+		if len(section.Name) != 1 {
+			return fmt.Errorf("section name %q must be a single character", section.Name)
+		}
+		if sections[section.Name] {
+			return fmt.Errorf("section %s is defined more than once", section.Name)
+		}
+		if !classes[section.Class] {
+			return fmt.Errorf("section %s belongs to unknown fare class %q", section.Name, section.Class)
+		}
+		if section.Capacity <= 0 {
+			return fmt.Errorf("section %s must have a positive capacity", section.Name)
+		}
+		sections[section.Name] = true
+	}
+
+	for seat, attributes := range l.SeatAttributes {
+		section := l.section(sectionOf(seat))
+		if section == nil {
+			return fmt.Errorf("seat %s with accessibility attributes belongs to an unknown section", seat)
+		}
+		if n := seatNumber(seat); n < 1 || n > section.Capacity {
+			return fmt.Errorf("seat %s with accessibility attributes does not exist", seat)
+		}
+		for _, attribute := range attributes {
+			if attribute != SeatWheelchair && attribute != SeatPriority {
+				return fmt.Errorf("seat %s has unknown accessibility attribute %q", seat, attribute)
+			}
+		}
+	}
+	return nil
+}
+
+// section returns the section with the given name, or nil if the layout has none.
+func (l Layout) section(name string) *Section {
+	for i := range l.Sections {
+		if l.Sections[i].Name == name {
+			return &l.Sections[i]
+		}
+	}
+	return nil
+}
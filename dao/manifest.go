@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"train-booking-service/proto"
+)
+
+// ManifestCoach is a section of the train and the tickets seated in it, ordered by seat.
+type ManifestCoach struct {
+	Section Section
+	Tickets []*proto.TicketReceipt
+}
+
+// Manifest lists every booking of the departure by coach.
+type Manifest struct {
+	Coaches  []ManifestCoach        // In the order of the layout, including empty coaches
+	Unseated []*proto.TicketReceipt // Bookings confirmed beyond capacity that have no seat yet, ordered by email
+}
+
+// GetManifest retrieves every booking of the departure grouped by the coach it is seated in.
+func (dao *TrainDAO) GetManifest(ctx context.Context) Manifest {
+	defer dao.lock(ctx, "GetManifest")(nil)
+
+	manifest := Manifest{Unseated: []*proto.TicketReceipt{}}
+	for _, section := range dao.layout.Sections {
+		coach := ManifestCoach{Section: section, Tickets: []*proto.TicketReceipt{}}
+		for _, ticket := range dao.sections[section.Name] {
+			coach.Tickets = append(coach.Tickets, cloneTicket(ticket))
+		}
+		sort.SliceStable(coach.Tickets, func(i, j int) bool {
+			return seatNumber(coach.Tickets[i].Seat) < seatNumber(coach.Tickets[j].Seat)
+		})
+		manifest.Coaches = append(manifest.Coaches, coach)
+	}
+
+	for _, ticket := range dao.tickets {
+		if ticket.Seat == "" {
+			manifest.Unseated = append(manifest.Unseated, cloneTicket(ticket))
+		}
+	}
+	sort.Slice(manifest.Unseated, func(i, j int) bool {
+		return manifest.Unseated[i].User.Email < manifest.Unseated[j].User.Email
+	})
+	return manifest
+}
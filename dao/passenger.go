@@ -0,0 +1,134 @@
+package dao
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"train-booking-service/proto"
+)
+
+// Define passenger type constants for type safety
+const (
+	PassengerAdult  = "adult"
+	PassengerChild  = "child"
+	PassengerSenior = "senior"
+	PassengerInfant = "infant"
+)
+
+// Define concession constants for type safety
+const (
+	ConcessionChild      = "child"
+	ConcessionSenior     = "senior"
+	ConcessionStudent    = "student"
+	ConcessionDisability = "disability"
+)
+
+// Define age boundaries between passenger types
+const (
+	InfantMaxAge = 1  // Infants are under two and travel without a seat
+	ChildMaxAge  = 15 // Children are under sixteen
+	SeniorMinAge = 60 // Seniors are sixty or over
+	MaxInfants   = 1  // Maximum number of infants travelling on one adult's lap
+)
+
+// DateOfBirthLayout is the layout of the date_of_birth field of a user.
+const DateOfBirthLayout = "2006-01-02"
+
+// concessionDiscounts holds the percentage taken off the fare for each concession.
+var concessionDiscounts = map[string]float32{
+	ConcessionChild:      50,
+	ConcessionSenior:     30,
+	ConcessionStudent:    25,
+	ConcessionDisability: 35,
+}
+
+// ageOn returns the age in whole years of someone born on dob at the given time.
+func ageOn(dob, at time.Time) int {
+	age := at.Year() - dob.Year()
+	if at.Month() < dob.Month() || (at.Month() == dob.Month() && at.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
+
+// passengerTypeOf returns the passenger type for an age.
+func passengerTypeOf(age int) string {
+	switch {
+	case age <= InfantMaxAge:
+		return PassengerInfant
+	case age <= ChildMaxAge:
+		return PassengerChild
+	case age >= SeniorMinAge:
+		return PassengerSenior
+	default:
+		return PassengerAdult
+	}
+}
+
+// resolvePassengerType validates a user's date of birth, passenger type and railcard
+// and returns the passenger type they travel as.
+func resolvePassengerType(user *proto.User, now time.Time) (string, error) {
+	if user.DateOfBirth == "" {
+		switch user.PassengerType {
+		case "", PassengerAdult:
+			return PassengerAdult, nil
+		case PassengerChild, PassengerSenior, PassengerInfant:
+			return "", fmt.Errorf("date of birth is required for %s passenger %s", user.PassengerType, user.Email)
+		default:
+			return "", fmt.Errorf("invalid passenger type: %s", user.PassengerType)
+		}
+	}
+
+	dob, err := time.Parse(DateOfBirthLayout, user.DateOfBirth)
+	if err != nil {
+		return "", fmt.Errorf("invalid date of birth %s, expected YYYY-MM-DD", user.DateOfBirth)
+	}
+	if dob.After(now) {
+		return "", fmt.Errorf("date of birth %s is in the future", user.DateOfBirth)
+	}
+
+	passengerType := passengerTypeOf(ageOn(dob, now))
+	if user.PassengerType != "" && user.PassengerType != passengerType {
+		return "", fmt.Errorf("passenger type %s does not match date of birth %s", user.PassengerType, user.DateOfBirth)
+	}
+	return passengerType, nil
+}
+
+// concessionFor returns the concession a passenger is eligible for, preferring the largest discount.
+// Concessions do not stack.
+func concessionFor(passengerType, railcard string) (string, error) {
+	eligible := []string{}
+	switch passengerType {
+	case PassengerChild:
+		eligible = append(eligible, ConcessionChild)
+	case PassengerSenior:
+		eligible = append(eligible, ConcessionSenior)
+	}
+
+	switch railcard {
+	case "":
+	case ConcessionStudent:
+		if passengerType != PassengerAdult {
+			return "", fmt.Errorf("student railcard is only valid for adult passengers")
+		}
+		eligible = append(eligible, ConcessionStudent)
+	case ConcessionDisability:
+		eligible = append(eligible, ConcessionDisability)
+	default:
+		return "", fmt.Errorf("invalid railcard: %s", railcard)
+	}
+
+	concession := ""
+	for _, candidate := range eligible {
+		if concession == "" || concessionDiscounts[candidate] > concessionDiscounts[concession] {
+			concession = candidate
+		}
+	}
+	return concession, nil
+}
+
+// discountedFare applies a concession to a fare, rounded to the nearest penny.
+func discountedFare(fare float32, concession string) float32 {
+	discounted := float64(fare) * float64(100-concessionDiscounts[concession]) / 100
+	return float32(math.Round(discounted*100) / 100)
+}
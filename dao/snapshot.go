@@ -0,0 +1,175 @@
+package dao
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+	"train-booking-service/proto"
+
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// SnapshotVersion is the version of the snapshot format written by EncodeSnapshot.
+const SnapshotVersion = 1
+
+// EncodeSnapshot encodes a snapshot as a snapshot file of the current version, returning it with its checksum.
+func EncodeSnapshot(snapshot *proto.Snapshot) ([]byte, string, error) {
+	data, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(snapshot)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not encode snapshot: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	file, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(&proto.SnapshotFile{Version: SnapshotVersion, Snapshot: data, Sha256: checksum})
+	if err != nil {
+		return nil, "", fmt.Errorf("could not encode snapshot: %w", err)
+	}
+	return file, checksum, nil
+}
+
+// DecodeSnapshot decodes a snapshot file, checking its version and its checksum.
+func DecodeSnapshot(data []byte) (*proto.Snapshot, error) {
+	var file proto.SnapshotFile
+	if err := protobuf.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("not a snapshot file: %w", err)
+	}
+	switch {
+	case file.Version == 0:
+		return nil, fmt.Errorf("not a snapshot file: no version")
+	case file.Version > SnapshotVersion:
+		return nil, fmt.Errorf("snapshot version %d is newer than the supported version %d", file.Version, SnapshotVersion)
+	}
+	sum := sha256.Sum256(file.Snapshot)
+	if checksum := hex.EncodeToString(sum[:]); checksum != file.Sha256 {
+		return nil, fmt.Errorf("snapshot checksum mismatch: the file says %s but its content is %s", file.Sha256, checksum)
+	}
+
+	snapshot := &proto.Snapshot{}
+	if err := protobuf.Unmarshal(file.Snapshot, snapshot); err != nil {
+		return nil, fmt.Errorf("could not decode snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// Snapshot captures the whole booking state: the bookings and their users, the free seats of every section,
+// the blocked seats and the departure.
+func (dao *TrainDAO) Snapshot(ctx context.Context) *proto.Snapshot {
+	defer dao.lock(ctx, "Snapshot")(nil)
+
+	return dao.snapshot()
+}
+
+// snapshot captures the whole booking state like Snapshot. The caller must hold the lock.
+func (dao *TrainDAO) snapshot() *proto.Snapshot {
+	state := dao.state()
+	snapshot := &proto.Snapshot{
+		CreatedAt: dao.now().UTC().Format(time.RFC3339),
+		Blocks:    state.Blocks,
+		Departure: departureProto(state.Departure),
+	}
+	for _, ticket := range state.Tickets {
+		snapshot.Tickets = append(snapshot.Tickets, cloneTicket(ticket))
+	}
+	for _, section := range dao.layout.Sections {
+		available := slices.Clone(dao.availableSeats[section.Name])
+		slices.SortFunc(available, func(a, b string) int {
+			return seatNumber(a) - seatNumber(b)
+		})
+		snapshot.Sections = append(snapshot.Sections, &proto.SnapshotSection{
+			Name:           section.Name,
+			FareClass:      section.Class,
+			Capacity:       int32(section.Capacity),
+			AvailableSeats: available,
+		})
+	}
+	return snapshot
+}
+
+// RestoreSnapshot replaces the whole booking state with a snapshot. The snapshot is checked against the train layout
+// first: its sections must match the layout, no seat may be booked twice or be both booked and free, and the bookings
+// without a seat must stay within the overbooking allowance. A rejected snapshot, or a dry run, leaves the state
+// untouched.
+func (dao *TrainDAO) RestoreSnapshot(ctx context.Context, snapshot *proto.Snapshot, dryRun bool) (err error) {
+	defer dao.lock(ctx, "RestoreSnapshot")(&err)
+
+	state, err := snapshotState(snapshot)
+	if err != nil {
+		return err
+	}
+	restored, err := NewTrainDAOWithLayout(dao.layout)
+	if err != nil {
+		return err
+	}
+	restored.now = dao.now
+	restored.random = dao.random
+	if err := restored.restore(state); err != nil {
+		return err
+	}
+	if err := restored.checkSections(snapshot.Sections); err != nil {
+		return err
+	}
+	if unseated := restored.unseatedBookings(); unseated > state.Departure.OverbookingAllowance {
+		return fmt.Errorf("%d bookings without a seat exceed the overbooking allowance of %d", unseated, state.Departure.OverbookingAllowance)
+	}
+	if dryRun {
+		return nil
+	}
+
+	_, err = dao.record(&proto.BookingEvent{Type: EventSnapshotRestored, Snapshot: restored.snapshot()})
+	return err
+}
+
+// snapshotState converts a snapshot to the state restored by restore.
+func snapshotState(snapshot *proto.Snapshot) (*State, error) {
+	departure, err := parseDeparture(snapshot.Departure)
+	if err != nil {
+		return nil, err
+	}
+	return &State{Tickets: snapshot.Tickets, Blocks: snapshot.Blocks, Departure: departure}, nil
+}
+
+// checkSections checks that the sections of a snapshot match the layout, and that their free seats are exactly
+// the seats the restored bookings left free.
+func (dao *TrainDAO) checkSections(sections []*proto.SnapshotSection) error {
+	seen := map[string]bool{}
+	for _, section := range sections {
+		layoutSection := dao.layout.section(section.Name)
+		if layoutSection == nil {
+			return fmt.Errorf("section %s is not part of the train layout", section.Name)
+		}
+		if seen[section.Name] {
+			return fmt.Errorf("section %s is listed more than once", section.Name)
+		}
+		seen[section.Name] = true
+		if section.FareClass != layoutSection.Class || int(section.Capacity) != layoutSection.Capacity {
+			return fmt.Errorf("section %s is %s with %d seats, the train layout has it %s with %d seats",
+				section.Name, section.FareClass, section.Capacity, layoutSection.Class, layoutSection.Capacity)
+		}
+
+		free := map[string]bool{}
+		for _, seat := range section.AvailableSeats {
+			switch {
+			case sectionOf(seat) != section.Name || !dao.seatExists(seat):
+				return fmt.Errorf("free seat %s is not part of section %s", seat, section.Name)
+			case free[seat]:
+				return fmt.Errorf("seat %s is listed as free more than once", seat)
+			case dao.sections[section.Name][seat] != nil:
+				return fmt.Errorf("seat %s is both booked and free", seat)
+			}
+			free[seat] = true
+		}
+		if booked := len(dao.sections[section.Name]); booked+len(free) != layoutSection.Capacity {
+			return fmt.Errorf("section %s has %d booked and %d free seats, but %d seats", section.Name, booked, len(free), layoutSection.Capacity)
+		}
+	}
+	for _, section := range dao.layout.Sections {
+		if !seen[section.Name] {
+			return fmt.Errorf("section %s of the train layout is missing", section.Name)
+		}
+	}
+	return nil
+}
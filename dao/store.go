@@ -0,0 +1,242 @@
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"train-booking-service/proto"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// State is everything a TrainDAO needs to be restored: the bookings, the blocked seats and the departure.
+type State struct {
+	Tickets   []*proto.TicketReceipt
+	Blocks    []*proto.SeatBlock
+	Departure Departure
+}
+
+// Store persists the state of a TrainDAO.
+type Store interface {
+	// Load returns the saved state, or nil if nothing has been saved yet.
+	Load() (*State, error)
+	// Save replaces the saved state.
+	Save(state *State) error
+}
+
+// NewTrainDAOWithStore initializes a new TrainDAO instance with the given layout and restores the state saved in store.
+// Changes are written back to the store by Flush.
+func NewTrainDAOWithStore(layout Layout, store Store) (*TrainDAO, error) {
+	return NewTrainDAOWithEventStore(layout, store, NewMemoryEventStore())
+}
+
+// restore rebuilds the seat map of an empty train from a saved state, checking that it fits the layout. The tickets
+// of the state are copied, it is not changed.
+func (dao *TrainDAO) restore(state *State) error {
+	for _, ticket := range state.Tickets {
+		ticket = cloneTicket(ticket)
+		if ticket.User == nil || ticket.User.Email == "" {
+			return fmt.Errorf("ticket without a user")
+		}
+		if _, exists := dao.tickets[ticket.User.Email]; exists {
+			return fmt.Errorf("user %s has more than one ticket", ticket.User.Email)
+		}
+		if ticket.Seat != "" {
+			if !dao.seatExists(ticket.Seat) {
+				return fmt.Errorf("seat %s of user %s is not part of the train layout", ticket.Seat, ticket.User.Email)
+			}
+			if !dao.isSeatAvailable(ticket.Seat) {
+				return fmt.Errorf("seat %s is booked more than once", ticket.Seat)
+			}
+			ticket.FareClass = dao.sectionClass[sectionOf(ticket.Seat)]
+		} else if _, ok := dao.fares[ticket.FareClass]; !ok {
+			return fmt.Errorf("ticket of user %s has unknown fare class %q", ticket.User.Email, ticket.FareClass)
+		}
+		// State saved before booking references were introduced gets them on load
+		if ticket.BookingReference == "" {
+			ticket.BookingReference = dao.newBookingReference()
+		}
+		dao.putTicket(ticket)
+	}
+
+	for _, block := range state.Blocks {
+		if !dao.seatExists(block.Seat) {
+			return fmt.Errorf("blocked seat %s is not part of the train layout", block.Seat)
+		}
+		seatBlock, err := parseBlock(block)
+		if err != nil {
+			return err
+		}
+		dao.blocks[block.Seat] = seatBlock
+	}
+
+	dao.departure = state.Departure
+	return nil
+}
+
+// state captures the current state, ordered by seat so saved files are stable.
+func (dao *TrainDAO) state() *State {
+	state := &State{Departure: dao.departure}
+	for _, ticket := range dao.tickets {
+		state.Tickets = append(state.Tickets, ticket)
+	}
+	sort.SliceStable(state.Tickets, func(i, j int) bool {
+		if state.Tickets[i].Seat != state.Tickets[j].Seat {
+			return seatLess(state.Tickets[i].Seat, state.Tickets[j].Seat)
+		}
+		return state.Tickets[i].User.Email < state.Tickets[j].User.Email
+	})
+	for seat, block := range dao.blocks {
+		state.Blocks = append(state.Blocks, block.toProto(seat))
+	}
+	sort.SliceStable(state.Blocks, func(i, j int) bool {
+		return seatLess(state.Blocks[i].Seat, state.Blocks[j].Seat)
+	})
+	return state
+}
+
+// markDirty records that the state has changed since it was last saved.
+func (dao *TrainDAO) markDirty() {
+	dao.dirty = true
+}
+
+// Flush appends the events not yet in the event store, and saves the state to the store if it changed since the
+// last save. The state is not saved without a store.
+func (dao *TrainDAO) Flush() error {
+	dao.mu.Lock()
+	defer dao.mu.Unlock()
+
+	if err := dao.publish(); err != nil {
+		return fmt.Errorf("could not save events: %w", err)
+	}
+	if dao.store == nil || !dao.dirty {
+		return nil
+	}
+	if err := dao.store.Save(dao.state()); err != nil {
+		return fmt.Errorf("could not save state: %w", err)
+	}
+	dao.dirty = false
+	return nil
+}
+
+// FileStore keeps the state in a JSON file.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore initializes a new FileStore instance writing to path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// fileState is the JSON document a FileStore writes. Tickets and blocks use the protobuf JSON mapping.
+type fileState struct {
+	Tickets   []json.RawMessage `json:"tickets"`
+	Blocks    []json.RawMessage `json:"blocks"`
+	Departure fileDeparture     `json:"departure"`
+}
+
+// fileDeparture is the JSON representation of a Departure.
+type fileDeparture struct {
+	Time                 string `json:"time,omitempty"`
+	AssistanceCutoff     string `json:"assistance_cutoff"`
+	OverbookingAllowance int    `json:"overbooking_allowance"`
+}
+
+// Load reads the state file. A missing file means nothing has been saved yet.
+func (s *FileStore) Load() (*State, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved fileState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", s.path, err)
+	}
+
+	state := &State{Departure: Departure{OverbookingAllowance: saved.Departure.OverbookingAllowance}}
+	for _, raw := range saved.Tickets {
+		ticket := &proto.TicketReceipt{}
+		if err := protojson.Unmarshal(raw, ticket); err != nil {
+			return nil, fmt.Errorf("could not parse ticket in %s: %w", s.path, err)
+		}
+		state.Tickets = append(state.Tickets, ticket)
+	}
+	for _, raw := range saved.Blocks {
+		block := &proto.SeatBlock{}
+		if err := protojson.Unmarshal(raw, block); err != nil {
+			return nil, fmt.Errorf("could not parse seat block in %s: %w", s.path, err)
+		}
+		state.Blocks = append(state.Blocks, block)
+	}
+	if saved.Departure.Time != "" {
+		if state.Departure.Time, err = time.Parse(time.RFC3339, saved.Departure.Time); err != nil {
+			return nil, fmt.Errorf("invalid departure time in %s: %w", s.path, err)
+		}
+	}
+	if saved.Departure.AssistanceCutoff != "" {
+		if state.Departure.AssistanceCutoff, err = time.ParseDuration(saved.Departure.AssistanceCutoff); err != nil {
+			return nil, fmt.Errorf("invalid assistance cutoff in %s: %w", s.path, err)
+		}
+	}
+	return state, nil
+}
+
+// Save writes the state file. The file is replaced atomically so a crash never leaves it half-written.
+func (s *FileStore) Save(state *State) error {
+	saved := fileState{
+		Tickets: []json.RawMessage{},
+		Blocks:  []json.RawMessage{},
+		Departure: fileDeparture{
+			AssistanceCutoff:     state.Departure.AssistanceCutoff.String(),
+			OverbookingAllowance: state.Departure.OverbookingAllowance,
+		},
+	}
+	if !state.Departure.Time.IsZero() {
+		saved.Departure.Time = state.Departure.Time.Format(time.RFC3339)
+	}
+	for _, ticket := range state.Tickets {
+		raw, err := protojson.Marshal(ticket)
+		if err != nil {
+			return err
+		}
+		saved.Tickets = append(saved.Tickets, raw)
+	}
+	for _, block := range state.Blocks {
+		raw, err := protojson.Marshal(block)
+		if err != nil {
+			return err
+		}
+		saved.Blocks = append(saved.Blocks, raw)
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.path)
+}
@@ -0,0 +1,48 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// tracer creates the spans of DAO operations.
+var tracer = otel.Tracer("train-booking-service/dao")
+
+// LockWaitAttribute is the span attribute holding how long an operation waited for the lock, in milliseconds.
+const LockWaitAttribute = "dao.lock.wait_ms"
+
+// lock starts a span for a DAO operation and acquires the lock, recording how long the operation waited for it.
+// The returned function appends the events recorded by the operation to the event store, adds the changes they
+// made to the Changes of ctx, releases the lock and ends the span. When the events cannot be appended, the changes
+// they made are undone and, unless err is nil or already holds an error, an ErrNotSaved error is returned through err.
+func (dao *TrainDAO) lock(ctx context.Context, operation string) func(err *error) {
+	_, span := tracer.Start(ctx, "TrainDAO."+operation)
+
+	waitStart := time.Now()
+	dao.mu.Lock()
+	span.SetAttributes(attribute.Float64(LockWaitAttribute, float64(time.Since(waitStart).Microseconds())/1000))
+	dao.changes = changesFromContext(ctx)
+
+	return func(err *error) {
+		if publishErr := dao.publish(); publishErr != nil {
+			saveErr := errorf(ErrNotSaved, "could not save the change, it was undone: %v", publishErr)
+			if rollbackErr := dao.rollback(); rollbackErr != nil {
+				saveErr = errorf(ErrNotSaved, "could not save the change: %v, nor undo it: %v", publishErr, rollbackErr)
+			}
+			span.RecordError(saveErr)
+			span.SetStatus(codes.Error, saveErr.Error())
+			if err != nil && *err == nil {
+				*err = saveErr
+			}
+		} else if dao.changes != nil {
+			dao.changes.keep(dao.staged)
+		}
+		dao.changes, dao.staged = nil, nil
+		dao.mu.Unlock()
+		span.End()
+	}
+}
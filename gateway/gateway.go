@@ -0,0 +1,373 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"train-booking-service/auth"
+	"train-booking-service/logging"
+	pb "train-booking-service/proto"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// maxBodySize bounds the JSON request bodies the gateway reads.
+const maxBodySize = 1 << 20
+
+// OpenAPIPath is the path the OpenAPI document of the gateway is served at.
+const OpenAPIPath = "/openapi.json"
+
+// forwardedHeaders are the HTTP headers passed to the RPC as metadata.
+var forwardedHeaders = []string{auth.AuthorizationHeader, auth.APIKeyHeader, logging.RequestIDHeader}
+
+// tracer creates the spans of HTTP requests.
+var tracer = otel.Tracer("train-booking-service/gateway")
+
+// Route maps an HTTP method and path to a TrainService RPC. Path wildcards and query parameters are named after
+// fields of the request message, the other fields are read from the JSON body when Body is set.
+type Route struct {
+	Method  string
+	Path    string // Such as "/v1/tickets/{user_email}"
+	RPC     string // Method name of the RPC, such as "GetReceipt"
+	Body    bool
+	Status  int // Status of a successful call, http.StatusOK when zero
+	Summary string
+}
+
+// Routes lists the REST resources of TrainService.
+var Routes = []Route{
+	{Method: http.MethodPost, Path: "/v1/tickets", RPC: "PurchaseTicket", Body: true, Status: http.StatusCreated, Summary: "Purchase a ticket"},
+	{Method: http.MethodGet, Path: "/v1/tickets/{user_email}", RPC: "GetReceipt", Summary: "Get the receipt of a passenger's ticket"},
+	{Method: http.MethodGet, Path: "/v1/booking-history", RPC: "GetBookingHistory", Summary: "List every revision of a booking, by passenger email or booking reference"},
+	{Method: http.MethodDelete, Path: "/v1/tickets/{user_email}", RPC: "RemoveUser", Summary: "Remove a passenger from the train"},
+	{Method: http.MethodPut, Path: "/v1/tickets/{user_email}/seat", RPC: "ModifySeat", Body: true, Summary: "Move a passenger to another seat"},
+	{Method: http.MethodPost, Path: "/v1/tickets/{user_email}/check-in", RPC: "CheckIn", Summary: "Check a passenger in"},
+	{Method: http.MethodGet, Path: "/v1/sections/{section}/users", RPC: "GetUsersBySection", Summary: "List the passengers seated in a section"},
+	{Method: http.MethodGet, Path: "/v1/assistance-manifest", RPC: "GetAssistanceManifest", Summary: "List the passengers requiring assistance"},
+	{Method: http.MethodGet, Path: "/v1/seat-blocks", RPC: "ListSeatBlocks", Summary: "List the blocked seats"},
+	{Method: http.MethodPost, Path: "/v1/seat-blocks", RPC: "BlockSeats", Body: true, Summary: "Block seats or a section"},
+	{Method: http.MethodDelete, Path: "/v1/seat-blocks", RPC: "UnblockSeats", Summary: "Unblock seats or a section"},
+	{Method: http.MethodPut, Path: "/v1/departure", RPC: "SetDeparture", Body: true, Summary: "Schedule the departure"},
+	{Method: http.MethodGet, Path: "/v1/denied-boarding-report", RPC: "GetDeniedBoardingReport", Summary: "List the bookings still without a seat"},
+	{Method: http.MethodGet, Path: "/v1/snapshot", RPC: "ExportSnapshot", Summary: "Export a snapshot of the booking state"},
+	{Method: http.MethodPut, Path: "/v1/snapshot", RPC: "ImportSnapshot", Body: true, Summary: "Replace the booking state with a snapshot"},
+	{Method: http.MethodGet, Path: "/v1/manifest", RPC: "ExportManifest", Summary: "Export the passenger manifest as CSV, JSON Lines or HTML"},
+	{Method: http.MethodGet, Path: "/v1/audit-log", RPC: "QueryAuditLog", Summary: "Query the audit log of changes"},
+}
+
+// Gateway serves TrainService as an HTTP/JSON API. Calls go through the same interceptors as gRPC calls, so
+// they are authenticated, authorized, rate limited and logged alike.
+type Gateway struct {
+	service     pb.TrainServiceServer
+	interceptor grpc.UnaryServerInterceptor
+	mux         *http.ServeMux
+	openAPI     []byte
+}
+
+// New creates a Gateway calling service through the given unary interceptors, in order.
+func New(service pb.TrainServiceServer, interceptors ...grpc.UnaryServerInterceptor) (*Gateway, error) {
+	openAPI, err := OpenAPI()
+	if err != nil {
+		return nil, err
+	}
+	g := &Gateway{
+		service:     service,
+		interceptor: chain(interceptors),
+		mux:         http.NewServeMux(),
+		openAPI:     openAPI,
+	}
+
+	services := pb.File_proto_train_service_proto.Services().ByName("TrainService")
+	for _, route := range Routes {
+		method := services.Methods().ByName(protoreflect.Name(route.RPC))
+		if method == nil {
+			return nil, fmt.Errorf("route %s %s: unknown RPC %s", route.Method, route.Path, route.RPC)
+		}
+		desc, err := methodDesc(route.RPC)
+		if err != nil {
+			return nil, err
+		}
+		requestType, err := protoregistry.GlobalTypes.FindMessageByName(method.Input().FullName())
+		if err != nil {
+			return nil, fmt.Errorf("route %s %s: %w", route.Method, route.Path, err)
+		}
+		g.mux.Handle(route.Method+" "+route.Path, &handler{gateway: g, route: route, desc: desc, requestType: requestType})
+	}
+	g.mux.HandleFunc("GET "+OpenAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(g.openAPI)
+	})
+	return g, nil
+}
+
+// ServeHTTP routes a request to its RPC.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// methodDesc finds the handler of a TrainService RPC.
+func methodDesc(name string) (grpc.MethodDesc, error) {
+	for _, desc := range pb.TrainService_ServiceDesc.Methods {
+		if desc.MethodName == name {
+			return desc, nil
+		}
+	}
+	return grpc.MethodDesc{}, fmt.Errorf("RPC %s is not a unary method", name)
+}
+
+// chain combines interceptors into one, the first being the outermost.
+func chain(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, req any) (any, error) {
+				return interceptor(ctx, req, info, inner)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// handler serves one route.
+type handler struct {
+	gateway     *Gateway
+	route       Route
+	desc        grpc.MethodDesc
+	requestType protoreflect.MessageType
+}
+
+// ServeHTTP decodes the request message, calls the RPC and writes its response or status.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, h.route.Method+" "+h.route.Path, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	req := h.requestType.New().Interface()
+	if err := h.decode(w, r, req); err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	md := metadata.MD{}
+	for _, key := range forwardedHeaders {
+		if values := r.Header.Values(key); len(values) > 0 {
+			md.Set(key, values...)
+		}
+	}
+	ctx = metadata.NewIncomingContext(ctx, md)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: remoteAddr(r.RemoteAddr)})
+	stream := &transportStream{method: "/" + pb.TrainService_ServiceDesc.ServiceName + "/" + h.route.RPC}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+
+	resp, err := h.desc.Handler(h.gateway.service, ctx, func(in any) error {
+		proto.Merge(in.(proto.Message), req)
+		return nil
+	}, h.gateway.interceptor)
+
+	// Response headers and trailers, such as the request ID and retry-after, become HTTP headers
+	for _, md := range []metadata.MD{stream.header, stream.trailer} {
+		for key, values := range md {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	body, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(resp.(proto.Message))
+	if err != nil {
+		writeError(w, status.Errorf(codes.Internal, "could not encode response: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	code := h.route.Status
+	if code == 0 {
+		code = http.StatusOK
+	}
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// decode fills the request message from the JSON body, the path wildcards and the query parameters.
+func (h *handler) decode(w http.ResponseWriter, r *http.Request, req proto.Message) error {
+	if h.route.Body {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			return fmt.Errorf("could not read request body: %w", err)
+		}
+		if len(strings.TrimSpace(string(body))) > 0 {
+			if err := protojson.Unmarshal(body, req); err != nil {
+				return fmt.Errorf("invalid request body: %w", err)
+			}
+		}
+	}
+
+	message := req.ProtoReflect()
+	fields := message.Descriptor().Fields()
+	for _, name := range pathWildcards(h.route.Path) {
+		if err := setField(message, fields.ByName(protoreflect.Name(name)), []string{r.PathValue(name)}); err != nil {
+			return err
+		}
+	}
+	for name, values := range r.URL.Query() {
+		field := fields.ByName(protoreflect.Name(name))
+		if field == nil {
+			return fmt.Errorf("unknown query parameter %s", name)
+		}
+		if err := setField(message, field, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathWildcards returns the names of the wildcards of a route path.
+func pathWildcards(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.Trim(segment, "{}"))
+		}
+	}
+	return names
+}
+
+// setField sets a scalar or repeated scalar field from its text values.
+func setField(message protoreflect.Message, field protoreflect.FieldDescriptor, values []string) error {
+	if field == nil {
+		return fmt.Errorf("unknown request field")
+	}
+	if !field.IsList() && len(values) > 1 {
+		return fmt.Errorf("%s must be given once", field.Name())
+	}
+
+	var list protoreflect.List
+	if field.IsList() {
+		list = message.Mutable(field).List()
+	}
+	for _, text := range values {
+		var value protoreflect.Value
+		switch field.Kind() {
+		case protoreflect.StringKind:
+			value = protoreflect.ValueOfString(text)
+		case protoreflect.Int32Kind:
+			n, err := strconv.ParseInt(text, 10, 32)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer", field.Name())
+			}
+			value = protoreflect.ValueOfInt32(int32(n))
+		case protoreflect.BoolKind:
+			b, err := strconv.ParseBool(text)
+			if err != nil {
+				return fmt.Errorf("%s must be true or false", field.Name())
+			}
+			value = protoreflect.ValueOfBool(b)
+		default:
+			return fmt.Errorf("%s cannot be given in the path or query", field.Name())
+		}
+		if list != nil {
+			list.Append(value)
+		} else {
+			message.Set(field, value)
+		}
+	}
+	return nil
+}
+
+// remoteAddr parses the address of an HTTP client, so calls are rate limited by its IP address.
+func remoteAddr(address string) net.Addr {
+	if addr, err := net.ResolveTCPAddr("tcp", address); err == nil {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+
+// HTTPStatus returns the HTTP status matching a gRPC status code.
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // Client closed request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError writes a gRPC status as a google.rpc.Status JSON body with the matching HTTP status.
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	body, marshalErr := protojson.MarshalOptions{UseProtoNames: true}.Marshal(st.Proto())
+	if marshalErr != nil {
+		body = []byte(`{"code":13,"message":"could not encode error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatus(st.Code()))
+	w.Write(body)
+}
+
+// transportStream collects the headers and trailers set by the interceptors and handler of a call.
+type transportStream struct {
+	method  string
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+// Method returns the full method name of the call.
+func (s *transportStream) Method() string {
+	return s.method
+}
+
+// SetHeader adds response headers.
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+// SendHeader adds response headers, they are written with the response.
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+// SetTrailer adds response trailers.
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
@@ -0,0 +1,192 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"train-booking-service/auth"
+	pb "train-booking-service/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// trainService is a TrainService keeping tickets in a map.
+type trainService struct {
+	pb.UnimplementedTrainServiceServer
+	tickets  map[string]*pb.TicketReceipt
+	unblocks []*pb.UnblockSeatsRequest
+}
+
+func (s *trainService) PurchaseTicket(ctx context.Context, req *pb.PurchaseTicketRequest) (*pb.TicketPurchaseResponse, error) {
+	ticket := &pb.TicketReceipt{From: req.From, To: req.To, User: req.User, Seat: "A1", BookingReference: "ABC123"}
+	s.tickets[req.User.Email] = ticket
+	return &pb.TicketPurchaseResponse{Ticket: ticket, Message: "Ticket purchased successfully"}, nil
+}
+
+func (s *trainService) GetReceipt(ctx context.Context, req *pb.GetReceiptRequest) (*pb.GetReceiptResponse, error) {
+	ticket, ok := s.tickets[req.UserEmail]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "ticket for user with email %s not found", req.UserEmail)
+	}
+	return &pb.GetReceiptResponse{Ticket: ticket}, nil
+}
+
+func (s *trainService) ModifySeat(ctx context.Context, req *pb.ModifySeatRequest) (*pb.ModifySeatResponse, error) {
+	ticket := s.tickets[req.UserEmail]
+	ticket.Seat = req.NewSeat
+	return &pb.ModifySeatResponse{NewTicket: ticket, Message: "Seat modified successfully"}, nil
+}
+
+func (s *trainService) UnblockSeats(ctx context.Context, req *pb.UnblockSeatsRequest) (*pb.UnblockSeatsResponse, error) {
+	s.unblocks = append(s.unblocks, req)
+	return &pb.UnblockSeatsResponse{Seats: req.Seats}, nil
+}
+
+// newGateway creates a gateway whose interceptor records the calls and requires an API key.
+func newGateway(t *testing.T) (*Gateway, *trainService, *[]string) {
+	service := &trainService{tickets: map[string]*pb.TicketReceipt{}}
+	var methods []string
+	requireKey := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		methods = append(methods, info.FullMethod)
+		grpc.SetHeader(ctx, metadata.Pairs("x-request-id", "req-1"))
+		md, _ := metadata.FromIncomingContext(ctx)
+		switch key := md.Get(auth.APIKeyHeader); {
+		case len(key) == 0:
+			return nil, status.Error(codes.Unauthenticated, "missing credentials")
+		case key[0] == "exhausted":
+			grpc.SetTrailer(ctx, metadata.Pairs("retry-after", "3"))
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+	g, err := New(service, requireKey)
+	assert.NoError(t, err)
+	return g, service, &methods
+}
+
+// call sends a request to the gateway with an API key.
+func call(g *Gateway, method, target, apiKey, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set("X-Api-Key", apiKey)
+	}
+	recorder := httptest.NewRecorder()
+	g.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestGateway_Routes(t *testing.T) {
+	g, service, methods := newGateway(t)
+
+	resp := call(g, http.MethodPost, "/v1/tickets", "k", `{"from": "London", "to": "France", "user": {"first_name": "John", "last_name": "Doe", "email": "johndoe@example.com"}}`)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "req-1", resp.Header().Get("X-Request-Id"))
+	var purchase map[string]any
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &purchase))
+	assert.Equal(t, "ABC123", purchase["ticket"].(map[string]any)["booking_reference"])
+
+	// Path wildcards fill request fields, the body fills the others
+	resp = call(g, http.MethodPut, "/v1/tickets/johndoe@example.com/seat", "k", `{"new_seat": "B7"}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"seat":"B7"`)
+
+	resp = call(g, http.MethodGet, "/v1/tickets/johndoe%40example.com", "k", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"email":"johndoe@example.com"`)
+
+	// Query parameters fill request fields, repeated ones build lists
+	resp = call(g, http.MethodDelete, "/v1/seat-blocks?seats=A1&seats=A2", "k", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, []string{"A1", "A2"}, service.unblocks[0].Seats)
+
+	assert.Equal(t, []string{
+		pb.TrainService_PurchaseTicket_FullMethodName,
+		pb.TrainService_ModifySeat_FullMethodName,
+		pb.TrainService_GetReceipt_FullMethodName,
+		pb.TrainService_UnblockSeats_FullMethodName,
+	}, *methods)
+}
+
+func TestGateway_Errors(t *testing.T) {
+	g, _, _ := newGateway(t)
+
+	for name, test := range map[string]struct {
+		method, target, apiKey, body string
+		status                       int
+		code                         codes.Code
+	}{
+		"not found":             {http.MethodGet, "/v1/tickets/nobody@example.com", "k", "", http.StatusNotFound, codes.NotFound},
+		"unauthenticated":       {http.MethodGet, "/v1/tickets/nobody@example.com", "", "", http.StatusUnauthorized, codes.Unauthenticated},
+		"unimplemented":         {http.MethodPost, "/v1/tickets/nobody@example.com/check-in", "k", "", http.StatusNotImplemented, codes.Unimplemented},
+		"invalid body":          {http.MethodPost, "/v1/tickets", "k", `{"seat": 1}`, http.StatusBadRequest, codes.InvalidArgument},
+		"unknown query":         {http.MethodGet, "/v1/seat-blocks?page=2", "k", "", http.StatusBadRequest, codes.InvalidArgument},
+		"repeated single value": {http.MethodDelete, "/v1/seat-blocks?section=A&section=B", "k", "", http.StatusBadRequest, codes.InvalidArgument},
+	} {
+		resp := call(g, test.method, test.target, test.apiKey, test.body)
+		assert.Equal(t, test.status, resp.Code, name)
+
+		var body map[string]any
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body), name)
+		assert.Equal(t, float64(test.code), body["code"], name)
+		assert.NotEmpty(t, body["message"], name)
+	}
+
+	// Trailers such as retry-after become headers
+	resp := call(g, http.MethodGet, "/v1/seat-blocks", "exhausted", "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "3", resp.Header().Get("Retry-After"))
+
+	resp = call(g, http.MethodGet, "/v2/tickets", "k", "")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestOpenAPI(t *testing.T) {
+	g, _, _ := newGateway(t)
+	resp := call(g, http.MethodGet, OpenAPIPath, "", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var document struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &document))
+	assert.Equal(t, "3.0.3", document.OpenAPI)
+
+	// Every route is documented with the schemas of its messages
+	for _, route := range Routes {
+		operation := document.Paths[route.Path][strings.ToLower(route.Method)]
+		assert.Equal(t, route.RPC, operation["operationId"], route.Path)
+	}
+	assert.Contains(t, document.Paths["/v1/tickets"]["post"]["responses"], "201")
+	assert.Contains(t, document.Components.Schemas, "PurchaseTicketRequest")
+	assert.Contains(t, document.Components.Schemas, "User")
+	assert.Equal(t, map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/User"}},
+		document.Components.Schemas["TicketReceipt"]["properties"].(map[string]any)["infants"])
+	assert.Equal(t, map[string]any{"type": "string", "format": "byte"},
+		document.Components.Schemas["ExportManifestResponse"]["properties"].(map[string]any)["data"])
+
+	// Path wildcards and query parameters are listed
+	parameters := document.Paths["/v1/seat-blocks"]["delete"]["parameters"].([]any)
+	assert.Len(t, parameters, 2)
+	assert.Equal(t, "seats", parameters[0].(map[string]any)["name"])
+	assert.Equal(t, "path", document.Paths["/v1/tickets/{user_email}"]["get"]["parameters"].([]any)[0].(map[string]any)["in"])
+}
+
+func TestHTTPStatus(t *testing.T) {
+	assert.Equal(t, http.StatusOK, HTTPStatus(codes.OK))
+	assert.Equal(t, http.StatusConflict, HTTPStatus(codes.AlreadyExists))
+	assert.Equal(t, http.StatusForbidden, HTTPStatus(codes.PermissionDenied))
+	assert.Equal(t, http.StatusServiceUnavailable, HTTPStatus(codes.Unavailable))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(codes.DataLoss))
+}
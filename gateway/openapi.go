@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	pb "train-booking-service/proto"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// schemaRef returns a reference to the schema of a message.
+func schemaRef(message protoreflect.MessageDescriptor) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + string(message.Name())}
+}
+
+// fieldSchema returns the schema of a field, adding the schemas of the messages it refers to.
+func fieldSchema(field protoreflect.FieldDescriptor, schemas map[string]any) map[string]any {
+	var schema map[string]any
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		schema = map[string]any{"type": "string"}
+	case protoreflect.BoolKind:
+		schema = map[string]any{"type": "boolean"}
+	case protoreflect.Int32Kind:
+		schema = map[string]any{"type": "integer", "format": "int32"}
+	case protoreflect.FloatKind:
+		schema = map[string]any{"type": "number", "format": "float"}
+	case protoreflect.BytesKind:
+		schema = map[string]any{"type": "string", "format": "byte"}
+	case protoreflect.MessageKind:
+		addSchema(field.Message(), schemas)
+		schema = schemaRef(field.Message())
+	default:
+		schema = map[string]any{}
+	}
+	if field.IsList() {
+		return map[string]any{"type": "array", "items": schema}
+	}
+	return schema
+}
+
+// addSchema adds the schema of a message and of the messages its fields refer to.
+func addSchema(message protoreflect.MessageDescriptor, schemas map[string]any) {
+	name := string(message.Name())
+	if _, exists := schemas[name]; exists {
+		return
+	}
+	properties := map[string]any{}
+	schemas[name] = map[string]any{"type": "object", "properties": properties}
+
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		properties[string(fields.Get(i).Name())] = fieldSchema(fields.Get(i), schemas)
+	}
+}
+
+// OpenAPI generates the OpenAPI 3.0 document of the routes from the TrainService descriptors, so it always
+// matches the messages the gateway reads and writes.
+func OpenAPI() ([]byte, error) {
+	service := pb.File_proto_train_service_proto.Services().ByName("TrainService")
+	schemas := map[string]any{
+		"Status": map[string]any{
+			"type":        "object",
+			"description": "Error of a failed call, the gRPC status of the RPC.",
+			"properties": map[string]any{
+				"code":    map[string]any{"type": "integer", "format": "int32", "description": "gRPC status code"},
+				"message": map[string]any{"type": "string"},
+				"details": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+			},
+		},
+	}
+	paths := map[string]any{}
+
+	for _, route := range Routes {
+		method := service.Methods().ByName(protoreflect.Name(route.RPC))
+		if method == nil {
+			return nil, fmt.Errorf("route %s %s: unknown RPC %s", route.Method, route.Path, route.RPC)
+		}
+		addSchema(method.Input(), schemas)
+		addSchema(method.Output(), schemas)
+
+		var parameters []any
+		wildcards := pathWildcards(route.Path)
+		for _, name := range wildcards {
+			parameters = append(parameters, map[string]any{
+				"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		if !route.Body {
+			fields := method.Input().Fields()
+			for i := 0; i < fields.Len(); i++ {
+				field := fields.Get(i)
+				if field.Kind() == protoreflect.MessageKind || slices.Contains(wildcards, string(field.Name())) {
+					continue
+				}
+				parameters = append(parameters, map[string]any{
+					"name": string(field.Name()), "in": "query", "schema": fieldSchema(field, schemas),
+				})
+			}
+		}
+
+		successStatus := route.Status
+		if successStatus == 0 {
+			successStatus = http.StatusOK
+		}
+		operation := map[string]any{
+			"operationId": route.RPC,
+			"summary":     route.Summary,
+			"responses": map[string]any{
+				fmt.Sprint(successStatus): map[string]any{
+					"description": http.StatusText(successStatus),
+					"content":     map[string]any{"application/json": map[string]any{"schema": schemaRef(method.Output())}},
+				},
+				"default": map[string]any{
+					"description": "Error, with the HTTP status derived from the gRPC status code",
+					"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Status"}}},
+				},
+			},
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if route.Body {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schemaRef(method.Input())}},
+			}
+		}
+
+		path, _ := paths[route.Path].(map[string]any)
+		if path == nil {
+			path = map[string]any{}
+			paths[route.Path] = path
+		}
+		path[strings.ToLower(route.Method)] = operation
+	}
+
+	return json.MarshalIndent(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Train Booking Service",
+			"description": "HTTP/JSON API of TrainService. Fields use the names of the protobuf messages.",
+			"version":     "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": "x-api-key"},
+			},
+		},
+		"security": []any{map[string]any{"bearer": []any{}}, map[string]any{"apiKey": []any{}}},
+	}, "", "  ")
+}
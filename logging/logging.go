@@ -0,0 +1,244 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"train-booking-service/proto"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader is the metadata key carrying the request ID of a call, in requests and response headers.
+const RequestIDHeader = "x-request-id"
+
+// Define field name constants so every log record uses the same keys
+const (
+	KeyRequestID        = "request_id"
+	KeyMethod           = "method"
+	KeyCode             = "code"
+	KeyDuration         = "duration_ms"
+	KeyBookingReference = "booking_reference"
+	KeyTraceID          = "trace_id"
+	KeyError            = "error"
+	KeyEmail            = "email"
+	KeyFirstName        = "first_name"
+	KeyLastName         = "last_name"
+	KeyUser             = "user"
+)
+
+// emailPrefix starts every redacted email.
+const emailPrefix = "email:"
+
+// redacted replaces values that must not appear in logs.
+const redacted = "[redacted]"
+
+// emailPattern matches email addresses inside free text such as error messages.
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// requestIDPattern restricts the request IDs accepted from callers, so they cannot forge log output.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,64}$`)
+
+// New creates a logger writing records of at least level to w, as JSON when format is "json" and as text
+// otherwise. Passenger emails and names are redacted from every record.
+func New(w io.Writer, level, format string) *slog.Logger {
+	var logLevel slog.Level
+	logLevel.UnmarshalText([]byte(level))
+
+	options := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: Redact}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// Email returns a redacted form of an email address. Equal addresses give equal values, so the records of a
+// passenger can still be correlated without exposing the address.
+func Email(email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return emailPrefix + hex.EncodeToString(sum[:4])
+}
+
+// Redact is a slog.HandlerOptions.ReplaceAttr function removing personal data. Email and name attributes are
+// replaced, users keep only their passenger type, and email addresses inside any other text are masked.
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	switch a.Key {
+	case KeyEmail, "user_email", "target":
+		// Group members are passed through again, so values that are already redacted are kept
+		if email := a.Value.String(); email != "" && !strings.HasPrefix(email, emailPrefix) {
+			return slog.String(a.Key, Email(email))
+		}
+		return a
+	case KeyFirstName, KeyLastName, "name":
+		return slog.String(a.Key, redacted)
+	}
+
+	switch value := a.Value.Resolve(); value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, maskEmails(value.String()))
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case *proto.User:
+			return slog.Group(a.Key, slog.String(KeyEmail, Email(v.GetEmail())), slog.String("passenger_type", v.GetPassengerType()))
+		case error:
+			return slog.String(a.Key, maskEmails(v.Error()))
+		}
+	}
+	return a
+}
+
+// maskEmails replaces the email addresses in s with their redacted form.
+func maskEmails(s string) string {
+	return emailPattern.ReplaceAllStringFunc(s, Email)
+}
+
+// loggerKey is the context key of the logger of a call.
+type loggerKey struct{}
+
+// fieldsKey is the context key of the fields added to the record logged when a call finishes.
+type fieldsKey struct{}
+
+// fields collects attributes added by handlers while a call runs.
+type fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// FromContext returns the logger of a call, which carries its request ID and method, or the default logger
+// outside of a call.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Annotate adds attributes to the record logged when the call of ctx finishes.
+func Annotate(ctx context.Context, attrs ...slog.Attr) {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.attrs = append(f.attrs, attrs...)
+		f.mu.Unlock()
+	}
+}
+
+// BookingReference returns the attribute identifying the booking a record is about.
+func BookingReference(reference string) slog.Attr {
+	return slog.String(KeyBookingReference, reference)
+}
+
+// RequestID returns the request ID of the incoming call of ctx, or a new random one when the caller sent none
+// or an invalid one.
+func RequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(RequestIDHeader); len(values) > 0 && requestIDPattern.MatchString(values[0]) {
+		return values[0]
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// RPCLogger logs every gRPC call handled by the server with its request ID, method, status code and duration.
+type RPCLogger struct {
+	logger       *slog.Logger
+	debugMethods map[string]bool
+}
+
+// NewRPCLogger creates an RPCLogger writing to logger. Calls to debugMethods, such as health checks polled by
+// orchestrators, are logged at debug level.
+func NewRPCLogger(logger *slog.Logger, debugMethods []string) *RPCLogger {
+	l := &RPCLogger{logger: logger, debugMethods: make(map[string]bool)}
+	for _, method := range debugMethods {
+		l.debugMethods[method] = true
+	}
+	return l
+}
+
+// start attaches the logger and fields of a call to its context.
+func (l *RPCLogger) start(ctx context.Context, method string) (context.Context, string, *fields) {
+	requestID := RequestID(ctx)
+	logger := l.logger.With(slog.String(KeyRequestID, requestID), slog.String(KeyMethod, method))
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		logger = logger.With(slog.String(KeyTraceID, spanContext.TraceID().String()))
+	}
+
+	f := &fields{}
+	ctx = context.WithValue(ctx, loggerKey{}, logger)
+	ctx = context.WithValue(ctx, fieldsKey{}, f)
+	return ctx, requestID, f
+}
+
+// finish logs a handled call, at a level depending on its status code.
+func (l *RPCLogger) finish(ctx context.Context, method string, f *fields, err error, started time.Time) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch {
+	case l.debugMethods[method]:
+		level = slog.LevelDebug
+	case code == codes.Internal || code == codes.DataLoss:
+		level = slog.LevelError
+	case code != codes.OK:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String(KeyCode, code.String()),
+		slog.Float64(KeyDuration, float64(time.Since(started).Microseconds())/1000),
+	}
+	f.mu.Lock()
+	attrs = append(attrs, f.attrs...)
+	f.mu.Unlock()
+	if err != nil {
+		attrs = append(attrs, slog.String(KeyError, status.Convert(err).Message()))
+	}
+	FromContext(ctx).LogAttrs(context.Background(), level, "call finished", attrs...)
+}
+
+// UnaryServerInterceptor logs unary calls and returns their request ID in the response headers.
+func (l *RPCLogger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		started := time.Now()
+		ctx, requestID, f := l.start(ctx, info.FullMethod)
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, requestID))
+
+		resp, err := handler(ctx, req)
+		l.finish(ctx, info.FullMethod, f, err, started)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs streaming calls and returns their request ID in the response headers.
+func (l *RPCLogger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		started := time.Now()
+		ctx, requestID, f := l.start(stream.Context(), info.FullMethod)
+		stream.SetHeader(metadata.Pairs(RequestIDHeader, requestID))
+
+		err := handler(srv, &loggedStream{ServerStream: stream, ctx: ctx})
+		l.finish(ctx, info.FullMethod, f, err, started)
+		return err
+	}
+}
+
+// loggedStream is a server stream whose context carries the logger of the call.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the call.
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"train-booking-service/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// records decodes the JSON records written to output.
+func records(t *testing.T, output *bytes.Buffer) []map[string]any {
+	var result []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		result = append(result, record)
+	}
+	return result
+}
+
+func TestRedact(t *testing.T) {
+	var output bytes.Buffer
+	logger := New(&output, "info", "json")
+
+	user := &proto.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com", PassengerType: "adult"}
+	logger.Info("purchasing ticket for johndoe@example.com",
+		KeyUser, user,
+		KeyEmail, "johndoe@example.com",
+		KeyFirstName, "John",
+		KeyError, errors.New("user johndoe@example.com has already booked a ticket"),
+		"seat", "A1",
+	)
+
+	assert.NotContains(t, output.String(), "johndoe")
+	assert.NotContains(t, output.String(), "John")
+	assert.NotContains(t, output.String(), "Doe")
+
+	record := records(t, &output)[0]
+	assert.Equal(t, "purchasing ticket for "+Email("johndoe@example.com"), record["msg"])
+	assert.Equal(t, Email("johndoe@example.com"), record[KeyEmail])
+	assert.Equal(t, map[string]any{KeyEmail: Email("johndoe@example.com"), "passenger_type": "adult"}, record[KeyUser])
+	assert.Equal(t, redacted, record[KeyFirstName])
+	assert.Equal(t, "user "+Email("johndoe@example.com")+" has already booked a ticket", record[KeyError])
+	assert.Equal(t, "A1", record["seat"])
+
+	// Records below the configured level are dropped
+	output.Reset()
+	New(&output, "warn", "text").Info("ignored")
+	assert.Empty(t, output.String())
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var output bytes.Buffer
+	rpcLogger := NewRPCLogger(New(&output, "debug", "json"), []string{"/grpc.health.v1.Health/Check"})
+	interceptor := rpcLogger.UnaryServerInterceptor()
+
+	purchase := func(ctx context.Context, req any) (any, error) {
+		FromContext(ctx).Info("ticket purchased")
+		Annotate(ctx, BookingReference("ABC123"))
+		return "ok", nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "req-1"))
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/proto.TrainService/PurchaseTicket"}, purchase)
+	assert.NoError(t, err)
+
+	logged := records(t, &output)
+	assert.Len(t, logged, 2)
+	// Records written by the handler carry the request ID and method of the call
+	assert.Equal(t, "ticket purchased", logged[0]["msg"])
+	assert.Equal(t, "req-1", logged[0][KeyRequestID])
+	assert.Equal(t, "/proto.TrainService/PurchaseTicket", logged[0][KeyMethod])
+
+	assert.Equal(t, "call finished", logged[1]["msg"])
+	assert.Equal(t, "INFO", logged[1]["level"])
+	assert.Equal(t, "req-1", logged[1][KeyRequestID])
+	assert.Equal(t, "OK", logged[1][KeyCode])
+	assert.Equal(t, "ABC123", logged[1][KeyBookingReference])
+	assert.Contains(t, logged[1], KeyDuration)
+
+	// Failed calls are logged at warn level with their error, callers without a valid request ID get one
+	output.Reset()
+	notFound := func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.NotFound, "ticket for user with email johndoe@example.com not found")
+	}
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "bad id\n"))
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/proto.TrainService/GetReceipt"}, notFound)
+	assert.Error(t, err)
+
+	logged = records(t, &output)
+	assert.Equal(t, "WARN", logged[0]["level"])
+	assert.Equal(t, "NotFound", logged[0][KeyCode])
+	assert.Regexp(t, "^[0-9a-f]{32}$", logged[0][KeyRequestID])
+	assert.Equal(t, "ticket for user with email "+Email("johndoe@example.com")+" not found", logged[0][KeyError])
+
+	// Health checks are only logged at debug level
+	output.Reset()
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, purchase)
+	assert.NoError(t, err)
+	assert.Equal(t, "DEBUG", records(t, &output)[1]["level"])
+}
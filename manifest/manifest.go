@@ -0,0 +1,197 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"train-booking-service/proto"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Define export format constants for type safety
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl" // JSON Lines, one entry per line
+	FormatHTML  = "html"  // Printable page per coach
+)
+
+// contentTypes maps each export format to its media type.
+var contentTypes = map[string]string{
+	FormatCSV:   "text/csv; charset=utf-8",
+	FormatJSONL: "application/jsonl",
+	FormatHTML:  "text/html; charset=utf-8",
+}
+
+// csvHeader names the columns of the CSV export.
+var csvHeader = []string{
+	"coach", "seat", "fare_class", "booking_reference", "first_name", "last_name", "email", "passenger_type",
+	"date_of_birth", "from", "to", "infants", "assistance", "assistance_notes", "seat_attributes", "status",
+	"reseat_required",
+}
+
+// Manifest is the passenger manifest of the departure.
+type Manifest struct {
+	Departure   string // RFC 3339, empty when no departure is scheduled
+	GeneratedAt time.Time
+	Coaches     []*proto.ManifestCoach // In train order, the bookings without a seat last in a coach without a name
+}
+
+// Passengers counts the bookings on the manifest.
+func (m Manifest) Passengers() int {
+	count := 0
+	for _, coach := range m.Coaches {
+		count += len(coach.Entries)
+	}
+	return count
+}
+
+// ContentType returns the media type of an export format, or an empty string if the format is unknown.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Write writes the manifest to w in an export format.
+func Write(w io.Writer, format string, m Manifest) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, m)
+	case FormatJSONL:
+		return writeJSONL(w, m)
+	case FormatHTML:
+		return page.Execute(w, m)
+	default:
+		return fmt.Errorf("invalid manifest format %q: use csv, jsonl or html", format)
+	}
+}
+
+// writeCSV writes one row per booking, under a header row.
+func writeCSV(w io.Writer, m Manifest) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvHeader)
+	for _, coach := range m.Coaches {
+		for _, entry := range coach.Entries {
+			writer.Write(csvSafe([]string{
+				entry.Coach,
+				entry.Seat,
+				entry.FareClass,
+				entry.BookingReference,
+				entry.User.GetFirstName(),
+				entry.User.GetLastName(),
+				entry.User.GetEmail(),
+				entry.User.GetPassengerType(),
+				entry.User.GetDateOfBirth(),
+				entry.From,
+				entry.To,
+				infants(entry.Infants),
+				entry.Assistance.GetType(),
+				entry.Assistance.GetNotes(),
+				strings.Join(entry.SeatAttributes, ";"),
+				entry.Status,
+				strconv.FormatBool(entry.ReseatRequired),
+			}))
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvSafe prefixes cells starting like a formula with a quote, so spreadsheets show passenger input as text.
+func csvSafe(cells []string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+// writeJSONL writes each booking as a ManifestEntry JSON object on its own line.
+func writeJSONL(w io.Writer, m Manifest) error {
+	for _, coach := range m.Coaches {
+		for _, entry := range coach.Entries {
+			data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(entry)
+			if err != nil {
+				return fmt.Errorf("could not encode manifest entry: %w", err)
+			}
+			// Compact with encoding/json, as protojson varies its whitespace on purpose
+			var line bytes.Buffer
+			if err := json.Compact(&line, data); err != nil {
+				return fmt.Errorf("could not encode manifest entry: %w", err)
+			}
+			line.WriteByte('\n')
+			if _, err := line.WriteTo(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// name returns the full name of a user.
+func name(user *proto.User) string {
+	return strings.TrimSpace(user.GetFirstName() + " " + user.GetLastName())
+}
+
+// infants lists the infants of a booking with their dates of birth.
+func infants(users []*proto.User) string {
+	var names []string
+	for _, user := range users {
+		names = append(names, fmt.Sprintf("%s (%s)", name(user), user.DateOfBirth))
+	}
+	return strings.Join(names, "; ")
+}
+
+// page is the printable HTML manifest, each coach starting on a new page when printed.
+var page = template.Must(template.New("manifest").Funcs(template.FuncMap{
+	"name":    name,
+	"infants": infants,
+	"time":    func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Passenger manifest{{with .Departure}} {{.}}{{end}}</title>
+<style>
+body { font-family: sans-serif; font-size: 10pt; margin: 1.5cm; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #999; padding: 3px 6px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+tr { break-inside: avoid; }
+.assistance { font-weight: bold; }
+@media print { body { margin: 0; } section + section { break-before: page; } }
+</style>
+</head>
+<body>
+<h1>Passenger manifest</h1>
+<p>Departure: {{or .Departure "not scheduled"}}. {{.Passengers}} bookings, generated {{time .GeneratedAt}}.</p>
+{{- range .Coaches}}
+<section>
+{{- if .Name}}
+<h2>Coach {{.Name}}, {{.FareClass}}: {{len .Entries}} of {{.Capacity}} seats booked</h2>
+{{- else}}
+<h2>Without a seat: {{len .Entries}} bookings</h2>
+{{- end}}
+{{- if .Entries}}
+<table>
+<thead><tr><th>Seat</th><th>Passenger</th><th>Type</th><th>Journey</th><th>Infants</th><th>Assistance</th><th>Reference</th><th>Status</th></tr></thead>
+<tbody>
+{{- range .Entries}}
+<tr><td>{{.Seat}}{{range .SeatAttributes}} ({{.}}){{end}}</td><td>{{name .User}}</td><td>{{.User.PassengerType}}</td><td>{{.From}} to {{.To}}</td><td>{{infants .Infants}}</td><td{{if .Assistance}} class="assistance"{{end}}>{{with .Assistance}}{{.Type}}{{with .Notes}}: {{.}}{{end}}{{end}}</td><td>{{.BookingReference}}</td><td>{{.Status}}{{if .ReseatRequired}}, reseat required{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- else}}
+<p>No passengers.</p>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
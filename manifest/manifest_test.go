@@ -0,0 +1,100 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"train-booking-service/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testManifest returns a manifest with a seated booking requiring assistance, an empty coach and an unseated booking.
+func testManifest() Manifest {
+	return Manifest{
+		Departure:   "2030-01-01T09:00:00Z",
+		GeneratedAt: time.Date(2029, 12, 31, 18, 0, 0, 0, time.UTC),
+		Coaches: []*proto.ManifestCoach{
+			{Name: "W", FareClass: "standard", Capacity: 6, Entries: []*proto.ManifestEntry{{
+				Coach:            "W",
+				Seat:             "W1",
+				FareClass:        "standard",
+				BookingReference: "ABC123",
+				User:             &proto.User{FirstName: "Jane", LastName: "<Doe>", Email: "jane@example.com", PassengerType: "adult"},
+				From:             "London",
+				To:               "France",
+				Infants:          []*proto.User{{FirstName: "Baby", LastName: "Doe", DateOfBirth: "2029-06-01"}},
+				Assistance:       &proto.AssistanceRequest{Type: "wheelchair", Notes: "Ramp at France"},
+				SeatAttributes:   []string{"wheelchair"},
+				Status:           "checked_in",
+			}}},
+			{Name: "F", FareClass: "first", Capacity: 12},
+			{Entries: []*proto.ManifestEntry{{
+				FareClass: "sleeper",
+				User:      &proto.User{FirstName: "=cmd", LastName: "Doe", Email: "john@example.com", PassengerType: "adult"},
+				From:      "London",
+				To:        "France",
+				Status:    "denied_boarding",
+			}}},
+		},
+	}
+}
+
+func TestWrite_CSV(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, Write(&out, FormatCSV, testManifest()))
+
+	records, err := csv.NewReader(&out).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, []string{
+		"W", "W1", "standard", "ABC123", "Jane", "<Doe>", "jane@example.com", "adult", "", "London", "France",
+		"Baby Doe (2029-06-01)", "wheelchair", "Ramp at France", "wheelchair", "checked_in", "false",
+	}, records[1])
+
+	// Cells that spreadsheets would run as formulas are quoted
+	assert.Equal(t, "'=cmd", records[2][4])
+	assert.Empty(t, records[2][0])
+}
+
+func TestWrite_JSONL(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, Write(&out, FormatJSONL, testManifest()))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "W1", entry["seat"])
+	assert.Equal(t, "checked_in", entry["status"])
+	assert.Equal(t, "wheelchair", entry["assistance"].(map[string]any)["type"])
+	assert.NotContains(t, lines[0], ": ")
+}
+
+func TestWrite_HTML(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, Write(&out, FormatHTML, testManifest()))
+
+	page := out.String()
+	assert.Contains(t, page, "<h2>Coach W, standard: 1 of 6 seats booked</h2>")
+	assert.Contains(t, page, "<h2>Coach F, first: 0 of 12 seats booked</h2>")
+	assert.Contains(t, page, "<h2>Without a seat: 1 bookings</h2>")
+	assert.Contains(t, page, "2 bookings, generated 2029-12-31T18:00:00Z")
+	assert.Contains(t, page, `<td class="assistance">wheelchair: Ramp at France</td>`)
+	assert.Contains(t, page, "<td>W1 (wheelchair)</td>")
+
+	// Passenger input is escaped
+	assert.Contains(t, page, "Jane &lt;Doe&gt;")
+	assert.NotContains(t, page, "<Doe>")
+}
+
+func TestWrite_InvalidFormat(t *testing.T) {
+	assert.EqualError(t, Write(&bytes.Buffer{}, "pdf", testManifest()), `invalid manifest format "pdf": use csv, jsonl or html`)
+	assert.Empty(t, ContentType("pdf"))
+	assert.Equal(t, "text/csv; charset=utf-8", ContentType(FormatCSV))
+	assert.Equal(t, 2, testManifest().Passengers())
+}
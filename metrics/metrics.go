@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"train-booking-service/dao"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// namespace prefixes every metric name.
+const namespace = "train_booking"
+
+// Metrics holds the Prometheus metrics of the server.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+
+	purchases     *prometheus.CounterVec
+	modifications prometheus.Counter
+	removals      prometheus.Counter
+}
+
+// New initializes a new Metrics instance with its own registry, which also exports Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "gRPC calls handled, by method and status code.",
+		}, []string{"method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Time taken to handle gRPC calls, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		purchases: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "purchases_total",
+			Help:      "Tickets purchased, by fare class.",
+		}, []string{"fare_class"}),
+		modifications: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "seat_modifications_total",
+			Help:      "Bookings moved to another seat.",
+		}),
+		removals: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "removals_total",
+			Help:      "Bookings removed from the train.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.requests, m.latency, m.purchases, m.modifications, m.removals,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Registry returns the registry holding the metrics.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Purchased counts a ticket purchase in a fare class.
+func (m *Metrics) Purchased(fareClass string) {
+	m.purchases.WithLabelValues(fareClass).Inc()
+}
+
+// Modified counts a seat modification.
+func (m *Metrics) Modified() {
+	m.modifications.Inc()
+}
+
+// Removed counts a booking removal.
+func (m *Metrics) Removed() {
+	m.removals.Inc()
+}
+
+// observe records a handled call.
+func (m *Metrics) observe(method string, err error, started time.Time) {
+	m.requests.WithLabelValues(method, status.Code(err).String()).Inc()
+	m.latency.WithLabelValues(method).Observe(time.Since(started).Seconds())
+}
+
+// UnaryServerInterceptor records the status code and latency of unary calls.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		started := time.Now()
+		resp, err := handler(ctx, req)
+		m.observe(info.FullMethod, err, started)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records the status code and duration of streaming calls.
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		started := time.Now()
+		err := handler(srv, stream)
+		m.observe(info.FullMethod, err, started)
+		return err
+	}
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// daoCollector exports the seat inventory and bookings of a TrainDAO, read at scrape time.
+type daoCollector struct {
+	stats          func() (dao.Stats, bool)
+	availableSeats *prometheus.Desc
+	blockedSeats   *prometheus.Desc
+	ticketsSold    *prometheus.Desc
+	waitlist       *prometheus.Desc
+}
+
+// RegisterDAO exports the inventory of the train. stats returns false while no train state is loaded,
+// in which case no inventory is reported.
+func (m *Metrics) RegisterDAO(stats func() (dao.Stats, bool)) {
+	m.registry.MustRegister(&daoCollector{
+		stats: stats,
+		availableSeats: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "seats_available"),
+			"Free seats that are not blocked, by section.", []string{"section"}, nil),
+		blockedSeats: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "seats_blocked"),
+			"Seats taken out of service, by section.", []string{"section"}, nil),
+		ticketsSold: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "tickets_sold"),
+			"Current bookings, by fare class.", []string{"fare_class"}, nil),
+		waitlist: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "waitlist_length"),
+			"Bookings confirmed beyond capacity that are still waiting for a seat.", nil, nil),
+	})
+}
+
+// Describe sends the descriptors of the inventory metrics.
+func (c *daoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.availableSeats
+	ch <- c.blockedSeats
+	ch <- c.ticketsSold
+	ch <- c.waitlist
+}
+
+// Collect reads the current inventory of the train.
+func (c *daoCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, ok := c.stats()
+	if !ok {
+		return
+	}
+	for section, seats := range stats.AvailableSeats {
+		ch <- prometheus.MustNewConstMetric(c.availableSeats, prometheus.GaugeValue, float64(seats), section)
+	}
+	for section, seats := range stats.BlockedSeats {
+		ch <- prometheus.MustNewConstMetric(c.blockedSeats, prometheus.GaugeValue, float64(seats), section)
+	}
+	for fareClass, tickets := range stats.TicketsSold {
+		ch <- prometheus.MustNewConstMetric(c.ticketsSold, prometheus.GaugeValue, float64(tickets), fareClass)
+	}
+	ch <- prometheus.MustNewConstMetric(c.waitlist, prometheus.GaugeValue, float64(stats.Unseated))
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"train-booking-service/dao"
+	"train-booking-service/proto"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := New()
+	interceptor := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/proto.TrainService/GetReceipt"}
+
+	ok := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	notFound := func(ctx context.Context, req any) (any, error) { return nil, status.Error(codes.NotFound, "not found") }
+
+	_, err := interceptor(context.Background(), nil, info, ok)
+	assert.NoError(t, err)
+	_, err = interceptor(context.Background(), nil, info, ok)
+	assert.NoError(t, err)
+	_, err = interceptor(context.Background(), nil, info, notFound)
+	assert.Error(t, err)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.requests.WithLabelValues(info.FullMethod, "OK")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.requests.WithLabelValues(info.FullMethod, "NotFound")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.latency))
+}
+
+func TestDomainMetrics(t *testing.T) {
+	m := New()
+	trainDAO := dao.NewTrainDAO()
+	loaded := false
+	m.RegisterDAO(func() (dao.Stats, bool) {
+		if !loaded {
+			return dao.Stats{}, false
+		}
+		return trainDAO.GetStats(), true
+	})
+
+	// Nothing is reported before the train state is loaded
+	assert.Equal(t, 0, testutil.CollectAndCount(m.registry, "train_booking_seats_available"))
+	loaded = true
+
+	_, err := trainDAO.SaveTicket(context.Background(), &proto.User{FirstName: "John", LastName: "Doe", Email: "johndoe@example.com"}, "London", "France")
+	assert.NoError(t, err)
+	m.Purchased(dao.FareClassStandard)
+	m.Modified()
+	m.Removed()
+
+	expected := `
+# HELP train_booking_seats_available Free seats that are not blocked, by section.
+# TYPE train_booking_seats_available gauge
+train_booking_seats_available{section="A"} 24
+train_booking_seats_available{section="B"} 25
+train_booking_seats_available{section="F"} 12
+train_booking_seats_available{section="S"} 10
+train_booking_seats_available{section="W"} 6
+# HELP train_booking_tickets_sold Current bookings, by fare class.
+# TYPE train_booking_tickets_sold gauge
+train_booking_tickets_sold{fare_class="first"} 0
+train_booking_tickets_sold{fare_class="sleeper"} 0
+train_booking_tickets_sold{fare_class="standard"} 1
+# HELP train_booking_waitlist_length Bookings confirmed beyond capacity that are still waiting for a seat.
+# TYPE train_booking_waitlist_length gauge
+train_booking_waitlist_length 0
+# HELP train_booking_purchases_total Tickets purchased, by fare class.
+# TYPE train_booking_purchases_total counter
+train_booking_purchases_total{fare_class="standard"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(m.registry, strings.NewReader(expected),
+		"train_booking_seats_available", "train_booking_tickets_sold", "train_booking_waitlist_length", "train_booking_purchases_total"))
+
+	// The handler serves the exposition format
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "train_booking_seat_modifications_total 1")
+	assert.Contains(t, recorder.Body.String(), "train_booking_removals_total 1")
+	assert.Contains(t, recorder.Body.String(), "go_goroutines")
+}
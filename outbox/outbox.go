@@ -0,0 +1,311 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"train-booking-service/logging"
+	"train-booking-service/proto"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// maxBackoff caps the wait between two delivery attempts of an event.
+const maxBackoff = time.Minute
+
+// Source is the outbox the publisher reads: the event log of the TrainDAO, which records every event under the
+// same lock as the change it describes.
+type Source interface {
+	// EventsAfter returns the events recorded after the event with the given sequence, in order.
+	EventsAfter(ctx context.Context, sequence int64) ([]*proto.BookingEvent, error)
+}
+
+// Sink is a consumer events are delivered to. Delivery is at least once: an event may be delivered again after a
+// failed attempt or a restart, so consumers should ignore events whose sequence they have already seen.
+type Sink interface {
+	// Name identifies the sink in the delivery positions and dead letters, it must not change across restarts.
+	Name() string
+	// Deliver hands one event to the consumer, returning once the consumer has taken it.
+	Deliver(ctx context.Context, event *proto.BookingEvent) error
+}
+
+// Config controls how the publisher delivers events.
+type Config struct {
+	MaxAttempts  int           // Delivery attempts of an event before it goes to the dead letters
+	RetryBackoff time.Duration // Wait before the second attempt, doubling with each further attempt
+	PollInterval time.Duration // How often the outbox is checked for new events
+	Dir          string        // Directory of the delivery positions and dead letters, kept in memory when empty
+}
+
+// Publisher delivers the events of the outbox to every sink, in order. Each sink has its own position in the
+// outbox, so a failing sink does not hold back the others. An event a sink still rejects after every attempt is
+// kept as a dead letter, and the sink moves on to the next event.
+type Publisher struct {
+	source    Source
+	sinks     []Sink
+	config    Config
+	mu        sync.Mutex
+	positions map[string]int64 // Sequence of the last event delivered to each sink
+	dead      []*proto.DeadLetter
+	now       func() time.Time
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+// NewPublisher initializes a new Publisher instance delivering the events of source to sinks. When config.Dir is
+// set, the delivery positions and dead letters saved there are loaded, so a restarted publisher carries on where it
+// stopped.
+func NewPublisher(source Source, sinks []Sink, config Config) (*Publisher, error) {
+	if config.MaxAttempts < 1 {
+		return nil, fmt.Errorf("max delivery attempts must be at least 1")
+	}
+	p := &Publisher{
+		source:    source,
+		sinks:     sinks,
+		config:    config,
+		positions: make(map[string]int64),
+		now:       time.Now,
+		sleep:     sleep,
+	}
+	if config.Dir == "" {
+		return p, nil
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p.positionsPath())
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &p.positions); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", p.positionsPath(), err)
+		}
+	}
+	if p.dead, err = loadDeadLetters(p.deadLettersPath()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// positionsPath is the JSON file mapping each sink to the sequence of the last event delivered to it.
+func (p *Publisher) positionsPath() string {
+	return filepath.Join(p.config.Dir, "positions.json")
+}
+
+// deadLettersPath is the JSON Lines file of the dead letters, one DeadLetter per line.
+func (p *Publisher) deadLettersPath() string {
+	return filepath.Join(p.config.Dir, "dead-letters.jsonl")
+}
+
+// Run delivers new events to every sink until ctx is done, checking the outbox every poll interval.
+func (p *Publisher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, sink := range p.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(p.config.PollInterval)
+			defer ticker.Stop()
+			for {
+				if err := p.Drain(ctx, sink); err != nil && ctx.Err() == nil {
+					slog.Error("could not publish events", "sink", sink.Name(), logging.KeyError, err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Drain delivers to a sink every event it has not had yet, retrying each one with backoff. It stops early only
+// when ctx is done or its position cannot be saved.
+func (p *Publisher) Drain(ctx context.Context, sink Sink) error {
+	events, err := p.source.EventsAfter(ctx, p.Position(sink.Name()))
+	if err != nil {
+		return fmt.Errorf("could not read the outbox: %w", err)
+	}
+	for _, event := range events {
+		attempts, err := p.deliver(ctx, sink, event)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			slog.Warn("event dead-lettered", "sink", sink.Name(), "sequence", event.Sequence, "type", event.Type, "attempts", attempts, logging.KeyError, err)
+			if err := p.deadLetter(sink, event, attempts, err); err != nil {
+				return err
+			}
+		}
+		if err := p.advance(sink, event.Sequence); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver tries to deliver an event up to the maximum attempts, returning the attempts made and the last error.
+func (p *Publisher) deliver(ctx context.Context, sink Sink, event *proto.BookingEvent) (int, error) {
+	backoff := p.config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := sink.Deliver(ctx, event)
+		if err == nil || attempt == p.config.MaxAttempts {
+			return attempt, err
+		}
+		slog.Debug("event delivery failed, retrying", "sink", sink.Name(), "sequence", event.Sequence, "attempt", attempt, "backoff", backoff, logging.KeyError, err)
+		if err := p.sleep(ctx, backoff); err != nil {
+			return attempt, err
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// advance records that a sink is done with every event up to sequence. The position is saved after the event is
+// delivered, so an event is delivered again rather than lost if the publisher stops in between.
+func (p *Publisher) advance(sink Sink, sequence int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.positions[sink.Name()] = sequence
+	if p.config.Dir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(p.positions, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it, so a crash never leaves a truncated file behind
+	tmp := p.positionsPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("could not save delivery positions: %w", err)
+	}
+	if err := os.Rename(tmp, p.positionsPath()); err != nil {
+		return fmt.Errorf("could not save delivery positions: %w", err)
+	}
+	return nil
+}
+
+// deadLetter keeps an event a sink did not take.
+func (p *Publisher) deadLetter(sink Sink, event *proto.BookingEvent, attempts int, err error) error {
+	letter := &proto.DeadLetter{
+		Sink:     sink.Name(),
+		Event:    event,
+		Error:    err.Error(),
+		Attempts: int32(attempts),
+		FailedAt: p.now().UTC().Format(time.RFC3339),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config.Dir != "" {
+		if err := appendLine(p.deadLettersPath(), letter); err != nil {
+			return fmt.Errorf("could not save dead letter: %w", err)
+		}
+	}
+	p.dead = append(p.dead, letter)
+	return nil
+}
+
+// Position returns the sequence of the last event delivered to, or dead-lettered by, a sink.
+func (p *Publisher) Position(sink string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.positions[sink]
+}
+
+// DeadLetters returns the events the sinks did not take, oldest first.
+func (p *Publisher) DeadLetters() []*proto.DeadLetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*proto.DeadLetter(nil), p.dead...)
+}
+
+// encodeLine encodes a message as one line of JSON.
+func encodeLine(message protobuf.Message) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	// Compact with encoding/json, as protojson varies its whitespace on purpose
+	var line bytes.Buffer
+	if err := json.Compact(&line, data); err != nil {
+		return nil, err
+	}
+	line.WriteByte('\n')
+	return line.Bytes(), nil
+}
+
+// appendLine writes a message at the end of a JSON Lines file and syncs it.
+func appendLine(path string, message protobuf.Message) error {
+	line, err := encodeLine(message)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadDeadLetters reads the dead letters of a JSON Lines file. A missing file means there are none.
+func loadDeadLetters(path string) ([]*proto.DeadLetter, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var letters []*proto.DeadLetter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		letter := &proto.DeadLetter{}
+		if err := protojson.Unmarshal(scanner.Bytes(), letter); err != nil {
+			return nil, fmt.Errorf("could not parse dead letter on line %d of %s: %w", line, path, err)
+		}
+		letters = append(letters, letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	return letters, nil
+}
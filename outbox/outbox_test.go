@@ -0,0 +1,216 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"train-booking-service/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// testSource is an outbox of fixed events.
+type testSource []*proto.BookingEvent
+
+func (s testSource) EventsAfter(ctx context.Context, sequence int64) ([]*proto.BookingEvent, error) {
+	var events []*proto.BookingEvent
+	for _, event := range s {
+		if event.Sequence > sequence {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// events returns a source of n ticket purchases.
+func events(n int) testSource {
+	var source testSource
+	for i := 1; i <= n; i++ {
+		source = append(source, &proto.BookingEvent{Sequence: int64(i), Type: "TicketPurchased", OccurredAt: "2030-01-01T09:00:00Z"})
+	}
+	return source
+}
+
+// testSink records the sequences it is given and fails the attempts fail returns true for.
+type testSink struct {
+	mu        sync.Mutex
+	attempts  map[int64]int
+	delivered []int64
+	fail      func(sequence int64, attempt int) bool
+}
+
+func newTestSink(fail func(sequence int64, attempt int) bool) *testSink {
+	return &testSink{attempts: make(map[int64]int), fail: fail}
+}
+
+func (s *testSink) Name() string { return "test" }
+
+func (s *testSink) Deliver(ctx context.Context, event *proto.BookingEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts[event.Sequence]++
+	if s.fail != nil && s.fail(event.Sequence, s.attempts[event.Sequence]) {
+		return errors.New("consumer unavailable")
+	}
+	s.delivered = append(s.delivered, event.Sequence)
+	return nil
+}
+
+// newTestPublisher returns a publisher that records its backoffs instead of sleeping.
+func newTestPublisher(t *testing.T, source Source, sink Sink, dir string, backoffs *[]time.Duration) *Publisher {
+	p, err := NewPublisher(source, []Sink{sink}, Config{MaxAttempts: 3, RetryBackoff: time.Second, PollInterval: time.Millisecond, Dir: dir})
+	assert.NoError(t, err)
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		if backoffs != nil {
+			*backoffs = append(*backoffs, d)
+		}
+		return nil
+	}
+	return p
+}
+
+func TestPublisher_Retries(t *testing.T) {
+	sink := newTestSink(func(sequence int64, attempt int) bool { return sequence == 2 && attempt < 3 })
+	var backoffs []time.Duration
+	p := newTestPublisher(t, events(3), sink, "", &backoffs)
+
+	assert.NoError(t, p.Drain(context.Background(), sink))
+	assert.Equal(t, []int64{1, 2, 3}, sink.delivered)
+	assert.Equal(t, 3, sink.attempts[2])
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, backoffs)
+	assert.Equal(t, int64(3), p.Position("test"))
+	assert.Empty(t, p.DeadLetters())
+
+	// Events already delivered are not delivered again
+	assert.NoError(t, p.Drain(context.Background(), sink))
+	assert.Equal(t, []int64{1, 2, 3}, sink.delivered)
+}
+
+func TestPublisher_DeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	sink := newTestSink(func(sequence int64, attempt int) bool { return sequence == 1 })
+	p := newTestPublisher(t, events(2), sink, dir, nil)
+	p.now = func() time.Time { return time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC) }
+
+	// An event still failing after every attempt is dead-lettered and does not hold back the next ones
+	assert.NoError(t, p.Drain(context.Background(), sink))
+	assert.Equal(t, []int64{2}, sink.delivered)
+	assert.Equal(t, 3, sink.attempts[1])
+	letters := p.DeadLetters()
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "test", letters[0].Sink)
+	assert.Equal(t, int64(1), letters[0].Event.Sequence)
+	assert.Equal(t, "consumer unavailable", letters[0].Error)
+	assert.Equal(t, int32(3), letters[0].Attempts)
+	assert.Equal(t, "2030-01-01T09:00:00Z", letters[0].FailedAt)
+
+	// Positions and dead letters survive a restart
+	reopened := newTestPublisher(t, events(3), sink, dir, nil)
+	assert.Equal(t, int64(2), reopened.Position("test"))
+	assert.Len(t, reopened.DeadLetters(), 1)
+	assert.NoError(t, reopened.Drain(context.Background(), sink))
+	assert.Equal(t, []int64{2, 3}, sink.delivered)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "dead-letters.jsonl"), []byte("not json\n"), 0o600))
+	_, err := NewPublisher(events(0), nil, Config{MaxAttempts: 1, Dir: dir})
+	assert.ErrorContains(t, err, "could not parse dead letter on line 1")
+	_, err = NewPublisher(events(0), nil, Config{})
+	assert.Error(t, err)
+}
+
+func TestPublisher_Run(t *testing.T) {
+	sink := newTestSink(nil)
+	p := newTestPublisher(t, events(2), sink, "", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return p.Position("test") == 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, []int64{1, 2}, sink.delivered)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var headers []http.Header
+	var bodies []string
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		headers, bodies = append(headers, r.Header), append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, time.Second)
+	event := &proto.BookingEvent{Sequence: 7, Type: "TicketCancelled", OccurredAt: "2030-01-01T09:00:00Z"}
+	assert.ErrorContains(t, sink.Deliver(context.Background(), event), "503")
+
+	status = http.StatusNoContent
+	assert.NoError(t, sink.Deliver(context.Background(), event))
+	assert.Len(t, bodies, 2)
+	assert.Equal(t, "7", headers[1].Get(EventSequenceHeader))
+	assert.Equal(t, "TicketCancelled", headers[1].Get(EventTypeHeader))
+	assert.Equal(t, "application/json", headers[1].Get("Content-Type"))
+	assert.Contains(t, bodies[1], `"occurred_at":"2030-01-01T09:00:00Z"`)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink := NewFileSink(path)
+	for _, event := range events(2) {
+		assert.NoError(t, sink.Deliver(context.Background(), event))
+	}
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	var sequences []int64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		event := &proto.BookingEvent{}
+		assert.NoError(t, protojson.Unmarshal(scanner.Bytes(), event))
+		sequences = append(sequences, event.Sequence)
+	}
+	assert.Equal(t, []int64{1, 2}, sequences)
+}
+
+func TestBrokerSink(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "topics")
+	sink := NewBrokerSink(dir)
+	for i, eventType := range []string{"TicketPurchased", "TicketCancelled", "TicketPurchased"} {
+		assert.NoError(t, sink.Deliver(context.Background(), &proto.BookingEvent{Sequence: int64(i + 1), Type: eventType}))
+	}
+
+	// Every event is published on the topic of its type
+	topic := func(name string) []int64 {
+		file, err := os.Open(filepath.Join(dir, name+".jsonl"))
+		assert.NoError(t, err)
+		defer file.Close()
+		var sequences []int64
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			event := &proto.BookingEvent{}
+			assert.NoError(t, protojson.Unmarshal(scanner.Bytes(), event))
+			sequences = append(sequences, event.Sequence)
+		}
+		return sequences
+	}
+	assert.Equal(t, []int64{1, 3}, topic("TicketPurchased"))
+	assert.Equal(t, []int64{2}, topic("TicketCancelled"))
+
+	assert.Error(t, sink.Deliver(context.Background(), &proto.BookingEvent{Sequence: 4, Type: "../TicketPurchased"}))
+}
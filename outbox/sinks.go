@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"train-booking-service/proto"
+)
+
+// Define the headers of the webhook requests
+const (
+	EventSequenceHeader = "X-Event-Sequence" // Sequence of the event, for consumers to skip events already seen
+	EventTypeHeader     = "X-Event-Type"
+)
+
+// WebhookSink posts every event as JSON to an HTTP endpoint. Any 2xx answer means the endpoint took the event.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink initializes a new WebhookSink instance posting to url, each request timing out after timeout.
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Name identifies the sink by its URL.
+func (s *WebhookSink) Name() string {
+	return "webhook " + s.url
+}
+
+// Deliver posts the event, with its sequence and type in headers.
+func (s *WebhookSink) Deliver(ctx context.Context, event *proto.BookingEvent) error {
+	body, err := encodeLine(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventSequenceHeader, strconv.FormatInt(event.Sequence, 10))
+	req.Header.Set(EventTypeHeader, event.Type)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// FileSink appends every event to a JSON Lines file, one event per line, for consumers tailing the file.
+type FileSink struct {
+	path string
+}
+
+// NewFileSink initializes a new FileSink instance appending to path.
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+// Name identifies the sink by its path.
+func (s *FileSink) Name() string {
+	return "file " + s.path
+}
+
+// Deliver appends the event to the file and syncs it.
+func (s *FileSink) Deliver(ctx context.Context, event *proto.BookingEvent) error {
+	return appendLine(s.path, event)
+}
+
+// BrokerSink is a local stand-in for a message broker such as NATS or Kafka: it publishes every event on the topic
+// of its type, each topic being a JSON Lines file of the directory, such as TicketPurchased.jsonl, that consumers
+// read from their own offset.
+type BrokerSink struct {
+	dir string
+}
+
+// NewBrokerSink initializes a new BrokerSink instance keeping its topics in dir.
+func NewBrokerSink(dir string) *BrokerSink {
+	return &BrokerSink{dir: dir}
+}
+
+// Name identifies the sink by its directory.
+func (s *BrokerSink) Name() string {
+	return "broker " + s.dir
+}
+
+// Deliver appends the event to the topic of its type and syncs it.
+func (s *BrokerSink) Deliver(ctx context.Context, event *proto.BookingEvent) error {
+	if event.Type == "" || event.Type != filepath.Base(event.Type) {
+		return fmt.Errorf("event %d has no valid topic: %q", event.Sequence, event.Type)
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	return appendLine(filepath.Join(s.dir, event.Type+".jsonl"), event)
+}
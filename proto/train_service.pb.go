@@ -26,9 +26,12 @@ type User struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	FirstName string `protobuf:"bytes,1,opt,name=first_name,json=firstName,proto3" json:"first_name,omitempty"`
-	LastName  string `protobuf:"bytes,2,opt,name=last_name,json=lastName,proto3" json:"last_name,omitempty"`
-	Email     string `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
+	FirstName     string `protobuf:"bytes,1,opt,name=first_name,json=firstName,proto3" json:"first_name,omitempty"`
+	LastName      string `protobuf:"bytes,2,opt,name=last_name,json=lastName,proto3" json:"last_name,omitempty"`
+	Email         string `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
+	DateOfBirth   string `protobuf:"bytes,4,opt,name=date_of_birth,json=dateOfBirth,proto3" json:"date_of_birth,omitempty"`     // YYYY-MM-DD, required for child, senior and infant passengers
+	PassengerType string `protobuf:"bytes,5,opt,name=passenger_type,json=passengerType,proto3" json:"passenger_type,omitempty"` // "adult", "child", "senior" or "infant", derived from date_of_birth when empty
+	Railcard      string `protobuf:"bytes,6,opt,name=railcard,proto3" json:"railcard,omitempty"`                                // "student" or "disability"
 }
 
 func (x *User) Reset() {
@@ -82,17 +85,46 @@ func (x *User) GetEmail() string {
 	return ""
 }
 
+func (x *User) GetDateOfBirth() string {
+	if x != nil {
+		return x.DateOfBirth
+	}
+	return ""
+}
+
+func (x *User) GetPassengerType() string {
+	if x != nil {
+		return x.PassengerType
+	}
+	return ""
+}
+
+func (x *User) GetRailcard() string {
+	if x != nil {
+		return x.Railcard
+	}
+	return ""
+}
+
 // TicketReceipt message represents receipt details for ticket booking
 type TicketReceipt struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	From      string  `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
-	To        string  `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
-	User      *User   `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`
-	PricePaid float32 `protobuf:"fixed32,4,opt,name=price_paid,json=pricePaid,proto3" json:"price_paid,omitempty"`
-	Seat      string  `protobuf:"bytes,5,opt,name=seat,proto3" json:"seat,omitempty"`
+	From             string             `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To               string             `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	User             *User              `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`
+	PricePaid        float32            `protobuf:"fixed32,4,opt,name=price_paid,json=pricePaid,proto3" json:"price_paid,omitempty"`
+	Seat             string             `protobuf:"bytes,5,opt,name=seat,proto3" json:"seat,omitempty"`
+	FareClass        string             `protobuf:"bytes,6,opt,name=fare_class,json=fareClass,proto3" json:"fare_class,omitempty"`
+	Concession       string             `protobuf:"bytes,7,opt,name=concession,proto3" json:"concession,omitempty"`                                      // Concession applied to the fare, if any
+	Infants          []*User            `protobuf:"bytes,8,rep,name=infants,proto3" json:"infants,omitempty"`                                            // Infants travelling on the lap of the booking's user
+	Assistance       *AssistanceRequest `protobuf:"bytes,9,opt,name=assistance,proto3" json:"assistance,omitempty"`                                      // Special assistance requested for the journey, if any
+	ReseatRequired   bool               `protobuf:"varint,10,opt,name=reseat_required,json=reseatRequired,proto3" json:"reseat_required,omitempty"`      // Set when the seat was blocked and no replacement seat was free
+	Status           string             `protobuf:"bytes,11,opt,name=status,proto3" json:"status,omitempty"`                                             // "booked", "checked_in" or "denied_boarding", the seat is empty until check-in for overbooked tickets
+	BookingReference string             `protobuf:"bytes,12,opt,name=booking_reference,json=bookingReference,proto3" json:"booking_reference,omitempty"` // Short code identifying the booking, shown to the passenger and used in logs
+	BookedBy         string             `protobuf:"bytes,13,opt,name=booked_by,json=bookedBy,proto3" json:"booked_by,omitempty"`                         // Subject of the caller that purchased the ticket, booking limits are counted against it
 }
 
 func (x *TicketReceipt) Reset() {
@@ -160,20 +192,134 @@ func (x *TicketReceipt) GetSeat() string {
 	return ""
 }
 
+func (x *TicketReceipt) GetFareClass() string {
+	if x != nil {
+		return x.FareClass
+	}
+	return ""
+}
+
+func (x *TicketReceipt) GetConcession() string {
+	if x != nil {
+		return x.Concession
+	}
+	return ""
+}
+
+func (x *TicketReceipt) GetInfants() []*User {
+	if x != nil {
+		return x.Infants
+	}
+	return nil
+}
+
+func (x *TicketReceipt) GetAssistance() *AssistanceRequest {
+	if x != nil {
+		return x.Assistance
+	}
+	return nil
+}
+
+func (x *TicketReceipt) GetReseatRequired() bool {
+	if x != nil {
+		return x.ReseatRequired
+	}
+	return false
+}
+
+func (x *TicketReceipt) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *TicketReceipt) GetBookingReference() string {
+	if x != nil {
+		return x.BookingReference
+	}
+	return ""
+}
+
+func (x *TicketReceipt) GetBookedBy() string {
+	if x != nil {
+		return x.BookedBy
+	}
+	return ""
+}
+
+// AssistanceRequest message represents special assistance requested by a passenger
+type AssistanceRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type  string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"` // "wheelchair", "mobility", "visual", "hearing" or "other"
+	Notes string `protobuf:"bytes,2,opt,name=notes,proto3" json:"notes,omitempty"`
+}
+
+func (x *AssistanceRequest) Reset() {
+	*x = AssistanceRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AssistanceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AssistanceRequest) ProtoMessage() {}
+
+func (x *AssistanceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AssistanceRequest.ProtoReflect.Descriptor instead.
+func (*AssistanceRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AssistanceRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *AssistanceRequest) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
 // PurchaseTicketRequest message represents details of purchase request for a ticket
 type PurchaseTicketRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	From string `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
-	To   string `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
-	User *User  `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`
+	From          string             `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To            string             `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	User          *User              `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`
+	FareClass     string             `protobuf:"bytes,4,opt,name=fare_class,json=fareClass,proto3" json:"fare_class,omitempty"`             // "standard", "first" or "sleeper", defaults to "standard"
+	Infants       []*User            `protobuf:"bytes,5,rep,name=infants,proto3" json:"infants,omitempty"`                                  // Infants under two travelling without a seat
+	Assistance    *AssistanceRequest `protobuf:"bytes,6,opt,name=assistance,proto3" json:"assistance,omitempty"`                            // Special assistance required for the journey, if any
+	RequestedSeat string             `protobuf:"bytes,7,opt,name=requested_seat,json=requestedSeat,proto3" json:"requested_seat,omitempty"` // Seat to book, such as "A12", any free seat of the fare class when empty
 }
 
 func (x *PurchaseTicketRequest) Reset() {
 	*x = PurchaseTicketRequest{}
-	mi := &file_proto_train_service_proto_msgTypes[2]
+	mi := &file_proto_train_service_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -185,7 +331,7 @@ func (x *PurchaseTicketRequest) String() string {
 func (*PurchaseTicketRequest) ProtoMessage() {}
 
 func (x *PurchaseTicketRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[2]
+	mi := &file_proto_train_service_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -198,7 +344,7 @@ func (x *PurchaseTicketRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PurchaseTicketRequest.ProtoReflect.Descriptor instead.
 func (*PurchaseTicketRequest) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{2}
+	return file_proto_train_service_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *PurchaseTicketRequest) GetFrom() string {
@@ -222,6 +368,34 @@ func (x *PurchaseTicketRequest) GetUser() *User {
 	return nil
 }
 
+func (x *PurchaseTicketRequest) GetFareClass() string {
+	if x != nil {
+		return x.FareClass
+	}
+	return ""
+}
+
+func (x *PurchaseTicketRequest) GetInfants() []*User {
+	if x != nil {
+		return x.Infants
+	}
+	return nil
+}
+
+func (x *PurchaseTicketRequest) GetAssistance() *AssistanceRequest {
+	if x != nil {
+		return x.Assistance
+	}
+	return nil
+}
+
+func (x *PurchaseTicketRequest) GetRequestedSeat() string {
+	if x != nil {
+		return x.RequestedSeat
+	}
+	return ""
+}
+
 // TicketPurchaseResponse message represents details of purchased ticket
 type TicketPurchaseResponse struct {
 	state         protoimpl.MessageState
@@ -234,7 +408,7 @@ type TicketPurchaseResponse struct {
 
 func (x *TicketPurchaseResponse) Reset() {
 	*x = TicketPurchaseResponse{}
-	mi := &file_proto_train_service_proto_msgTypes[3]
+	mi := &file_proto_train_service_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -246,7 +420,7 @@ func (x *TicketPurchaseResponse) String() string {
 func (*TicketPurchaseResponse) ProtoMessage() {}
 
 func (x *TicketPurchaseResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[3]
+	mi := &file_proto_train_service_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -259,7 +433,7 @@ func (x *TicketPurchaseResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TicketPurchaseResponse.ProtoReflect.Descriptor instead.
 func (*TicketPurchaseResponse) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{3}
+	return file_proto_train_service_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *TicketPurchaseResponse) GetTicket() *TicketReceipt {
@@ -283,11 +457,12 @@ type GetReceiptRequest struct {
 	unknownFields protoimpl.UnknownFields
 
 	UserEmail string `protobuf:"bytes,1,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`
+	Revision  int32  `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"` // Revision of the booking to return, the current one when zero
 }
 
 func (x *GetReceiptRequest) Reset() {
 	*x = GetReceiptRequest{}
-	mi := &file_proto_train_service_proto_msgTypes[4]
+	mi := &file_proto_train_service_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -299,7 +474,7 @@ func (x *GetReceiptRequest) String() string {
 func (*GetReceiptRequest) ProtoMessage() {}
 
 func (x *GetReceiptRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[4]
+	mi := &file_proto_train_service_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -312,7 +487,7 @@ func (x *GetReceiptRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetReceiptRequest.ProtoReflect.Descriptor instead.
 func (*GetReceiptRequest) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{4}
+	return file_proto_train_service_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *GetReceiptRequest) GetUserEmail() string {
@@ -322,18 +497,26 @@ func (x *GetReceiptRequest) GetUserEmail() string {
 	return ""
 }
 
+func (x *GetReceiptRequest) GetRevision() int32 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
 // GetReceiptResponse message represents details of ticket receipt
 type GetReceiptResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Ticket *TicketReceipt `protobuf:"bytes,1,opt,name=ticket,proto3" json:"ticket,omitempty"`
+	Ticket   *TicketReceipt `protobuf:"bytes,1,opt,name=ticket,proto3" json:"ticket,omitempty"`
+	Revision int32          `protobuf:"varint,2,opt,name=revision,proto3" json:"revision,omitempty"` // Revision of the booking the ticket shows
 }
 
 func (x *GetReceiptResponse) Reset() {
 	*x = GetReceiptResponse{}
-	mi := &file_proto_train_service_proto_msgTypes[5]
+	mi := &file_proto_train_service_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -345,7 +528,7 @@ func (x *GetReceiptResponse) String() string {
 func (*GetReceiptResponse) ProtoMessage() {}
 
 func (x *GetReceiptResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[5]
+	mi := &file_proto_train_service_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -358,7 +541,7 @@ func (x *GetReceiptResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetReceiptResponse.ProtoReflect.Descriptor instead.
 func (*GetReceiptResponse) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{5}
+	return file_proto_train_service_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *GetReceiptResponse) GetTicket() *TicketReceipt {
@@ -368,18 +551,25 @@ func (x *GetReceiptResponse) GetTicket() *TicketReceipt {
 	return nil
 }
 
+func (x *GetReceiptResponse) GetRevision() int32 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
 // GetUsersBySectionRequest message represents request details of section required for user details
 type GetUsersBySectionRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Section string `protobuf:"bytes,1,opt,name=section,proto3" json:"section,omitempty"` // "A" or "B"
+	Section string `protobuf:"bytes,1,opt,name=section,proto3" json:"section,omitempty"` // "A", "B", "W", "F" or "S"
 }
 
 func (x *GetUsersBySectionRequest) Reset() {
 	*x = GetUsersBySectionRequest{}
-	mi := &file_proto_train_service_proto_msgTypes[6]
+	mi := &file_proto_train_service_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -391,7 +581,7 @@ func (x *GetUsersBySectionRequest) String() string {
 func (*GetUsersBySectionRequest) ProtoMessage() {}
 
 func (x *GetUsersBySectionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[6]
+	mi := &file_proto_train_service_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -404,7 +594,7 @@ func (x *GetUsersBySectionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetUsersBySectionRequest.ProtoReflect.Descriptor instead.
 func (*GetUsersBySectionRequest) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{6}
+	return file_proto_train_service_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *GetUsersBySectionRequest) GetSection() string {
@@ -425,7 +615,7 @@ type GetUsersBySectionResponse struct {
 
 func (x *GetUsersBySectionResponse) Reset() {
 	*x = GetUsersBySectionResponse{}
-	mi := &file_proto_train_service_proto_msgTypes[7]
+	mi := &file_proto_train_service_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -437,7 +627,7 @@ func (x *GetUsersBySectionResponse) String() string {
 func (*GetUsersBySectionResponse) ProtoMessage() {}
 
 func (x *GetUsersBySectionResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[7]
+	mi := &file_proto_train_service_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -450,7 +640,7 @@ func (x *GetUsersBySectionResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetUsersBySectionResponse.ProtoReflect.Descriptor instead.
 func (*GetUsersBySectionResponse) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{7}
+	return file_proto_train_service_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *GetUsersBySectionResponse) GetUserSeats() []*UserSeatAllocation {
@@ -472,7 +662,7 @@ type UserSeatAllocation struct {
 
 func (x *UserSeatAllocation) Reset() {
 	*x = UserSeatAllocation{}
-	mi := &file_proto_train_service_proto_msgTypes[8]
+	mi := &file_proto_train_service_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -484,7 +674,7 @@ func (x *UserSeatAllocation) String() string {
 func (*UserSeatAllocation) ProtoMessage() {}
 
 func (x *UserSeatAllocation) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[8]
+	mi := &file_proto_train_service_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -497,7 +687,7 @@ func (x *UserSeatAllocation) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UserSeatAllocation.ProtoReflect.Descriptor instead.
 func (*UserSeatAllocation) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{8}
+	return file_proto_train_service_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *UserSeatAllocation) GetUser() *User {
@@ -514,30 +704,28 @@ func (x *UserSeatAllocation) GetSeat() string {
 	return ""
 }
 
-// RemoveUserRequest message represents details of user to be removed
-type RemoveUserRequest struct {
+// GetAssistanceManifestRequest message represents a staff request for the assistance manifest of the departure
+type GetAssistanceManifestRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
-
-	UserEmail string `protobuf:"bytes,1,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`
 }
 
-func (x *RemoveUserRequest) Reset() {
-	*x = RemoveUserRequest{}
-	mi := &file_proto_train_service_proto_msgTypes[9]
+func (x *GetAssistanceManifestRequest) Reset() {
+	*x = GetAssistanceManifestRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *RemoveUserRequest) String() string {
+func (x *GetAssistanceManifestRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RemoveUserRequest) ProtoMessage() {}
+func (*GetAssistanceManifestRequest) ProtoMessage() {}
 
-func (x *RemoveUserRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[9]
+func (x *GetAssistanceManifestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -548,43 +736,36 @@ func (x *RemoveUserRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RemoveUserRequest.ProtoReflect.Descriptor instead.
-func (*RemoveUserRequest) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{9}
-}
-
-func (x *RemoveUserRequest) GetUserEmail() string {
-	if x != nil {
-		return x.UserEmail
-	}
-	return ""
+// Deprecated: Use GetAssistanceManifestRequest.ProtoReflect.Descriptor instead.
+func (*GetAssistanceManifestRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{10}
 }
 
-// RemoveUserResponse message represents response of user delete operation
-type RemoveUserResponse struct {
+// GetAssistanceManifestResponse message represents all assistance requests for the departure
+type GetAssistanceManifestResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Message string `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
-	User    *User  `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Departure string                     `protobuf:"bytes,1,opt,name=departure,proto3" json:"departure,omitempty"` // RFC 3339 departure time, empty when no departure is scheduled
+	Entries   []*AssistanceManifestEntry `protobuf:"bytes,2,rep,name=entries,proto3" json:"entries,omitempty"`
 }
 
-func (x *RemoveUserResponse) Reset() {
-	*x = RemoveUserResponse{}
-	mi := &file_proto_train_service_proto_msgTypes[10]
+func (x *GetAssistanceManifestResponse) Reset() {
+	*x = GetAssistanceManifestResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *RemoveUserResponse) String() string {
+func (x *GetAssistanceManifestResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RemoveUserResponse) ProtoMessage() {}
+func (*GetAssistanceManifestResponse) ProtoMessage() {}
 
-func (x *RemoveUserResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[10]
+func (x *GetAssistanceManifestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -595,50 +776,52 @@ func (x *RemoveUserResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RemoveUserResponse.ProtoReflect.Descriptor instead.
-func (*RemoveUserResponse) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{10}
+// Deprecated: Use GetAssistanceManifestResponse.ProtoReflect.Descriptor instead.
+func (*GetAssistanceManifestResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *RemoveUserResponse) GetMessage() string {
+func (x *GetAssistanceManifestResponse) GetDeparture() string {
 	if x != nil {
-		return x.Message
+		return x.Departure
 	}
 	return ""
 }
 
-func (x *RemoveUserResponse) GetUser() *User {
+func (x *GetAssistanceManifestResponse) GetEntries() []*AssistanceManifestEntry {
 	if x != nil {
-		return x.User
+		return x.Entries
 	}
 	return nil
 }
 
-// ModifySeatRequest message represents details required to modify a users seat
-type ModifySeatRequest struct {
+// AssistanceManifestEntry message represents a passenger who requested assistance and where they are seated
+type AssistanceManifestEntry struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	UserEmail string `protobuf:"bytes,1,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`
-	NewSeat   string `protobuf:"bytes,2,opt,name=new_seat,json=newSeat,proto3" json:"new_seat,omitempty"`
+	User           *User              `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Seat           string             `protobuf:"bytes,2,opt,name=seat,proto3" json:"seat,omitempty"`
+	Assistance     *AssistanceRequest `protobuf:"bytes,3,opt,name=assistance,proto3" json:"assistance,omitempty"`
+	SeatAttributes []string           `protobuf:"bytes,4,rep,name=seat_attributes,json=seatAttributes,proto3" json:"seat_attributes,omitempty"`
 }
 
-func (x *ModifySeatRequest) Reset() {
-	*x = ModifySeatRequest{}
-	mi := &file_proto_train_service_proto_msgTypes[11]
+func (x *AssistanceManifestEntry) Reset() {
+	*x = AssistanceManifestEntry{}
+	mi := &file_proto_train_service_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ModifySeatRequest) String() string {
+func (x *AssistanceManifestEntry) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ModifySeatRequest) ProtoMessage() {}
+func (*AssistanceManifestEntry) ProtoMessage() {}
 
-func (x *ModifySeatRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[11]
+func (x *AssistanceManifestEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -649,50 +832,2346 @@ func (x *ModifySeatRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ModifySeatRequest.ProtoReflect.Descriptor instead.
-func (*ModifySeatRequest) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{11}
+// Deprecated: Use AssistanceManifestEntry.ProtoReflect.Descriptor instead.
+func (*AssistanceManifestEntry) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{12}
 }
 
-func (x *ModifySeatRequest) GetUserEmail() string {
+func (x *AssistanceManifestEntry) GetUser() *User {
 	if x != nil {
-		return x.UserEmail
+		return x.User
 	}
-	return ""
+	return nil
 }
 
-func (x *ModifySeatRequest) GetNewSeat() string {
+func (x *AssistanceManifestEntry) GetSeat() string {
 	if x != nil {
-		return x.NewSeat
+		return x.Seat
 	}
 	return ""
 }
 
-// ModifySeatResponse message represents details of the modified seat
-type ModifySeatResponse struct {
+func (x *AssistanceManifestEntry) GetAssistance() *AssistanceRequest {
+	if x != nil {
+		return x.Assistance
+	}
+	return nil
+}
+
+func (x *AssistanceManifestEntry) GetSeatAttributes() []string {
+	if x != nil {
+		return x.SeatAttributes
+	}
+	return nil
+}
+
+// RemoveUserRequest message represents details of user to be removed
+type RemoveUserRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Message   string         `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
-	NewTicket *TicketReceipt `protobuf:"bytes,2,opt,name=new_ticket,json=newTicket,proto3" json:"new_ticket,omitempty"`
+	UserEmail string `protobuf:"bytes,1,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`
 }
 
-func (x *ModifySeatResponse) Reset() {
-	*x = ModifySeatResponse{}
-	mi := &file_proto_train_service_proto_msgTypes[12]
+func (x *RemoveUserRequest) Reset() {
+	*x = RemoveUserRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ModifySeatResponse) String() string {
+func (x *RemoveUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveUserRequest) ProtoMessage() {}
+
+func (x *RemoveUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveUserRequest.ProtoReflect.Descriptor instead.
+func (*RemoveUserRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RemoveUserRequest) GetUserEmail() string {
+	if x != nil {
+		return x.UserEmail
+	}
+	return ""
+}
+
+// RemoveUserResponse message represents response of user delete operation
+type RemoveUserResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message string `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	User    *User  `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+}
+
+func (x *RemoveUserResponse) Reset() {
+	*x = RemoveUserResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveUserResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveUserResponse) ProtoMessage() {}
+
+func (x *RemoveUserResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveUserResponse.ProtoReflect.Descriptor instead.
+func (*RemoveUserResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RemoveUserResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *RemoveUserResponse) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+// ModifySeatRequest message represents details required to modify a users seat
+type ModifySeatRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	UserEmail string `protobuf:"bytes,1,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`
+	NewSeat   string `protobuf:"bytes,2,opt,name=new_seat,json=newSeat,proto3" json:"new_seat,omitempty"`
+}
+
+func (x *ModifySeatRequest) Reset() {
+	*x = ModifySeatRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ModifySeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ModifySeatRequest) ProtoMessage() {}
+
+func (x *ModifySeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ModifySeatRequest.ProtoReflect.Descriptor instead.
+func (*ModifySeatRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ModifySeatRequest) GetUserEmail() string {
+	if x != nil {
+		return x.UserEmail
+	}
+	return ""
+}
+
+func (x *ModifySeatRequest) GetNewSeat() string {
+	if x != nil {
+		return x.NewSeat
+	}
+	return ""
+}
+
+// ModifySeatResponse message represents details of the modified seat
+type ModifySeatResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message        string         `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	NewTicket      *TicketReceipt `protobuf:"bytes,2,opt,name=new_ticket,json=newTicket,proto3" json:"new_ticket,omitempty"`
+	FareDifference float32        `protobuf:"fixed32,3,opt,name=fare_difference,json=fareDifference,proto3" json:"fare_difference,omitempty"` // Amount charged on top of the original fare when moving to a higher fare class
+}
+
+func (x *ModifySeatResponse) Reset() {
+	*x = ModifySeatResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ModifySeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ModifySeatResponse) ProtoMessage() {}
+
+func (x *ModifySeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ModifySeatResponse.ProtoReflect.Descriptor instead.
+func (*ModifySeatResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ModifySeatResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ModifySeatResponse) GetNewTicket() *TicketReceipt {
+	if x != nil {
+		return x.NewTicket
+	}
+	return nil
+}
+
+func (x *ModifySeatResponse) GetFareDifference() float32 {
+	if x != nil {
+		return x.FareDifference
+	}
+	return 0
+}
+
+// SeatBlock message represents a seat taken out of service by an operator
+type SeatBlock struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Seat      string `protobuf:"bytes,1,opt,name=seat,proto3" json:"seat,omitempty"`
+	Reason    string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	BlockedAt string `protobuf:"bytes,3,opt,name=blocked_at,json=blockedAt,proto3" json:"blocked_at,omitempty"` // RFC 3339
+	ExpiresAt string `protobuf:"bytes,4,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"` // RFC 3339, empty when the block does not expire
+}
+
+func (x *SeatBlock) Reset() {
+	*x = SeatBlock{}
+	mi := &file_proto_train_service_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SeatBlock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SeatBlock) ProtoMessage() {}
+
+func (x *SeatBlock) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SeatBlock.ProtoReflect.Descriptor instead.
+func (*SeatBlock) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *SeatBlock) GetSeat() string {
+	if x != nil {
+		return x.Seat
+	}
+	return ""
+}
+
+func (x *SeatBlock) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *SeatBlock) GetBlockedAt() string {
+	if x != nil {
+		return x.BlockedAt
+	}
+	return ""
+}
+
+func (x *SeatBlock) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+// BlockSeatsRequest message represents seats, or a whole section, to be taken out of service
+type BlockSeatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Seats     []string `protobuf:"bytes,1,rep,name=seats,proto3" json:"seats,omitempty"`
+	Section   string   `protobuf:"bytes,2,opt,name=section,proto3" json:"section,omitempty"` // Blocks every seat in the section
+	Reason    string   `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	ExpiresAt string   `protobuf:"bytes,4,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"` // RFC 3339, optional
+}
+
+func (x *BlockSeatsRequest) Reset() {
+	*x = BlockSeatsRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockSeatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockSeatsRequest) ProtoMessage() {}
+
+func (x *BlockSeatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockSeatsRequest.ProtoReflect.Descriptor instead.
+func (*BlockSeatsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *BlockSeatsRequest) GetSeats() []string {
+	if x != nil {
+		return x.Seats
+	}
+	return nil
+}
+
+func (x *BlockSeatsRequest) GetSection() string {
+	if x != nil {
+		return x.Section
+	}
+	return ""
+}
+
+func (x *BlockSeatsRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *BlockSeatsRequest) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+// BlockSeatsResponse message represents the blocked seats and the bookings affected by the block
+type BlockSeatsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message         string           `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Blocks          []*SeatBlock     `protobuf:"bytes,2,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	ReseatedTickets []*TicketReceipt `protobuf:"bytes,3,rep,name=reseated_tickets,json=reseatedTickets,proto3" json:"reseated_tickets,omitempty"` // Bookings moved off a blocked seat
+	FlaggedTickets  []*TicketReceipt `protobuf:"bytes,4,rep,name=flagged_tickets,json=flaggedTickets,proto3" json:"flagged_tickets,omitempty"`    // Bookings left on a blocked seat because no replacement seat was free
+}
+
+func (x *BlockSeatsResponse) Reset() {
+	*x = BlockSeatsResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockSeatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockSeatsResponse) ProtoMessage() {}
+
+func (x *BlockSeatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockSeatsResponse.ProtoReflect.Descriptor instead.
+func (*BlockSeatsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *BlockSeatsResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *BlockSeatsResponse) GetBlocks() []*SeatBlock {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
+}
+
+func (x *BlockSeatsResponse) GetReseatedTickets() []*TicketReceipt {
+	if x != nil {
+		return x.ReseatedTickets
+	}
+	return nil
+}
+
+func (x *BlockSeatsResponse) GetFlaggedTickets() []*TicketReceipt {
+	if x != nil {
+		return x.FlaggedTickets
+	}
+	return nil
+}
+
+// UnblockSeatsRequest message represents seats, or a whole section, to be returned to service
+type UnblockSeatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Seats   []string `protobuf:"bytes,1,rep,name=seats,proto3" json:"seats,omitempty"`
+	Section string   `protobuf:"bytes,2,opt,name=section,proto3" json:"section,omitempty"` // Unblocks every seat in the section
+}
+
+func (x *UnblockSeatsRequest) Reset() {
+	*x = UnblockSeatsRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnblockSeatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnblockSeatsRequest) ProtoMessage() {}
+
+func (x *UnblockSeatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnblockSeatsRequest.ProtoReflect.Descriptor instead.
+func (*UnblockSeatsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *UnblockSeatsRequest) GetSeats() []string {
+	if x != nil {
+		return x.Seats
+	}
+	return nil
+}
+
+func (x *UnblockSeatsRequest) GetSection() string {
+	if x != nil {
+		return x.Section
+	}
+	return ""
+}
+
+// UnblockSeatsResponse message represents the seats returned to service
+type UnblockSeatsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message string   `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Seats   []string `protobuf:"bytes,2,rep,name=seats,proto3" json:"seats,omitempty"`
+}
+
+func (x *UnblockSeatsResponse) Reset() {
+	*x = UnblockSeatsResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnblockSeatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnblockSeatsResponse) ProtoMessage() {}
+
+func (x *UnblockSeatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnblockSeatsResponse.ProtoReflect.Descriptor instead.
+func (*UnblockSeatsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *UnblockSeatsResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *UnblockSeatsResponse) GetSeats() []string {
+	if x != nil {
+		return x.Seats
+	}
+	return nil
+}
+
+// ListSeatBlocksRequest message represents a request for all seats currently out of service
+type ListSeatBlocksRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListSeatBlocksRequest) Reset() {
+	*x = ListSeatBlocksRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSeatBlocksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSeatBlocksRequest) ProtoMessage() {}
+
+func (x *ListSeatBlocksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSeatBlocksRequest.ProtoReflect.Descriptor instead.
+func (*ListSeatBlocksRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{22}
+}
+
+// ListSeatBlocksResponse message represents all seats currently out of service
+type ListSeatBlocksResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blocks []*SeatBlock `protobuf:"bytes,1,rep,name=blocks,proto3" json:"blocks,omitempty"`
+}
+
+func (x *ListSeatBlocksResponse) Reset() {
+	*x = ListSeatBlocksResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSeatBlocksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSeatBlocksResponse) ProtoMessage() {}
+
+func (x *ListSeatBlocksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSeatBlocksResponse.ProtoReflect.Descriptor instead.
+func (*ListSeatBlocksResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ListSeatBlocksResponse) GetBlocks() []*SeatBlock {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
+}
+
+// CheckInRequest message represents details of the user checking in for the departure
+type CheckInRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	UserEmail string `protobuf:"bytes,1,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`
+}
+
+func (x *CheckInRequest) Reset() {
+	*x = CheckInRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckInRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckInRequest) ProtoMessage() {}
+
+func (x *CheckInRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckInRequest.ProtoReflect.Descriptor instead.
+func (*CheckInRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *CheckInRequest) GetUserEmail() string {
+	if x != nil {
+		return x.UserEmail
+	}
+	return ""
+}
+
+// CheckInResponse message represents the checked in ticket, with the seat assigned at check-in for overbooked tickets
+type CheckInResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message string         `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Ticket  *TicketReceipt `protobuf:"bytes,2,opt,name=ticket,proto3" json:"ticket,omitempty"`
+}
+
+func (x *CheckInResponse) Reset() {
+	*x = CheckInResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckInResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckInResponse) ProtoMessage() {}
+
+func (x *CheckInResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckInResponse.ProtoReflect.Descriptor instead.
+func (*CheckInResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *CheckInResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *CheckInResponse) GetTicket() *TicketReceipt {
+	if x != nil {
+		return x.Ticket
+	}
+	return nil
+}
+
+// SetDepartureRequest message represents the schedule and booking policy of the departure
+type SetDepartureRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	DepartureTime        string `protobuf:"bytes,1,opt,name=departure_time,json=departureTime,proto3" json:"departure_time,omitempty"`                       // RFC 3339
+	AssistanceCutoff     string `protobuf:"bytes,2,opt,name=assistance_cutoff,json=assistanceCutoff,proto3" json:"assistance_cutoff,omitempty"`              // Go duration such as "24h", defaults to 24h
+	OverbookingAllowance int32  `protobuf:"varint,3,opt,name=overbooking_allowance,json=overbookingAllowance,proto3" json:"overbooking_allowance,omitempty"` // Bookings confirmed without a seat once a fare class is full
+}
+
+func (x *SetDepartureRequest) Reset() {
+	*x = SetDepartureRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDepartureRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDepartureRequest) ProtoMessage() {}
+
+func (x *SetDepartureRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDepartureRequest.ProtoReflect.Descriptor instead.
+func (*SetDepartureRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *SetDepartureRequest) GetDepartureTime() string {
+	if x != nil {
+		return x.DepartureTime
+	}
+	return ""
+}
+
+func (x *SetDepartureRequest) GetAssistanceCutoff() string {
+	if x != nil {
+		return x.AssistanceCutoff
+	}
+	return ""
+}
+
+func (x *SetDepartureRequest) GetOverbookingAllowance() int32 {
+	if x != nil {
+		return x.OverbookingAllowance
+	}
+	return 0
+}
+
+// SetDepartureResponse message represents the updated departure
+type SetDepartureResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message string `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (x *SetDepartureResponse) Reset() {
+	*x = SetDepartureResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetDepartureResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetDepartureResponse) ProtoMessage() {}
+
+func (x *SetDepartureResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetDepartureResponse.ProtoReflect.Descriptor instead.
+func (*SetDepartureResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *SetDepartureResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// GetDeniedBoardingReportRequest message represents a request for the passengers who could not be seated
+type GetDeniedBoardingReportRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *GetDeniedBoardingReportRequest) Reset() {
+	*x = GetDeniedBoardingReportRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDeniedBoardingReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDeniedBoardingReportRequest) ProtoMessage() {}
+
+func (x *GetDeniedBoardingReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDeniedBoardingReportRequest.ProtoReflect.Descriptor instead.
+func (*GetDeniedBoardingReportRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{28}
+}
+
+// GetDeniedBoardingReportResponse message represents the overbooked tickets still without a seat
+type GetDeniedBoardingReportResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Departure string           `protobuf:"bytes,1,opt,name=departure,proto3" json:"departure,omitempty"` // RFC 3339 departure time, empty when no departure is scheduled
+	Tickets   []*TicketReceipt `protobuf:"bytes,2,rep,name=tickets,proto3" json:"tickets,omitempty"`
+}
+
+func (x *GetDeniedBoardingReportResponse) Reset() {
+	*x = GetDeniedBoardingReportResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDeniedBoardingReportResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDeniedBoardingReportResponse) ProtoMessage() {}
+
+func (x *GetDeniedBoardingReportResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDeniedBoardingReportResponse.ProtoReflect.Descriptor instead.
+func (*GetDeniedBoardingReportResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *GetDeniedBoardingReportResponse) GetDeparture() string {
+	if x != nil {
+		return x.Departure
+	}
+	return ""
+}
+
+func (x *GetDeniedBoardingReportResponse) GetTickets() []*TicketReceipt {
+	if x != nil {
+		return x.Tickets
+	}
+	return nil
+}
+
+// BulkPurchaseRequest message represents one booking of a bulk purchase, the options are read from the first message
+type BulkPurchaseRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Row          int32                  `protobuf:"varint,1,opt,name=row,proto3" json:"row,omitempty"` // Row of the booking in the imported file, echoed in its result, defaults to its position in the stream
+	Ticket       *PurchaseTicketRequest `protobuf:"bytes,2,opt,name=ticket,proto3" json:"ticket,omitempty"`
+	DryRun       bool                   `protobuf:"varint,3,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`                     // Validate every booking and report the seats they would get without booking anything
+	AllOrNothing bool                   `protobuf:"varint,4,opt,name=all_or_nothing,json=allOrNothing,proto3" json:"all_or_nothing,omitempty"` // Book nothing unless every booking can be made
+}
+
+func (x *BulkPurchaseRequest) Reset() {
+	*x = BulkPurchaseRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BulkPurchaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BulkPurchaseRequest) ProtoMessage() {}
+
+func (x *BulkPurchaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BulkPurchaseRequest.ProtoReflect.Descriptor instead.
+func (*BulkPurchaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *BulkPurchaseRequest) GetRow() int32 {
+	if x != nil {
+		return x.Row
+	}
+	return 0
+}
+
+func (x *BulkPurchaseRequest) GetTicket() *PurchaseTicketRequest {
+	if x != nil {
+		return x.Ticket
+	}
+	return nil
+}
+
+func (x *BulkPurchaseRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *BulkPurchaseRequest) GetAllOrNothing() bool {
+	if x != nil {
+		return x.AllOrNothing
+	}
+	return false
+}
+
+// BulkPurchaseResult message represents the outcome of one booking of a bulk purchase
+type BulkPurchaseResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Row    int32          `protobuf:"varint,1,opt,name=row,proto3" json:"row,omitempty"`
+	Ticket *TicketReceipt `protobuf:"bytes,2,opt,name=ticket,proto3" json:"ticket,omitempty"` // Ticket booked, or that would have been booked when nothing was kept, unset on error
+	Error  string         `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`   // Why the booking could not be made, empty on success
+	Code   string         `protobuf:"bytes,4,opt,name=code,proto3" json:"code,omitempty"`     // gRPC status code of the error, such as "AlreadyExists", empty on success
+}
+
+func (x *BulkPurchaseResult) Reset() {
+	*x = BulkPurchaseResult{}
+	mi := &file_proto_train_service_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BulkPurchaseResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BulkPurchaseResult) ProtoMessage() {}
+
+func (x *BulkPurchaseResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BulkPurchaseResult.ProtoReflect.Descriptor instead.
+func (*BulkPurchaseResult) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *BulkPurchaseResult) GetRow() int32 {
+	if x != nil {
+		return x.Row
+	}
+	return 0
+}
+
+func (x *BulkPurchaseResult) GetTicket() *TicketReceipt {
+	if x != nil {
+		return x.Ticket
+	}
+	return nil
+}
+
+func (x *BulkPurchaseResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *BulkPurchaseResult) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+// BulkPurchaseResponse message represents the outcome of every booking of a bulk purchase, in the order they were sent
+type BulkPurchaseResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message string                `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Results []*BulkPurchaseResult `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	Booked  int32                 `protobuf:"varint,3,opt,name=booked,proto3" json:"booked,omitempty"` // Bookings kept, zero on a dry run or when an all-or-nothing purchase failed
+	Failed  int32                 `protobuf:"varint,4,opt,name=failed,proto3" json:"failed,omitempty"` // Bookings that could not be made
+}
+
+func (x *BulkPurchaseResponse) Reset() {
+	*x = BulkPurchaseResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BulkPurchaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BulkPurchaseResponse) ProtoMessage() {}
+
+func (x *BulkPurchaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BulkPurchaseResponse.ProtoReflect.Descriptor instead.
+func (*BulkPurchaseResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *BulkPurchaseResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *BulkPurchaseResponse) GetResults() []*BulkPurchaseResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *BulkPurchaseResponse) GetBooked() int32 {
+	if x != nil {
+		return x.Booked
+	}
+	return 0
+}
+
+func (x *BulkPurchaseResponse) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+// ManifestEntry message represents a booking on the passenger manifest
+type ManifestEntry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Coach            string             `protobuf:"bytes,1,opt,name=coach,proto3" json:"coach,omitempty"` // Section the passenger is seated in, empty for bookings without a seat
+	Seat             string             `protobuf:"bytes,2,opt,name=seat,proto3" json:"seat,omitempty"`
+	FareClass        string             `protobuf:"bytes,3,opt,name=fare_class,json=fareClass,proto3" json:"fare_class,omitempty"`
+	BookingReference string             `protobuf:"bytes,4,opt,name=booking_reference,json=bookingReference,proto3" json:"booking_reference,omitempty"`
+	User             *User              `protobuf:"bytes,5,opt,name=user,proto3" json:"user,omitempty"`
+	From             string             `protobuf:"bytes,6,opt,name=from,proto3" json:"from,omitempty"` // Journey leg the ticket is valid for
+	To               string             `protobuf:"bytes,7,opt,name=to,proto3" json:"to,omitempty"`
+	Infants          []*User            `protobuf:"bytes,8,rep,name=infants,proto3" json:"infants,omitempty"`
+	Assistance       *AssistanceRequest `protobuf:"bytes,9,opt,name=assistance,proto3" json:"assistance,omitempty"`
+	SeatAttributes   []string           `protobuf:"bytes,10,rep,name=seat_attributes,json=seatAttributes,proto3" json:"seat_attributes,omitempty"` // Accessibility attributes of the seat
+	Status           string             `protobuf:"bytes,11,opt,name=status,proto3" json:"status,omitempty"`                                       // Check-in status: "booked", "checked_in" or "denied_boarding"
+	ReseatRequired   bool               `protobuf:"varint,12,opt,name=reseat_required,json=reseatRequired,proto3" json:"reseat_required,omitempty"`
+}
+
+func (x *ManifestEntry) Reset() {
+	*x = ManifestEntry{}
+	mi := &file_proto_train_service_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ManifestEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ManifestEntry) ProtoMessage() {}
+
+func (x *ManifestEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ManifestEntry.ProtoReflect.Descriptor instead.
+func (*ManifestEntry) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *ManifestEntry) GetCoach() string {
+	if x != nil {
+		return x.Coach
+	}
+	return ""
+}
+
+func (x *ManifestEntry) GetSeat() string {
+	if x != nil {
+		return x.Seat
+	}
+	return ""
+}
+
+func (x *ManifestEntry) GetFareClass() string {
+	if x != nil {
+		return x.FareClass
+	}
+	return ""
+}
+
+func (x *ManifestEntry) GetBookingReference() string {
+	if x != nil {
+		return x.BookingReference
+	}
+	return ""
+}
+
+func (x *ManifestEntry) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+func (x *ManifestEntry) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *ManifestEntry) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *ManifestEntry) GetInfants() []*User {
+	if x != nil {
+		return x.Infants
+	}
+	return nil
+}
+
+func (x *ManifestEntry) GetAssistance() *AssistanceRequest {
+	if x != nil {
+		return x.Assistance
+	}
+	return nil
+}
+
+func (x *ManifestEntry) GetSeatAttributes() []string {
+	if x != nil {
+		return x.SeatAttributes
+	}
+	return nil
+}
+
+func (x *ManifestEntry) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ManifestEntry) GetReseatRequired() bool {
+	if x != nil {
+		return x.ReseatRequired
+	}
+	return false
+}
+
+// ManifestCoach message represents a coach of the train and the bookings seated in it
+type ManifestCoach struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name      string           `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"` // Section name, empty for the bookings without a seat
+	FareClass string           `protobuf:"bytes,2,opt,name=fare_class,json=fareClass,proto3" json:"fare_class,omitempty"`
+	Capacity  int32            `protobuf:"varint,3,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	Entries   []*ManifestEntry `protobuf:"bytes,4,rep,name=entries,proto3" json:"entries,omitempty"` // Ordered by seat
+}
+
+func (x *ManifestCoach) Reset() {
+	*x = ManifestCoach{}
+	mi := &file_proto_train_service_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ManifestCoach) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ManifestCoach) ProtoMessage() {}
+
+func (x *ManifestCoach) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ManifestCoach.ProtoReflect.Descriptor instead.
+func (*ManifestCoach) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *ManifestCoach) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ManifestCoach) GetFareClass() string {
+	if x != nil {
+		return x.FareClass
+	}
+	return ""
+}
+
+func (x *ManifestCoach) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *ManifestCoach) GetEntries() []*ManifestEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+// ExportManifestRequest message represents a staff request for the passenger manifest of the departure
+type ExportManifestRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Format string `protobuf:"bytes,1,opt,name=format,proto3" json:"format,omitempty"` // "csv", "jsonl" or "html", defaults to "csv"
+}
+
+func (x *ExportManifestRequest) Reset() {
+	*x = ExportManifestRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportManifestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportManifestRequest) ProtoMessage() {}
+
+func (x *ExportManifestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportManifestRequest.ProtoReflect.Descriptor instead.
+func (*ExportManifestRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *ExportManifestRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+// ExportManifestResponse message represents the passenger manifest rendered in the requested format
+type ExportManifestResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Format      string `protobuf:"bytes,1,opt,name=format,proto3" json:"format,omitempty"`
+	ContentType string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"` // Media type of data, such as "text/csv"
+	Data        []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Departure   string `protobuf:"bytes,4,opt,name=departure,proto3" json:"departure,omitempty"`    // RFC 3339 departure time, empty when no departure is scheduled
+	Passengers  int32  `protobuf:"varint,5,opt,name=passengers,proto3" json:"passengers,omitempty"` // Bookings on the manifest, infants not included
+}
+
+func (x *ExportManifestResponse) Reset() {
+	*x = ExportManifestResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[36]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportManifestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportManifestResponse) ProtoMessage() {}
+
+func (x *ExportManifestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[36]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportManifestResponse.ProtoReflect.Descriptor instead.
+func (*ExportManifestResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *ExportManifestResponse) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *ExportManifestResponse) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *ExportManifestResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ExportManifestResponse) GetDeparture() string {
+	if x != nil {
+		return x.Departure
+	}
+	return ""
+}
+
+func (x *ExportManifestResponse) GetPassengers() int32 {
+	if x != nil {
+		return x.Passengers
+	}
+	return 0
+}
+
+// SnapshotDeparture message represents the departure saved in a snapshot
+type SnapshotDeparture struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Time                 string `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`                                                 // RFC 3339, empty when no departure is scheduled
+	AssistanceCutoff     string `protobuf:"bytes,2,opt,name=assistance_cutoff,json=assistanceCutoff,proto3" json:"assistance_cutoff,omitempty"` // Go duration such as "24h"
+	OverbookingAllowance int32  `protobuf:"varint,3,opt,name=overbooking_allowance,json=overbookingAllowance,proto3" json:"overbooking_allowance,omitempty"`
+}
+
+func (x *SnapshotDeparture) Reset() {
+	*x = SnapshotDeparture{}
+	mi := &file_proto_train_service_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotDeparture) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotDeparture) ProtoMessage() {}
+
+func (x *SnapshotDeparture) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[37]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotDeparture.ProtoReflect.Descriptor instead.
+func (*SnapshotDeparture) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *SnapshotDeparture) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *SnapshotDeparture) GetAssistanceCutoff() string {
+	if x != nil {
+		return x.AssistanceCutoff
+	}
+	return ""
+}
+
+func (x *SnapshotDeparture) GetOverbookingAllowance() int32 {
+	if x != nil {
+		return x.OverbookingAllowance
+	}
+	return 0
+}
+
+// SnapshotSection message represents a section of the train and its free seats in a snapshot
+type SnapshotSection struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name           string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	FareClass      string   `protobuf:"bytes,2,opt,name=fare_class,json=fareClass,proto3" json:"fare_class,omitempty"`
+	Capacity       int32    `protobuf:"varint,3,opt,name=capacity,proto3" json:"capacity,omitempty"`
+	AvailableSeats []string `protobuf:"bytes,4,rep,name=available_seats,json=availableSeats,proto3" json:"available_seats,omitempty"` // Seats neither booked nor held by a booking, blocked seats included
+}
+
+func (x *SnapshotSection) Reset() {
+	*x = SnapshotSection{}
+	mi := &file_proto_train_service_proto_msgTypes[38]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotSection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotSection) ProtoMessage() {}
+
+func (x *SnapshotSection) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[38]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotSection.ProtoReflect.Descriptor instead.
+func (*SnapshotSection) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{38}
+}
+
+func (x *SnapshotSection) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SnapshotSection) GetFareClass() string {
+	if x != nil {
+		return x.FareClass
+	}
+	return ""
+}
+
+func (x *SnapshotSection) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *SnapshotSection) GetAvailableSeats() []string {
+	if x != nil {
+		return x.AvailableSeats
+	}
+	return nil
+}
+
+// Snapshot message represents the whole booking state of the train
+type Snapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	CreatedAt string             `protobuf:"bytes,1,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"` // RFC 3339
+	Tickets   []*TicketReceipt   `protobuf:"bytes,2,rep,name=tickets,proto3" json:"tickets,omitempty"`                      // Every booking with its user, seated or not
+	Sections  []*SnapshotSection `protobuf:"bytes,3,rep,name=sections,proto3" json:"sections,omitempty"`
+	Blocks    []*SeatBlock       `protobuf:"bytes,4,rep,name=blocks,proto3" json:"blocks,omitempty"` // Seats held out of service
+	Departure *SnapshotDeparture `protobuf:"bytes,5,opt,name=departure,proto3" json:"departure,omitempty"`
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_proto_train_service_proto_msgTypes[39]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[39]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *Snapshot) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+func (x *Snapshot) GetTickets() []*TicketReceipt {
+	if x != nil {
+		return x.Tickets
+	}
+	return nil
+}
+
+func (x *Snapshot) GetSections() []*SnapshotSection {
+	if x != nil {
+		return x.Sections
+	}
+	return nil
+}
+
+func (x *Snapshot) GetBlocks() []*SeatBlock {
+	if x != nil {
+		return x.Blocks
+	}
+	return nil
+}
+
+func (x *Snapshot) GetDeparture() *SnapshotDeparture {
+	if x != nil {
+		return x.Departure
+	}
+	return nil
+}
+
+// SnapshotFile message represents a snapshot file: a versioned, checksummed encoding of a Snapshot
+type SnapshotFile struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version  int32  `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`  // Version of the snapshot format
+	Snapshot []byte `protobuf:"bytes,2,opt,name=snapshot,proto3" json:"snapshot,omitempty"` // Binary encoding of the Snapshot
+	Sha256   string `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`     // Hex SHA-256 checksum of snapshot
+}
+
+func (x *SnapshotFile) Reset() {
+	*x = SnapshotFile{}
+	mi := &file_proto_train_service_proto_msgTypes[40]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SnapshotFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SnapshotFile) ProtoMessage() {}
+
+func (x *SnapshotFile) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[40]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SnapshotFile.ProtoReflect.Descriptor instead.
+func (*SnapshotFile) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{40}
+}
+
+func (x *SnapshotFile) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *SnapshotFile) GetSnapshot() []byte {
+	if x != nil {
+		return x.Snapshot
+	}
+	return nil
+}
+
+func (x *SnapshotFile) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+// BookingEvent message represents an immutable change to the booking state, as kept in the event store
+type BookingEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sequence         int64              `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`                      // Position of the event in the event store, from 1
+	Type             string             `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`                               // Such as "TicketPurchased", "SeatChanged" or "TicketCancelled"
+	OccurredAt       string             `protobuf:"bytes,3,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"` // RFC 3339 with nanoseconds
+	UserEmail        string             `protobuf:"bytes,4,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`    // Email of the booking the event is about, empty for other events
+	BookingReference string             `protobuf:"bytes,5,opt,name=booking_reference,json=bookingReference,proto3" json:"booking_reference,omitempty"`
+	Ticket           *TicketReceipt     `protobuf:"bytes,6,opt,name=ticket,proto3" json:"ticket,omitempty"`                                 // The booking after the change, or as it was when it was cancelled
+	PreviousSeat     string             `protobuf:"bytes,7,opt,name=previous_seat,json=previousSeat,proto3" json:"previous_seat,omitempty"` // Seat the booking held before the change, empty when it had none
+	Block            *SeatBlock         `protobuf:"bytes,8,opt,name=block,proto3" json:"block,omitempty"`                                   // Seat blocked or unblocked
+	Departure        *SnapshotDeparture `protobuf:"bytes,9,opt,name=departure,proto3" json:"departure,omitempty"`                           // Departure set
+	Snapshot         *Snapshot          `protobuf:"bytes,10,opt,name=snapshot,proto3" json:"snapshot,omitempty"`                            // State restored from a snapshot, the events after it apply to this state
+}
+
+func (x *BookingEvent) Reset() {
+	*x = BookingEvent{}
+	mi := &file_proto_train_service_proto_msgTypes[41]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BookingEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BookingEvent) ProtoMessage() {}
+
+func (x *BookingEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[41]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BookingEvent.ProtoReflect.Descriptor instead.
+func (*BookingEvent) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{41}
+}
+
+func (x *BookingEvent) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *BookingEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *BookingEvent) GetOccurredAt() string {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return ""
+}
+
+func (x *BookingEvent) GetUserEmail() string {
+	if x != nil {
+		return x.UserEmail
+	}
+	return ""
+}
+
+func (x *BookingEvent) GetBookingReference() string {
+	if x != nil {
+		return x.BookingReference
+	}
+	return ""
+}
+
+func (x *BookingEvent) GetTicket() *TicketReceipt {
+	if x != nil {
+		return x.Ticket
+	}
+	return nil
+}
+
+func (x *BookingEvent) GetPreviousSeat() string {
+	if x != nil {
+		return x.PreviousSeat
+	}
+	return ""
+}
+
+func (x *BookingEvent) GetBlock() *SeatBlock {
+	if x != nil {
+		return x.Block
+	}
+	return nil
+}
+
+func (x *BookingEvent) GetDeparture() *SnapshotDeparture {
+	if x != nil {
+		return x.Departure
+	}
+	return nil
+}
+
+func (x *BookingEvent) GetSnapshot() *Snapshot {
+	if x != nil {
+		return x.Snapshot
+	}
+	return nil
+}
+
+// DeadLetter message represents an event a sink could not take after every delivery attempt
+type DeadLetter struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sink     string        `protobuf:"bytes,1,opt,name=sink,proto3" json:"sink,omitempty"`
+	Event    *BookingEvent `protobuf:"bytes,2,opt,name=event,proto3" json:"event,omitempty"`
+	Error    string        `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"` // Error of the last attempt
+	Attempts int32         `protobuf:"varint,4,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	FailedAt string        `protobuf:"bytes,5,opt,name=failed_at,json=failedAt,proto3" json:"failed_at,omitempty"` // RFC 3339
+}
+
+func (x *DeadLetter) Reset() {
+	*x = DeadLetter{}
+	mi := &file_proto_train_service_proto_msgTypes[42]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeadLetter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeadLetter) ProtoMessage() {}
+
+func (x *DeadLetter) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[42]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeadLetter.ProtoReflect.Descriptor instead.
+func (*DeadLetter) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{42}
+}
+
+func (x *DeadLetter) GetSink() string {
+	if x != nil {
+		return x.Sink
+	}
+	return ""
+}
+
+func (x *DeadLetter) GetEvent() *BookingEvent {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *DeadLetter) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *DeadLetter) GetAttempts() int32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *DeadLetter) GetFailedAt() string {
+	if x != nil {
+		return x.FailedAt
+	}
+	return ""
+}
+
+// ExportSnapshotRequest message represents an admin request for a snapshot of the booking state
+type ExportSnapshotRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ExportSnapshotRequest) Reset() {
+	*x = ExportSnapshotRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[43]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportSnapshotRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportSnapshotRequest) ProtoMessage() {}
+
+func (x *ExportSnapshotRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[43]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportSnapshotRequest.ProtoReflect.Descriptor instead.
+func (*ExportSnapshotRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{43}
+}
+
+// ExportSnapshotResponse message represents a snapshot file of the booking state
+type ExportSnapshotResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Data    []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"` // Binary encoding of a SnapshotFile
+	Sha256  string `protobuf:"bytes,2,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	Tickets int32  `protobuf:"varint,3,opt,name=tickets,proto3" json:"tickets,omitempty"`
+	Blocks  int32  `protobuf:"varint,4,opt,name=blocks,proto3" json:"blocks,omitempty"`
+}
+
+func (x *ExportSnapshotResponse) Reset() {
+	*x = ExportSnapshotResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[44]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportSnapshotResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportSnapshotResponse) ProtoMessage() {}
+
+func (x *ExportSnapshotResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[44]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportSnapshotResponse.ProtoReflect.Descriptor instead.
+func (*ExportSnapshotResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{44}
+}
+
+func (x *ExportSnapshotResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ExportSnapshotResponse) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *ExportSnapshotResponse) GetTickets() int32 {
+	if x != nil {
+		return x.Tickets
+	}
+	return 0
+}
+
+func (x *ExportSnapshotResponse) GetBlocks() int32 {
+	if x != nil {
+		return x.Blocks
+	}
+	return 0
+}
+
+// ImportSnapshotRequest message represents an admin request to replace the booking state with a snapshot
+type ImportSnapshotRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Data   []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`                    // Binary encoding of a SnapshotFile
+	DryRun bool   `protobuf:"varint,2,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"` // Validate the snapshot without replacing the state
+}
+
+func (x *ImportSnapshotRequest) Reset() {
+	*x = ImportSnapshotRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[45]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportSnapshotRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportSnapshotRequest) ProtoMessage() {}
+
+func (x *ImportSnapshotRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[45]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportSnapshotRequest.ProtoReflect.Descriptor instead.
+func (*ImportSnapshotRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{45}
+}
+
+func (x *ImportSnapshotRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ImportSnapshotRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+// ImportSnapshotResponse message represents the outcome of a snapshot import
+type ImportSnapshotResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Message string `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Tickets int32  `protobuf:"varint,2,opt,name=tickets,proto3" json:"tickets,omitempty"`
+	Blocks  int32  `protobuf:"varint,3,opt,name=blocks,proto3" json:"blocks,omitempty"`
+}
+
+func (x *ImportSnapshotResponse) Reset() {
+	*x = ImportSnapshotResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[46]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportSnapshotResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportSnapshotResponse) ProtoMessage() {}
+
+func (x *ImportSnapshotResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[46]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportSnapshotResponse.ProtoReflect.Descriptor instead.
+func (*ImportSnapshotResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{46}
+}
+
+func (x *ImportSnapshotResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ImportSnapshotResponse) GetTickets() int32 {
+	if x != nil {
+		return x.Tickets
+	}
+	return 0
+}
+
+func (x *ImportSnapshotResponse) GetBlocks() int32 {
+	if x != nil {
+		return x.Blocks
+	}
+	return 0
+}
+
+// AuditEntry message represents a call that changed, or tried to change, the booking state
+type AuditEntry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sequence         int64    `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"` // Position in the audit log, starting at 1
+	Time             string   `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`          // RFC 3339 time the call finished
+	Actor            string   `protobuf:"bytes,3,opt,name=actor,proto3" json:"actor,omitempty"`        // Subject of the caller
+	ActorEmail       string   `protobuf:"bytes,4,opt,name=actor_email,json=actorEmail,proto3" json:"actor_email,omitempty"`
+	ActorRoles       []string `protobuf:"bytes,5,rep,name=actor_roles,json=actorRoles,proto3" json:"actor_roles,omitempty"`
+	Method           string   `protobuf:"bytes,6,opt,name=method,proto3" json:"method,omitempty"`                        // Method called, such as "ModifySeat"
+	UserEmail        string   `protobuf:"bytes,7,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"` // Passenger the call acted on, empty for calls acting on the whole train
+	BookingReference string   `protobuf:"bytes,8,opt,name=booking_reference,json=bookingReference,proto3" json:"booking_reference,omitempty"`
+	Before           string   `protobuf:"bytes,9,opt,name=before,proto3" json:"before,omitempty"` // JSON of the value the call changes as it was before the call, empty if there was none
+	After            string   `protobuf:"bytes,10,opt,name=after,proto3" json:"after,omitempty"`  // JSON of the value the call changes as it was after the call, empty if there was none
+	Code             string   `protobuf:"bytes,11,opt,name=code,proto3" json:"code,omitempty"`    // gRPC status code of the call, such as "OK"
+	Error            string   `protobuf:"bytes,12,opt,name=error,proto3" json:"error,omitempty"`  // Why the call failed, empty on success
+}
+
+func (x *AuditEntry) Reset() {
+	*x = AuditEntry{}
+	mi := &file_proto_train_service_proto_msgTypes[47]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditEntry) ProtoMessage() {}
+
+func (x *AuditEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[47]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditEntry.ProtoReflect.Descriptor instead.
+func (*AuditEntry) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{47}
+}
+
+func (x *AuditEntry) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetActorEmail() string {
+	if x != nil {
+		return x.ActorEmail
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetActorRoles() []string {
+	if x != nil {
+		return x.ActorRoles
+	}
+	return nil
+}
+
+func (x *AuditEntry) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetUserEmail() string {
+	if x != nil {
+		return x.UserEmail
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetBookingReference() string {
+	if x != nil {
+		return x.BookingReference
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetBefore() string {
+	if x != nil {
+		return x.Before
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetAfter() string {
+	if x != nil {
+		return x.After
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// QueryAuditLogRequest message represents an admin request for audit entries, every filter being optional
+type QueryAuditLogRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BookingReference string `protobuf:"bytes,1,opt,name=booking_reference,json=bookingReference,proto3" json:"booking_reference,omitempty"`
+	UserEmail        string `protobuf:"bytes,2,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"` // Passenger the calls acted on
+	Actor            string `protobuf:"bytes,3,opt,name=actor,proto3" json:"actor,omitempty"`                          // Subject or email of the caller
+	Since            string `protobuf:"bytes,4,opt,name=since,proto3" json:"since,omitempty"`                          // RFC 3339, entries at or after this time
+	Until            string `protobuf:"bytes,5,opt,name=until,proto3" json:"until,omitempty"`                          // RFC 3339, entries before this time
+}
+
+func (x *QueryAuditLogRequest) Reset() {
+	*x = QueryAuditLogRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[48]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryAuditLogRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ModifySeatResponse) ProtoMessage() {}
+func (*QueryAuditLogRequest) ProtoMessage() {}
 
-func (x *ModifySeatResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_train_service_proto_msgTypes[12]
+func (x *QueryAuditLogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[48]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -703,21 +3182,274 @@ func (x *ModifySeatResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ModifySeatResponse.ProtoReflect.Descriptor instead.
-func (*ModifySeatResponse) Descriptor() ([]byte, []int) {
-	return file_proto_train_service_proto_rawDescGZIP(), []int{12}
+// Deprecated: Use QueryAuditLogRequest.ProtoReflect.Descriptor instead.
+func (*QueryAuditLogRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{48}
 }
 
-func (x *ModifySeatResponse) GetMessage() string {
+func (x *QueryAuditLogRequest) GetBookingReference() string {
 	if x != nil {
-		return x.Message
+		return x.BookingReference
 	}
 	return ""
 }
 
-func (x *ModifySeatResponse) GetNewTicket() *TicketReceipt {
+func (x *QueryAuditLogRequest) GetUserEmail() string {
 	if x != nil {
-		return x.NewTicket
+		return x.UserEmail
+	}
+	return ""
+}
+
+func (x *QueryAuditLogRequest) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *QueryAuditLogRequest) GetSince() string {
+	if x != nil {
+		return x.Since
+	}
+	return ""
+}
+
+func (x *QueryAuditLogRequest) GetUntil() string {
+	if x != nil {
+		return x.Until
+	}
+	return ""
+}
+
+// QueryAuditLogResponse message represents the matching audit entries, oldest first
+type QueryAuditLogResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Entries []*AuditEntry `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+}
+
+func (x *QueryAuditLogResponse) Reset() {
+	*x = QueryAuditLogResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[49]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryAuditLogResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryAuditLogResponse) ProtoMessage() {}
+
+func (x *QueryAuditLogResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[49]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryAuditLogResponse.ProtoReflect.Descriptor instead.
+func (*QueryAuditLogResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{49}
+}
+
+func (x *QueryAuditLogResponse) GetEntries() []*AuditEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+// BookingRevision message represents a booking as it was after one of its changes
+type BookingRevision struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Revision  int32          `protobuf:"varint,1,opt,name=revision,proto3" json:"revision,omitempty"`                   // 1 for the purchase, counting up with every change
+	Change    string         `protobuf:"bytes,2,opt,name=change,proto3" json:"change,omitempty"`                        // Event that made the revision, such as "SeatChanged"
+	ChangedAt string         `protobuf:"bytes,3,opt,name=changed_at,json=changedAt,proto3" json:"changed_at,omitempty"` // RFC 3339
+	Sequence  int64          `protobuf:"varint,4,opt,name=sequence,proto3" json:"sequence,omitempty"`                   // Sequence of the event that made the revision
+	Ticket    *TicketReceipt `protobuf:"bytes,5,opt,name=ticket,proto3" json:"ticket,omitempty"`                        // The booking after the change, or as it was when it was cancelled
+}
+
+func (x *BookingRevision) Reset() {
+	*x = BookingRevision{}
+	mi := &file_proto_train_service_proto_msgTypes[50]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BookingRevision) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BookingRevision) ProtoMessage() {}
+
+func (x *BookingRevision) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[50]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BookingRevision.ProtoReflect.Descriptor instead.
+func (*BookingRevision) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{50}
+}
+
+func (x *BookingRevision) GetRevision() int32 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *BookingRevision) GetChange() string {
+	if x != nil {
+		return x.Change
+	}
+	return ""
+}
+
+func (x *BookingRevision) GetChangedAt() string {
+	if x != nil {
+		return x.ChangedAt
+	}
+	return ""
+}
+
+func (x *BookingRevision) GetSequence() int64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *BookingRevision) GetTicket() *TicketReceipt {
+	if x != nil {
+		return x.Ticket
+	}
+	return nil
+}
+
+// GetBookingHistoryRequest message represents a request for every revision of a booking
+type GetBookingHistoryRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	UserEmail        string `protobuf:"bytes,1,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`                      // Finds the current booking of the passenger, or their last cancelled one
+	BookingReference string `protobuf:"bytes,2,opt,name=booking_reference,json=bookingReference,proto3" json:"booking_reference,omitempty"` // Finds the booking by reference, it must belong to user_email if both are set
+}
+
+func (x *GetBookingHistoryRequest) Reset() {
+	*x = GetBookingHistoryRequest{}
+	mi := &file_proto_train_service_proto_msgTypes[51]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBookingHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBookingHistoryRequest) ProtoMessage() {}
+
+func (x *GetBookingHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[51]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBookingHistoryRequest.ProtoReflect.Descriptor instead.
+func (*GetBookingHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{51}
+}
+
+func (x *GetBookingHistoryRequest) GetUserEmail() string {
+	if x != nil {
+		return x.UserEmail
+	}
+	return ""
+}
+
+func (x *GetBookingHistoryRequest) GetBookingReference() string {
+	if x != nil {
+		return x.BookingReference
+	}
+	return ""
+}
+
+// GetBookingHistoryResponse message represents every revision of a booking, oldest first
+type GetBookingHistoryResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BookingReference string             `protobuf:"bytes,1,opt,name=booking_reference,json=bookingReference,proto3" json:"booking_reference,omitempty"`
+	Revisions        []*BookingRevision `protobuf:"bytes,2,rep,name=revisions,proto3" json:"revisions,omitempty"`
+}
+
+func (x *GetBookingHistoryResponse) Reset() {
+	*x = GetBookingHistoryResponse{}
+	mi := &file_proto_train_service_proto_msgTypes[52]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBookingHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBookingHistoryResponse) ProtoMessage() {}
+
+func (x *GetBookingHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_train_service_proto_msgTypes[52]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBookingHistoryResponse.ProtoReflect.Descriptor instead.
+func (*GetBookingHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_proto_train_service_proto_rawDescGZIP(), []int{52}
+}
+
+func (x *GetBookingHistoryResponse) GetBookingReference() string {
+	if x != nil {
+		return x.BookingReference
+	}
+	return ""
+}
+
+func (x *GetBookingHistoryResponse) GetRevisions() []*BookingRevision {
+	if x != nil {
+		return x.Revisions
 	}
 	return nil
 }
@@ -727,99 +3459,535 @@ var File_proto_train_service_proto protoreflect.FileDescriptor
 var file_proto_train_service_proto_rawDesc = []byte{
 	0x0a, 0x19, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x5f, 0x73, 0x65,
 	0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x05, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x22, 0x58, 0x0a, 0x04, 0x55, 0x73, 0x65, 0x72, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x69,
-	0x72, 0x73, 0x74, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
-	0x66, 0x69, 0x72, 0x73, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x61, 0x73,
-	0x74, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c, 0x61,
-	0x73, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18,
-	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x22, 0x87, 0x01, 0x0a,
-	0x0d, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x12, 0x12,
-	0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x66, 0x72,
-	0x6f, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02,
-	0x74, 0x6f, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
-	0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x04, 0x75,
-	0x73, 0x65, 0x72, 0x12, 0x1d, 0x0a, 0x0a, 0x70, 0x72, 0x69, 0x63, 0x65, 0x5f, 0x70, 0x61, 0x69,
-	0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x02, 0x52, 0x09, 0x70, 0x72, 0x69, 0x63, 0x65, 0x50, 0x61,
-	0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x61, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x04, 0x73, 0x65, 0x61, 0x74, 0x22, 0x5c, 0x0a, 0x15, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61,
-	0x73, 0x65, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
-	0x12, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x66,
-	0x72, 0x6f, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x02, 0x74, 0x6f, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x74, 0x6f, 0x22, 0xbf, 0x01, 0x0a, 0x04, 0x55, 0x73, 0x65, 0x72, 0x12, 0x1d, 0x0a, 0x0a, 0x66,
+	0x69, 0x72, 0x73, 0x74, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x09, 0x66, 0x69, 0x72, 0x73, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x61,
+	0x73, 0x74, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c,
+	0x61, 0x73, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x22, 0x0a,
+	0x0d, 0x64, 0x61, 0x74, 0x65, 0x5f, 0x6f, 0x66, 0x5f, 0x62, 0x69, 0x72, 0x74, 0x68, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x61, 0x74, 0x65, 0x4f, 0x66, 0x42, 0x69, 0x72, 0x74,
+	0x68, 0x12, 0x25, 0x0a, 0x0e, 0x70, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72, 0x5f, 0x74,
+	0x79, 0x70, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x70, 0x61, 0x73, 0x73, 0x65,
+	0x6e, 0x67, 0x65, 0x72, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x61, 0x69, 0x6c,
+	0x63, 0x61, 0x72, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x61, 0x69, 0x6c,
+	0x63, 0x61, 0x72, 0x64, 0x22, 0xb2, 0x03, 0x0a, 0x0d, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52,
+	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x6f,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x74, 0x6f, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73,
+	0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x04, 0x75, 0x73, 0x65, 0x72, 0x12, 0x1d, 0x0a, 0x0a, 0x70,
+	0x72, 0x69, 0x63, 0x65, 0x5f, 0x70, 0x61, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x02, 0x52,
+	0x09, 0x70, 0x72, 0x69, 0x63, 0x65, 0x50, 0x61, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65,
+	0x61, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x73, 0x65, 0x61, 0x74, 0x12, 0x1d,
+	0x0a, 0x0a, 0x66, 0x61, 0x72, 0x65, 0x5f, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x09, 0x66, 0x61, 0x72, 0x65, 0x43, 0x6c, 0x61, 0x73, 0x73, 0x12, 0x1e, 0x0a,
+	0x0a, 0x63, 0x6f, 0x6e, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0a, 0x63, 0x6f, 0x6e, 0x63, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x25, 0x0a,
+	0x07, 0x69, 0x6e, 0x66, 0x61, 0x6e, 0x74, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x07, 0x69, 0x6e, 0x66,
+	0x61, 0x6e, 0x74, 0x73, 0x12, 0x38, 0x0a, 0x0a, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e,
+	0x63, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x41, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x52, 0x0a, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x27,
+	0x0a, 0x0f, 0x72, 0x65, 0x73, 0x65, 0x61, 0x74, 0x5f, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65,
+	0x64, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x72, 0x65, 0x73, 0x65, 0x61, 0x74, 0x52,
+	0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75,
+	0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12,
+	0x2b, 0x0a, 0x11, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x5f, 0x72, 0x65, 0x66, 0x65, 0x72,
+	0x65, 0x6e, 0x63, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x62, 0x6f, 0x6f, 0x6b,
+	0x69, 0x6e, 0x67, 0x52, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x1b, 0x0a, 0x09,
+	0x62, 0x6f, 0x6f, 0x6b, 0x65, 0x64, 0x5f, 0x62, 0x79, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x62, 0x6f, 0x6f, 0x6b, 0x65, 0x64, 0x42, 0x79, 0x22, 0x3d, 0x0a, 0x11, 0x41, 0x73, 0x73,
+	0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12,
+	0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x6e, 0x6f, 0x74, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x6e, 0x6f, 0x74, 0x65, 0x73, 0x22, 0x83, 0x02, 0x0a, 0x15, 0x50, 0x75, 0x72,
+	0x63, 0x68, 0x61, 0x73, 0x65, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x6f, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x02, 0x74, 0x6f, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73, 0x65, 0x72, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x73, 0x65,
+	0x72, 0x52, 0x04, 0x75, 0x73, 0x65, 0x72, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x61, 0x72, 0x65, 0x5f,
+	0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x66, 0x61, 0x72,
+	0x65, 0x43, 0x6c, 0x61, 0x73, 0x73, 0x12, 0x25, 0x0a, 0x07, 0x69, 0x6e, 0x66, 0x61, 0x6e, 0x74,
+	0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x55, 0x73, 0x65, 0x72, 0x52, 0x07, 0x69, 0x6e, 0x66, 0x61, 0x6e, 0x74, 0x73, 0x12, 0x38, 0x0a,
+	0x0a, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x41, 0x73, 0x73, 0x69, 0x73, 0x74,
+	0x61, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x0a, 0x61, 0x73, 0x73,
+	0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x25, 0x0a, 0x0e, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x65, 0x64, 0x5f, 0x73, 0x65, 0x61, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0d, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x65, 0x64, 0x53, 0x65, 0x61, 0x74, 0x22, 0x60,
+	0x0a, 0x16, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2c, 0x0a, 0x06, 0x74, 0x69, 0x63, 0x6b,
+	0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x06,
+	0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x22, 0x4e, 0x0a, 0x11, 0x47, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x65, 0x6d,
+	0x61, 0x69, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x75, 0x73, 0x65, 0x72, 0x45,
+	0x6d, 0x61, 0x69, 0x6c, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x72, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e,
+	0x22, 0x5e, 0x0a, 0x12, 0x47, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2c, 0x0a, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54,
+	0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x06, 0x74, 0x69,
+	0x63, 0x6b, 0x65, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x72, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e,
+	0x22, 0x34, 0x0a, 0x18, 0x47, 0x65, 0x74, 0x55, 0x73, 0x65, 0x72, 0x73, 0x42, 0x79, 0x53, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07,
+	0x73, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x73,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x55, 0x0a, 0x19, 0x47, 0x65, 0x74, 0x55, 0x73, 0x65,
+	0x72, 0x73, 0x42, 0x79, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x38, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x73, 0x65, 0x61, 0x74,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x55, 0x73, 0x65, 0x72, 0x53, 0x65, 0x61, 0x74, 0x41, 0x6c, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x52, 0x09, 0x75, 0x73, 0x65, 0x72, 0x53, 0x65, 0x61, 0x74, 0x73, 0x22, 0x49, 0x0a,
+	0x12, 0x55, 0x73, 0x65, 0x72, 0x53, 0x65, 0x61, 0x74, 0x41, 0x6c, 0x6c, 0x6f, 0x63, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x04,
-	0x75, 0x73, 0x65, 0x72, 0x22, 0x60, 0x0a, 0x16, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x50, 0x75,
-	0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2c,
-	0x0a, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14,
-	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x63,
-	0x65, 0x69, 0x70, 0x74, 0x52, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x18, 0x0a, 0x07,
-	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d,
-	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x32, 0x0a, 0x11, 0x47, 0x65, 0x74, 0x52, 0x65, 0x63,
-	0x65, 0x69, 0x70, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x75,
-	0x73, 0x65, 0x72, 0x5f, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x09, 0x75, 0x73, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x22, 0x42, 0x0a, 0x12, 0x47, 0x65,
-	0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x12, 0x2c, 0x0a, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
-	0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52,
-	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x22, 0x34,
-	0x0a, 0x18, 0x47, 0x65, 0x74, 0x55, 0x73, 0x65, 0x72, 0x73, 0x42, 0x79, 0x53, 0x65, 0x63, 0x74,
-	0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x65,
-	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x73, 0x65, 0x63,
-	0x74, 0x69, 0x6f, 0x6e, 0x22, 0x55, 0x0a, 0x19, 0x47, 0x65, 0x74, 0x55, 0x73, 0x65, 0x72, 0x73,
-	0x42, 0x79, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
-	0x65, 0x12, 0x38, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x73, 0x65, 0x61, 0x74, 0x73, 0x18,
-	0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x73,
-	0x65, 0x72, 0x53, 0x65, 0x61, 0x74, 0x41, 0x6c, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e,
-	0x52, 0x09, 0x75, 0x73, 0x65, 0x72, 0x53, 0x65, 0x61, 0x74, 0x73, 0x22, 0x49, 0x0a, 0x12, 0x55,
-	0x73, 0x65, 0x72, 0x53, 0x65, 0x61, 0x74, 0x41, 0x6c, 0x6c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f,
-	0x6e, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
-	0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x04, 0x75, 0x73,
-	0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x04, 0x73, 0x65, 0x61, 0x74, 0x22, 0x32, 0x0a, 0x11, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65,
-	0x55, 0x73, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x75,
-	0x73, 0x65, 0x72, 0x5f, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x09, 0x75, 0x73, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x22, 0x4f, 0x0a, 0x12, 0x52, 0x65,
-	0x6d, 0x6f, 0x76, 0x65, 0x55, 0x73, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73,
-	0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x04, 0x75, 0x73, 0x65, 0x72, 0x22, 0x4d, 0x0a, 0x11, 0x4d,
-	0x6f, 0x64, 0x69, 0x66, 0x79, 0x53, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
-	0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x75, 0x73, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x12,
-	0x19, 0x0a, 0x08, 0x6e, 0x65, 0x77, 0x5f, 0x73, 0x65, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x07, 0x6e, 0x65, 0x77, 0x53, 0x65, 0x61, 0x74, 0x22, 0x63, 0x0a, 0x12, 0x4d, 0x6f,
+	0x75, 0x73, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x73, 0x65, 0x61, 0x74, 0x22, 0x1e, 0x0a, 0x1c, 0x47, 0x65, 0x74, 0x41,
+	0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73,
+	0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x77, 0x0a, 0x1d, 0x47, 0x65, 0x74, 0x41,
+	0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73,
+	0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x65, 0x70,
+	0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x65,
+	0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x12, 0x38, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69,
+	0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x41, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x4d, 0x61, 0x6e, 0x69, 0x66,
+	0x65, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65,
+	0x73, 0x22, 0xb1, 0x01, 0x0a, 0x17, 0x41, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65,
+	0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x1f, 0x0a,
+	0x04, 0x75, 0x73, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x04, 0x75, 0x73, 0x65, 0x72, 0x12, 0x12,
+	0x0a, 0x04, 0x73, 0x65, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x73, 0x65,
+	0x61, 0x74, 0x12, 0x38, 0x0a, 0x0a, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x41,
+	0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x52, 0x0a, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x27, 0x0a, 0x0f,
+	0x73, 0x65, 0x61, 0x74, 0x5f, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x73, 0x18,
+	0x04, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0e, 0x73, 0x65, 0x61, 0x74, 0x41, 0x74, 0x74, 0x72, 0x69,
+	0x62, 0x75, 0x74, 0x65, 0x73, 0x22, 0x32, 0x0a, 0x11, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x55,
+	0x73, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73,
+	0x65, 0x72, 0x5f, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x75, 0x73, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x22, 0x4f, 0x0a, 0x12, 0x52, 0x65, 0x6d,
+	0x6f, 0x76, 0x65, 0x55, 0x73, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73, 0x65,
+	0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x55, 0x73, 0x65, 0x72, 0x52, 0x04, 0x75, 0x73, 0x65, 0x72, 0x22, 0x4d, 0x0a, 0x11, 0x4d, 0x6f,
+	0x64, 0x69, 0x66, 0x79, 0x53, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x1d, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x09, 0x75, 0x73, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x19,
+	0x0a, 0x08, 0x6e, 0x65, 0x77, 0x5f, 0x73, 0x65, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x6e, 0x65, 0x77, 0x53, 0x65, 0x61, 0x74, 0x22, 0x8c, 0x01, 0x0a, 0x12, 0x4d, 0x6f,
 	0x64, 0x69, 0x66, 0x79, 0x53, 0x65, 0x61, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
 	0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x33, 0x0a, 0x0a, 0x6e, 0x65,
 	0x77, 0x5f, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14,
 	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x63,
-	0x65, 0x69, 0x70, 0x74, 0x52, 0x09, 0x6e, 0x65, 0x77, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x32,
-	0xfe, 0x02, 0x0a, 0x0c, 0x54, 0x72, 0x61, 0x69, 0x6e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x12, 0x4d, 0x0a, 0x0e, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x54, 0x69, 0x63, 0x6b,
-	0x65, 0x74, 0x12, 0x1c, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x50, 0x75, 0x72, 0x63, 0x68,
-	0x61, 0x73, 0x65, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
-	0x1a, 0x1d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x50,
-	0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
-	0x41, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x12, 0x18, 0x2e,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74,
-	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
-	0x47, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x73, 0x65, 0x12, 0x56, 0x0a, 0x11, 0x47, 0x65, 0x74, 0x55, 0x73, 0x65, 0x72, 0x73, 0x42, 0x79,
-	0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1f, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
-	0x47, 0x65, 0x74, 0x55, 0x73, 0x65, 0x72, 0x73, 0x42, 0x79, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f,
-	0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x2e, 0x47, 0x65, 0x74, 0x55, 0x73, 0x65, 0x72, 0x73, 0x42, 0x79, 0x53, 0x65, 0x63, 0x74, 0x69,
-	0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x41, 0x0a, 0x0a, 0x52, 0x65,
-	0x6d, 0x6f, 0x76, 0x65, 0x55, 0x73, 0x65, 0x72, 0x12, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x55, 0x73, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x1a, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76,
-	0x65, 0x55, 0x73, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x41, 0x0a,
-	0x0a, 0x4d, 0x6f, 0x64, 0x69, 0x66, 0x79, 0x53, 0x65, 0x61, 0x74, 0x12, 0x18, 0x2e, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x2e, 0x4d, 0x6f, 0x64, 0x69, 0x66, 0x79, 0x53, 0x65, 0x61, 0x74, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4d, 0x6f,
-	0x64, 0x69, 0x66, 0x79, 0x53, 0x65, 0x61, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x42, 0x08, 0x5a, 0x06, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x33,
+	0x65, 0x69, 0x70, 0x74, 0x52, 0x09, 0x6e, 0x65, 0x77, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x12,
+	0x27, 0x0a, 0x0f, 0x66, 0x61, 0x72, 0x65, 0x5f, 0x64, 0x69, 0x66, 0x66, 0x65, 0x72, 0x65, 0x6e,
+	0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x02, 0x52, 0x0e, 0x66, 0x61, 0x72, 0x65, 0x44, 0x69,
+	0x66, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x22, 0x75, 0x0a, 0x09, 0x53, 0x65, 0x61, 0x74,
+	0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x61, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x73, 0x65, 0x61, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f,
+	0x6e, 0x12, 0x1d, 0x0a, 0x0a, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64, 0x41, 0x74,
+	0x12, 0x1d, 0x0a, 0x0a, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x5f, 0x61, 0x74, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x22,
+	0x7a, 0x0a, 0x11, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x65, 0x61, 0x74, 0x73, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x05, 0x73, 0x65, 0x61, 0x74, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x73, 0x65, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x1d, 0x0a, 0x0a,
+	0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x5f, 0x61, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x22, 0xd8, 0x01, 0x0a, 0x12,
+	0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x28, 0x0a, 0x06,
+	0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65, 0x61, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x06,
+	0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x12, 0x3f, 0x0a, 0x10, 0x72, 0x65, 0x73, 0x65, 0x61, 0x74,
+	0x65, 0x64, 0x5f, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52,
+	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x0f, 0x72, 0x65, 0x73, 0x65, 0x61, 0x74, 0x65, 0x64,
+	0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x3d, 0x0a, 0x0f, 0x66, 0x6c, 0x61, 0x67, 0x67,
+	0x65, 0x64, 0x5f, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52,
+	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x0e, 0x66, 0x6c, 0x61, 0x67, 0x67, 0x65, 0x64, 0x54,
+	0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x22, 0x45, 0x0a, 0x13, 0x55, 0x6e, 0x62, 0x6c, 0x6f, 0x63,
+	0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a,
+	0x05, 0x73, 0x65, 0x61, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05, 0x73, 0x65,
+	0x61, 0x74, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x73, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x46, 0x0a,
+	0x14, 0x55, 0x6e, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12,
+	0x14, 0x0a, 0x05, 0x73, 0x65, 0x61, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x05,
+	0x73, 0x65, 0x61, 0x74, 0x73, 0x22, 0x17, 0x0a, 0x15, 0x4c, 0x69, 0x73, 0x74, 0x53, 0x65, 0x61,
+	0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x42,
+	0x0a, 0x16, 0x4c, 0x69, 0x73, 0x74, 0x53, 0x65, 0x61, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x28, 0x0a, 0x06, 0x62, 0x6c, 0x6f, 0x63,
+	0x6b, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x53, 0x65, 0x61, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x06, 0x62, 0x6c, 0x6f, 0x63,
+	0x6b, 0x73, 0x22, 0x2f, 0x0a, 0x0e, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x49, 0x6e, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x65, 0x6d, 0x61,
+	0x69, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x75, 0x73, 0x65, 0x72, 0x45, 0x6d,
+	0x61, 0x69, 0x6c, 0x22, 0x59, 0x0a, 0x0f, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x49, 0x6e, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x12, 0x2c, 0x0a, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52,
+	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x22, 0x9e,
+	0x01, 0x0a, 0x13, 0x53, 0x65, 0x74, 0x44, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x25, 0x0a, 0x0e, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74,
+	0x75, 0x72, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d,
+	0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x2b, 0x0a,
+	0x11, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x63, 0x75, 0x74, 0x6f,
+	0x66, 0x66, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74,
+	0x61, 0x6e, 0x63, 0x65, 0x43, 0x75, 0x74, 0x6f, 0x66, 0x66, 0x12, 0x33, 0x0a, 0x15, 0x6f, 0x76,
+	0x65, 0x72, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x5f, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x61,
+	0x6e, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x14, 0x6f, 0x76, 0x65, 0x72, 0x62,
+	0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x41, 0x6c, 0x6c, 0x6f, 0x77, 0x61, 0x6e, 0x63, 0x65, 0x22,
+	0x30, 0x0a, 0x14, 0x53, 0x65, 0x74, 0x44, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x22, 0x20, 0x0a, 0x1e, 0x47, 0x65, 0x74, 0x44, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x42, 0x6f,
+	0x61, 0x72, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x22, 0x6f, 0x0a, 0x1f, 0x47, 0x65, 0x74, 0x44, 0x65, 0x6e, 0x69, 0x65, 0x64,
+	0x42, 0x6f, 0x61, 0x72, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74,
+	0x75, 0x72, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x65, 0x70, 0x61, 0x72,
+	0x74, 0x75, 0x72, 0x65, 0x12, 0x2e, 0x0a, 0x07, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18,
+	0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69,
+	0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x07, 0x74, 0x69, 0x63,
+	0x6b, 0x65, 0x74, 0x73, 0x22, 0x9c, 0x01, 0x0a, 0x13, 0x42, 0x75, 0x6c, 0x6b, 0x50, 0x75, 0x72,
+	0x63, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x10, 0x0a, 0x03,
+	0x72, 0x6f, 0x77, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x03, 0x72, 0x6f, 0x77, 0x12, 0x34,
+	0x0a, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x54,
+	0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x06, 0x74, 0x69,
+	0x63, 0x6b, 0x65, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x64, 0x72, 0x79, 0x5f, 0x72, 0x75, 0x6e, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x64, 0x72, 0x79, 0x52, 0x75, 0x6e, 0x12, 0x24, 0x0a,
+	0x0e, 0x61, 0x6c, 0x6c, 0x5f, 0x6f, 0x72, 0x5f, 0x6e, 0x6f, 0x74, 0x68, 0x69, 0x6e, 0x67, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x61, 0x6c, 0x6c, 0x4f, 0x72, 0x4e, 0x6f, 0x74, 0x68,
+	0x69, 0x6e, 0x67, 0x22, 0x7e, 0x0a, 0x12, 0x42, 0x75, 0x6c, 0x6b, 0x50, 0x75, 0x72, 0x63, 0x68,
+	0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x72, 0x6f, 0x77,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x03, 0x72, 0x6f, 0x77, 0x12, 0x2c, 0x0a, 0x06, 0x74,
+	0x69, 0x63, 0x6b, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70,
+	0x74, 0x52, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12,
+	0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63,
+	0x6f, 0x64, 0x65, 0x22, 0x95, 0x01, 0x0a, 0x14, 0x42, 0x75, 0x6c, 0x6b, 0x50, 0x75, 0x72, 0x63,
+	0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x33, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74,
+	0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x42, 0x75, 0x6c, 0x6b, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x52, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x62,
+	0x6f, 0x6f, 0x6b, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x62, 0x6f, 0x6f,
+	0x6b, 0x65, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x06, 0x66, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x22, 0x95, 0x03, 0x0a, 0x0d,
+	0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x14, 0x0a,
+	0x05, 0x63, 0x6f, 0x61, 0x63, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x63, 0x6f,
+	0x61, 0x63, 0x68, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x73, 0x65, 0x61, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x61, 0x72, 0x65, 0x5f,
+	0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x66, 0x61, 0x72,
+	0x65, 0x43, 0x6c, 0x61, 0x73, 0x73, 0x12, 0x2b, 0x0a, 0x11, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e,
+	0x67, 0x5f, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x10, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x66, 0x65, 0x72, 0x65,
+	0x6e, 0x63, 0x65, 0x12, 0x1f, 0x0a, 0x04, 0x75, 0x73, 0x65, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x04,
+	0x75, 0x73, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x6f, 0x18, 0x07,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x74, 0x6f, 0x12, 0x25, 0x0a, 0x07, 0x69, 0x6e, 0x66, 0x61,
+	0x6e, 0x74, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x07, 0x69, 0x6e, 0x66, 0x61, 0x6e, 0x74, 0x73, 0x12,
+	0x38, 0x0a, 0x0a, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x09, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x41, 0x73, 0x73, 0x69,
+	0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x0a, 0x61,
+	0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65, 0x61,
+	0x74, 0x5f, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x73, 0x18, 0x0a, 0x20, 0x03,
+	0x28, 0x09, 0x52, 0x0e, 0x73, 0x65, 0x61, 0x74, 0x41, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74,
+	0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x0b, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x72, 0x65,
+	0x73, 0x65, 0x61, 0x74, 0x5f, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x18, 0x0c, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x0e, 0x72, 0x65, 0x73, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x69,
+	0x72, 0x65, 0x64, 0x22, 0x8e, 0x01, 0x0a, 0x0d, 0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73, 0x74,
+	0x43, 0x6f, 0x61, 0x63, 0x68, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x61, 0x72,
+	0x65, 0x5f, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x66,
+	0x61, 0x72, 0x65, 0x43, 0x6c, 0x61, 0x73, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x61, 0x70, 0x61,
+	0x63, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x63, 0x61, 0x70, 0x61,
+	0x63, 0x69, 0x74, 0x79, 0x12, 0x2e, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18,
+	0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4d, 0x61,
+	0x6e, 0x69, 0x66, 0x65, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x07, 0x65, 0x6e, 0x74,
+	0x72, 0x69, 0x65, 0x73, 0x22, 0x2f, 0x0a, 0x15, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x4d, 0x61,
+	0x6e, 0x69, 0x66, 0x65, 0x73, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a,
+	0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66,
+	0x6f, 0x72, 0x6d, 0x61, 0x74, 0x22, 0xa5, 0x01, 0x0a, 0x16, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74,
+	0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x74,
+	0x65, 0x6e, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b,
+	0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x64,
+	0x61, 0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12,
+	0x1c, 0x0a, 0x09, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x09, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x12, 0x1e, 0x0a,
+	0x0a, 0x70, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x0a, 0x70, 0x61, 0x73, 0x73, 0x65, 0x6e, 0x67, 0x65, 0x72, 0x73, 0x22, 0x89, 0x01,
+	0x0a, 0x11, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x44, 0x65, 0x70, 0x61, 0x72, 0x74,
+	0x75, 0x72, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x2b, 0x0a, 0x11, 0x61, 0x73, 0x73, 0x69, 0x73,
+	0x74, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x63, 0x75, 0x74, 0x6f, 0x66, 0x66, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x10, 0x61, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x43, 0x75,
+	0x74, 0x6f, 0x66, 0x66, 0x12, 0x33, 0x0a, 0x15, 0x6f, 0x76, 0x65, 0x72, 0x62, 0x6f, 0x6f, 0x6b,
+	0x69, 0x6e, 0x67, 0x5f, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x14, 0x6f, 0x76, 0x65, 0x72, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67,
+	0x41, 0x6c, 0x6c, 0x6f, 0x77, 0x61, 0x6e, 0x63, 0x65, 0x22, 0x89, 0x01, 0x0a, 0x0f, 0x53, 0x6e,
+	0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x61, 0x72, 0x65, 0x5f, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x66, 0x61, 0x72, 0x65, 0x43, 0x6c, 0x61, 0x73, 0x73,
+	0x12, 0x1a, 0x0a, 0x08, 0x63, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x08, 0x63, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x12, 0x27, 0x0a, 0x0f,
+	0x61, 0x76, 0x61, 0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65, 0x5f, 0x73, 0x65, 0x61, 0x74, 0x73, 0x18,
+	0x04, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0e, 0x61, 0x76, 0x61, 0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65,
+	0x53, 0x65, 0x61, 0x74, 0x73, 0x22, 0xef, 0x01, 0x0a, 0x08, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68,
+	0x6f, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41,
+	0x74, 0x12, 0x2e, 0x0a, 0x07, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65,
+	0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x07, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74,
+	0x73, 0x12, 0x32, 0x0a, 0x08, 0x73, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x6e, 0x61, 0x70,
+	0x73, 0x68, 0x6f, 0x74, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x08, 0x73, 0x65, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x28, 0x0a, 0x06, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x18,
+	0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65,
+	0x61, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x06, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x12,
+	0x36, 0x0a, 0x09, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x44, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x52, 0x09, 0x64, 0x65,
+	0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x22, 0x5c, 0x0a, 0x0c, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69,
+	0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x08, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x16, 0x0a,
+	0x06, 0x73, 0x68, 0x61, 0x32, 0x35, 0x36, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73,
+	0x68, 0x61, 0x32, 0x35, 0x36, 0x22, 0x8b, 0x03, 0x0a, 0x0c, 0x42, 0x6f, 0x6f, 0x6b, 0x69, 0x6e,
+	0x67, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x63, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x6f, 0x63, 0x63, 0x75, 0x72, 0x72,
+	0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6f, 0x63, 0x63,
+	0x75, 0x72, 0x72, 0x65, 0x64, 0x41, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f,
+	0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x75, 0x73, 0x65,
+	0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x2b, 0x0a, 0x11, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e,
+	0x67, 0x5f, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x10, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x66, 0x65, 0x72, 0x65,
+	0x6e, 0x63, 0x65, 0x12, 0x2c, 0x0a, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b,
+	0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65,
+	0x74, 0x12, 0x23, 0x0a, 0x0d, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f, 0x75, 0x73, 0x5f, 0x73, 0x65,
+	0x61, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x70, 0x72, 0x65, 0x76, 0x69, 0x6f,
+	0x75, 0x73, 0x53, 0x65, 0x61, 0x74, 0x12, 0x26, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65,
+	0x61, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x36,
+	0x0a, 0x09, 0x64, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68,
+	0x6f, 0x74, 0x44, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x52, 0x09, 0x64, 0x65, 0x70,
+	0x61, 0x72, 0x74, 0x75, 0x72, 0x65, 0x12, 0x2b, 0x0a, 0x08, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68,
+	0x6f, 0x74, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x52, 0x08, 0x73, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x22, 0x9a, 0x01, 0x0a, 0x0a, 0x44, 0x65, 0x61, 0x64, 0x4c, 0x65, 0x74, 0x74,
+	0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x6e, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x73, 0x69, 0x6e, 0x6b, 0x12, 0x29, 0x0a, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x42, 0x6f,
+	0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x05, 0x65, 0x76, 0x65, 0x6e,
+	0x74, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d,
+	0x70, 0x74, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d,
+	0x70, 0x74, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x66, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x5f, 0x61, 0x74,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x66, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x41, 0x74,
+	0x22, 0x17, 0x0a, 0x15, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68,
+	0x6f, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x76, 0x0a, 0x16, 0x45, 0x78, 0x70,
+	0x6f, 0x72, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x68, 0x61, 0x32, 0x35,
+	0x36, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x68, 0x61, 0x32, 0x35, 0x36, 0x12,
+	0x18, 0x0a, 0x07, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x07, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x6c, 0x6f,
+	0x63, 0x6b, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x62, 0x6c, 0x6f, 0x63, 0x6b,
+	0x73, 0x22, 0x44, 0x0a, 0x15, 0x49, 0x6d, 0x70, 0x6f, 0x72, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61,
+	0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x17,
+	0x0a, 0x07, 0x64, 0x72, 0x79, 0x5f, 0x72, 0x75, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x06, 0x64, 0x72, 0x79, 0x52, 0x75, 0x6e, 0x22, 0x64, 0x0a, 0x16, 0x49, 0x6d, 0x70, 0x6f, 0x72,
+	0x74, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x74,
+	0x69, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x07, 0x74, 0x69,
+	0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x22, 0xd0, 0x02,
+	0x0a, 0x0a, 0x41, 0x75, 0x64, 0x69, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x1a, 0x0a, 0x08,
+	0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08,
+	0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x61, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x61, 0x63, 0x74,
+	0x6f, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x5f, 0x65, 0x6d, 0x61, 0x69,
+	0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x45, 0x6d,
+	0x61, 0x69, 0x6c, 0x12, 0x1f, 0x0a, 0x0b, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x5f, 0x72, 0x6f, 0x6c,
+	0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x52,
+	0x6f, 0x6c, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x12, 0x1d, 0x0a, 0x0a,
+	0x75, 0x73, 0x65, 0x72, 0x5f, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x75, 0x73, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x2b, 0x0a, 0x11, 0x62,
+	0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x5f, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65,
+	0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x52,
+	0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x65, 0x66, 0x6f,
+	0x72, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65,
+	0x12, 0x14, 0x0a, 0x05, 0x61, 0x66, 0x74, 0x65, 0x72, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x61, 0x66, 0x74, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x0b,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72,
+	0x72, 0x6f, 0x72, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72,
+	0x22, 0xa4, 0x01, 0x0a, 0x14, 0x51, 0x75, 0x65, 0x72, 0x79, 0x41, 0x75, 0x64, 0x69, 0x74, 0x4c,
+	0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2b, 0x0a, 0x11, 0x62, 0x6f, 0x6f,
+	0x6b, 0x69, 0x6e, 0x67, 0x5f, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x66,
+	0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x65,
+	0x6d, 0x61, 0x69, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x75, 0x73, 0x65, 0x72,
+	0x45, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x61, 0x63, 0x74, 0x6f, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x73,
+	0x69, 0x6e, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x73, 0x69, 0x6e, 0x63,
+	0x65, 0x12, 0x14, 0x0a, 0x05, 0x75, 0x6e, 0x74, 0x69, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x75, 0x6e, 0x74, 0x69, 0x6c, 0x22, 0x44, 0x0a, 0x15, 0x51, 0x75, 0x65, 0x72, 0x79,
+	0x41, 0x75, 0x64, 0x69, 0x74, 0x4c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x2b, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x11, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x41, 0x75, 0x64, 0x69, 0x74, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x22, 0xae, 0x01,
+	0x0a, 0x0f, 0x42, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f,
+	0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x05, 0x52, 0x08, 0x72, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a,
+	0x06, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63,
+	0x68, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64,
+	0x5f, 0x61, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x67,
+	0x65, 0x64, 0x41, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65,
+	0x12, 0x2c, 0x0a, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x14, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x52,
+	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x22, 0x66,
+	0x0a, 0x18, 0x47, 0x65, 0x74, 0x42, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x48, 0x69, 0x73, 0x74,
+	0x6f, 0x72, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73,
+	0x65, 0x72, 0x5f, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x75, 0x73, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x2b, 0x0a, 0x11, 0x62, 0x6f, 0x6f,
+	0x6b, 0x69, 0x6e, 0x67, 0x5f, 0x72, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x66,
+	0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x22, 0x7e, 0x0a, 0x19, 0x47, 0x65, 0x74, 0x42, 0x6f, 0x6f,
+	0x6b, 0x69, 0x6e, 0x67, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x2b, 0x0a, 0x11, 0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x5f, 0x72,
+	0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10,
+	0x62, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65,
+	0x12, 0x34, 0x0a, 0x09, 0x72, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x42, 0x6f, 0x6f, 0x6b,
+	0x69, 0x6e, 0x67, 0x52, 0x65, 0x76, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x09, 0x72, 0x65, 0x76,
+	0x69, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x32, 0x86, 0x0b, 0x0a, 0x0c, 0x54, 0x72, 0x61, 0x69, 0x6e,
+	0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x4d, 0x0a, 0x0e, 0x50, 0x75, 0x72, 0x63, 0x68,
+	0x61, 0x73, 0x65, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x1c, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x2e, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x54, 0x69, 0x63, 0x6b, 0x65, 0x74,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x54, 0x69, 0x63, 0x6b, 0x65, 0x74, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x41, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x52, 0x65, 0x63,
+	0x65, 0x69, 0x70, 0x74, 0x12, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74,
+	0x52, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x52, 0x65, 0x63, 0x65, 0x69, 0x70,
+	0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x56, 0x0a, 0x11, 0x47, 0x65, 0x74,
+	0x55, 0x73, 0x65, 0x72, 0x73, 0x42, 0x79, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1f,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x55, 0x73, 0x65, 0x72, 0x73, 0x42,
+	0x79, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x20, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x55, 0x73, 0x65, 0x72, 0x73,
+	0x42, 0x79, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x41, 0x0a, 0x0a, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x55, 0x73, 0x65, 0x72, 0x12,
+	0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x55, 0x73,
+	0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x55, 0x73, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x41, 0x0a, 0x0a, 0x4d, 0x6f, 0x64, 0x69, 0x66, 0x79, 0x53, 0x65,
+	0x61, 0x74, 0x12, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4d, 0x6f, 0x64, 0x69, 0x66,
+	0x79, 0x53, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x4d, 0x6f, 0x64, 0x69, 0x66, 0x79, 0x53, 0x65, 0x61, 0x74, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x62, 0x0a, 0x15, 0x47, 0x65, 0x74, 0x41, 0x73,
+	0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73, 0x74,
+	0x12, 0x23, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x41, 0x73, 0x73, 0x69,
+	0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65,
+	0x74, 0x41, 0x73, 0x73, 0x69, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x4d, 0x61, 0x6e, 0x69, 0x66,
+	0x65, 0x73, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x41, 0x0a, 0x0a, 0x42,
+	0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x12, 0x18, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x2e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x42, 0x6c, 0x6f, 0x63,
+	0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x47,
+	0x0a, 0x0c, 0x55, 0x6e, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x12, 0x1a,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x55, 0x6e, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65,
+	0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1b, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x2e, 0x55, 0x6e, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x53, 0x65, 0x61, 0x74, 0x73, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x4d, 0x0a, 0x0e, 0x4c, 0x69, 0x73, 0x74, 0x53,
+	0x65, 0x61, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x12, 0x1c, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x53, 0x65, 0x61, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x4c, 0x69, 0x73, 0x74, 0x53, 0x65, 0x61, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x73, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x38, 0x0a, 0x07, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x49,
+	0x6e, 0x12, 0x15, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x49,
+	0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2e, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x49, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x47, 0x0a, 0x0c, 0x53, 0x65, 0x74, 0x44, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72, 0x65,
+	0x12, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65, 0x74, 0x44, 0x65, 0x70, 0x61,
+	0x72, 0x74, 0x75, 0x72, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1b, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65, 0x74, 0x44, 0x65, 0x70, 0x61, 0x72, 0x74, 0x75, 0x72,
+	0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x68, 0x0a, 0x17, 0x47, 0x65, 0x74,
+	0x44, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x42, 0x6f, 0x61, 0x72, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65,
+	0x70, 0x6f, 0x72, 0x74, 0x12, 0x25, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74,
+	0x44, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x42, 0x6f, 0x61, 0x72, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65,
+	0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x44, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x42, 0x6f, 0x61,
+	0x72, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x49, 0x0a, 0x0c, 0x42, 0x75, 0x6c, 0x6b, 0x50, 0x75, 0x72, 0x63, 0x68,
+	0x61, 0x73, 0x65, 0x12, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x42, 0x75, 0x6c, 0x6b,
+	0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x1b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x42, 0x75, 0x6c, 0x6b, 0x50, 0x75, 0x72, 0x63,
+	0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x12, 0x4d,
+	0x0a, 0x0e, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x4d, 0x61, 0x6e, 0x69, 0x66, 0x65, 0x73, 0x74,
+	0x12, 0x1c, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x4d,
+	0x61, 0x6e, 0x69, 0x66, 0x65, 0x73, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x4d, 0x61, 0x6e,
+	0x69, 0x66, 0x65, 0x73, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x4d, 0x0a,
+	0x0e, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12,
+	0x1c, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x53, 0x6e,
+	0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x78, 0x70, 0x6f, 0x72, 0x74, 0x53, 0x6e, 0x61, 0x70,
+	0x73, 0x68, 0x6f, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x4d, 0x0a, 0x0e,
+	0x49, 0x6d, 0x70, 0x6f, 0x72, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x1c,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x49, 0x6d, 0x70, 0x6f, 0x72, 0x74, 0x53, 0x6e, 0x61,
+	0x70, 0x73, 0x68, 0x6f, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x49, 0x6d, 0x70, 0x6f, 0x72, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x4a, 0x0a, 0x0d, 0x51,
+	0x75, 0x65, 0x72, 0x79, 0x41, 0x75, 0x64, 0x69, 0x74, 0x4c, 0x6f, 0x67, 0x12, 0x1b, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x41, 0x75, 0x64, 0x69, 0x74, 0x4c,
+	0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1c, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x41, 0x75, 0x64, 0x69, 0x74, 0x4c, 0x6f, 0x67, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x56, 0x0a, 0x11, 0x47, 0x65, 0x74, 0x42, 0x6f,
+	0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x1f, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x42, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67, 0x48,
+	0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x65, 0x74, 0x42, 0x6f, 0x6f, 0x6b, 0x69, 0x6e, 0x67,
+	0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42,
+	0x08, 0x5a, 0x06, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
 }
 
 var (
@@ -834,46 +4002,144 @@ func file_proto_train_service_proto_rawDescGZIP() []byte {
 	return file_proto_train_service_proto_rawDescData
 }
 
-var file_proto_train_service_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_proto_train_service_proto_msgTypes = make([]protoimpl.MessageInfo, 53)
 var file_proto_train_service_proto_goTypes = []any{
-	(*User)(nil),                      // 0: proto.User
-	(*TicketReceipt)(nil),             // 1: proto.TicketReceipt
-	(*PurchaseTicketRequest)(nil),     // 2: proto.PurchaseTicketRequest
-	(*TicketPurchaseResponse)(nil),    // 3: proto.TicketPurchaseResponse
-	(*GetReceiptRequest)(nil),         // 4: proto.GetReceiptRequest
-	(*GetReceiptResponse)(nil),        // 5: proto.GetReceiptResponse
-	(*GetUsersBySectionRequest)(nil),  // 6: proto.GetUsersBySectionRequest
-	(*GetUsersBySectionResponse)(nil), // 7: proto.GetUsersBySectionResponse
-	(*UserSeatAllocation)(nil),        // 8: proto.UserSeatAllocation
-	(*RemoveUserRequest)(nil),         // 9: proto.RemoveUserRequest
-	(*RemoveUserResponse)(nil),        // 10: proto.RemoveUserResponse
-	(*ModifySeatRequest)(nil),         // 11: proto.ModifySeatRequest
-	(*ModifySeatResponse)(nil),        // 12: proto.ModifySeatResponse
+	(*User)(nil),                            // 0: proto.User
+	(*TicketReceipt)(nil),                   // 1: proto.TicketReceipt
+	(*AssistanceRequest)(nil),               // 2: proto.AssistanceRequest
+	(*PurchaseTicketRequest)(nil),           // 3: proto.PurchaseTicketRequest
+	(*TicketPurchaseResponse)(nil),          // 4: proto.TicketPurchaseResponse
+	(*GetReceiptRequest)(nil),               // 5: proto.GetReceiptRequest
+	(*GetReceiptResponse)(nil),              // 6: proto.GetReceiptResponse
+	(*GetUsersBySectionRequest)(nil),        // 7: proto.GetUsersBySectionRequest
+	(*GetUsersBySectionResponse)(nil),       // 8: proto.GetUsersBySectionResponse
+	(*UserSeatAllocation)(nil),              // 9: proto.UserSeatAllocation
+	(*GetAssistanceManifestRequest)(nil),    // 10: proto.GetAssistanceManifestRequest
+	(*GetAssistanceManifestResponse)(nil),   // 11: proto.GetAssistanceManifestResponse
+	(*AssistanceManifestEntry)(nil),         // 12: proto.AssistanceManifestEntry
+	(*RemoveUserRequest)(nil),               // 13: proto.RemoveUserRequest
+	(*RemoveUserResponse)(nil),              // 14: proto.RemoveUserResponse
+	(*ModifySeatRequest)(nil),               // 15: proto.ModifySeatRequest
+	(*ModifySeatResponse)(nil),              // 16: proto.ModifySeatResponse
+	(*SeatBlock)(nil),                       // 17: proto.SeatBlock
+	(*BlockSeatsRequest)(nil),               // 18: proto.BlockSeatsRequest
+	(*BlockSeatsResponse)(nil),              // 19: proto.BlockSeatsResponse
+	(*UnblockSeatsRequest)(nil),             // 20: proto.UnblockSeatsRequest
+	(*UnblockSeatsResponse)(nil),            // 21: proto.UnblockSeatsResponse
+	(*ListSeatBlocksRequest)(nil),           // 22: proto.ListSeatBlocksRequest
+	(*ListSeatBlocksResponse)(nil),          // 23: proto.ListSeatBlocksResponse
+	(*CheckInRequest)(nil),                  // 24: proto.CheckInRequest
+	(*CheckInResponse)(nil),                 // 25: proto.CheckInResponse
+	(*SetDepartureRequest)(nil),             // 26: proto.SetDepartureRequest
+	(*SetDepartureResponse)(nil),            // 27: proto.SetDepartureResponse
+	(*GetDeniedBoardingReportRequest)(nil),  // 28: proto.GetDeniedBoardingReportRequest
+	(*GetDeniedBoardingReportResponse)(nil), // 29: proto.GetDeniedBoardingReportResponse
+	(*BulkPurchaseRequest)(nil),             // 30: proto.BulkPurchaseRequest
+	(*BulkPurchaseResult)(nil),              // 31: proto.BulkPurchaseResult
+	(*BulkPurchaseResponse)(nil),            // 32: proto.BulkPurchaseResponse
+	(*ManifestEntry)(nil),                   // 33: proto.ManifestEntry
+	(*ManifestCoach)(nil),                   // 34: proto.ManifestCoach
+	(*ExportManifestRequest)(nil),           // 35: proto.ExportManifestRequest
+	(*ExportManifestResponse)(nil),          // 36: proto.ExportManifestResponse
+	(*SnapshotDeparture)(nil),               // 37: proto.SnapshotDeparture
+	(*SnapshotSection)(nil),                 // 38: proto.SnapshotSection
+	(*Snapshot)(nil),                        // 39: proto.Snapshot
+	(*SnapshotFile)(nil),                    // 40: proto.SnapshotFile
+	(*BookingEvent)(nil),                    // 41: proto.BookingEvent
+	(*DeadLetter)(nil),                      // 42: proto.DeadLetter
+	(*ExportSnapshotRequest)(nil),           // 43: proto.ExportSnapshotRequest
+	(*ExportSnapshotResponse)(nil),          // 44: proto.ExportSnapshotResponse
+	(*ImportSnapshotRequest)(nil),           // 45: proto.ImportSnapshotRequest
+	(*ImportSnapshotResponse)(nil),          // 46: proto.ImportSnapshotResponse
+	(*AuditEntry)(nil),                      // 47: proto.AuditEntry
+	(*QueryAuditLogRequest)(nil),            // 48: proto.QueryAuditLogRequest
+	(*QueryAuditLogResponse)(nil),           // 49: proto.QueryAuditLogResponse
+	(*BookingRevision)(nil),                 // 50: proto.BookingRevision
+	(*GetBookingHistoryRequest)(nil),        // 51: proto.GetBookingHistoryRequest
+	(*GetBookingHistoryResponse)(nil),       // 52: proto.GetBookingHistoryResponse
 }
 var file_proto_train_service_proto_depIdxs = []int32{
 	0,  // 0: proto.TicketReceipt.user:type_name -> proto.User
-	0,  // 1: proto.PurchaseTicketRequest.user:type_name -> proto.User
-	1,  // 2: proto.TicketPurchaseResponse.ticket:type_name -> proto.TicketReceipt
-	1,  // 3: proto.GetReceiptResponse.ticket:type_name -> proto.TicketReceipt
-	8,  // 4: proto.GetUsersBySectionResponse.user_seats:type_name -> proto.UserSeatAllocation
-	0,  // 5: proto.UserSeatAllocation.user:type_name -> proto.User
-	0,  // 6: proto.RemoveUserResponse.user:type_name -> proto.User
-	1,  // 7: proto.ModifySeatResponse.new_ticket:type_name -> proto.TicketReceipt
-	2,  // 8: proto.TrainService.PurchaseTicket:input_type -> proto.PurchaseTicketRequest
-	4,  // 9: proto.TrainService.GetReceipt:input_type -> proto.GetReceiptRequest
-	6,  // 10: proto.TrainService.GetUsersBySection:input_type -> proto.GetUsersBySectionRequest
-	9,  // 11: proto.TrainService.RemoveUser:input_type -> proto.RemoveUserRequest
-	11, // 12: proto.TrainService.ModifySeat:input_type -> proto.ModifySeatRequest
-	3,  // 13: proto.TrainService.PurchaseTicket:output_type -> proto.TicketPurchaseResponse
-	5,  // 14: proto.TrainService.GetReceipt:output_type -> proto.GetReceiptResponse
-	7,  // 15: proto.TrainService.GetUsersBySection:output_type -> proto.GetUsersBySectionResponse
-	10, // 16: proto.TrainService.RemoveUser:output_type -> proto.RemoveUserResponse
-	12, // 17: proto.TrainService.ModifySeat:output_type -> proto.ModifySeatResponse
-	13, // [13:18] is the sub-list for method output_type
-	8,  // [8:13] is the sub-list for method input_type
-	8,  // [8:8] is the sub-list for extension type_name
-	8,  // [8:8] is the sub-list for extension extendee
-	0,  // [0:8] is the sub-list for field type_name
+	0,  // 1: proto.TicketReceipt.infants:type_name -> proto.User
+	2,  // 2: proto.TicketReceipt.assistance:type_name -> proto.AssistanceRequest
+	0,  // 3: proto.PurchaseTicketRequest.user:type_name -> proto.User
+	0,  // 4: proto.PurchaseTicketRequest.infants:type_name -> proto.User
+	2,  // 5: proto.PurchaseTicketRequest.assistance:type_name -> proto.AssistanceRequest
+	1,  // 6: proto.TicketPurchaseResponse.ticket:type_name -> proto.TicketReceipt
+	1,  // 7: proto.GetReceiptResponse.ticket:type_name -> proto.TicketReceipt
+	9,  // 8: proto.GetUsersBySectionResponse.user_seats:type_name -> proto.UserSeatAllocation
+	0,  // 9: proto.UserSeatAllocation.user:type_name -> proto.User
+	12, // 10: proto.GetAssistanceManifestResponse.entries:type_name -> proto.AssistanceManifestEntry
+	0,  // 11: proto.AssistanceManifestEntry.user:type_name -> proto.User
+	2,  // 12: proto.AssistanceManifestEntry.assistance:type_name -> proto.AssistanceRequest
+	0,  // 13: proto.RemoveUserResponse.user:type_name -> proto.User
+	1,  // 14: proto.ModifySeatResponse.new_ticket:type_name -> proto.TicketReceipt
+	17, // 15: proto.BlockSeatsResponse.blocks:type_name -> proto.SeatBlock
+	1,  // 16: proto.BlockSeatsResponse.reseated_tickets:type_name -> proto.TicketReceipt
+	1,  // 17: proto.BlockSeatsResponse.flagged_tickets:type_name -> proto.TicketReceipt
+	17, // 18: proto.ListSeatBlocksResponse.blocks:type_name -> proto.SeatBlock
+	1,  // 19: proto.CheckInResponse.ticket:type_name -> proto.TicketReceipt
+	1,  // 20: proto.GetDeniedBoardingReportResponse.tickets:type_name -> proto.TicketReceipt
+	3,  // 21: proto.BulkPurchaseRequest.ticket:type_name -> proto.PurchaseTicketRequest
+	1,  // 22: proto.BulkPurchaseResult.ticket:type_name -> proto.TicketReceipt
+	31, // 23: proto.BulkPurchaseResponse.results:type_name -> proto.BulkPurchaseResult
+	0,  // 24: proto.ManifestEntry.user:type_name -> proto.User
+	0,  // 25: proto.ManifestEntry.infants:type_name -> proto.User
+	2,  // 26: proto.ManifestEntry.assistance:type_name -> proto.AssistanceRequest
+	33, // 27: proto.ManifestCoach.entries:type_name -> proto.ManifestEntry
+	1,  // 28: proto.Snapshot.tickets:type_name -> proto.TicketReceipt
+	38, // 29: proto.Snapshot.sections:type_name -> proto.SnapshotSection
+	17, // 30: proto.Snapshot.blocks:type_name -> proto.SeatBlock
+	37, // 31: proto.Snapshot.departure:type_name -> proto.SnapshotDeparture
+	1,  // 32: proto.BookingEvent.ticket:type_name -> proto.TicketReceipt
+	17, // 33: proto.BookingEvent.block:type_name -> proto.SeatBlock
+	37, // 34: proto.BookingEvent.departure:type_name -> proto.SnapshotDeparture
+	39, // 35: proto.BookingEvent.snapshot:type_name -> proto.Snapshot
+	41, // 36: proto.DeadLetter.event:type_name -> proto.BookingEvent
+	47, // 37: proto.QueryAuditLogResponse.entries:type_name -> proto.AuditEntry
+	1,  // 38: proto.BookingRevision.ticket:type_name -> proto.TicketReceipt
+	50, // 39: proto.GetBookingHistoryResponse.revisions:type_name -> proto.BookingRevision
+	3,  // 40: proto.TrainService.PurchaseTicket:input_type -> proto.PurchaseTicketRequest
+	5,  // 41: proto.TrainService.GetReceipt:input_type -> proto.GetReceiptRequest
+	7,  // 42: proto.TrainService.GetUsersBySection:input_type -> proto.GetUsersBySectionRequest
+	13, // 43: proto.TrainService.RemoveUser:input_type -> proto.RemoveUserRequest
+	15, // 44: proto.TrainService.ModifySeat:input_type -> proto.ModifySeatRequest
+	10, // 45: proto.TrainService.GetAssistanceManifest:input_type -> proto.GetAssistanceManifestRequest
+	18, // 46: proto.TrainService.BlockSeats:input_type -> proto.BlockSeatsRequest
+	20, // 47: proto.TrainService.UnblockSeats:input_type -> proto.UnblockSeatsRequest
+	22, // 48: proto.TrainService.ListSeatBlocks:input_type -> proto.ListSeatBlocksRequest
+	24, // 49: proto.TrainService.CheckIn:input_type -> proto.CheckInRequest
+	26, // 50: proto.TrainService.SetDeparture:input_type -> proto.SetDepartureRequest
+	28, // 51: proto.TrainService.GetDeniedBoardingReport:input_type -> proto.GetDeniedBoardingReportRequest
+	30, // 52: proto.TrainService.BulkPurchase:input_type -> proto.BulkPurchaseRequest
+	35, // 53: proto.TrainService.ExportManifest:input_type -> proto.ExportManifestRequest
+	43, // 54: proto.TrainService.ExportSnapshot:input_type -> proto.ExportSnapshotRequest
+	45, // 55: proto.TrainService.ImportSnapshot:input_type -> proto.ImportSnapshotRequest
+	48, // 56: proto.TrainService.QueryAuditLog:input_type -> proto.QueryAuditLogRequest
+	51, // 57: proto.TrainService.GetBookingHistory:input_type -> proto.GetBookingHistoryRequest
+	4,  // 58: proto.TrainService.PurchaseTicket:output_type -> proto.TicketPurchaseResponse
+	6,  // 59: proto.TrainService.GetReceipt:output_type -> proto.GetReceiptResponse
+	8,  // 60: proto.TrainService.GetUsersBySection:output_type -> proto.GetUsersBySectionResponse
+	14, // 61: proto.TrainService.RemoveUser:output_type -> proto.RemoveUserResponse
+	16, // 62: proto.TrainService.ModifySeat:output_type -> proto.ModifySeatResponse
+	11, // 63: proto.TrainService.GetAssistanceManifest:output_type -> proto.GetAssistanceManifestResponse
+	19, // 64: proto.TrainService.BlockSeats:output_type -> proto.BlockSeatsResponse
+	21, // 65: proto.TrainService.UnblockSeats:output_type -> proto.UnblockSeatsResponse
+	23, // 66: proto.TrainService.ListSeatBlocks:output_type -> proto.ListSeatBlocksResponse
+	25, // 67: proto.TrainService.CheckIn:output_type -> proto.CheckInResponse
+	27, // 68: proto.TrainService.SetDeparture:output_type -> proto.SetDepartureResponse
+	29, // 69: proto.TrainService.GetDeniedBoardingReport:output_type -> proto.GetDeniedBoardingReportResponse
+	32, // 70: proto.TrainService.BulkPurchase:output_type -> proto.BulkPurchaseResponse
+	36, // 71: proto.TrainService.ExportManifest:output_type -> proto.ExportManifestResponse
+	44, // 72: proto.TrainService.ExportSnapshot:output_type -> proto.ExportSnapshotResponse
+	46, // 73: proto.TrainService.ImportSnapshot:output_type -> proto.ImportSnapshotResponse
+	49, // 74: proto.TrainService.QueryAuditLog:output_type -> proto.QueryAuditLogResponse
+	52, // 75: proto.TrainService.GetBookingHistory:output_type -> proto.GetBookingHistoryResponse
+	58, // [58:76] is the sub-list for method output_type
+	40, // [40:58] is the sub-list for method input_type
+	40, // [40:40] is the sub-list for extension type_name
+	40, // [40:40] is the sub-list for extension extendee
+	0,  // [0:40] is the sub-list for field type_name
 }
 
 func init() { file_proto_train_service_proto_init() }
@@ -887,7 +4153,7 @@ func file_proto_train_service_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proto_train_service_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   13,
+			NumMessages:   53,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,11 +19,24 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	TrainService_PurchaseTicket_FullMethodName    = "/proto.TrainService/PurchaseTicket"
-	TrainService_GetReceipt_FullMethodName        = "/proto.TrainService/GetReceipt"
-	TrainService_GetUsersBySection_FullMethodName = "/proto.TrainService/GetUsersBySection"
-	TrainService_RemoveUser_FullMethodName        = "/proto.TrainService/RemoveUser"
-	TrainService_ModifySeat_FullMethodName        = "/proto.TrainService/ModifySeat"
+	TrainService_PurchaseTicket_FullMethodName          = "/proto.TrainService/PurchaseTicket"
+	TrainService_GetReceipt_FullMethodName              = "/proto.TrainService/GetReceipt"
+	TrainService_GetUsersBySection_FullMethodName       = "/proto.TrainService/GetUsersBySection"
+	TrainService_RemoveUser_FullMethodName              = "/proto.TrainService/RemoveUser"
+	TrainService_ModifySeat_FullMethodName              = "/proto.TrainService/ModifySeat"
+	TrainService_GetAssistanceManifest_FullMethodName   = "/proto.TrainService/GetAssistanceManifest"
+	TrainService_BlockSeats_FullMethodName              = "/proto.TrainService/BlockSeats"
+	TrainService_UnblockSeats_FullMethodName            = "/proto.TrainService/UnblockSeats"
+	TrainService_ListSeatBlocks_FullMethodName          = "/proto.TrainService/ListSeatBlocks"
+	TrainService_CheckIn_FullMethodName                 = "/proto.TrainService/CheckIn"
+	TrainService_SetDeparture_FullMethodName            = "/proto.TrainService/SetDeparture"
+	TrainService_GetDeniedBoardingReport_FullMethodName = "/proto.TrainService/GetDeniedBoardingReport"
+	TrainService_BulkPurchase_FullMethodName            = "/proto.TrainService/BulkPurchase"
+	TrainService_ExportManifest_FullMethodName          = "/proto.TrainService/ExportManifest"
+	TrainService_ExportSnapshot_FullMethodName          = "/proto.TrainService/ExportSnapshot"
+	TrainService_ImportSnapshot_FullMethodName          = "/proto.TrainService/ImportSnapshot"
+	TrainService_QueryAuditLog_FullMethodName           = "/proto.TrainService/QueryAuditLog"
+	TrainService_GetBookingHistory_FullMethodName       = "/proto.TrainService/GetBookingHistory"
 )
 
 // TrainServiceClient is the client API for TrainService service.
@@ -37,6 +50,19 @@ type TrainServiceClient interface {
 	GetUsersBySection(ctx context.Context, in *GetUsersBySectionRequest, opts ...grpc.CallOption) (*GetUsersBySectionResponse, error)
 	RemoveUser(ctx context.Context, in *RemoveUserRequest, opts ...grpc.CallOption) (*RemoveUserResponse, error)
 	ModifySeat(ctx context.Context, in *ModifySeatRequest, opts ...grpc.CallOption) (*ModifySeatResponse, error)
+	GetAssistanceManifest(ctx context.Context, in *GetAssistanceManifestRequest, opts ...grpc.CallOption) (*GetAssistanceManifestResponse, error)
+	BlockSeats(ctx context.Context, in *BlockSeatsRequest, opts ...grpc.CallOption) (*BlockSeatsResponse, error)
+	UnblockSeats(ctx context.Context, in *UnblockSeatsRequest, opts ...grpc.CallOption) (*UnblockSeatsResponse, error)
+	ListSeatBlocks(ctx context.Context, in *ListSeatBlocksRequest, opts ...grpc.CallOption) (*ListSeatBlocksResponse, error)
+	CheckIn(ctx context.Context, in *CheckInRequest, opts ...grpc.CallOption) (*CheckInResponse, error)
+	SetDeparture(ctx context.Context, in *SetDepartureRequest, opts ...grpc.CallOption) (*SetDepartureResponse, error)
+	GetDeniedBoardingReport(ctx context.Context, in *GetDeniedBoardingReportRequest, opts ...grpc.CallOption) (*GetDeniedBoardingReportResponse, error)
+	BulkPurchase(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BulkPurchaseRequest, BulkPurchaseResponse], error)
+	ExportManifest(ctx context.Context, in *ExportManifestRequest, opts ...grpc.CallOption) (*ExportManifestResponse, error)
+	ExportSnapshot(ctx context.Context, in *ExportSnapshotRequest, opts ...grpc.CallOption) (*ExportSnapshotResponse, error)
+	ImportSnapshot(ctx context.Context, in *ImportSnapshotRequest, opts ...grpc.CallOption) (*ImportSnapshotResponse, error)
+	QueryAuditLog(ctx context.Context, in *QueryAuditLogRequest, opts ...grpc.CallOption) (*QueryAuditLogResponse, error)
+	GetBookingHistory(ctx context.Context, in *GetBookingHistoryRequest, opts ...grpc.CallOption) (*GetBookingHistoryResponse, error)
 }
 
 type trainServiceClient struct {
@@ -97,6 +123,139 @@ func (c *trainServiceClient) ModifySeat(ctx context.Context, in *ModifySeatReque
 	return out, nil
 }
 
+func (c *trainServiceClient) GetAssistanceManifest(ctx context.Context, in *GetAssistanceManifestRequest, opts ...grpc.CallOption) (*GetAssistanceManifestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetAssistanceManifestResponse)
+	err := c.cc.Invoke(ctx, TrainService_GetAssistanceManifest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) BlockSeats(ctx context.Context, in *BlockSeatsRequest, opts ...grpc.CallOption) (*BlockSeatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BlockSeatsResponse)
+	err := c.cc.Invoke(ctx, TrainService_BlockSeats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) UnblockSeats(ctx context.Context, in *UnblockSeatsRequest, opts ...grpc.CallOption) (*UnblockSeatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UnblockSeatsResponse)
+	err := c.cc.Invoke(ctx, TrainService_UnblockSeats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) ListSeatBlocks(ctx context.Context, in *ListSeatBlocksRequest, opts ...grpc.CallOption) (*ListSeatBlocksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSeatBlocksResponse)
+	err := c.cc.Invoke(ctx, TrainService_ListSeatBlocks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) CheckIn(ctx context.Context, in *CheckInRequest, opts ...grpc.CallOption) (*CheckInResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckInResponse)
+	err := c.cc.Invoke(ctx, TrainService_CheckIn_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) SetDeparture(ctx context.Context, in *SetDepartureRequest, opts ...grpc.CallOption) (*SetDepartureResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetDepartureResponse)
+	err := c.cc.Invoke(ctx, TrainService_SetDeparture_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) GetDeniedBoardingReport(ctx context.Context, in *GetDeniedBoardingReportRequest, opts ...grpc.CallOption) (*GetDeniedBoardingReportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetDeniedBoardingReportResponse)
+	err := c.cc.Invoke(ctx, TrainService_GetDeniedBoardingReport_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) BulkPurchase(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BulkPurchaseRequest, BulkPurchaseResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TrainService_ServiceDesc.Streams[0], TrainService_BulkPurchase_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BulkPurchaseRequest, BulkPurchaseResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TrainService_BulkPurchaseClient = grpc.ClientStreamingClient[BulkPurchaseRequest, BulkPurchaseResponse]
+
+func (c *trainServiceClient) ExportManifest(ctx context.Context, in *ExportManifestRequest, opts ...grpc.CallOption) (*ExportManifestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExportManifestResponse)
+	err := c.cc.Invoke(ctx, TrainService_ExportManifest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) ExportSnapshot(ctx context.Context, in *ExportSnapshotRequest, opts ...grpc.CallOption) (*ExportSnapshotResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExportSnapshotResponse)
+	err := c.cc.Invoke(ctx, TrainService_ExportSnapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) ImportSnapshot(ctx context.Context, in *ImportSnapshotRequest, opts ...grpc.CallOption) (*ImportSnapshotResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImportSnapshotResponse)
+	err := c.cc.Invoke(ctx, TrainService_ImportSnapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) QueryAuditLog(ctx context.Context, in *QueryAuditLogRequest, opts ...grpc.CallOption) (*QueryAuditLogResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryAuditLogResponse)
+	err := c.cc.Invoke(ctx, TrainService_QueryAuditLog_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainServiceClient) GetBookingHistory(ctx context.Context, in *GetBookingHistoryRequest, opts ...grpc.CallOption) (*GetBookingHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetBookingHistoryResponse)
+	err := c.cc.Invoke(ctx, TrainService_GetBookingHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TrainServiceServer is the server API for TrainService service.
 // All implementations must embed UnimplementedTrainServiceServer
 // for forward compatibility.
@@ -108,6 +267,19 @@ type TrainServiceServer interface {
 	GetUsersBySection(context.Context, *GetUsersBySectionRequest) (*GetUsersBySectionResponse, error)
 	RemoveUser(context.Context, *RemoveUserRequest) (*RemoveUserResponse, error)
 	ModifySeat(context.Context, *ModifySeatRequest) (*ModifySeatResponse, error)
+	GetAssistanceManifest(context.Context, *GetAssistanceManifestRequest) (*GetAssistanceManifestResponse, error)
+	BlockSeats(context.Context, *BlockSeatsRequest) (*BlockSeatsResponse, error)
+	UnblockSeats(context.Context, *UnblockSeatsRequest) (*UnblockSeatsResponse, error)
+	ListSeatBlocks(context.Context, *ListSeatBlocksRequest) (*ListSeatBlocksResponse, error)
+	CheckIn(context.Context, *CheckInRequest) (*CheckInResponse, error)
+	SetDeparture(context.Context, *SetDepartureRequest) (*SetDepartureResponse, error)
+	GetDeniedBoardingReport(context.Context, *GetDeniedBoardingReportRequest) (*GetDeniedBoardingReportResponse, error)
+	BulkPurchase(grpc.ClientStreamingServer[BulkPurchaseRequest, BulkPurchaseResponse]) error
+	ExportManifest(context.Context, *ExportManifestRequest) (*ExportManifestResponse, error)
+	ExportSnapshot(context.Context, *ExportSnapshotRequest) (*ExportSnapshotResponse, error)
+	ImportSnapshot(context.Context, *ImportSnapshotRequest) (*ImportSnapshotResponse, error)
+	QueryAuditLog(context.Context, *QueryAuditLogRequest) (*QueryAuditLogResponse, error)
+	GetBookingHistory(context.Context, *GetBookingHistoryRequest) (*GetBookingHistoryResponse, error)
 	mustEmbedUnimplementedTrainServiceServer()
 }
 
@@ -133,6 +305,45 @@ func (UnimplementedTrainServiceServer) RemoveUser(context.Context, *RemoveUserRe
 func (UnimplementedTrainServiceServer) ModifySeat(context.Context, *ModifySeatRequest) (*ModifySeatResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ModifySeat not implemented")
 }
+func (UnimplementedTrainServiceServer) GetAssistanceManifest(context.Context, *GetAssistanceManifestRequest) (*GetAssistanceManifestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAssistanceManifest not implemented")
+}
+func (UnimplementedTrainServiceServer) BlockSeats(context.Context, *BlockSeatsRequest) (*BlockSeatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BlockSeats not implemented")
+}
+func (UnimplementedTrainServiceServer) UnblockSeats(context.Context, *UnblockSeatsRequest) (*UnblockSeatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnblockSeats not implemented")
+}
+func (UnimplementedTrainServiceServer) ListSeatBlocks(context.Context, *ListSeatBlocksRequest) (*ListSeatBlocksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSeatBlocks not implemented")
+}
+func (UnimplementedTrainServiceServer) CheckIn(context.Context, *CheckInRequest) (*CheckInResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckIn not implemented")
+}
+func (UnimplementedTrainServiceServer) SetDeparture(context.Context, *SetDepartureRequest) (*SetDepartureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetDeparture not implemented")
+}
+func (UnimplementedTrainServiceServer) GetDeniedBoardingReport(context.Context, *GetDeniedBoardingReportRequest) (*GetDeniedBoardingReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeniedBoardingReport not implemented")
+}
+func (UnimplementedTrainServiceServer) BulkPurchase(grpc.ClientStreamingServer[BulkPurchaseRequest, BulkPurchaseResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method BulkPurchase not implemented")
+}
+func (UnimplementedTrainServiceServer) ExportManifest(context.Context, *ExportManifestRequest) (*ExportManifestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportManifest not implemented")
+}
+func (UnimplementedTrainServiceServer) ExportSnapshot(context.Context, *ExportSnapshotRequest) (*ExportSnapshotResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportSnapshot not implemented")
+}
+func (UnimplementedTrainServiceServer) ImportSnapshot(context.Context, *ImportSnapshotRequest) (*ImportSnapshotResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportSnapshot not implemented")
+}
+func (UnimplementedTrainServiceServer) QueryAuditLog(context.Context, *QueryAuditLogRequest) (*QueryAuditLogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryAuditLog not implemented")
+}
+func (UnimplementedTrainServiceServer) GetBookingHistory(context.Context, *GetBookingHistoryRequest) (*GetBookingHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBookingHistory not implemented")
+}
 func (UnimplementedTrainServiceServer) mustEmbedUnimplementedTrainServiceServer() {}
 func (UnimplementedTrainServiceServer) testEmbeddedByValue()                      {}
 
@@ -244,6 +455,229 @@ func _TrainService_ModifySeat_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TrainService_GetAssistanceManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAssistanceManifestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).GetAssistanceManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_GetAssistanceManifest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).GetAssistanceManifest(ctx, req.(*GetAssistanceManifestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_BlockSeats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockSeatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).BlockSeats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_BlockSeats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).BlockSeats(ctx, req.(*BlockSeatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_UnblockSeats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnblockSeatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).UnblockSeats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_UnblockSeats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).UnblockSeats(ctx, req.(*UnblockSeatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_ListSeatBlocks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSeatBlocksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).ListSeatBlocks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_ListSeatBlocks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).ListSeatBlocks(ctx, req.(*ListSeatBlocksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_CheckIn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckInRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).CheckIn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_CheckIn_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).CheckIn(ctx, req.(*CheckInRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_SetDeparture_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetDepartureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).SetDeparture(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_SetDeparture_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).SetDeparture(ctx, req.(*SetDepartureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_GetDeniedBoardingReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeniedBoardingReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).GetDeniedBoardingReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_GetDeniedBoardingReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).GetDeniedBoardingReport(ctx, req.(*GetDeniedBoardingReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_BulkPurchase_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TrainServiceServer).BulkPurchase(&grpc.GenericServerStream[BulkPurchaseRequest, BulkPurchaseResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TrainService_BulkPurchaseServer = grpc.ClientStreamingServer[BulkPurchaseRequest, BulkPurchaseResponse]
+
+func _TrainService_ExportManifest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportManifestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).ExportManifest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_ExportManifest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).ExportManifest(ctx, req.(*ExportManifestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_ExportSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).ExportSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_ExportSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).ExportSnapshot(ctx, req.(*ExportSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_ImportSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).ImportSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_ImportSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).ImportSnapshot(ctx, req.(*ImportSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_QueryAuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryAuditLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).QueryAuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_QueryAuditLog_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).QueryAuditLog(ctx, req.(*QueryAuditLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrainService_GetBookingHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBookingHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainServiceServer).GetBookingHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TrainService_GetBookingHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainServiceServer).GetBookingHistory(ctx, req.(*GetBookingHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // TrainService_ServiceDesc is the grpc.ServiceDesc for TrainService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -271,7 +705,61 @@ var TrainService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ModifySeat",
 			Handler:    _TrainService_ModifySeat_Handler,
 		},
+		{
+			MethodName: "GetAssistanceManifest",
+			Handler:    _TrainService_GetAssistanceManifest_Handler,
+		},
+		{
+			MethodName: "BlockSeats",
+			Handler:    _TrainService_BlockSeats_Handler,
+		},
+		{
+			MethodName: "UnblockSeats",
+			Handler:    _TrainService_UnblockSeats_Handler,
+		},
+		{
+			MethodName: "ListSeatBlocks",
+			Handler:    _TrainService_ListSeatBlocks_Handler,
+		},
+		{
+			MethodName: "CheckIn",
+			Handler:    _TrainService_CheckIn_Handler,
+		},
+		{
+			MethodName: "SetDeparture",
+			Handler:    _TrainService_SetDeparture_Handler,
+		},
+		{
+			MethodName: "GetDeniedBoardingReport",
+			Handler:    _TrainService_GetDeniedBoardingReport_Handler,
+		},
+		{
+			MethodName: "ExportManifest",
+			Handler:    _TrainService_ExportManifest_Handler,
+		},
+		{
+			MethodName: "ExportSnapshot",
+			Handler:    _TrainService_ExportSnapshot_Handler,
+		},
+		{
+			MethodName: "ImportSnapshot",
+			Handler:    _TrainService_ImportSnapshot_Handler,
+		},
+		{
+			MethodName: "QueryAuditLog",
+			Handler:    _TrainService_QueryAuditLog_Handler,
+		},
+		{
+			MethodName: "GetBookingHistory",
+			Handler:    _TrainService_GetBookingHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BulkPurchase",
+			Handler:       _TrainService_BulkPurchase_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/train_service.proto",
 }
@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"train-booking-service/auth"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RetryAfterHeader is the trailer metadata key holding the whole seconds a rejected caller should wait before
+// retrying.
+const RetryAfterHeader = "retry-after"
+
+// sweepInterval is how often buckets that have refilled are dropped, so the limiter does not grow with every
+// caller and address it has seen.
+const sweepInterval = time.Minute
+
+// Limit is a token bucket refilled with Rate tokens per second and holding up to Burst tokens. Every call takes
+// one token. A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Config configures the limits applied to calls.
+type Config struct {
+	Caller  Limit            // Per authenticated caller, across all methods
+	IP      Limit            // Per client IP address, across all methods
+	Methods map[string]Limit // Per authenticated caller and full method name
+	Exempt  []string         // Full method names that are never limited, such as health checks
+}
+
+// bucket identifies the token bucket of a caller, address or caller and method.
+type bucket struct {
+	kind string
+	key  string
+}
+
+// Limiter rejects calls that exceed the configured rates.
+type Limiter struct {
+	config  Config
+	exempt  map[string]bool
+	mu      sync.Mutex
+	buckets map[bucket]*rate.Limiter
+	swept   time.Time
+	now     func() time.Time
+}
+
+// New initializes a new Limiter instance.
+func New(config Config) (*Limiter, error) {
+	limits := map[string]Limit{"caller": config.Caller, "ip": config.IP}
+	for method, limit := range config.Methods {
+		limits[method] = limit
+	}
+	for name, limit := range limits {
+		if limit.Rate < 0 {
+			return nil, fmt.Errorf("invalid %s rate limit: rate must not be negative", name)
+		}
+		if limit.Rate > 0 && limit.Burst < 1 {
+			return nil, fmt.Errorf("invalid %s rate limit: burst must be at least 1", name)
+		}
+	}
+
+	l := &Limiter{
+		config:  config,
+		exempt:  make(map[string]bool),
+		buckets: make(map[bucket]*rate.Limiter),
+		now:     time.Now,
+	}
+	for _, method := range config.Exempt {
+		l.exempt[method] = true
+	}
+	l.swept = l.now()
+	return l, nil
+}
+
+// reserve takes a token from a bucket, creating it full when it does not exist.
+func (l *Limiter) reserve(b bucket, limit Limit, now time.Time) *rate.Reservation {
+	limiter, exists := l.buckets[b]
+	if !exists {
+		limiter = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		l.buckets[b] = limiter
+	}
+	return limiter.ReserveN(now, 1)
+}
+
+// sweep drops the buckets that have refilled, as they behave like new ones.
+func (l *Limiter) sweep(now time.Time) {
+	for b, limiter := range l.buckets {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(l.buckets, b)
+		}
+	}
+	l.swept = now
+}
+
+// Allow takes a token from every bucket a call of method with ctx is counted against. When one of them is
+// empty no token is taken and Allow returns how long the caller should wait before retrying.
+func (l *Limiter) Allow(ctx context.Context, method string) (time.Duration, bool) {
+	if l.exempt[method] {
+		return 0, true
+	}
+
+	var buckets []bucket
+	var limits []Limit
+	if l.config.IP.Rate > 0 {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			buckets = append(buckets, bucket{kind: "ip", key: host(p.Addr)})
+			limits = append(limits, l.config.IP)
+		}
+	}
+	if identity, ok := auth.FromContext(ctx); ok {
+		if l.config.Caller.Rate > 0 {
+			buckets = append(buckets, bucket{kind: "caller", key: identity.Subject})
+			limits = append(limits, l.config.Caller)
+		}
+		if limit := l.config.Methods[method]; limit.Rate > 0 {
+			buckets = append(buckets, bucket{kind: method, key: identity.Subject})
+			limits = append(limits, limit)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.swept) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	var reservations []*rate.Reservation
+	var wait time.Duration
+	for i, b := range buckets {
+		reservation := l.reserve(b, limits[i], now)
+		reservations = append(reservations, reservation)
+		wait = max(wait, reservation.DelayFrom(now))
+	}
+	if wait == 0 {
+		return 0, true
+	}
+	// Give back the tokens taken from the other buckets, the call is not made
+	for _, reservation := range reservations {
+		reservation.CancelAt(now)
+	}
+	return wait, false
+}
+
+// host returns the IP address of a peer without its port.
+func host(addr net.Addr) string {
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// exhausted builds the error of a rejected call, with the retry delay in its details.
+func exhausted(wait time.Duration) error {
+	st := status.Newf(codes.ResourceExhausted, "rate limit exceeded, retry in %s", wait.Round(time.Millisecond))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// retryAfter returns the trailer telling a rejected caller how many whole seconds to wait.
+func retryAfter(wait time.Duration) metadata.MD {
+	return metadata.Pairs(RetryAfterHeader, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// UnaryServerInterceptor rejects unary calls over the limits with ResourceExhausted. It must run after the
+// authenticator so calls are counted against their caller.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if wait, ok := l.Allow(ctx, info.FullMethod); !ok {
+			grpc.SetTrailer(ctx, retryAfter(wait))
+			return nil, exhausted(wait)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streaming calls over the limits with ResourceExhausted. It must run after the
+// authenticator so calls are counted against their caller.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if wait, ok := l.Allow(stream.Context(), info.FullMethod); !ok {
+			stream.SetTrailer(retryAfter(wait))
+			return exhausted(wait)
+		}
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+	"train-booking-service/auth"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	purchase = "/proto.TrainService/PurchaseTicket"
+	receipt  = "/proto.TrainService/GetReceipt"
+	health   = "/grpc.health.v1.Health/Check"
+)
+
+// callerContext returns the context of a call from an authenticated caller at an IP address.
+func callerContext(subject, ip string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}})
+	return auth.NewContext(ctx, &auth.Identity{Subject: subject})
+}
+
+// newLimiter creates a limiter whose clock is controlled by the test.
+func newLimiter(t *testing.T, config Config) (*Limiter, *time.Time) {
+	limiter, err := New(config)
+	assert.NoError(t, err)
+	now := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	limiter.swept = now
+	return limiter, &now
+}
+
+func TestAllow_PerCallerAndMethod(t *testing.T) {
+	limiter, now := newLimiter(t, Config{
+		Caller:  Limit{Rate: 10, Burst: 3},
+		Methods: map[string]Limit{purchase: {Rate: 1, Burst: 1}},
+		Exempt:  []string{health},
+	})
+	alice := callerContext("alice", "10.0.0.1")
+	bob := callerContext("bob", "10.0.0.1")
+
+	// The method limit applies on top of the caller limit
+	_, ok := limiter.Allow(alice, purchase)
+	assert.True(t, ok)
+	wait, ok := limiter.Allow(alice, purchase)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// The rejected call did not use up the caller's tokens for other methods
+	_, ok = limiter.Allow(alice, receipt)
+	assert.True(t, ok)
+	_, ok = limiter.Allow(alice, receipt)
+	assert.True(t, ok)
+	wait, ok = limiter.Allow(alice, receipt)
+	assert.False(t, ok)
+	assert.Equal(t, 100*time.Millisecond, wait)
+
+	// Other callers have their own buckets and exempt methods are never limited
+	_, ok = limiter.Allow(bob, purchase)
+	assert.True(t, ok)
+	for i := 0; i < 10; i++ {
+		_, ok = limiter.Allow(alice, health)
+		assert.True(t, ok)
+	}
+
+	// Buckets refill over time
+	*now = now.Add(time.Second)
+	_, ok = limiter.Allow(alice, purchase)
+	assert.True(t, ok)
+}
+
+func TestAllow_PerIP(t *testing.T) {
+	limiter, now := newLimiter(t, Config{IP: Limit{Rate: 1, Burst: 2}})
+
+	// Callers behind the same address share its bucket, unauthenticated calls are counted too
+	_, ok := limiter.Allow(callerContext("alice", "10.0.0.1"), receipt)
+	assert.True(t, ok)
+	_, ok = limiter.Allow(peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 50001}}), receipt)
+	assert.True(t, ok)
+	_, ok = limiter.Allow(callerContext("bob", "10.0.0.1"), receipt)
+	assert.False(t, ok)
+	_, ok = limiter.Allow(callerContext("bob", "10.0.0.2"), receipt)
+	assert.True(t, ok)
+
+	// Refilled buckets are dropped
+	*now = now.Add(sweepInterval)
+	_, ok = limiter.Allow(callerContext("bob", "10.0.0.3"), receipt)
+	assert.True(t, ok)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	limiter, _ := newLimiter(t, Config{Caller: Limit{Rate: 0.5, Burst: 1}})
+	interceptor := limiter.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: receipt}
+	ok := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+
+	ctx := callerContext("alice", "10.0.0.1")
+	resp, err := interceptor(ctx, nil, info, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = interceptor(ctx, nil, info, ok)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	details := status.Convert(err).Details()
+	assert.Len(t, details, 1)
+	assert.Equal(t, 2*time.Second, details[0].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+	assert.Equal(t, "2", retryAfter(2 * time.Second).Get(RetryAfterHeader)[0])
+	assert.Equal(t, "1", retryAfter(100 * time.Millisecond).Get(RetryAfterHeader)[0])
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New(Config{Caller: Limit{Rate: -1, Burst: 1}})
+	assert.Error(t, err)
+	_, err = New(Config{Methods: map[string]Limit{purchase: {Rate: 1}}})
+	assert.Error(t, err)
+	_, err = New(Config{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,198 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"train-booking-service/logging"
+)
+
+// reloadInterval is how often the certificate files are checked for changes.
+const reloadInterval = time.Second
+
+// fileStamp identifies the version of a file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// stampOf returns the current version of a file.
+func stampOf(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// reloader keeps a value loaded from files up to date, reloading it when any of the files changes.
+// A failed reload keeps serving the last good value.
+type reloader[T any] struct {
+	paths     []string
+	load      func() (T, error)
+	value     T
+	stamps    []fileStamp
+	checkedAt time.Time
+	mu        sync.Mutex
+}
+
+// newReloader loads the initial value from the files.
+func newReloader[T any](load func() (T, error), paths ...string) (*reloader[T], error) {
+	r := &reloader[T]{paths: paths, load: load}
+	stamps, err := r.currentStamps()
+	if err != nil {
+		return nil, err
+	}
+	if r.value, err = load(); err != nil {
+		return nil, err
+	}
+	r.stamps, r.checkedAt = stamps, time.Now()
+	return r, nil
+}
+
+// currentStamps returns the current version of every file.
+func (r *reloader[T]) currentStamps() ([]fileStamp, error) {
+	stamps := make([]fileStamp, len(r.paths))
+	for i, path := range r.paths {
+		stamp, err := stampOf(path)
+		if err != nil {
+			return nil, err
+		}
+		stamps[i] = stamp
+	}
+	return stamps, nil
+}
+
+// get returns the current value, reloading it first if the files changed since the last check.
+func (r *reloader[T]) get() T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) < reloadInterval {
+		return r.value
+	}
+	r.checkedAt = time.Now()
+
+	stamps, err := r.currentStamps()
+	if err != nil {
+		slog.Warn("could not check TLS files for changes, keeping the loaded version", "paths", r.paths, logging.KeyError, err)
+		return r.value
+	}
+	changed := false
+	for i := range stamps {
+		if stamps[i] != r.stamps[i] {
+			changed = true
+		}
+	}
+	if !changed {
+		return r.value
+	}
+
+	value, err := r.load()
+	if err != nil {
+		slog.Error("could not reload TLS files, keeping the loaded version", "paths", r.paths, logging.KeyError, err)
+		return r.value
+	}
+	slog.Info("reloaded TLS files", "paths", r.paths)
+	r.value, r.stamps = value, stamps
+	return r.value
+}
+
+// loadCertPool reads a PEM file of CA certificates.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CA certificates: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no CA certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// loadKeyPair reads a PEM certificate and private key.
+func loadKeyPair(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// Server returns the TLS configuration for the gRPC server. When clientCAFile is set,
+// clients must present a certificate signed by one of its CAs (mutual TLS).
+// The certificate, key and client CAs are reloaded when their files change.
+func Server(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("both a certificate and a key are required")
+	}
+
+	certs, err := newReloader(func() (*tls.Certificate, error) { return loadKeyPair(certFile, keyFile) }, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.get(), nil
+		},
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	clientCAs, err := newReloader(func() (*x509.CertPool, error) { return loadCertPool(clientCAFile) }, clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Build the configuration per handshake so connections verify against the latest client CAs
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			perClient := config.Clone()
+			perClient.ClientAuth = tls.RequireAndVerifyClientCert
+			perClient.ClientCAs = clientCAs.get()
+			return perClient, nil
+		},
+	}, nil
+}
+
+// Client returns the TLS configuration for a gRPC client. caFile verifies the server certificate instead of
+// the system roots when set, and certFile and keyFile give the client certificate for mutual TLS.
+// The client certificate is reloaded when its files change.
+func Client(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile == "" && keyFile == "" {
+		return config, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("both a client certificate and a key are required for mutual TLS")
+	}
+
+	certs, err := newReloader(func() (*tls.Certificate, error) { return loadKeyPair(certFile, keyFile) }, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return certs.get(), nil
+	}
+	return config, nil
+}
@@ -0,0 +1,214 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCert is a generated certificate and its key.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newCert generates a certificate for commonName signed by parent, or a self-signed CA when parent is nil.
+func newCert(t *testing.T, commonName string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{commonName},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write stores the certificate and key as PEM files in dir and returns their paths.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	assert.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// handshake runs a TLS handshake between the configurations over loopback TCP and returns the
+// server certificate the client saw.
+func handshake(serverConfig, clientConfig *tls.Config) (*x509.Certificate, error) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		// Read the byte the client sends once its handshake completes, so client certificates are verified
+		_, err = conn.Read(make([]byte, 1))
+		serverErr <- err
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	if err != nil {
+		<-serverErr
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte{0}); err != nil {
+		return nil, err
+	}
+	if err := <-serverErr; err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestServer_TLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "Test CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newCert(t, "localhost", ca).write(t, dir, "server")
+
+	serverConfig, err := Server(certFile, keyFile, "")
+	assert.NoError(t, err)
+	clientConfig, err := Client(caFile, "", "", "localhost")
+	assert.NoError(t, err)
+
+	peer, err := handshake(serverConfig, clientConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", peer.Subject.CommonName)
+
+	// Servers signed by an unknown CA are rejected
+	otherCAFile, _ := newCert(t, "Other CA", nil).write(t, dir, "other-ca")
+	clientConfig, err = Client(otherCAFile, "", "", "localhost")
+	assert.NoError(t, err)
+	_, err = handshake(serverConfig, clientConfig)
+	assert.Error(t, err)
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "Test CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newCert(t, "localhost", ca).write(t, dir, "server")
+	clientCertFile, clientKeyFile := newCert(t, "client", ca).write(t, dir, "client")
+	strangerCertFile, strangerKeyFile := newCert(t, "stranger", newCert(t, "Other CA", nil)).write(t, dir, "stranger")
+
+	serverConfig, err := Server(certFile, keyFile, caFile)
+	assert.NoError(t, err)
+
+	clientConfig, err := Client(caFile, clientCertFile, clientKeyFile, "localhost")
+	assert.NoError(t, err)
+	_, err = handshake(serverConfig, clientConfig)
+	assert.NoError(t, err)
+
+	// Clients without a certificate, or with one from another CA, are rejected
+	clientConfig, err = Client(caFile, "", "", "localhost")
+	assert.NoError(t, err)
+	_, err = handshake(serverConfig, clientConfig)
+	assert.Error(t, err)
+
+	clientConfig, err = Client(caFile, strangerCertFile, strangerKeyFile, "localhost")
+	assert.NoError(t, err)
+	_, err = handshake(serverConfig, clientConfig)
+	assert.Error(t, err)
+}
+
+func TestServer_ReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "Test CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	first := newCert(t, "localhost", ca)
+	certFile, keyFile := first.write(t, dir, "server")
+
+	serverConfig, err := Server(certFile, keyFile, "")
+	assert.NoError(t, err)
+	clientConfig, err := Client(caFile, "", "", "localhost")
+	assert.NoError(t, err)
+
+	peer, err := handshake(serverConfig, clientConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, first.cert.SerialNumber, peer.SerialNumber)
+
+	// Rotate the certificate on disk and make sure the change is visible to the next check
+	second := newCert(t, "localhost", ca)
+	second.write(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, later, later))
+	assert.NoError(t, os.Chtimes(keyFile, later, later))
+	time.Sleep(reloadInterval)
+
+	peer, err = handshake(serverConfig, clientConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, second.cert.SerialNumber, peer.SerialNumber)
+
+	// A broken certificate file keeps the last good certificate in use
+	assert.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	later = later.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, later, later))
+	time.Sleep(reloadInterval)
+
+	peer, err = handshake(serverConfig, clientConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, second.cert.SerialNumber, peer.SerialNumber)
+}
+
+func TestServer_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newCert(t, "localhost", nil).write(t, dir, "server")
+
+	_, err := Server("", keyFile, "")
+	assert.Error(t, err)
+	_, err = Server(certFile, filepath.Join(dir, "missing.key"), "")
+	assert.Error(t, err)
+	_, err = Server(certFile, keyFile, keyFile)
+	assert.Error(t, err)
+	_, err = Client("", certFile, "", "localhost")
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Define exporter constants for type safety
+const (
+	ExporterNone   = "none"   // Spans are not recorded
+	ExporterStdout = "stdout" // Spans are written to standard output as JSON
+	ExporterOTLP   = "otlp"   // Spans are sent to an OpenTelemetry collector over gRPC
+)
+
+// DefaultOTLPEndpoint is the address of a collector running next to the service.
+const DefaultOTLPEndpoint = "localhost:4317"
+
+// Config configures where spans are exported.
+type Config struct {
+	ServiceName  string
+	Exporter     string
+	OTLPEndpoint string    // Collector address of the otlp exporter, DefaultOTLPEndpoint when empty
+	Output       io.Writer // Destination of the stdout exporter, os.Stdout when nil
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator, so spans are exported
+// and trace context crosses gRPC calls. The returned function flushes pending spans and must be called
+// before the process exits.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		output := config.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(output))
+	case ExporterOTLP:
+		endpoint := config.OTLPEndpoint
+		if endpoint == "" {
+			endpoint = DefaultOTLPEndpoint
+		}
+		// The collector is expected to run locally, so the connection is not encrypted
+		exporter, err = otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	default:
+		return nil, fmt.Errorf("invalid trace exporter %q, must be %s, %s or %s", config.Exporter, ExporterNone, ExporterStdout, ExporterOTLP)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s trace exporter: %w", config.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
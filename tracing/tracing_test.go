@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSetup_Stdout(t *testing.T) {
+	var output bytes.Buffer
+	shutdown, err := Setup(context.Background(), Config{ServiceName: "train-booking-test", Exporter: ExporterStdout, Output: &output})
+	assert.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "PurchaseTicket")
+	span.End()
+
+	// Spans are batched until the provider is shut down
+	assert.NoError(t, shutdown(context.Background()))
+	assert.Contains(t, output.String(), `"Name":"PurchaseTicket"`)
+	assert.Contains(t, output.String(), "train-booking-test")
+}
+
+func TestSetup_Invalid(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "jaeger"})
+	assert.Error(t, err)
+
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestPropagation(t *testing.T) {
+	// Setup installs the propagator, the recorder replaces the exporter
+	_, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	assert.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "client operation")
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	parent.End()
+	server.GracefulStop()
+
+	// The client span, the server span and the parent all belong to the same trace
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	for _, span := range spans {
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID(), span.Name())
+	}
+}